@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// Error implements the error interface so error responses can be returned as errors.
+func (e Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+/*
+Pages walks a paginated list endpoint, yielding every result of every page. fetch requests the page at cursor,
+which is nil for the first page, and returns its results and the cursor of the next page.
+Iteration stops at the first error, which is yielded with the zero value of T.
+*/
+func Pages[T any](ctx context.Context, fetch func(ctx context.Context, cursor *string) ([]T, *string, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var cursor *string
+		for {
+			results, next, err := fetch(ctx, cursor)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, result := range results {
+				if !yield(result, nil) {
+					return
+				}
+			}
+
+			if next == nil {
+				return
+			}
+			cursor = next
+		}
+	}
+}
+
+// AllItems iterates over every item matching params, requesting further pages as needed.
+// params.Cursor is ignored.
+func (c *ClientWithResponses) AllItems(ctx context.Context, params *ListItemsParams, reqEditors ...RequestEditorFn) iter.Seq2[Item, error] {
+	var p ListItemsParams
+	if params != nil {
+		p = *params
+	}
+
+	return Pages(ctx, func(ctx context.Context, cursor *string) ([]Item, *string, error) {
+		p.Cursor = cursor
+
+		resp, err := c.ListItemsWithResponse(ctx, &p, reqEditors...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch {
+		case resp.JSON200 != nil:
+			return resp.JSON200.Items, resp.JSON200.NextCursor, nil
+		case resp.JSON400 != nil:
+			return nil, nil, *resp.JSON400
+		}
+
+		return nil, nil, fmt.Errorf("listing items: unexpected status %s", resp.Status())
+	})
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+
+	"github.com/circa10a/go-rest-template/internal/patch"
+)
+
+// NewMergePatch returns a JSON Merge Patch that changes before into after. Fields omitted from after are removed.
+func NewMergePatch(before, after any) (json.RawMessage, error) {
+	return patch.CreateMerge(before, after)
+}
+
+// NewJSONPatch returns JSON Patch operations that change before into after. Arrays that differ are replaced
+// as a whole. Prepend test operations to only apply the patch if the resource still matches before.
+func NewJSONPatch(before, after any) (JSONPatch, error) {
+	ops, err := patch.Diff(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	var p JSONPatch
+	return p, json.Unmarshal(data, &p)
+}
+
+// MergePatchItemWithResponse sends the changes between before and after as a JSON Merge Patch,
+// so fields changed concurrently by other clients are left alone.
+func (c *ClientWithResponses) MergePatchItemWithResponse(ctx context.Context, id ItemID, params *PatchItemParams, before, after NewItem, reqEditors ...RequestEditorFn) (*PatchItemResponse, error) {
+	body, err := NewMergePatch(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.PatchItemWithBodyWithResponse(ctx, id, params, patch.MergePatchType, bytes.NewReader(body), reqEditors...)
+}
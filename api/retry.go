@@ -0,0 +1,125 @@
+package api
+
+import (
+	"crypto/rand"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryConfig holds configuration for retrying requests. See WithRetries.
+type RetryConfig struct {
+	// Attempts is the maximum number of times a request is sent. Defaults to 3.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for every further retry. Defaults to 100ms.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between attempts, including delays requested with Retry-After. Defaults to 5s.
+	MaxBackoff time.Duration
+}
+
+/*
+WithRetries retries requests that fail with a network error, 429, 503 or another server error.
+POST and PATCH requests are given an Idempotency-Key header, if they do not have one, that is reused for every
+attempt, so the server applies the request at most once and replays its response to retries.
+Apply it after WithHTTPClient, since it wraps the client's HttpRequestDoer:
+
+	client, err := api.NewClientWithResponses(server, api.WithHTTPClient(httpClient), api.WithRetries(api.RetryConfig{}))
+*/
+func WithRetries(cfg RetryConfig) ClientOption {
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = 3
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Second
+	}
+
+	return func(c *Client) error {
+		doer := c.Client
+		if doer == nil {
+			doer = &http.Client{}
+		}
+		c.Client = &retryDoer{doer: doer, cfg: cfg}
+		return nil
+	}
+}
+
+// NewIdempotencyKey returns a random key for the Idempotency-Key header.
+func NewIdempotencyKey() string {
+	return rand.Text()
+}
+
+type retryDoer struct {
+	doer HttpRequestDoer
+	cfg  RetryConfig
+}
+
+func (d *retryDoer) Do(req *http.Request) (*http.Response, error) {
+	if (req.Method == http.MethodPost || req.Method == http.MethodPatch) && req.Header.Get("Idempotency-Key") == "" {
+		req.Header.Set("Idempotency-Key", NewIdempotencyKey())
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := d.doer.Do(req)
+		if attempt == d.cfg.Attempts || !retryable(resp, err) || req.Body != nil && req.GetBody == nil {
+			return resp, err
+		}
+
+		delay := d.backoff(attempt, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt, honoring Retry-After.
+func (d *retryDoer) backoff(attempt int, resp *http.Response) time.Duration {
+	delay := d.cfg.Backoff << (attempt - 1)
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			delay = time.Duration(seconds) * time.Second
+		}
+	}
+
+	// Jitter spreads out retries from clients that failed at the same time
+	delay += mathrand.N(delay/4 + 1)
+
+	return min(delay, d.cfg.MaxBackoff)
+}
+
+// retryable reports whether a request should be retried. A 409 with Retry-After means the first attempt of an
+// idempotent request is still in flight.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= http.StatusInternalServerError:
+		return resp.StatusCode != http.StatusNotImplemented
+	case resp.StatusCode == http.StatusConflict:
+		return resp.Header.Get("Retry-After") != ""
+	}
+
+	return false
+}
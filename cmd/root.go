@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/spf13/cobra"
 )
@@ -36,7 +37,7 @@ var versionCmd = &cobra.Command{
 type flagDef struct {
 	Name      string
 	Shorthand string
-	Type      string // "bool", "string", "stringArray", "int"
+	Type      string // "bool", "string", "stringArray", "int", "duration"
 	Default   interface{}
 	Usage     string
 	ViperKey  string
@@ -55,6 +56,8 @@ func RegisterFlagTypes(cmd *cobra.Command, defs []flagDef) {
 			cmd.Flags().StringArrayP(d.Name, d.Shorthand, d.Default.([]string), d.Usage)
 		case "int":
 			cmd.Flags().IntP(d.Name, d.Shorthand, d.Default.(int), d.Usage)
+		case "duration":
+			cmd.Flags().DurationP(d.Name, d.Shorthand, d.Default.(time.Duration), d.Usage)
 		}
 	}
 }
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package cmd
+
+import (
+	"os"
+	"syscall"
+)
+
+// upgradeSignals make the server upgrade to a new binary.
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,6 @@
+package cmd
+
+import "os"
+
+// upgradeSignals make the server upgrade to a new binary. Windows has no signal for it.
+var upgradeSignals []os.Signal
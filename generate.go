@@ -1,2 +1,3 @@
 //go:generate go tool oapi-codegen --config=api/oapi-codegen.yaml api/openapi.yaml
+//go:generate go run github.com/bufbuild/buf/cmd/buf@v1.73.0 generate
 package main
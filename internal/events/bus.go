@@ -0,0 +1,271 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// Config holds configuration for a Bus.
+type Config struct {
+	// Logger logs failed subscribers. Defaults to slog.Default.
+	Logger *slog.Logger
+	// PollInterval is how often the outbox is checked for events. Events published with Bus.WithTx, or
+	// outside of a transaction, are relayed immediately. Defaults to 1s.
+	PollInterval time.Duration
+	// BatchSize is the maximum number of events claimed from the outbox at a time. Defaults to 20.
+	BatchSize int
+	// Timeout cancels the context of a subscriber that runs longer. Defaults to 30 seconds.
+	Timeout time.Duration
+	// Lock is how long a relay holds the events it claimed before another relay may claim them. Defaults to
+	// 5 minutes.
+	Lock time.Duration
+	// Backoff is the delay before the first retry of a failed event, doubled for every further retry.
+	// Defaults to 1s.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to 1 hour.
+	MaxBackoff time.Duration
+}
+
+// Bus publishes events to the outbox and relays them to subscribers.
+type Bus struct {
+	store       store.Store
+	outbox      store.OutboxStore
+	logger      *slog.Logger
+	wake        chan struct{}
+	subscribers []subscriber
+	cfg         Config
+	mu          sync.RWMutex
+}
+
+// subscriber is a handler subscribed to events.
+type subscriber struct {
+	fn   HandlerFunc
+	name string
+	// types are the event types handled by fn. It handles every event when empty.
+	types []string
+}
+
+// New returns a Bus storing events in the outbox of s, which must implement store.OutboxStore. Subscribe
+// handlers and add sinks before calling Run.
+func New(s store.Store, cfg Config) (*Bus, error) {
+	outbox, ok := s.(store.OutboxStore)
+	if !ok {
+		return nil, errors.New("the store does not support an outbox")
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 20
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.Lock <= 0 {
+		cfg.Lock = 5 * time.Minute
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+
+	return &Bus{
+		store:  s,
+		outbox: outbox,
+		logger: cfg.Logger.With("component", "events"),
+		wake:   make(chan struct{}, 1),
+		cfg:    cfg,
+	}, nil
+}
+
+// Subscribe subscribes fn to the events of types, or to every event if types is empty. The outbox records
+// the subscribers that handled an event by name, so a name must identify one subscriber for each type and
+// must not change while events are waiting in the outbox.
+func (b *Bus) Subscribe(name string, types []string, fn HandlerFunc) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscribers = append(b.subscribers, subscriber{name: name, types: types, fn: fn})
+}
+
+// AddSink subscribes sink, under name, to every event.
+func (b *Bus) AddSink(name string, sink Sink) {
+	b.Subscribe(name, nil, sink.Send)
+}
+
+// Publish adds an event of eventType with data encoded as JSON to the outbox. It joins the transaction in
+// ctx, so call it in the transaction of the change the event describes, see WithTx.
+func (b *Bus) Publish(ctx context.Context, eventType string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.outbox.AddOutboxEvent(ctx, store.OutboxEvent{Type: eventType, Data: encoded})
+	if err != nil {
+		return err
+	}
+
+	b.notify()
+	return nil
+}
+
+// WithTx runs fn in a transaction of the store, see store.Store.WithTx, and wakes the relay once the events
+// published by fn are committed.
+func (b *Bus) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	err := b.store.WithTx(ctx, fn)
+	if err != nil {
+		return err
+	}
+
+	b.notify()
+	return nil
+}
+
+// Run relays the events of the outbox to the subscribers until ctx is done. Replicas sharing the store may
+// each run a relay: every event is relayed by one of them, roughly in the order it was published.
+func (b *Bus) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// A full batch suggests more events are waiting
+		for b.relay(ctx) == b.cfg.BatchSize {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.wake:
+		}
+	}
+}
+
+// notify wakes Run to relay events.
+func (b *Bus) notify() {
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+
+// relay claims a batch of events and relays them in order. It returns the number of events claimed.
+func (b *Bus) relay(ctx context.Context) int {
+	now := time.Now()
+	claimed, err := b.outbox.ClaimOutboxEvents(ctx, now, now.Add(b.cfg.Lock), b.cfg.BatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.logger.Error("claiming events", "err", err)
+		}
+		return 0
+	}
+
+	for _, event := range claimed {
+		b.deliver(ctx, event)
+	}
+
+	return len(claimed)
+}
+
+// deliver calls the subscribers of an event that have not handled it yet, then deletes the event, or records
+// the subscribers that handled it and retries it later if any of them failed.
+func (b *Bus) deliver(ctx context.Context, claimed store.OutboxEvent) {
+	event := Event{ID: claimed.ID, Type: claimed.Type, CreatedAt: claimed.CreatedAt, Data: claimed.Data}
+	handled := slices.Clone(claimed.Handled)
+
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range subscribers {
+		if ctx.Err() != nil {
+			// The remaining subscribers are called by the next relay
+			errs = append(errs, ctx.Err())
+			break
+		}
+		if (len(sub.types) > 0 && !slices.Contains(sub.types, event.Type)) || slices.Contains(handled, sub.name) {
+			continue
+		}
+
+		start := time.Now()
+		runCtx, cancel := context.WithTimeout(ctx, b.cfg.Timeout)
+		err := run(runCtx, sub.fn, event)
+		cancel()
+
+		outcome := "succeeded"
+		if err != nil {
+			outcome = "failed"
+			errs = append(errs, fmt.Errorf("%s: %w", sub.name, err))
+		} else {
+			handled = append(handled, sub.name)
+		}
+		handlerDuration.WithLabelValues(sub.name, outcome).Observe(time.Since(start).Seconds())
+	}
+
+	// The outcome is recorded even if the process is shutting down
+	storeCtx := context.WithoutCancel(ctx)
+	var err error
+	switch {
+	case len(errs) == 0:
+		relayLatency.Observe(max(time.Since(event.CreatedAt), 0).Seconds())
+		eventsRelayed.WithLabelValues(event.Type).Inc()
+		err = b.outbox.DeleteOutboxEvent(storeCtx, event.ID, claimed.Attempts)
+	case ctx.Err() != nil:
+		err = b.outbox.RetryOutboxEvent(storeCtx, event.ID, claimed.Attempts, handled, "interrupted by shutdown", time.Now())
+	default:
+		err = errors.Join(errs...)
+		retryAt := time.Now().Add(b.backoff(claimed.Attempts))
+		b.logger.Warn("event subscriber failed, retrying", "id", event.ID, "type", event.Type, "attempt", claimed.Attempts,
+			"retry_at", retryAt, "err", err)
+		err = b.outbox.RetryOutboxEvent(storeCtx, event.ID, claimed.Attempts, handled, err.Error(), retryAt)
+	}
+
+	if errors.Is(err, store.ErrConflict) {
+		b.logger.Warn("event lock expired before it was relayed, it may have been relayed twice", "id", event.ID, "type", event.Type)
+	} else if err != nil {
+		b.logger.Error("recording event outcome", "id", event.ID, "type", event.Type, "err", err)
+	}
+}
+
+// backoff returns the delay before retrying an event that failed attempt.
+func (b *Bus) backoff(attempt int) time.Duration {
+	delay := b.cfg.Backoff
+	for i := 1; i < attempt && delay < b.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, b.cfg.MaxBackoff)
+
+	// Jitter spreads out retries of events that failed at the same time
+	return delay + mathrand.N(delay/4+1)
+}
+
+// run calls fn, turning a panic into an error so it fails the event instead of the process.
+func run(ctx context.Context, fn HandlerFunc, event Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return fn(ctx, event)
+}
@@ -0,0 +1,234 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// widget is the data of the test events.
+type widget struct {
+	Name string `json:"name"`
+}
+
+var (
+	widgetCreated = Type[widget]("widget.created")
+	widgetDeleted = Type[widget]("widget.deleted")
+)
+
+// recordingSink is a Sink that records the events it is sent, in place of a message broker.
+type recordingSink struct {
+	events chan Event
+	// failures is the number of sends that fail before the sink accepts events
+	failures int
+	mu       sync.Mutex
+}
+
+func newRecordingSink() *recordingSink {
+	return &recordingSink{events: make(chan Event, 100)}
+}
+
+func (b *recordingSink) Send(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("sink unavailable")
+	}
+
+	b.events <- event
+	return nil
+}
+
+// next returns the next event sent to b.
+func (b *recordingSink) next(t *testing.T) Event {
+	t.Helper()
+
+	select {
+	case event := <-b.events:
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func newTestBus(t *testing.T, s store.Store) *Bus {
+	t.Helper()
+
+	b, err := New(s, Config{
+		Logger:       slog.New(slog.DiscardHandler),
+		PollInterval: 10 * time.Millisecond,
+		Backoff:      time.Millisecond,
+		MaxBackoff:   time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestBus(t *testing.T) {
+	s := store.NewMemory()
+	b := newTestBus(t, s)
+
+	created := make(chan widget, 10)
+	Handle(b, "created", widgetCreated, func(ctx context.Context, event Event, data widget) error {
+		created <- data
+		return nil
+	})
+	sink := newRecordingSink()
+	b.AddSink("recorder", sink)
+	relay(t, b)
+
+	errRollback := errors.New("rollback")
+	err := b.WithTx(context.Background(), func(ctx context.Context) error {
+		err := Publish(ctx, b, widgetCreated, widget{Name: "rolled back"})
+		if err != nil {
+			return err
+		}
+		return errRollback
+	})
+	if !errors.Is(err, errRollback) {
+		t.Fatalf("unexpected error: got %v want %v", err, errRollback)
+	}
+
+	err = b.WithTx(context.Background(), func(ctx context.Context) error {
+		err := Publish(ctx, b, widgetCreated, widget{Name: "first"})
+		if err != nil {
+			return err
+		}
+		return Publish(ctx, b, widgetDeleted, widget{Name: "first"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		expect string
+	}{
+		{name: "created", expect: `{"name":"first"}`},
+		{name: "deleted", expect: `{"name":"first"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := sink.next(t)
+			if event.Type != "widget."+test.name || string(event.Data) != test.expect || event.ID == "" || event.CreatedAt.IsZero() {
+				t.Errorf("unexpected event: %+v", event)
+			}
+		})
+	}
+
+	// Typed subscribers only receive the events of their type
+	if data := <-created; data.Name != "first" {
+		t.Errorf("unexpected created widget: %+v", data)
+	}
+	select {
+	case data := <-created:
+		t.Errorf("unexpected event for the created subscriber: %+v", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	waitEmpty(t, s)
+}
+
+func TestBusRetry(t *testing.T) {
+	s := store.NewMemory()
+	b := newTestBus(t, s)
+
+	// The sink fails twice, and the subscriber that handled the event is not called again
+	calls := 0
+	var mu sync.Mutex
+	Handle(b, "counter", widgetCreated, func(ctx context.Context, event Event, data widget) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		return nil
+	})
+	sink := newRecordingSink()
+	sink.failures = 2
+	b.AddSink("recorder", sink)
+	relay(t, b)
+
+	err := Publish(context.Background(), b, widgetCreated, widget{Name: "retried"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	event := sink.next(t)
+	if string(event.Data) != `{"name":"retried"}` {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	waitEmpty(t, s)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("unexpected number of calls to the subscriber that succeeded: got %d want 1", calls)
+	}
+}
+
+func TestBusInvalidData(t *testing.T) {
+	s := store.NewMemory()
+	b := newTestBus(t, s)
+
+	called := false
+	Handle(b, "typed", widgetCreated, func(ctx context.Context, event Event, data widget) error {
+		called = true
+		return nil
+	})
+	relay(t, b)
+
+	// Data that does not decode into the type is skipped instead of retried
+	err := b.Publish(context.Background(), string(widgetCreated), []string{"not", "a", "widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitEmpty(t, s)
+
+	if called {
+		t.Error("the subscriber was called with invalid data")
+	}
+}
+
+// relay relays the events of b until the test ends.
+func relay(t *testing.T, b *Bus) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() { b.Run(ctx) })
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// waitEmpty waits until every event of the outbox of s has been relayed.
+func waitEmpty(t *testing.T, s store.OutboxStore) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats, err := s.OutboxStats(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.Count == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("events left in the outbox: %d", stats.Count)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Package events publishes domain events, such as an item being created, through a transactional outbox. Events
+are written to the outbox of the store in the transaction of the change they describe, so an event is
+published if and only if its change is stored, and a Bus relays them to in-process subscribers and to sinks
+that forward them to external message brokers.
+
+	var ItemCreated = events.Type[api.Item]("item.created")
+
+	events.Handle(bus, "search", ItemCreated, func(ctx context.Context, event events.Event, item api.Item) error {
+		return index(ctx, item)
+	})
+
+	err := bus.WithTx(ctx, func(ctx context.Context) error {
+		doc, err := items.Create(ctx, item)
+		if err != nil {
+			return err
+		}
+		return events.Publish(ctx, bus, ItemCreated, toItem(doc))
+	})
+
+Delivery is at least once: a subscriber that fails is retried with exponential backoff until it succeeds,
+without calling again the subscribers that already handled the event, but a relay that stops midway repeats
+the event. Subscribers must be safe to repeat.
+*/
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a domain event relayed from the outbox.
+type Event struct {
+	CreatedAt time.Time       `json:"created_at"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Type is the name of a type of event whose data is T.
+type Type[T any] string
+
+// HandlerFunc handles an event. Handlers run at least once per event, so they must be safe to repeat.
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// Sink forwards events to an external message broker, such as NATS or Kafka, so other services and the
+// other replicas of the server receive them. See Bus.AddSink.
+type Sink interface {
+	// Send publishes event to the broker. The event is sent again until Send succeeds, and brokers that
+	// deduplicate messages can use its ID.
+	Send(ctx context.Context, event Event) error
+}
+
+// Publish adds an event of typ with data encoded as JSON to the outbox. See Bus.Publish.
+func Publish[T any](ctx context.Context, b *Bus, typ Type[T], data T) error {
+	return b.Publish(ctx, string(typ), data)
+}
+
+// Handle subscribes fn, under name, to the events of typ. The data of each event is decoded from JSON into
+// T; events whose data cannot be decoded are logged and skipped, since retrying cannot fix them.
+func Handle[T any](b *Bus, name string, typ Type[T], fn func(ctx context.Context, event Event, data T) error) {
+	b.Subscribe(name, []string{string(typ)}, func(ctx context.Context, event Event) error {
+		var data T
+		err := json.Unmarshal(event.Data, &data)
+		if err != nil {
+			b.logger.Error("skipping event with invalid data", "id", event.ID, "type", event.Type, "subscriber", name,
+				"err", fmt.Errorf("decoding data: %w", err))
+			return nil
+		}
+
+		return fn(ctx, event, data)
+	})
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	eventsRelayed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "events_relayed_total",
+		Help: "Number of events relayed to every subscriber, by type.",
+	}, []string{"type"})
+	relayLatency = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "events_relay_latency_seconds",
+		Help:    "Time from when an event was published until every subscriber had handled it.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	})
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "events_handler_duration_seconds",
+		Help:    "Time taken by a subscriber to handle an event, by outcome: succeeded or failed.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"subscriber", "outcome"})
+
+	pendingDesc = prometheus.NewDesc("events_outbox_pending", "Number of events waiting in the outbox.", nil, nil)
+	oldestDesc  = prometheus.NewDesc("events_outbox_oldest_seconds", "Age of the oldest event waiting in the outbox.", nil, nil)
+)
+
+// RegisterMetrics registers the event metrics with the default Prometheus registry. The outbox size is read
+// from s whenever the metrics are scraped.
+func RegisterMetrics(s store.OutboxStore) error {
+	for _, c := range []prometheus.Collector{eventsRelayed, relayLatency, handlerDuration, outboxCollector{store: s}} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// outboxCollector exports the number of events waiting in the outbox.
+type outboxCollector struct {
+	store store.OutboxStore
+}
+
+func (c outboxCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pendingDesc
+	ch <- oldestDesc
+}
+
+func (c outboxCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stats, err := c.store.OutboxStats(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(pendingDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(pendingDesc, prometheus.GaugeValue, float64(stats.Count))
+	var oldest time.Duration
+	if stats.Count > 0 {
+		oldest = max(time.Since(stats.OldestCreatedAt), 0)
+	}
+	ch <- prometheus.MustNewConstMetric(oldestDesc, prometheus.GaugeValue, oldest.Seconds())
+}
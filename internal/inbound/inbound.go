@@ -0,0 +1,416 @@
+/*
+Package inbound receives webhooks pushed by third parties. Each provider is defined once, with how its
+requests are signed and how its events are identified, and mounted at its own endpoint:
+
+	POST /v1/inbound/github
+	POST /v1/inbound/stripe
+
+Every request is verified before anything else happens: the signature must match, a signed timestamp must
+be within the tolerance of the provider, and the signed content must not have been received before, which
+a nonce store remembers. Verified events are stored and processed by handlers through the job queue, so a
+failing handler is retried without the provider sending the event again. Stored events can be replayed to
+run their handlers again, for example after fixing a bug.
+*/
+package inbound
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// EventsCollection is the store collection holding received events.
+const EventsCollection = "inbound_events"
+
+// processJob is the kind of job that runs the handlers of an event.
+const processJob = "inbound.process"
+
+// AnyEvent registers a handler for every event type of a provider.
+const AnyEvent = "*"
+
+// EventStatus is the state of a received event.
+type EventStatus string
+
+// Event states. Pending events are waiting for their handler to run or to be retried.
+const (
+	EventPending   EventStatus = "pending"
+	EventProcessed EventStatus = "processed"
+	EventIgnored   EventStatus = "ignored"
+	EventFailed    EventStatus = "failed"
+)
+
+// Provider defines a third party that sends webhooks.
+type Provider struct {
+	// Verifier authenticates the requests of the provider.
+	Verifier Verifier
+	// EventType returns the type of the event in a verified request, which selects its handlers.
+	EventType func(r *http.Request, body []byte) string
+	// EventID returns the provider's ID of the event, which is stored for display. It may come from an
+	// unsigned header, so replays are detected with a hash of the signed timestamp and the body instead.
+	EventID func(r *http.Request, body []byte) string
+	// Name is the last segment of the path of the provider's endpoint.
+	Name string
+	// Tolerance is how far the signed timestamp of a request may be from the current time. Defaults to
+	// 5 minutes.
+	Tolerance time.Duration
+}
+
+// Event is a verified webhook received from a provider.
+type Event struct {
+	Provider string `json:"provider"`
+	// ExternalID is the provider's ID of the event, if it has one. It is not necessarily signed.
+	ExternalID  string      `json:"external_id,omitempty"`
+	Type        string      `json:"type"`
+	ContentType string      `json:"content_type,omitempty"`
+	Status      EventStatus `json:"status"`
+	Error       string      `json:"error,omitempty"`
+	Body        []byte      `json:"body"`
+	Attempts    int         `json:"attempts"`
+}
+
+// HandlerFunc processes an event. It may run more than once for the same event, when it fails or the event
+// is replayed, so it must be safe to repeat.
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// Config holds configuration for a Receiver.
+type Config struct {
+	// Logger logs rejected requests and failed handlers. Defaults to slog.Default.
+	Logger *slog.Logger
+	// Nonces remembers received events. Defaults to a NonceStore in the store of the receiver that keeps
+	// nonces for NonceTTL.
+	Nonces NonceStore
+	// NonceTTL is how long received events are remembered, which bounds the replay protection of providers
+	// that do not sign a timestamp. Defaults to DefaultNonceTTL.
+	NonceTTL time.Duration
+	// MaxAttempts is the number of times the handler of an event runs before the event fails. Defaults to
+	// the MaxAttempts of the job queue.
+	MaxAttempts int
+}
+
+// DefaultNonceTTL is the default Config.NonceTTL.
+const DefaultNonceTTL = 24 * time.Hour
+
+// Receiver verifies webhooks from providers and runs the handlers of their events.
+type Receiver struct {
+	events    *store.Collection[Event]
+	nonces    NonceStore
+	queue     *jobs.Queue
+	logger    *slog.Logger
+	providers map[string]Provider
+	handlers  map[string]HandlerFunc
+	cfg       Config
+	mu        sync.RWMutex
+}
+
+// processArgs are the arguments of a process job.
+type processArgs struct {
+	EventID string `json:"event_id"`
+}
+
+// New returns a Receiver that stores events in s and registers its process job with q.
+func New(s store.Store, q *jobs.Queue, cfg Config) *Receiver {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.NonceTTL <= 0 {
+		cfg.NonceTTL = DefaultNonceTTL
+	}
+	if cfg.Nonces == nil {
+		cfg.Nonces = NewNonceStore(s, cfg.NonceTTL)
+	}
+
+	rc := &Receiver{
+		events:    store.NewCollection[Event](s, EventsCollection),
+		nonces:    cfg.Nonces,
+		queue:     q,
+		logger:    cfg.Logger.With("component", "inbound"),
+		providers: map[string]Provider{},
+		handlers:  map[string]HandlerFunc{},
+		cfg:       cfg,
+	}
+	jobs.Handle(q, processJob, rc.process)
+
+	return rc
+}
+
+// Register mounts the endpoint of a provider. Providers can only be registered once.
+func (rc *Receiver) Register(p Provider) error {
+	if p.Name == "" || p.Verifier == nil {
+		return errors.New("a webhook provider needs a name and a verifier")
+	}
+	if p.Tolerance <= 0 {
+		p.Tolerance = 5 * time.Minute
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if _, ok := rc.providers[p.Name]; ok {
+		return fmt.Errorf("webhook provider %q is already registered", p.Name)
+	}
+	rc.providers[p.Name] = p
+
+	return nil
+}
+
+// Providers returns the names of the registered providers, sorted.
+func (rc *Receiver) Providers() []string {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	names := make([]string, 0, len(rc.providers))
+	for name := range rc.providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	return names
+}
+
+// Handle registers fn to process the events of provider with eventType, or every event of provider if
+// eventType is AnyEvent. A handler for the exact type takes precedence. Events without a handler are ignored.
+// Handlers do not need the provider to be registered, so worker processes can run them without its secrets.
+func (rc *Receiver) Handle(provider, eventType string, fn HandlerFunc) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.handlers[provider+" "+eventType] = fn
+}
+
+// Routes registers the endpoints of the providers on r.
+func (rc *Receiver) Routes(r chi.Router) {
+	r.Post("/{provider}", rc.receive)
+}
+
+// receive verifies a webhook and enqueues its event. Replays are acknowledged without being processed, as
+// providers retry requests that they do not see succeed.
+func (rc *Receiver) receive(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "provider")
+	rc.mu.RLock()
+	p, ok := rc.providers[name]
+	rc.mu.RUnlock()
+	if !ok {
+		render.Error(w, http.StatusNotFound, "unknown webhook provider")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			render.Error(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+		render.Error(w, http.StatusBadRequest, "reading request body: "+err.Error())
+		return
+	}
+
+	timestamp, err := p.Verifier.Verify(r, body)
+	if err == nil && !timestamp.IsZero() {
+		if age := time.Since(timestamp); age > p.Tolerance || age < -p.Tolerance {
+			err = fmt.Errorf("%w: signed %s ago", ErrInvalidTimestamp, age.Round(time.Second))
+		}
+	}
+	if err != nil {
+		rc.logger.Warn("rejected webhook", "provider", name, "err", err)
+		render.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	event := Event{Provider: name, ContentType: r.Header.Get("Content-Type"), Body: body}
+	if p.EventID != nil {
+		event.ExternalID = p.EventID(r, body)
+	}
+	if p.EventType != nil {
+		event.Type = p.EventType(r, body)
+	}
+
+	// The nonce only covers signed content, so a replay cannot pass as a new event by changing a header
+	sum := sha256.Sum256(fmt.Appendf(nil, "%d.%s", timestamp.Unix(), body))
+	nonce := name + ":" + hex.EncodeToString(sum[:])
+
+	claimed, err := rc.nonces.Claim(r.Context(), nonce)
+	if err != nil {
+		rc.logger.Error("claiming webhook nonce", "provider", name, "err", err)
+		render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	if !claimed {
+		rc.logger.Info("ignored replayed webhook", "provider", name, "type", event.Type, "external_id", event.ExternalID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	_, err = rc.enqueue(r.Context(), event)
+	if err != nil {
+		rc.logger.Error("storing webhook", "provider", name, "err", err)
+		// Let the provider's retry through
+		_ = rc.nonces.Release(context.WithoutCancel(r.Context()), nonce)
+		render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Replay runs the handlers of a stored event again. Events that are still pending cannot be replayed.
+func (rc *Receiver) Replay(ctx context.Context, id string) (store.Document[Event], error) {
+	doc, err := rc.events.Get(ctx, id)
+	if err != nil {
+		return doc, err
+	}
+	if doc.Value.Status == EventPending {
+		return doc, fmt.Errorf("event %s is pending: %w", id, store.ErrConflict)
+	}
+
+	event := doc.Value
+	event.Status = EventPending
+	event.Error = ""
+	event.Attempts = 0
+	doc, err = rc.events.Update(ctx, id, doc.Version, event)
+	if err != nil {
+		return doc, err
+	}
+
+	return doc, rc.enqueueJob(ctx, id)
+}
+
+// ReplayAll replays every stored event matching filters that is not pending and returns how many were replayed.
+func (rc *Receiver) ReplayAll(ctx context.Context, filters []store.Filter) (int, error) {
+	filters = append(slices.Clip(filters), store.Filter{Field: "status", Op: store.OpNe, Value: string(EventPending)})
+	q := store.Query{Filters: filters, Limit: 100}
+
+	replayed := 0
+	for {
+		docs, err := rc.events.List(ctx, q)
+		if err != nil {
+			return replayed, err
+		}
+
+		for _, doc := range docs {
+			_, err = rc.Replay(ctx, doc.ID)
+			if errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrNotFound) {
+				// Replayed or deleted concurrently
+				continue
+			}
+			if err != nil {
+				return replayed, err
+			}
+			replayed++
+		}
+
+		// Replayed events are pending now, so the filter skips them and the next page starts after the last event
+		if len(docs) < q.Limit {
+			return replayed, nil
+		}
+		q.After, err = store.SortKey(docs[len(docs)-1].Record(), q)
+		if err != nil {
+			return replayed, err
+		}
+	}
+}
+
+// enqueue stores a pending event and enqueues the job that processes it.
+func (rc *Receiver) enqueue(ctx context.Context, event Event) (store.Document[Event], error) {
+	event.Status = EventPending
+	doc, err := rc.events.Create(ctx, event)
+	if err != nil {
+		return doc, err
+	}
+
+	err = rc.enqueueJob(ctx, doc.ID)
+	if err != nil {
+		_ = rc.events.Delete(context.WithoutCancel(ctx), doc.ID, 0)
+		return doc, err
+	}
+
+	return doc, nil
+}
+
+func (rc *Receiver) enqueueJob(ctx context.Context, id string) error {
+	_, err := rc.queue.Enqueue(ctx, processJob, processArgs{EventID: id}, jobs.EnqueueOptions{MaxAttempts: rc.cfg.MaxAttempts})
+	if err != nil {
+		return fmt.Errorf("enqueueing event %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// process is the job handler that runs the handler of an event and records the outcome. It returns the
+// error of the handler for the job queue to retry it.
+func (rc *Receiver) process(ctx context.Context, job store.Job, args processArgs) error {
+	doc, err := rc.events.Get(ctx, args.EventID)
+	if errors.Is(err, store.ErrNotFound) {
+		// The event was cleaned up
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if doc.Value.Status != EventPending {
+		return nil
+	}
+	event := doc.Value
+
+	fn := rc.handler(event.Provider, event.Type)
+	if fn == nil {
+		event.Status = EventIgnored
+		return rc.record(ctx, doc.ID, event)
+	}
+
+	event.Attempts++
+	err = fn(ctx, event)
+	switch {
+	case err == nil:
+		event.Status = EventProcessed
+		event.Error = ""
+	case job.Attempts >= job.MaxAttempts || jobs.IsPermanent(err):
+		event.Status = EventFailed
+		event.Error = err.Error()
+		rc.logger.Error("webhook handler failed, giving up", "id", doc.ID, "provider", event.Provider, "type", event.Type, "err", err)
+	default:
+		event.Error = err.Error()
+	}
+
+	return errors.Join(err, rc.record(ctx, doc.ID, event))
+}
+
+// handler returns the handler of an event type of provider, or nil if it has none.
+func (rc *Receiver) handler(provider, eventType string) HandlerFunc {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+
+	if fn, ok := rc.handlers[provider+" "+eventType]; ok {
+		return fn
+	}
+
+	return rc.handlers[provider+" "+AnyEvent]
+}
+
+// record stores the outcome of processing an event, even if the process is shutting down.
+func (rc *Receiver) record(ctx context.Context, id string, event Event) error {
+	_, err := rc.events.Update(context.WithoutCancel(ctx), id, 0, event)
+	if err != nil {
+		return fmt.Errorf("recording event %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// DeleteEvents deletes the events of s received before before and returns how many were deleted.
+func DeleteEvents(ctx context.Context, s store.Store, before time.Time) (int, error) {
+	return deleteBefore(ctx, store.NewCollection[Event](s, EventsCollection), store.FieldCreatedAt, before)
+}
@@ -0,0 +1,276 @@
+package inbound
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// newTestReceiver returns a receiver with a running queue that retries quickly, mounted on a test server,
+// with the test provider registered.
+func newTestReceiver(t *testing.T, cfg Config) (*Receiver, store.Store, *httptest.Server) {
+	t.Helper()
+
+	s := store.NewMemory()
+	q := jobs.New(s, jobs.Config{
+		Logger:       slog.New(slog.DiscardHandler),
+		PollInterval: 5 * time.Millisecond,
+		Backoff:      5 * time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+	})
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	rc := New(s, q, cfg)
+
+	err := rc.Register(Standard("partner", "secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := chi.NewRouter()
+	r.Route("/inbound", rc.Routes)
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return rc, s, ts
+}
+
+// send POSTs an event signed with secret at timestamp to the endpoint of provider and returns the status.
+func send(t *testing.T, ts *httptest.Server, provider, secret, id string, timestamp time.Time, body string) int {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/inbound/"+provider, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Webhook-Id", id)
+	req.Header.Set("Webhook-Event", "item.created")
+	req.Header.Set("Webhook-Timestamp", unix)
+	req.Header.Set("Webhook-Signature", "v1="+hex.EncodeToString(mac([]byte(secret), []byte(unix+"."+body))))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+// waitForEvent polls the stored events until the only event is no longer pending.
+func waitForEvent(t *testing.T, s store.Store) store.Document[Event] {
+	t.Helper()
+
+	events := store.NewCollection[Event](s, EventsCollection)
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		docs, err := events.List(context.Background(), store.Query{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) == 1 && docs[0].Value.Status != EventPending {
+			return docs[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatal("timed out waiting for the event to be processed")
+	return store.Document[Event]{}
+}
+
+func TestReceive(t *testing.T) {
+	rc, s, ts := newTestReceiver(t, Config{})
+
+	received := make(chan Event, 10)
+	rc.Handle("partner", "item.created", func(ctx context.Context, event Event) error {
+		received <- event
+		return nil
+	})
+
+	now := time.Now()
+	tests := []struct {
+		timestamp time.Time
+		name      string
+		provider  string
+		secret    string
+		id        string
+		status    int
+		processed bool
+	}{
+		{name: "valid", provider: "partner", secret: "secret", id: "evt_1", timestamp: now, status: http.StatusAccepted, processed: true},
+		// The event ID is not signed, so changing it does not make a replay pass as a new event
+		{name: "replayed", provider: "partner", secret: "secret", id: "evt_6", timestamp: now, status: http.StatusOK},
+		{name: "wrong secret", provider: "partner", secret: "other", id: "evt_2", timestamp: now, status: http.StatusUnauthorized},
+		{name: "expired", provider: "partner", secret: "secret", id: "evt_3", timestamp: now.Add(-10 * time.Minute), status: http.StatusUnauthorized},
+		{name: "future", provider: "partner", secret: "secret", id: "evt_4", timestamp: now.Add(10 * time.Minute), status: http.StatusUnauthorized},
+		{name: "unknown provider", provider: "other", secret: "secret", id: "evt_5", timestamp: now, status: http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			status := send(t, ts, test.provider, test.secret, test.id, test.timestamp, `{"name":"Widget"}`)
+			if status != test.status {
+				t.Fatalf("unexpected status: got %d want %d", status, test.status)
+			}
+			if !test.processed {
+				return
+			}
+
+			select {
+			case event := <-received:
+				if event.Provider != "partner" || event.ExternalID != test.id || event.Type != "item.created" || string(event.Body) != `{"name":"Widget"}` {
+					t.Errorf("unexpected event: %+v", event)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for the handler")
+			}
+		})
+	}
+
+	// Only the valid request reached the handler
+	doc := waitForEvent(t, s)
+	if doc.Value.Status != EventProcessed || doc.Value.Attempts != 1 {
+		t.Errorf("unexpected event: %+v", doc.Value)
+	}
+	if len(received) != 0 {
+		t.Errorf("unexpected number of handled events: got %d more", len(received))
+	}
+}
+
+func TestReceiveWithoutEventID(t *testing.T) {
+	rc, s, ts := newTestReceiver(t, Config{})
+	rc.Handle("partner", AnyEvent, func(ctx context.Context, event Event) error { return nil })
+
+	// The nonce is derived from the timestamp and body, so identical requests are replays without an event ID too
+	now := time.Now()
+	for i, expect := range []int{http.StatusAccepted, http.StatusOK} {
+		status := send(t, ts, "partner", "secret", "", now, `{"name":"Widget"}`)
+		if status != expect {
+			t.Errorf("unexpected status of request %d: got %d want %d", i, status, expect)
+		}
+	}
+
+	doc := waitForEvent(t, s)
+	if doc.Value.Status != EventProcessed || doc.Value.ExternalID != "" {
+		t.Errorf("unexpected event: %+v", doc.Value)
+	}
+}
+
+func TestReceiveIgnored(t *testing.T) {
+	_, s, ts := newTestReceiver(t, Config{})
+
+	status := send(t, ts, "partner", "secret", "evt_1", time.Now(), `{}`)
+	if status != http.StatusAccepted {
+		t.Fatalf("unexpected status: got %d want %d", status, http.StatusAccepted)
+	}
+
+	doc := waitForEvent(t, s)
+	if doc.Value.Status != EventIgnored {
+		t.Errorf("unexpected status of an event without a handler: got %s want %s", doc.Value.Status, EventIgnored)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	ctx := context.Background()
+	rc, s, ts := newTestReceiver(t, Config{MaxAttempts: 2})
+
+	var fixed atomic.Bool
+	calls := make(chan struct{}, 10)
+	rc.Handle("partner", AnyEvent, func(ctx context.Context, event Event) error {
+		calls <- struct{}{}
+		if !fixed.Load() {
+			return errors.New("handler bug")
+		}
+		return nil
+	})
+
+	status := send(t, ts, "partner", "secret", "evt_1", time.Now(), `{}`)
+	if status != http.StatusAccepted {
+		t.Fatalf("unexpected status: got %d want %d", status, http.StatusAccepted)
+	}
+
+	failed := waitForEvent(t, s)
+	if failed.Value.Status != EventFailed || failed.Value.Attempts != 2 || failed.Value.Error != "handler bug" {
+		t.Fatalf("unexpected event: %+v", failed.Value)
+	}
+	if len(calls) != 2 {
+		t.Errorf("unexpected number of handler calls: got %d want 2", len(calls))
+	}
+
+	fixed.Store(true)
+	replayed, err := rc.ReplayAll(ctx, []store.Filter{{Field: "status", Op: store.OpEq, Value: string(EventFailed)}})
+	if err != nil || replayed != 1 {
+		t.Fatalf("unexpected replay: got %d, %v want 1", replayed, err)
+	}
+
+	doc := waitForEvent(t, s)
+	if doc.Value.Status != EventProcessed || doc.Value.Error != "" || doc.Value.Attempts != 1 {
+		t.Errorf("unexpected replayed event: %+v", doc.Value)
+	}
+
+	_, err = rc.Replay(ctx, "missing")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unexpected error replaying a missing event: got %v want %v", err, store.ErrNotFound)
+	}
+}
+
+func TestNonceStore(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	nonces := NewNonceStore(s, 50*time.Millisecond)
+
+	tests := []struct {
+		action func() error
+		name   string
+		expect bool
+	}{
+		{name: "new", expect: true},
+		{name: "claimed", expect: false},
+		{name: "released", action: func() error { return nonces.Release(ctx, "partner:1") }, expect: true},
+		{name: "expired", action: func() error { time.Sleep(60 * time.Millisecond); return nil }, expect: true},
+		{name: "reclaimed", expect: false},
+	}
+
+	for _, test := range tests {
+		if test.action != nil {
+			err := test.action()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		claimed, err := nonces.Claim(ctx, "partner:1")
+		if err != nil || claimed != test.expect {
+			t.Errorf("%s: got %v, %v want %v", test.name, claimed, err, test.expect)
+		}
+	}
+
+	deleted, err := DeleteNonces(ctx, s, time.Now().Add(time.Second))
+	if err != nil || deleted != 1 {
+		t.Errorf("unexpected deletion of nonces: got %d, %v want 1", deleted, err)
+	}
+}
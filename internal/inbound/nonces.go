@@ -0,0 +1,105 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// NoncesCollection is the store collection holding the nonces of received events.
+const NoncesCollection = "inbound_nonces"
+
+// NonceStore remembers the nonces of received events so that a replayed request is not processed again.
+type NonceStore interface {
+	// Claim records nonce. It returns false if the nonce is already recorded and has not expired.
+	Claim(ctx context.Context, nonce string) (bool, error)
+	// Release forgets nonce, so the request can be retried after it failed to be stored.
+	Release(ctx context.Context, nonce string) error
+}
+
+// nonce is the value of a nonce record. The record ID is the nonce and its update time is when it was claimed.
+type nonce struct{}
+
+// storeNonces is a NonceStore backed by a store.Store, shared by every replica using the same database.
+type storeNonces struct {
+	nonces *store.Collection[nonce]
+	ttl    time.Duration
+}
+
+// NewNonceStore returns a NonceStore that keeps nonces in s for ttl. Delete expired nonces with DeleteNonces.
+func NewNonceStore(s store.Store, ttl time.Duration) NonceStore {
+	return &storeNonces{nonces: store.NewCollection[nonce](s, NoncesCollection), ttl: ttl}
+}
+
+func (n *storeNonces) Claim(ctx context.Context, id string) (bool, error) {
+	_, err := n.nonces.CreateWithID(ctx, id, nonce{})
+	if !errors.Is(err, store.ErrConflict) {
+		return err == nil, err
+	}
+
+	doc, err := n.nonces.Get(ctx, id)
+	if errors.Is(err, store.ErrNotFound) {
+		// Released or deleted since, so try once more
+		_, err = n.nonces.CreateWithID(ctx, id, nonce{})
+		if errors.Is(err, store.ErrConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+	if time.Since(doc.UpdatedAt) < n.ttl {
+		return false, nil
+	}
+
+	// The nonce expired but has not been deleted yet. The version check lets one concurrent request claim it.
+	_, err = n.nonces.Update(ctx, id, doc.Version, nonce{})
+	if errors.Is(err, store.ErrConflict) || errors.Is(err, store.ErrNotFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (n *storeNonces) Release(ctx context.Context, id string) error {
+	err := n.nonces.Delete(ctx, id, 0)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// DeleteNonces deletes the nonces of s claimed before before and returns how many were deleted.
+func DeleteNonces(ctx context.Context, s store.Store, before time.Time) (int, error) {
+	return deleteBefore(ctx, store.NewCollection[nonce](s, NoncesCollection), store.FieldUpdatedAt, before)
+}
+
+// deleteBefore deletes the documents of c whose field is before before and returns how many were deleted.
+func deleteBefore[T any](ctx context.Context, c *store.Collection[T], field string, before time.Time) (int, error) {
+	deleted := 0
+	for {
+		docs, err := c.List(ctx, store.Query{
+			Filters: []store.Filter{{Field: field, Op: store.OpLt, Value: before}},
+			Limit:   100,
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, doc := range docs {
+			err = c.Delete(ctx, doc.ID, 0)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return deleted, err
+			}
+			deleted++
+		}
+
+		if len(docs) < 100 {
+			return deleted, nil
+		}
+	}
+}
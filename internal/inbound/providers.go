@@ -0,0 +1,108 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/webhooks"
+)
+
+// Header returns an EventID or EventType function that reads the request header name.
+func Header(name string) func(r *http.Request, body []byte) string {
+	return func(r *http.Request, body []byte) string {
+		return r.Header.Get(name)
+	}
+}
+
+// JSONField returns an EventID or EventType function that reads the top level string field name of a JSON body.
+func JSONField(name string) func(r *http.Request, body []byte) string {
+	return func(r *http.Request, body []byte) string {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal(body, &fields) != nil {
+			return ""
+		}
+
+		var value string
+		_ = json.Unmarshal(fields[name], &value)
+		return value
+	}
+}
+
+// GitHub returns the provider definition of GitHub webhooks, signed with secret. GitHub does not sign a
+// timestamp, so replays are only detected while the hash of the body is remembered.
+func GitHub(secret string) Provider {
+	return Provider{
+		Name:      "github",
+		Verifier:  HMAC([]byte(secret), Signature{Header: "X-Hub-Signature-256", Prefix: "sha256="}),
+		EventID:   Header("X-GitHub-Delivery"),
+		EventType: Header("X-GitHub-Event"),
+	}
+}
+
+// Stripe returns the provider definition of Stripe webhooks, signed with the endpoint secret.
+func Stripe(secret string) Provider {
+	return Provider{
+		Name:      "stripe",
+		Verifier:  VerifierFunc(func(r *http.Request, body []byte) (time.Time, error) { return verifyStripe(secret, r, body) }),
+		EventID:   JSONField("id"),
+		EventType: JSONField("type"),
+	}
+}
+
+// Standard returns the provider definition of webhooks sent by the webhooks package of another instance of
+// this service, signed with the secret of the subscription.
+func Standard(name, secret string) Provider {
+	return Provider{
+		Name: name,
+		Verifier: HMAC([]byte(secret), Signature{
+			Header:          webhooks.HeaderSignature,
+			Prefix:          "v1=",
+			TimestampHeader: webhooks.HeaderTimestamp,
+			Separator:       ".",
+		}),
+		EventID:   Header(webhooks.HeaderID),
+		EventType: Header(webhooks.HeaderEvent),
+	}
+}
+
+// verifyStripe checks the Stripe-Signature header, which holds the timestamp and the signatures in the form
+// t=1492774577,v1=5257a869...,v1=...
+func verifyStripe(secret string, r *http.Request, body []byte) (time.Time, error) {
+	header := r.Header.Get("Stripe-Signature")
+	if header == "" {
+		return time.Time{}, ErrMissingSignature
+	}
+
+	var raw string
+	var signatures []string
+	for part := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			raw = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	seconds, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidTimestamp
+	}
+	timestamp := time.Unix(seconds, 0)
+
+	expected := mac([]byte(secret), []byte(raw+"."+string(body)))
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return timestamp, nil
+		}
+	}
+
+	return timestamp, ErrInvalidSignature
+}
@@ -0,0 +1,165 @@
+package inbound
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMissingSignature is returned by verifiers when the request has no signature.
+	ErrMissingSignature = errors.New("missing webhook signature")
+	// ErrInvalidSignature is returned by verifiers when no signature of the request matches its payload.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrInvalidTimestamp is returned when the timestamp of a request is malformed or outside the tolerance.
+	ErrInvalidTimestamp = errors.New("invalid webhook timestamp")
+)
+
+// Verifier authenticates the requests of a provider.
+type Verifier interface {
+	// Verify checks the signature of a request with body. It returns the time the provider signed the request,
+	// or the zero time if the signature does not cover a timestamp.
+	Verify(r *http.Request, body []byte) (time.Time, error)
+}
+
+// VerifierFunc adapts a function to a Verifier.
+type VerifierFunc func(r *http.Request, body []byte) (time.Time, error)
+
+// Verify calls f.
+func (f VerifierFunc) Verify(r *http.Request, body []byte) (time.Time, error) {
+	return f(r, body)
+}
+
+// Encoding is how a signature is encoded in its header.
+type Encoding int
+
+// Supported signature encodings.
+const (
+	Hex Encoding = iota
+	Base64
+)
+
+// Signature describes where a provider sends its signature and what it signs.
+type Signature struct {
+	// Header holds the signature. It may hold several signatures separated by commas or spaces, such as
+	// while the provider rotates its secret, and the request is valid if any of them matches.
+	Header string
+	// Prefix precedes each signature, such as sha256=. Signatures without it are ignored.
+	Prefix string
+	// TimestampHeader holds the Unix time in seconds the request was signed at. If set, the signed payload
+	// is the timestamp, Separator and the body, otherwise the body alone.
+	TimestampHeader string
+	Separator       string
+	Encoding        Encoding
+}
+
+// HMAC returns a Verifier of HMAC-SHA256 signatures keyed with secret.
+func HMAC(secret []byte, sig Signature) Verifier {
+	return VerifierFunc(func(r *http.Request, body []byte) (time.Time, error) {
+		return sig.verify(r, body, func(payload, signature []byte) bool {
+			return hmac.Equal(mac(secret, payload), signature)
+		})
+	})
+}
+
+// PublicKey returns a Verifier of signatures made with the private key of key. Ed25519 keys, ECDSA keys with
+// SHA-256 and ASN.1 encoded signatures, and RSA keys with SHA-256 and PKCS #1 v1.5 signatures are supported.
+func PublicKey(key crypto.PublicKey, sig Signature) (Verifier, error) {
+	var check func(payload, signature []byte) bool
+	switch key := key.(type) {
+	case ed25519.PublicKey:
+		check = func(payload, signature []byte) bool {
+			return ed25519.Verify(key, payload, signature)
+		}
+	case *ecdsa.PublicKey:
+		check = func(payload, signature []byte) bool {
+			digest := sha256.Sum256(payload)
+			return ecdsa.VerifyASN1(key, digest[:], signature)
+		}
+	case *rsa.PublicKey:
+		check = func(payload, signature []byte) bool {
+			digest := sha256.Sum256(payload)
+			return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+
+	return VerifierFunc(func(r *http.Request, body []byte) (time.Time, error) {
+		return sig.verify(r, body, check)
+	}), nil
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key, as published by providers that sign asymmetrically.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// verify checks the signatures of a request with check, which reports whether a decoded signature matches
+// the signed payload.
+func (s Signature) verify(r *http.Request, body []byte, check func(payload, signature []byte) bool) (time.Time, error) {
+	header := r.Header.Get(s.Header)
+	if header == "" {
+		return time.Time{}, ErrMissingSignature
+	}
+
+	payload := body
+	var timestamp time.Time
+	if s.TimestampHeader != "" {
+		raw := r.Header.Get(s.TimestampHeader)
+		seconds, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return time.Time{}, ErrInvalidTimestamp
+		}
+		timestamp = time.Unix(seconds, 0)
+		payload = slices.Concat([]byte(raw), []byte(s.Separator), body)
+	}
+
+	separator := func(r rune) bool { return r == ',' || r == ' ' }
+	for signature := range strings.FieldsFuncSeq(header, separator) {
+		encoded, ok := strings.CutPrefix(signature, s.Prefix)
+		if !ok {
+			continue
+		}
+		decoded, err := s.Encoding.decode(encoded)
+		if err == nil && check(payload, decoded) {
+			return timestamp, nil
+		}
+	}
+
+	return timestamp, ErrInvalidSignature
+}
+
+func (e Encoding) decode(s string) ([]byte, error) {
+	if e == Base64 {
+		return base64.StdEncoding.DecodeString(s)
+	}
+
+	return hex.DecodeString(s)
+}
+
+func mac(secret, payload []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write(payload)
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,263 @@
+package inbound
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedRequest returns a request with headers.
+func signedRequest(headers map[string]string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+
+	return r
+}
+
+func TestHMAC(t *testing.T) {
+	body := `{"action":"opened"}`
+	now := time.Now()
+	ts := strconv.FormatInt(now.Unix(), 10)
+	hexMAC := func(secret, payload string) string { return hex.EncodeToString(mac([]byte(secret), []byte(payload))) }
+
+	timestamped := Signature{Header: "X-Signature", Prefix: "v1=", TimestampHeader: "X-Timestamp", Separator: "."}
+
+	tests := []struct {
+		headers   map[string]string
+		expect    error
+		name      string
+		sig       Signature
+		timestamp bool
+	}{
+		{
+			name:    "body",
+			sig:     Signature{Header: "X-Hub-Signature-256", Prefix: "sha256="},
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + hexMAC("secret", body)},
+		},
+		{
+			name:    "base64",
+			sig:     Signature{Header: "X-Signature", Encoding: Base64},
+			headers: map[string]string{"X-Signature": base64.StdEncoding.EncodeToString(mac([]byte("secret"), []byte(body)))},
+		},
+		{
+			name:      "timestamp",
+			sig:       timestamped,
+			headers:   map[string]string{"X-Signature": "v1=" + hexMAC("secret", ts+"."+body), "X-Timestamp": ts},
+			timestamp: true,
+		},
+		{
+			name:      "rotated secret",
+			sig:       timestamped,
+			headers:   map[string]string{"X-Signature": "v1=" + hexMAC("old", ts+"."+body) + " v1=" + hexMAC("secret", ts+"."+body), "X-Timestamp": ts},
+			timestamp: true,
+		},
+		{
+			name:    "missing signature",
+			sig:     timestamped,
+			headers: map[string]string{"X-Timestamp": ts},
+			expect:  ErrMissingSignature,
+		},
+		{
+			name:    "missing prefix",
+			sig:     Signature{Header: "X-Hub-Signature-256", Prefix: "sha256="},
+			headers: map[string]string{"X-Hub-Signature-256": hexMAC("secret", body)},
+			expect:  ErrInvalidSignature,
+		},
+		{
+			name:    "wrong secret",
+			sig:     Signature{Header: "X-Hub-Signature-256", Prefix: "sha256="},
+			headers: map[string]string{"X-Hub-Signature-256": "sha256=" + hexMAC("other", body)},
+			expect:  ErrInvalidSignature,
+		},
+		{
+			name:    "unsigned timestamp",
+			sig:     timestamped,
+			headers: map[string]string{"X-Signature": "v1=" + hexMAC("secret", body), "X-Timestamp": ts},
+			expect:  ErrInvalidSignature,
+		},
+		{
+			name:    "malformed timestamp",
+			sig:     timestamped,
+			headers: map[string]string{"X-Signature": "v1=" + hexMAC("secret", "now."+body), "X-Timestamp": "now"},
+			expect:  ErrInvalidTimestamp,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			timestamp, err := HMAC([]byte("secret"), test.sig).Verify(signedRequest(test.headers), []byte(body))
+			if !errors.Is(err, test.expect) {
+				t.Fatalf("unexpected error: got %v want %v", err, test.expect)
+			}
+			if test.timestamp && timestamp.Unix() != now.Unix() {
+				t.Errorf("unexpected timestamp: got %v want %v", timestamp, now)
+			}
+		})
+	}
+}
+
+func TestPublicKey(t *testing.T) {
+	body := []byte(`{"type":"payment.completed"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	payload := []byte(ts + string(body))
+	digest := sha256.Sum256(payload)
+
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSignature, err := ecdsa.SignASN1(rand.Reader, ecPrivate, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaPrivate, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		key       crypto.PublicKey
+		name      string
+		signature []byte
+	}{
+		{name: "ed25519", key: edPublic, signature: ed25519.Sign(edPrivate, payload)},
+		{name: "ecdsa", key: &ecPrivate.PublicKey, signature: ecSignature},
+		{name: "rsa", key: &rsaPrivate.PublicKey, signature: rsaSignature},
+	}
+
+	sig := Signature{Header: "X-Signature-Ed25519", TimestampHeader: "X-Signature-Timestamp"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// Keys published by providers are PEM encoded
+			der, err := x509.MarshalPKIXPublicKey(test.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			v, err := PublicKey(key, sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := signedRequest(map[string]string{"X-Signature-Ed25519": hex.EncodeToString(test.signature), "X-Signature-Timestamp": ts})
+			_, err = v.Verify(r, body)
+			if err != nil {
+				t.Errorf("unexpected error for a valid signature: %v", err)
+			}
+
+			_, err = v.Verify(r, []byte(`{"type":"payment.refunded"}`))
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("unexpected error for a modified body: got %v want %v", err, ErrInvalidSignature)
+			}
+		})
+	}
+
+	_, err = PublicKey("key", sig)
+	if err == nil {
+		t.Error("expected an error for an unsupported key type")
+	}
+}
+
+func TestProviders(t *testing.T) {
+	body := []byte(`{"id":"evt_1","type":"invoice.paid"}`)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+
+	tests := []struct {
+		expect   error
+		headers  map[string]string
+		name     string
+		id       string
+		typ      string
+		provider Provider
+	}{
+		{
+			name:     "github",
+			provider: GitHub("secret"),
+			headers: map[string]string{
+				"X-Hub-Signature-256": "sha256=" + hex.EncodeToString(mac([]byte("secret"), body)),
+				"X-GitHub-Delivery":   "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+				"X-GitHub-Event":      "push",
+			},
+			id:  "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+			typ: "push",
+		},
+		{
+			name:     "stripe",
+			provider: Stripe("secret"),
+			headers:  map[string]string{"Stripe-Signature": "t=" + ts + ",v1=" + hex.EncodeToString(mac([]byte("secret"), []byte(ts+"."+string(body)))) + ",v0=abc"},
+			id:       "evt_1",
+			typ:      "invoice.paid",
+		},
+		{
+			name:     "stripe wrong secret",
+			provider: Stripe("secret"),
+			headers:  map[string]string{"Stripe-Signature": "t=" + ts + ",v1=" + hex.EncodeToString(mac([]byte("other"), []byte(ts+"."+string(body))))},
+			expect:   ErrInvalidSignature,
+		},
+		{
+			name:     "stripe missing timestamp",
+			provider: Stripe("secret"),
+			headers:  map[string]string{"Stripe-Signature": "v1=" + hex.EncodeToString(mac([]byte("secret"), []byte("."+string(body))))},
+			expect:   ErrInvalidTimestamp,
+		},
+		{
+			name:     "standard",
+			provider: Standard("partner", "secret"),
+			headers: map[string]string{
+				"Webhook-Signature": "v1=" + hex.EncodeToString(mac([]byte("secret"), []byte(ts+"."+string(body)))),
+				"Webhook-Timestamp": ts,
+				"Webhook-Id":        "1f2e3d4c",
+				"Webhook-Event":     "item.created",
+			},
+			id:  "1f2e3d4c",
+			typ: "item.created",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := signedRequest(test.headers)
+			_, err := test.provider.Verifier.Verify(r, body)
+			if !errors.Is(err, test.expect) {
+				t.Fatalf("unexpected error: got %v want %v", err, test.expect)
+			}
+			if err != nil {
+				return
+			}
+
+			if id := test.provider.EventID(r, body); id != test.id {
+				t.Errorf("unexpected event ID: got %q want %q", id, test.id)
+			}
+			if typ := test.provider.EventType(r, body); typ != test.typ {
+				t.Errorf("unexpected event type: got %q want %q", typ, test.typ)
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+/*
+Package jobs runs background work outside of request handlers. Jobs are enqueued in a store.JobStore with
+typed arguments and consumed by a pool of workers, in the server process or in separate worker processes
+started with the worker command.
+
+A job that returns an error is retried with exponential backoff until it has been attempted MaxAttempts
+times, then moved to the dead letter state where it is kept until an operator retries or discards it.
+Handlers run at least once, so they must be safe to repeat.
+
+	jobs.Handle(q, "email.send", func(ctx context.Context, job store.Job, args EmailArgs) error {
+		return send(ctx, args.To)
+	})
+
+	_, err := q.Enqueue(ctx, "email.send", EmailArgs{To: "a@example.com"}, jobs.EnqueueOptions{Delay: time.Minute})
+*/
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// Config holds configuration for a Queue.
+type Config struct {
+	// Logger logs job failures. Defaults to slog.Default.
+	Logger *slog.Logger
+	// Workers is the maximum number of jobs run concurrently by Run. Defaults to 4.
+	Workers int
+	// PollInterval is how often the store is checked for due jobs. Jobs enqueued by this process are picked
+	// up immediately. Defaults to 1s.
+	PollInterval time.Duration
+	// Timeout cancels the context of a job that runs longer. Jobs are locked for a minute longer than the
+	// timeout, after which another worker may claim them. Defaults to 5 minutes.
+	Timeout time.Duration
+	// MaxAttempts is the number of times a job is attempted before it is dead-lettered, unless it was
+	// enqueued with its own. Defaults to 10.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every further retry. Defaults to 1s.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between retries. Defaults to 1 hour.
+	MaxBackoff time.Duration
+}
+
+// EnqueueOptions holds the options for enqueueing a job.
+type EnqueueOptions struct {
+	// RunAt schedules the job. Defaults to now.
+	RunAt time.Time
+	// UniqueKey, if set, makes Enqueue return store.ErrConflict while a pending or running job of the same
+	// kind has the key.
+	UniqueKey string
+	// Delay postpones the job. It is added to RunAt.
+	Delay time.Duration
+	// MaxAttempts overrides Config.MaxAttempts for the job.
+	MaxAttempts int
+}
+
+// handlerFunc runs a job.
+type handlerFunc func(ctx context.Context, job store.Job) error
+
+// Queue enqueues jobs and runs the handlers registered for them.
+type Queue struct {
+	store    store.JobStore
+	logger   *slog.Logger
+	handlers map[string]handlerFunc
+	wake     chan struct{}
+	cfg      Config
+	mu       sync.RWMutex
+}
+
+// New returns a Queue storing jobs in s. Register handlers before calling Run.
+func New(s store.JobStore, cfg Config) *Queue {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Minute
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+
+	return &Queue{
+		store:    s,
+		logger:   cfg.Logger.With("component", "jobs"),
+		handlers: map[string]handlerFunc{},
+		wake:     make(chan struct{}, 1),
+		cfg:      cfg,
+	}
+}
+
+// Handle registers fn to run jobs of kind. The arguments of each job are decoded from JSON into T; jobs
+// whose arguments cannot be decoded are dead-lettered without being retried.
+func Handle[T any](q *Queue, kind string, fn func(ctx context.Context, job store.Job, args T) error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[kind] = func(ctx context.Context, job store.Job) error {
+		var args T
+		if len(job.Args) > 0 {
+			err := json.Unmarshal(job.Args, &args)
+			if err != nil {
+				return Permanent(fmt.Errorf("decoding arguments: %w", err))
+			}
+		}
+
+		return fn(ctx, job, args)
+	}
+}
+
+// Kinds returns the kinds of job with a registered handler.
+func (q *Queue) Kinds() []string {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+
+	return kinds
+}
+
+// Enqueue stores a job of kind with args encoded as JSON. The job runs on whichever process sharing the
+// store has a handler for kind.
+func (q *Queue) Enqueue(ctx context.Context, kind string, args any, opts EnqueueOptions) (store.Job, error) {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return store.Job{}, err
+	}
+
+	runAt := opts.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = q.cfg.MaxAttempts
+	}
+
+	job, err := q.store.EnqueueJob(ctx, store.Job{
+		Kind:        kind,
+		Args:        data,
+		UniqueKey:   opts.UniqueKey,
+		RunAt:       runAt.Add(opts.Delay),
+		MaxAttempts: maxAttempts,
+	})
+	if err != nil {
+		return store.Job{}, err
+	}
+
+	if opts.Delay <= 0 {
+		q.notify()
+	}
+
+	return job, nil
+}
+
+// Run claims and runs due jobs of the registered kinds until ctx is done, then waits for the running jobs.
+// Jobs interrupted by ctx are retried.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	kinds := q.Kinds()
+	slots := make(chan struct{}, q.cfg.Workers)
+	ticker := time.NewTicker(q.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if free := cap(slots) - len(slots); free > 0 && len(kinds) > 0 {
+			now := time.Now()
+			jobs, err := q.store.ClaimJobs(ctx, kinds, now, now.Add(q.cfg.Timeout+time.Minute), free)
+			if err != nil && ctx.Err() == nil {
+				q.logger.Error("claiming jobs", "err", err)
+			}
+
+			for _, job := range jobs {
+				slots <- struct{}{}
+				wg.Go(func() {
+					defer func() {
+						<-slots
+						q.notify()
+					}()
+					q.execute(ctx, job)
+				})
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// notify wakes Run to claim jobs.
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// execute runs a claimed job and records its outcome.
+func (q *Queue) execute(ctx context.Context, job store.Job) {
+	q.mu.RLock()
+	fn := q.handlers[job.Kind]
+	q.mu.RUnlock()
+
+	start := time.Now()
+	jobLatency.WithLabelValues(job.Kind).Observe(max(start.Sub(job.RunAt), 0).Seconds())
+
+	runCtx, cancel := context.WithTimeout(ctx, q.cfg.Timeout)
+	err := run(runCtx, fn, job)
+	cancel()
+
+	// The outcome is recorded even if the process is shutting down
+	storeCtx := context.WithoutCancel(ctx)
+	outcome := "succeeded"
+	switch {
+	case err == nil:
+		err = q.store.CompleteJob(storeCtx, job.ID, job.Attempts)
+	case ctx.Err() != nil:
+		outcome = "interrupted"
+		err = q.store.FailJob(storeCtx, job.ID, job.Attempts, "interrupted by shutdown", time.Now())
+	case IsPermanent(err), job.Attempts >= job.MaxAttempts:
+		outcome = "dead"
+		q.logger.Error("job failed, moving it to the dead letter queue", "id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "err", err)
+		err = q.store.FailJob(storeCtx, job.ID, job.Attempts, err.Error(), time.Time{})
+	default:
+		outcome = "retried"
+		retryAt := time.Now().Add(q.backoff(job.Attempts))
+		q.logger.Warn("job failed, retrying", "id", job.ID, "kind", job.Kind, "attempt", job.Attempts, "retry_at", retryAt, "err", err)
+		err = q.store.FailJob(storeCtx, job.ID, job.Attempts, err.Error(), retryAt)
+	}
+	jobDuration.WithLabelValues(job.Kind, outcome).Observe(time.Since(start).Seconds())
+
+	if errors.Is(err, store.ErrConflict) {
+		q.logger.Warn("job lock expired before it finished, it may have run twice", "id", job.ID, "kind", job.Kind)
+	} else if err != nil {
+		q.logger.Error("recording job outcome", "id", job.ID, "kind", job.Kind, "err", err)
+	}
+}
+
+// backoff returns the delay before retrying a job that failed attempt.
+func (q *Queue) backoff(attempt int) time.Duration {
+	delay := q.cfg.Backoff
+	for i := 1; i < attempt && delay < q.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, q.cfg.MaxBackoff)
+
+	// Jitter spreads out retries of jobs that failed at the same time
+	return delay + mathrand.N(delay/4+1)
+}
+
+// run calls fn, turning a panic into an error so it fails the job instead of the process.
+func run(ctx context.Context, fn handlerFunc, job store.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return fn(ctx, job)
+}
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+// Permanent wraps err so the job that returned it is dead-lettered instead of retried.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked with Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,175 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// testConfig makes jobs retry quickly.
+var testConfig = Config{
+	Logger:       slog.New(slog.DiscardHandler),
+	PollInterval: 5 * time.Millisecond,
+	Backoff:      time.Millisecond,
+	MaxBackoff:   5 * time.Millisecond,
+	MaxAttempts:  3,
+}
+
+type testArgs struct {
+	Name     string `json:"name"`
+	FailRuns int    `json:"fail_runs"`
+}
+
+// startQueue runs q until the test ends.
+func startQueue(t *testing.T, q *Queue) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitForJob polls the store until the job with id is done, returning ErrNotFound once it completed.
+func waitForJob(t *testing.T, s store.JobStore, id string) (store.Job, error) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := s.GetJob(context.Background(), id)
+		if err != nil || job.State == store.JobDead {
+			return job, err
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("timed out waiting for job %s", id)
+	return store.Job{}, nil
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	q := New(s, testConfig)
+
+	runs := map[string]*atomic.Int32{}
+	for _, name := range []string{"succeeds", "retried", "exhausted", "permanent", "panics", "invalid"} {
+		runs[name] = &atomic.Int32{}
+	}
+	Handle(q, "test", func(ctx context.Context, job store.Job, args testArgs) error {
+		n := runs[args.Name].Add(1)
+		switch {
+		case args.Name == "permanent":
+			return Permanent(errors.New("bad input"))
+		case args.Name == "panics":
+			panic("boom")
+		case int(n) <= args.FailRuns:
+			return errors.New("temporary")
+		}
+		return nil
+	})
+	startQueue(t, q)
+
+	tests := []struct {
+		args        any
+		expectError string
+		name        string
+		expectRuns  int32
+		expectDead  bool
+	}{
+		{name: "succeeds", args: testArgs{Name: "succeeds"}, expectRuns: 1},
+		{name: "retried", args: testArgs{Name: "retried", FailRuns: 2}, expectRuns: 3},
+		{name: "exhausted", args: testArgs{Name: "exhausted", FailRuns: 5}, expectRuns: 3, expectDead: true, expectError: "temporary"},
+		{name: "permanent", args: testArgs{Name: "permanent"}, expectRuns: 1, expectDead: true, expectError: "bad input"},
+		{name: "panics", args: testArgs{Name: "panics"}, expectRuns: 3, expectDead: true, expectError: "panic: boom"},
+		{name: "invalid", args: map[string]int{"name": 1}, expectRuns: 0, expectDead: true, expectError: "decoding arguments: json: cannot unmarshal number into Go struct field testArgs.name of type string"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			job, err := q.Enqueue(ctx, "test", test.args, EnqueueOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			job, err = waitForJob(t, s, job.ID)
+			if test.expectDead {
+				if err != nil || job.LastError != test.expectError {
+					t.Errorf("unexpected dead job: got %+v, %v want error %q", job, err, test.expectError)
+				}
+			} else if !errors.Is(err, store.ErrNotFound) {
+				t.Errorf("expected the job to complete: got %+v, %v", job, err)
+			}
+
+			if got := runs[test.name].Load(); got != test.expectRuns {
+				t.Errorf("unexpected number of runs: got %d want %d", got, test.expectRuns)
+			}
+		})
+	}
+}
+
+func TestQueueEnqueueOptions(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	q := New(s, testConfig)
+
+	delayed, err := q.Enqueue(ctx, "test", nil, EnqueueOptions{Delay: time.Hour, UniqueKey: "a", MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Until(delayed.RunAt) < 59*time.Minute || delayed.MaxAttempts != 1 {
+		t.Errorf("unexpected delayed job: %+v", delayed)
+	}
+
+	_, err = q.Enqueue(ctx, "test", nil, EnqueueOptions{UniqueKey: "a"})
+	if !errors.Is(err, store.ErrConflict) {
+		t.Errorf("unexpected error enqueueing a duplicate: got %v want %v", err, store.ErrConflict)
+	}
+
+	// Delayed jobs are not run before they are due
+	var runs atomic.Int32
+	Handle(q, "test", func(ctx context.Context, job store.Job, args struct{}) error {
+		runs.Add(1)
+		return nil
+	})
+	startQueue(t, q)
+	time.Sleep(50 * time.Millisecond)
+
+	job, err := s.GetJob(ctx, delayed.ID)
+	if err != nil || job.State != store.JobPending || runs.Load() != 0 {
+		t.Errorf("delayed job ran early: %+v, %v", job, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := New(store.NewMemory(), Config{Backoff: time.Second, MaxBackoff: time.Minute})
+
+	tests := []struct {
+		attempt int
+		expect  time.Duration
+	}{
+		{attempt: 1, expect: time.Second},
+		{attempt: 2, expect: 2 * time.Second},
+		{attempt: 4, expect: 8 * time.Second},
+		{attempt: 10, expect: time.Minute},
+		{attempt: 100, expect: time.Minute},
+	}
+
+	for _, test := range tests {
+		got := q.backoff(test.attempt)
+		if got < test.expect || got > test.expect+test.expect/4 {
+			t.Errorf("unexpected backoff for attempt %d: got %v want %v plus up to 25%% jitter", test.attempt, got, test.expect)
+		}
+	}
+}
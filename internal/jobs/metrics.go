@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	jobLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jobs_latency_seconds",
+		Help:    "Time from when a job was due until a worker started it.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"kind"})
+	jobDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "jobs_duration_seconds",
+		Help:    "Time taken to run a job, by outcome: succeeded, retried, dead or interrupted.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"kind", "outcome"})
+
+	depthDesc = prometheus.NewDesc("jobs_queue_depth", "Number of jobs by kind and state.",
+		[]string{"kind", "state"}, nil)
+	oldestDesc = prometheus.NewDesc("jobs_oldest_pending_seconds", "Time since the oldest pending job of a kind was due.",
+		[]string{"kind"}, nil)
+)
+
+// RegisterMetrics registers the job metrics with the default Prometheus registry. The queue depth is read
+// from s whenever the metrics are scraped.
+func RegisterMetrics(s store.JobStore) error {
+	for _, c := range []prometheus.Collector{jobLatency, jobDuration, depthCollector{store: s}} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// depthCollector exports the number of queued jobs.
+type depthCollector struct {
+	store store.JobStore
+}
+
+func (c depthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- depthDesc
+	ch <- oldestDesc
+}
+
+func (c depthCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stats, err := c.store.JobStats(ctx)
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(depthDesc, err)
+		return
+	}
+
+	now := time.Now()
+	for _, st := range stats {
+		ch <- prometheus.MustNewConstMetric(depthDesc, prometheus.GaugeValue, float64(st.Count), st.Kind, string(st.State))
+		if st.State == store.JobPending {
+			ch <- prometheus.MustNewConstMetric(oldestDesc, prometheus.GaugeValue, max(now.Sub(st.OldestRunAt), 0).Seconds(), st.Kind)
+		}
+	}
+}
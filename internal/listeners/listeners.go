@@ -0,0 +1,282 @@
+/*
+Package listeners opens the sockets the server accepts connections on, described by URLs:
+
+	tcp://127.0.0.1:8080                           TCP address, [::]:8080 or :8080 for every interface
+	unix:///run/app/app.sock?mode=0660             Unix domain socket, created with a file mode
+	fd://3                                         socket inherited as file descriptor 3
+	systemd://                                     every socket passed by systemd socket activation
+	systemd://http                                 the sockets named http by FileDescriptorName=
+
+Every URL accepts cert and key parameters, the paths of the TLS certificate and key of the listener, and
+tls=false to serve it without TLS when the server has a default certificate:
+
+	tcp://:8443?cert=/etc/app/tls.crt&key=/etc/app/tls.key
+	unix:///run/app/app.sock?tls=false
+
+Upgrade passes the sockets of a process to a new one, started from its executable, which serves them without
+binding them again.
+*/
+package listeners
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// Address is a parsed listener URL.
+type Address struct {
+	// URL is the listener URL, used to name the listener in logs.
+	URL string
+	// Scheme is tcp, unix, fd or systemd.
+	Scheme string
+	// Addr is the host and port of tcp, the socket path of unix, the descriptor of fd, or the socket name of
+	// systemd, which is empty for every activated socket.
+	Addr string
+	// CertFile and KeyFile are the TLS certificate and key of the listener.
+	CertFile string
+	KeyFile  string
+	// Mode is the file mode of a unix socket. It is left to the umask if zero.
+	Mode os.FileMode
+	// NoTLS serves the listener without TLS, even if the server has a default certificate.
+	NoTLS bool
+}
+
+// Parse parses a listener URL.
+func Parse(raw string) (Address, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid listener %q: %w", raw, err)
+	}
+
+	a := Address{URL: raw, Scheme: u.Scheme}
+	switch u.Scheme {
+	case "tcp":
+		a.Addr = u.Host
+		_, _, err = net.SplitHostPort(a.Addr)
+	case "unix":
+		a.Addr = u.Path
+		if a.Addr == "" {
+			err = errors.New("missing socket path")
+		}
+	case "fd":
+		a.Addr = u.Host
+		var fd int
+		fd, err = strconv.Atoi(a.Addr)
+		if err == nil && fd < 3 {
+			err = errors.New("descriptors 0 to 2 are the standard streams")
+		}
+	case "systemd":
+		a.Addr = u.Host
+	default:
+		err = errors.New("the scheme must be tcp, unix, fd or systemd")
+	}
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid listener %q: %w", raw, err)
+	}
+
+	query := u.Query()
+	a.CertFile, a.KeyFile = query.Get("cert"), query.Get("key")
+	if (a.CertFile == "") != (a.KeyFile == "") {
+		return Address{}, fmt.Errorf("invalid listener %q: cert and key must be set together", raw)
+	}
+
+	if value := query.Get("tls"); value != "" {
+		useTLS, err := strconv.ParseBool(value)
+		if err != nil {
+			return Address{}, fmt.Errorf("invalid listener %q: tls must be true or false", raw)
+		}
+		a.NoTLS = !useTLS
+	}
+	if a.NoTLS && a.CertFile != "" {
+		return Address{}, fmt.Errorf("invalid listener %q: tls=false cannot be used with a cert and key", raw)
+	}
+
+	if value := query.Get("mode"); value != "" {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || a.Scheme != "unix" || mode > 0o777 {
+			return Address{}, fmt.Errorf("invalid listener %q: mode must be an octal file mode of a unix socket", raw)
+		}
+		a.Mode = os.FileMode(mode)
+	}
+
+	return a, nil
+}
+
+// Listen opens the sockets of a, or returns those passed for it by the process that upgraded to this one.
+// Only systemd addresses may return several.
+func (a Address) Listen() ([]net.Listener, error) {
+	if files := inheritedFiles(a.URL); len(files) > 0 {
+		return fileListeners(files)
+	}
+
+	switch a.Scheme {
+	case "tcp":
+		lis, err := net.Listen("tcp", a.Addr)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{lis}, nil
+	case "unix":
+		lis, err := listenUnix(a.Addr, a.Mode)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{lis}, nil
+	case "fd":
+		fd, _ := strconv.Atoi(a.Addr)
+		lis, err := FileListener(os.NewFile(uintptr(fd), a.URL))
+		if err != nil {
+			return nil, fmt.Errorf("inheriting %s: %w", a.URL, err)
+		}
+		return []net.Listener{lis}, nil
+	case "systemd":
+		return listenSystemd(a.Addr)
+	}
+
+	return nil, fmt.Errorf("unsupported listener %s", a.URL)
+}
+
+// FileListener returns a listener of the socket in f, and closes f.
+func FileListener(f *os.File) (net.Listener, error) {
+	defer func() { _ = f.Close() }()
+
+	return net.FileListener(f)
+}
+
+// listenUnix listens on a unix socket at path with mode. A socket left by a process that stopped without
+// removing it is replaced, but not one that accepts connections.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("listen unix %s: %w", path, syscall.EADDRINUSE)
+		}
+		_ = os.Remove(path)
+	}
+
+	lis, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if mode != 0 {
+		err = os.Chmod(path, mode)
+		if err != nil {
+			_ = lis.Close()
+			return nil, err
+		}
+	}
+
+	return lis, nil
+}
+
+// listenFDsStart is the first descriptor passed by systemd.
+var listenFDsStart = 3
+
+// activated holds the sockets passed by systemd. Each is handed out once.
+var activated struct {
+	err   error
+	files map[string][]*os.File
+	once  sync.Once
+	mu    sync.Mutex
+}
+
+// listenSystemd returns the listeners of the sockets passed by systemd under name, or of every socket if
+// name is empty.
+func listenSystemd(name string) ([]net.Listener, error) {
+	activated.once.Do(func() {
+		activated.files, activated.err = systemdFiles()
+	})
+	if activated.err != nil {
+		return nil, activated.err
+	}
+
+	activated.mu.Lock()
+	var files []*os.File
+	for fdName, fs := range activated.files {
+		if name == "" || fdName == name {
+			files = append(files, fs...)
+			delete(activated.files, fdName)
+		}
+	}
+	activated.mu.Unlock()
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("systemd passed no socket named %q", name)
+	}
+
+	return fileListeners(files)
+}
+
+// fileListeners returns the listeners of the sockets in files, and closes them.
+func fileListeners(files []*os.File) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(files))
+	for _, f := range files {
+		lis, err := FileListener(f)
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, fmt.Errorf("inheriting %s: %w", f.Name(), err)
+		}
+		listeners = append(listeners, lis)
+	}
+
+	return listeners, nil
+}
+
+// systemdFiles returns the sockets passed by systemd socket activation, by name, following sd_listen_fds(3).
+// The environment variables are unset so child processes do not inherit them.
+func systemdFiles() (map[string][]*os.File, error) {
+	defer func() {
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+	}()
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, errors.New("the process was not started by systemd socket activation")
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, errors.New("systemd passed no sockets")
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	files := make(map[string][]*os.File, count)
+	for i := range count {
+		name := "unknown"
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		fd := listenFDsStart + i
+		files[name] = append(files[name], os.NewFile(uintptr(fd), "systemd://"+name))
+	}
+
+	return files, nil
+}
+
+// SystemdActivated reports whether systemd passed sockets to the process, or to the process that upgraded to
+// it.
+func SystemdActivated() bool {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err == nil && pid == os.Getpid() && os.Getenv("LISTEN_FDS") != "" {
+		return true
+	}
+
+	loadInherited()
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+	_, ok := inherited.files["systemd://"]
+
+	return ok
+}
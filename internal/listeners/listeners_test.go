@@ -0,0 +1,180 @@
+package listeners
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		raw       string
+		expected  Address
+		expectErr bool
+	}{
+		{
+			raw:      "tcp://127.0.0.1:8080",
+			expected: Address{URL: "tcp://127.0.0.1:8080", Scheme: "tcp", Addr: "127.0.0.1:8080"},
+		},
+		{
+			raw:      "tcp://[::]:8443?cert=tls.crt&key=tls.key",
+			expected: Address{URL: "tcp://[::]:8443?cert=tls.crt&key=tls.key", Scheme: "tcp", Addr: "[::]:8443", CertFile: "tls.crt", KeyFile: "tls.key"},
+		},
+		{
+			raw:      "unix:///run/app.sock?mode=0660&tls=false",
+			expected: Address{URL: "unix:///run/app.sock?mode=0660&tls=false", Scheme: "unix", Addr: "/run/app.sock", Mode: 0o660, NoTLS: true},
+		},
+		{
+			raw:      "fd://3",
+			expected: Address{URL: "fd://3", Scheme: "fd", Addr: "3"},
+		},
+		{
+			raw:      "systemd://http",
+			expected: Address{URL: "systemd://http", Scheme: "systemd", Addr: "http"},
+		},
+		{raw: "udp://:8080", expectErr: true},
+		{raw: "tcp://localhost", expectErr: true},
+		{raw: "unix://", expectErr: true},
+		{raw: "fd://1", expectErr: true},
+		{raw: "fd://stdin", expectErr: true},
+		{raw: "tcp://:8443?cert=tls.crt", expectErr: true},
+		{raw: "tcp://:8443?cert=tls.crt&key=tls.key&tls=false", expectErr: true},
+		{raw: "tcp://:8080?tls=maybe", expectErr: true},
+		{raw: "tcp://:8080?mode=0660", expectErr: true},
+		{raw: "unix:///run/app.sock?mode=rw", expectErr: true},
+	}
+
+	for _, test := range tests {
+		addr, err := Parse(test.raw)
+		if (err != nil) != test.expectErr {
+			t.Errorf("%s: got error=%v, wantErr=%v", test.raw, err, test.expectErr)
+			continue
+		}
+		if addr != test.expected {
+			t.Errorf("%s: got %+v, want %+v", test.raw, addr, test.expected)
+		}
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	addr, err := Parse("unix://" + path + "?mode=0600")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lns, err := addr.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected socket mode %v", info.Mode().Perm())
+	}
+
+	// A socket that accepts connections is not replaced
+	_, err = addr.Listen()
+	if err == nil {
+		t.Error("expected the socket to be in use")
+	}
+
+	// A socket left behind is replaced
+	lns[0].(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = lns[0].Close()
+	lns, err = addr.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = lns[0].Close()
+}
+
+func TestListenFD(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lis.Close() }()
+
+	f, err := lis.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr, err := Parse("fd://" + strconv.Itoa(int(f.Fd())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lns, err := addr.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = lns[0].Close() }()
+
+	if lns[0].Addr().String() != lis.Addr().String() {
+		t.Errorf("unexpected address %s, want %s", lns[0].Addr(), lis.Addr())
+	}
+}
+
+func TestListenSystemd(t *testing.T) {
+	// The sockets are passed from a descriptor the test process does not use, instead of 3
+	listenFDsStart = 200
+	t.Cleanup(func() { listenFDsStart = 3 })
+	for i := range 2 {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := lis.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = lis.Close()
+		err = unix.Dup2(int(f.Fd()), listenFDsStart+i)
+		_ = f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	activated.once = sync.Once{}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	t.Setenv("LISTEN_FDNAMES", "http:admin")
+	if !SystemdActivated() {
+		t.Fatal("expected socket activation")
+	}
+
+	addr, err := Parse("systemd://admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lns, err := addr.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = lns[0].Close()
+
+	// The remaining socket is handed out once
+	addr, _ = Parse("systemd://")
+	lns, err = addr.Listen()
+	if err != nil || len(lns) != 1 {
+		t.Fatalf("unexpected listeners %v, err=%v", lns, err)
+	}
+	_ = lns[0].Close()
+	_, err = addr.Listen()
+	if err == nil {
+		t.Error("expected no sockets left")
+	}
+
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Error("expected the environment to be unset")
+	}
+}
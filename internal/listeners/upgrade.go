@@ -0,0 +1,174 @@
+package listeners
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// inheritEnv lists the keys of the sockets passed by Upgrade, one per line and descriptor from 3 on.
+const inheritEnv = "APP_INHERITED_LISTENERS"
+
+// File is an open socket passed to the new process of an upgrade, which finds it by its key.
+type File struct {
+	*os.File
+	// Key is the URL of the listener address of the socket, or another name of the socket, such as
+	// udp://[::]:8443 for the socket of HTTP/3.
+	Key string
+}
+
+// inherited holds the sockets passed by the process that upgraded to this one. Each is handed out once.
+var inherited struct {
+	files map[string][]*os.File
+	once  sync.Once
+	mu    sync.Mutex
+}
+
+// loadInherited reads the sockets passed by the process that upgraded to this one from the environment, and
+// unsets it so child processes do not inherit it.
+func loadInherited() {
+	inherited.once.Do(func() {
+		value := os.Getenv(inheritEnv)
+		_ = os.Unsetenv(inheritEnv)
+
+		inherited.files = map[string][]*os.File{}
+		if value == "" {
+			return
+		}
+		for i, key := range strings.Split(value, "\n") {
+			fd := listenFDsStart + i
+			inherited.files[key] = append(inherited.files[key], os.NewFile(uintptr(fd), key))
+		}
+	})
+}
+
+// inheritedFiles returns the sockets passed under key by the process that upgraded to this one.
+func inheritedFiles(key string) []*os.File {
+	loadInherited()
+
+	inherited.mu.Lock()
+	defer inherited.mu.Unlock()
+
+	files := inherited.files[key]
+	delete(inherited.files, key)
+
+	return files
+}
+
+// Listen returns the socket passed under key by the process that upgraded to this one, or listens on
+// network and address.
+func Listen(key, network, address string) (net.Listener, error) {
+	if files := inheritedFiles(key); len(files) > 0 {
+		return FileListener(files[0])
+	}
+
+	return net.Listen(network, address)
+}
+
+// ListenPacket returns the socket passed under key by the process that upgraded to this one, or listens on
+// network and address.
+func ListenPacket(key, network, address string) (net.PacketConn, error) {
+	if files := inheritedFiles(key); len(files) > 0 {
+		defer func() { _ = files[0].Close() }()
+		return net.FilePacketConn(files[0])
+	}
+
+	return net.ListenPacket(network, address)
+}
+
+// Upgrade starts the executable of the process again, with the same arguments, passing it files. The new
+// process looks its sockets up with Listen, ListenPacket and Address.Listen instead of binding them, so
+// connections are not refused while it starts. It is ready once it has written its PID to pidFile. Upgrade
+// waits for it until ctx is done, and stops it if it exits or is not ready in time.
+func Upgrade(ctx context.Context, files []File, pidFile string) (*os.Process, error) {
+	if pidFile == "" {
+		return nil, errors.New("upgrades require a PID file")
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(files))
+	cmd := exec.Command(executable, os.Args[1:]...) //nolint:gosec // the executable of this process
+	for _, f := range files {
+		keys = append(keys, f.Key)
+		cmd.ExtraFiles = append(cmd.ExtraFiles, f.File)
+	}
+	cmd.Env = append(os.Environ(), inheritEnv+"="+strings.Join(keys, "\n"))
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pid, _ := ReadPIDFile(pidFile)
+		if pid == cmd.Process.Pid {
+			return cmd.Process, nil
+		}
+
+		select {
+		case err := <-exited:
+			return nil, fmt.Errorf("new process exited before it was ready: %w", err)
+		case <-ctx.Done():
+			_ = cmd.Process.Kill()
+			return nil, fmt.Errorf("new process was not ready in time: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// WritePIDFile writes the PID of the process to path. The file is replaced atomically, so a process waiting
+// for it never reads a partial PID.
+func WritePIDFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	_, err = tmp.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	if err == nil {
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadPIDFile returns the PID written to path.
+func ReadPIDFile(path string) (int, error) {
+	data, err := os.ReadFile(path) //nolint:gosec // configured by the operator
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// RemovePIDFile removes path if it holds the PID of the process, and not that of the process it upgraded to.
+func RemovePIDFile(path string) {
+	if pid, _ := ReadPIDFile(path); pid == os.Getpid() {
+		_ = os.Remove(path)
+	}
+}
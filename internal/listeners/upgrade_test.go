@@ -0,0 +1,94 @@
+package listeners
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestMain runs the test binary as the new process of an upgrade when started by TestUpgrade.
+func TestMain(m *testing.M) {
+	switch os.Getenv("LISTENERS_TEST_UPGRADE") {
+	case "":
+		os.Exit(m.Run())
+	case "fail":
+		os.Exit(1)
+	}
+
+	// The new process serves the inherited socket, answering a connection with its PID
+	lis, err := Listen("tcp://test", "tcp", "127.0.0.1:0")
+	if err != nil {
+		os.Exit(2)
+	}
+	err = WritePIDFile(os.Getenv("LISTENERS_TEST_UPGRADE"))
+	if err != nil {
+		os.Exit(3)
+	}
+	conn, err := lis.Accept()
+	if err != nil {
+		os.Exit(4)
+	}
+	_, _ = conn.Write([]byte(strconv.Itoa(os.Getpid())))
+	_ = conn.Close()
+	os.Exit(0)
+}
+
+func TestUpgrade(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "app.pid")
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := lis.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// A new process that exits is not waited for
+	t.Setenv("LISTENERS_TEST_UPGRADE", "fail")
+	_, err = Upgrade(ctx, []File{{File: f, Key: "tcp://test"}}, pidFile)
+	if err == nil {
+		t.Fatal("expected the upgrade to fail")
+	}
+
+	t.Setenv("LISTENERS_TEST_UPGRADE", pidFile)
+	process, err := Upgrade(ctx, []File{{File: f, Key: "tcp://test"}}, pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+	_ = lis.Close()
+
+	// Connections to the address of the socket reach the new process
+	conn, err := net.Dial("tcp", lis.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	buf := make([]byte, 16)
+	n, _ := conn.Read(buf)
+	if string(buf[:n]) != strconv.Itoa(process.Pid) {
+		t.Errorf("connection served by %q, want PID %d", buf[:n], process.Pid)
+	}
+
+	// The PID file belongs to the new process
+	RemovePIDFile(pidFile)
+	pid, err := ReadPIDFile(pidFile)
+	if err != nil || pid != process.Pid {
+		t.Errorf("unexpected PID file %d, err=%v", pid, err)
+	}
+}
+
+func TestUpgradeWithoutPIDFile(t *testing.T) {
+	_, err := Upgrade(context.Background(), nil, "")
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,144 @@
+/*
+Package messaging consumes and publishes messages with a message broker, so the server takes part in
+event-driven systems as well as serving HTTP. A Broker publishes messages to subjects and delivers the
+messages of a subject to consumers; consumers of the same group share the messages, each message going to one
+of them, like Kafka consumer groups.
+
+	err := broker.Subscribe(ctx, messaging.Subscription{Subject: "orders.created", Group: "billing"},
+		func(ctx context.Context, d *messaging.Delivery) error {
+			return bill(ctx, d.Data)
+		})
+
+	err = broker.Publish(ctx, messaging.Message{Subject: "orders.created", ID: order.ID, Data: data})
+
+A delivery is acknowledged when its handler returns nil, and redelivered with exponential backoff when it
+returns an error, until it has been attempted MaxAttempts times. Handlers run at least once per message, so
+they must be safe to repeat. NATS implements Broker with JetStream.
+*/
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Message is a message published to, or received from, a broker.
+type Message struct {
+	Header map[string]string
+	// Subject is the subject, or topic, of the message.
+	Subject string
+	// ID identifies the message, so brokers drop it if it is published again. It is optional.
+	ID   string
+	Data []byte
+}
+
+// Delivery is a message received by a consumer.
+type Delivery struct {
+	ack  func() error
+	nack func(delay time.Duration) error
+	Message
+	// Attempt counts the deliveries of the message, starting at 1.
+	Attempt int
+	settled bool
+}
+
+// Handler handles a delivery. The delivery is acknowledged if it returns nil and redelivered otherwise,
+// unless the handler acknowledged it itself.
+type Handler func(ctx context.Context, d *Delivery) error
+
+// Subscription describes the messages delivered to a consumer.
+type Subscription struct {
+	// Subject selects the messages to consume. NATS subjects may contain the * and > wildcards.
+	Subject string
+	// Group is the consumer group. Consumers of the same group, in this process or others, share the
+	// messages. Every consumer without a group receives every message, and misses those published while it
+	// is not running.
+	Group string
+	// Concurrency is the number of deliveries handled concurrently. Defaults to 1, which handles the
+	// messages in order.
+	Concurrency int
+	// MaxAttempts is the number of times a message is delivered before it is dropped. Defaults to 10.
+	MaxAttempts int
+}
+
+// Broker publishes and consumes messages.
+type Broker interface {
+	// Publish publishes msg, returning once the broker has stored it.
+	Publish(ctx context.Context, msg Message) error
+	// Subscribe starts a consumer that calls handler for the messages of sub until the broker is closed.
+	Subscribe(ctx context.Context, sub Subscription, handler Handler) error
+	// Ping checks that the broker is reachable. It is used for readiness checks.
+	Ping(ctx context.Context) error
+	// Close stops the consumers, waiting for the deliveries being handled until ctx is done, then closes the
+	// connection to the broker.
+	Close(ctx context.Context) error
+}
+
+// ErrSettled is returned when a delivery is acknowledged twice.
+var ErrSettled = errors.New("delivery already acknowledged")
+
+// NewDelivery returns a delivery of msg that calls ack and nack when it is acknowledged. Broker
+// implementations use it to deliver their messages.
+func NewDelivery(msg Message, attempt int, ack func() error, nack func(delay time.Duration) error) *Delivery {
+	return &Delivery{Message: msg, Attempt: attempt, ack: ack, nack: nack}
+}
+
+// Ack acknowledges that the delivery was handled, so it is not delivered again.
+func (d *Delivery) Ack() error {
+	if d.settled {
+		return ErrSettled
+	}
+	d.settled = true
+
+	return d.ack()
+}
+
+// Nack asks for the message to be delivered again after delay.
+func (d *Delivery) Nack(delay time.Duration) error {
+	if d.settled {
+		return ErrSettled
+	}
+	d.settled = true
+
+	return d.nack(delay)
+}
+
+// Consume calls handler for d and acknowledges d according to the result, unless handler did. Failed
+// deliveries are redelivered after backoff. Broker implementations call it for every delivery.
+func Consume(ctx context.Context, logger *slog.Logger, sub Subscription, handler Handler, d *Delivery, backoff time.Duration) {
+	start := time.Now()
+	err := run(ctx, handler, d)
+
+	outcome := "acked"
+	if err != nil {
+		outcome = "nacked"
+		logger.Warn("message handler failed", "subject", d.Subject, "group", sub.Group, "attempt", d.Attempt, "err", err)
+	}
+	handlerDuration.WithLabelValues(sub.Subject, outcome).Observe(time.Since(start).Seconds())
+
+	if d.settled {
+		return
+	}
+	if err != nil {
+		err = d.Nack(backoff)
+	} else {
+		err = d.Ack()
+	}
+	if err != nil {
+		logger.Error("acknowledging message", "subject", d.Subject, "group", sub.Group, "err", err)
+	}
+}
+
+// run calls handler, turning a panic into an error so it fails the delivery instead of the process.
+func run(ctx context.Context, handler Handler, d *Delivery) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return handler(ctx, d)
+}
@@ -0,0 +1,32 @@
+package messaging
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	published = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "messaging_published_total",
+		Help: "Number of messages published, by subject and outcome: succeeded or failed.",
+	}, []string{"subject", "outcome"})
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "messaging_handler_duration_seconds",
+		Help:    "Time taken to handle a delivery, by subscribed subject and outcome: acked or nacked.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+	}, []string{"subject", "outcome"})
+)
+
+// RegisterMetrics registers the messaging metrics with the default Prometheus registry.
+func RegisterMetrics() error {
+	for _, c := range []prometheus.Collector{published, handlerDuration} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// prefetch is the number of messages buffered by each consumer. Buffered messages are handled before the
+// consumer stops.
+const prefetch = 10
+
+// NATSConfig holds configuration for NATS.
+type NATSConfig struct {
+	// Logger logs failed deliveries and connection changes. Defaults to slog.Default.
+	Logger *slog.Logger
+	// URL is the address of the NATS servers, such as nats://localhost:4222. Separate several with commas.
+	URL string
+	// Name identifies the connection in the monitoring of the servers.
+	Name string
+	// Stream is the JetStream stream storing the messages, created if it does not exist. Defaults to app.
+	Stream string
+	// Subjects are the subjects stored in the stream. Defaults to the name of the stream followed by .>,
+	// such as app.>.
+	Subjects []string
+	// MaxAge is how long messages are kept in the stream. Defaults to 7 days.
+	MaxAge time.Duration
+	// AckWait is how long a handler has to handle a delivery before it is redelivered. Defaults to 30 seconds.
+	AckWait time.Duration
+	// Backoff is the delay before the first redelivery of a failed message, doubled for every further
+	// redelivery. Defaults to 1s.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between redeliveries. Defaults to 5 minutes.
+	MaxBackoff time.Duration
+}
+
+// NATS is a Broker backed by NATS JetStream. Consumer groups are durable consumers named after the group.
+type NATS struct {
+	conn      *nats.Conn
+	js        jetstream.JetStream
+	logger    *slog.Logger
+	ctx       context.Context
+	cancel    context.CancelFunc
+	consumers []jetstream.ConsumeContext
+	cfg       NATSConfig
+	mu        sync.Mutex
+	closed    bool
+}
+
+// NewNATS connects to the NATS servers of cfg and creates the stream if needed.
+func NewNATS(ctx context.Context, cfg NATSConfig) (*NATS, error) {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Stream == "" {
+		cfg.Stream = "app"
+	}
+	if len(cfg.Subjects) == 0 {
+		cfg.Subjects = []string{cfg.Stream + ".>"}
+	}
+	if cfg.MaxAge <= 0 {
+		cfg.MaxAge = 7 * 24 * time.Hour
+	}
+	if cfg.AckWait <= 0 {
+		cfg.AckWait = 30 * time.Second
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Second
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+	logger := cfg.Logger.With("component", "messaging")
+
+	conn, err := nats.Connect(cfg.URL,
+		nats.Name(cfg.Name),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				logger.Warn("disconnected from nats", "err", err)
+			}
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			logger.Info("reconnected to nats", "url", c.ConnectedUrlRedacted())
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to nats: %w", err)
+	}
+
+	js, err := jetstream.New(conn)
+	if err == nil {
+		_, err = js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+			Name:     cfg.Stream,
+			Subjects: cfg.Subjects,
+			MaxAge:   cfg.MaxAge,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("creating stream %s: %w", cfg.Stream, err)
+	}
+
+	// Handlers outlive the context of Subscribe, and are cancelled when Close gives up waiting for them
+	handlerCtx, cancel := context.WithCancel(context.Background())
+
+	return &NATS{
+		conn:   conn,
+		js:     js,
+		logger: logger,
+		ctx:    handlerCtx,
+		cancel: cancel,
+		cfg:    cfg,
+	}, nil
+}
+
+// Publish publishes msg to the stream. See Broker.
+func (n *NATS) Publish(ctx context.Context, msg Message) error {
+	m := nats.NewMsg(msg.Subject)
+	m.Data = msg.Data
+	for k, v := range msg.Header {
+		m.Header.Set(k, v)
+	}
+
+	var opts []jetstream.PublishOpt
+	if msg.ID != "" {
+		opts = append(opts, jetstream.WithMsgID(msg.ID))
+	}
+
+	_, err := n.js.PublishMsg(ctx, m, opts...)
+	outcome := "succeeded"
+	if err != nil {
+		outcome = "failed"
+	}
+	published.WithLabelValues(msg.Subject, outcome).Inc()
+
+	return err
+}
+
+// Subscribe starts a consumer. See Broker.
+func (n *NATS) Subscribe(ctx context.Context, sub Subscription, handler Handler) error {
+	if sub.Concurrency <= 0 {
+		sub.Concurrency = 1
+	}
+	if sub.MaxAttempts <= 0 {
+		sub.MaxAttempts = 10
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.closed {
+		return errors.New("the broker is closed")
+	}
+
+	cfg := jetstream.ConsumerConfig{
+		FilterSubject: sub.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       n.cfg.AckWait,
+		MaxDeliver:    sub.MaxAttempts,
+	}
+
+	var consumer jetstream.Consumer
+	var err error
+	if sub.Group != "" {
+		cfg.Durable = sub.Group
+		consumer, err = n.js.CreateOrUpdateConsumer(ctx, n.cfg.Stream, cfg)
+	} else {
+		// Consumers without a group receive the messages published from now on, and are removed by the server
+		// once they stop
+		cfg.DeliverPolicy = jetstream.DeliverNewPolicy
+		cfg.InactiveThreshold = time.Minute
+		consumer, err = n.js.CreateConsumer(ctx, n.cfg.Stream, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("creating consumer for %s: %w", sub.Subject, err)
+	}
+
+	for range sub.Concurrency {
+		cc, err := consumer.Consume(func(msg jetstream.Msg) {
+			n.deliver(sub, handler, msg)
+		}, jetstream.PullMaxMessages(prefetch))
+		if err != nil {
+			return fmt.Errorf("consuming %s: %w", sub.Subject, err)
+		}
+		n.consumers = append(n.consumers, cc)
+	}
+
+	return nil
+}
+
+// Ping checks that the connection is established with a round trip to the server. See Broker.
+func (n *NATS) Ping(ctx context.Context) error {
+	if status := n.conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("nats connection is %s", status)
+	}
+
+	// FlushWithContext requires a deadline
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+	}
+
+	return n.conn.FlushWithContext(ctx)
+}
+
+// Close drains the consumers, handling the messages they buffered, then closes the connection. See Broker.
+func (n *NATS) Close(ctx context.Context) error {
+	n.mu.Lock()
+	n.closed = true
+	consumers := n.consumers
+	n.consumers = nil
+	n.mu.Unlock()
+
+	for _, cc := range consumers {
+		cc.Drain()
+	}
+
+	var err error
+	for _, cc := range consumers {
+		select {
+		case <-cc.Closed():
+		case <-ctx.Done():
+			// The deliveries left unacknowledged are redelivered once their ack wait expires
+			err = ctx.Err()
+			n.cancel()
+			cc.Stop()
+		}
+	}
+	n.cancel()
+	n.conn.Close()
+
+	return err
+}
+
+// deliver handles a message received by the consumer of sub.
+func (n *NATS) deliver(sub Subscription, handler Handler, msg jetstream.Msg) {
+	attempt := 1
+	if meta, err := msg.Metadata(); err == nil {
+		attempt = int(meta.NumDelivered)
+	}
+
+	m := Message{Subject: msg.Subject(), Data: msg.Data()}
+	if h := msg.Headers(); len(h) > 0 {
+		m.Header = make(map[string]string, len(h))
+		for k := range h {
+			m.Header[k] = h.Get(k)
+		}
+		m.ID = h.Get(jetstream.MsgIDHeader)
+	}
+
+	ctx, cancel := context.WithTimeout(n.ctx, n.cfg.AckWait)
+	defer cancel()
+
+	d := NewDelivery(m, attempt, msg.Ack, msg.NakWithDelay)
+	Consume(ctx, n.logger, sub, handler, d, n.backoff(attempt))
+}
+
+// backoff returns the delay before redelivering a message that failed attempt.
+func (n *NATS) backoff(attempt int) time.Duration {
+	delay := n.cfg.Backoff
+	for i := 1; i < attempt && delay < n.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, n.cfg.MaxBackoff)
+
+	// Jitter spreads out redeliveries of messages that failed at the same time
+	return delay + mathrand.N(delay/4+1)
+}
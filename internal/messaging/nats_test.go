@@ -0,0 +1,251 @@
+package messaging
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// runServer starts an embedded NATS server with JetStream and returns its URL.
+func runServer(t *testing.T) string {
+	t.Helper()
+
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	return ns.ClientURL()
+}
+
+func newTestNATS(t *testing.T, url string) *NATS {
+	t.Helper()
+
+	n, err := NewNATS(t.Context(), NATSConfig{
+		Logger:     slog.New(slog.DiscardHandler),
+		URL:        url,
+		Stream:     "test",
+		Backoff:    time.Millisecond,
+		MaxBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = n.Close(context.Background()) })
+
+	return n
+}
+
+// receive subscribes to sub and returns a channel receiving the deliveries handled without error.
+func receive(t *testing.T, n *NATS, sub Subscription, fn Handler) <-chan Message {
+	t.Helper()
+
+	messages := make(chan Message, 100)
+	err := n.Subscribe(t.Context(), sub, func(ctx context.Context, d *Delivery) error {
+		if fn != nil {
+			err := fn(ctx, d)
+			if err != nil {
+				return err
+			}
+		}
+		messages <- d.Message
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return messages
+}
+
+func next(t *testing.T, messages <-chan Message) Message {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return Message{}
+	}
+}
+
+func none(t *testing.T, messages <-chan Message) {
+	t.Helper()
+
+	select {
+	case msg := <-messages:
+		t.Fatalf("unexpected message %s", msg.Data)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestNATS(t *testing.T) {
+	n := newTestNATS(t, runServer(t))
+	ctx := t.Context()
+
+	err := n.Ping(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created := receive(t, n, Subscription{Subject: "test.created", Group: "a"}, nil)
+	all := receive(t, n, Subscription{Subject: "test.>"}, nil)
+
+	err = n.Publish(ctx, Message{Subject: "test.created", ID: "1", Header: map[string]string{"Trace": "abc"}, Data: []byte("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = n.Publish(ctx, Message{Subject: "test.deleted", Data: []byte("two")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg := next(t, created)
+	if string(msg.Data) != "one" || msg.ID != "1" || msg.Header["Trace"] != "abc" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	none(t, created)
+
+	if msg := next(t, all); string(msg.Data) != "one" {
+		t.Errorf("expected one, got %s", msg.Data)
+	}
+	if msg := next(t, all); string(msg.Data) != "two" {
+		t.Errorf("expected two, got %s", msg.Data)
+	}
+
+	// Messages are deduplicated by ID
+	err = n.Publish(ctx, Message{Subject: "test.created", ID: "1", Data: []byte("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	none(t, created)
+}
+
+func TestNATSGroups(t *testing.T) {
+	url := runServer(t)
+	a, b := newTestNATS(t, url), newTestNATS(t, url)
+	ctx := t.Context()
+
+	// Replicas of a group share the messages
+	first := receive(t, a, Subscription{Subject: "test.created", Group: "shared"}, nil)
+	second := receive(t, b, Subscription{Subject: "test.created", Group: "shared"}, nil)
+
+	for range 10 {
+		err := a.Publish(ctx, Message{Subject: "test.created", Data: []byte("x")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	received := 0
+	for received < 10 {
+		select {
+		case <-first:
+		case <-second:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("received %d of 10 messages", received)
+		}
+		received++
+	}
+	none(t, first)
+	none(t, second)
+
+	// A group receives the messages published before it subscribed
+	late := receive(t, b, Subscription{Subject: "test.created", Group: "late"}, nil)
+	for range 10 {
+		next(t, late)
+	}
+}
+
+func TestNATSRedelivery(t *testing.T) {
+	n := newTestNATS(t, runServer(t))
+	ctx := t.Context()
+
+	var attempts atomic.Int32
+	messages := receive(t, n, Subscription{Subject: "test.created", Group: "retry"}, func(ctx context.Context, d *Delivery) error {
+		attempts.Add(1)
+		if d.Attempt < 3 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+
+	var dropped atomic.Int32
+	err := n.Subscribe(ctx, Subscription{Subject: "test.created", Group: "drop", MaxAttempts: 2}, func(ctx context.Context, d *Delivery) error {
+		dropped.Add(1)
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.Publish(ctx, Message{Subject: "test.created", Data: []byte("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next(t, messages)
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if got := dropped.Load(); got != 2 {
+		t.Errorf("expected 2 attempts before the message is dropped, got %d", got)
+	}
+}
+
+func TestNATSClose(t *testing.T) {
+	n := newTestNATS(t, runServer(t))
+	ctx := t.Context()
+
+	started := make(chan struct{})
+	var handled atomic.Bool
+	err := n.Subscribe(ctx, Subscription{Subject: "test.created", Group: "slow"}, func(ctx context.Context, d *Delivery) error {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		handled.Store(true)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = n.Publish(ctx, Message{Subject: "test.created", Data: []byte("one")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+
+	// Close waits for the delivery being handled
+	err = n.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !handled.Load() {
+		t.Error("expected the delivery to be handled before Close returned")
+	}
+
+	err = n.Subscribe(ctx, Subscription{Subject: "test.created"}, func(context.Context, *Delivery) error { return nil })
+	if err == nil {
+		t.Error("expected an error subscribing to a closed broker")
+	}
+}
@@ -0,0 +1,571 @@
+/*
+Package operations runs long-running work in the background for requests that cannot complete within a
+response timeout. A handler starts an operation and responds with 202 Accepted and the operation's location;
+clients then poll the operation for its status and progress, cancel it, and fetch its result once it succeeds.
+
+Operations are persisted in the "operations" collection of a store.Store, so they survive a restart and
+replicas sharing a store share the work: a worker claims a pending operation by updating its version, keeps
+the claim alive with a heartbeat while it runs, and operations whose heartbeat stops (because the process
+died) are claimed again once their lease expires. Each claim stores a token, so a worker whose lease expired
+notices the new claim, stops the operation and leaves its outcome to the new worker.
+*/
+package operations
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// Collection is the store collection holding operations.
+const Collection = "operations"
+
+// Status is the state of an operation.
+type Status string
+
+// Operation statuses. Succeeded, Failed and Cancelled are final.
+const (
+	Pending   Status = "pending"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+)
+
+// Done reports whether s is a final status.
+func (s Status) Done() bool {
+	return s == Succeeded || s == Failed || s == Cancelled
+}
+
+var (
+	// ErrUnknownType is returned when starting an operation of a type with no registered Func.
+	ErrUnknownType = errors.New("unknown operation type")
+	// ErrDone is returned when cancelling an operation that has already finished.
+	ErrDone = errors.New("operation has finished")
+	// ErrNotSucceeded is returned when fetching the result of an operation that has not succeeded.
+	ErrNotSucceeded = errors.New("operation has not succeeded")
+)
+
+var (
+	// errCancelled is the cancellation cause of operations cancelled by a client.
+	errCancelled = errors.New("operation cancelled")
+	// errLeaseLost cancels a run whose operation was claimed by another worker.
+	errLeaseLost = errors.New("operation claimed by another worker")
+)
+
+// Operation is the state of an operation as reported to clients.
+type Operation struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ID        string
+	Type      string
+	Status    Status
+	Message   string
+	// Error describes why a failed operation failed.
+	Error string
+	// Progress is the completed percentage, from 0 to 100.
+	Progress int
+}
+
+// state is the persisted form of an operation.
+type state struct {
+	Type    string `json:"type"`
+	Status  Status `json:"status"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Claim identifies the claim of the worker running the operation.
+	Claim           string          `json:"claim,omitempty"`
+	Input           json.RawMessage `json:"input,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	Progress        int             `json:"progress"`
+	CancelRequested bool            `json:"cancel_requested,omitempty"`
+}
+
+// Func performs an operation. It must return promptly once ctx is done, which happens when the operation is
+// cancelled or the process shuts down; an operation interrupted by a shutdown is run again from the start, so
+// Func should be safe to repeat. The returned value is stored as the JSON result of the operation.
+type Func func(ctx context.Context, task *Task) (any, error)
+
+// Task gives a running Func its input and lets it report progress.
+type Task struct {
+	message  string
+	ID       string
+	input    json.RawMessage
+	mu       sync.Mutex
+	progress int
+}
+
+// Decode decodes the input the operation was started with into v.
+func (t *Task) Decode(v any) error {
+	if len(t.input) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(t.input, v)
+}
+
+// Progress reports the completed percentage, clamped to 0-100, and a message describing the current step.
+// It is cheap to call often; progress is persisted with the next heartbeat.
+func (t *Task) Progress(percent int, message string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.progress = min(max(percent, 0), 100)
+	t.message = message
+}
+
+func (t *Task) current() (int, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.progress, t.message
+}
+
+// Config holds configuration for a Manager.
+type Config struct {
+	// Logger logs operation failures. Defaults to slog.Default.
+	Logger *slog.Logger
+	// Workers is the maximum number of operations run concurrently by this process. Defaults to 4.
+	Workers int
+	// PollInterval is how often the store is checked for pending operations started by other replicas.
+	// Operations started by this process are picked up immediately. Defaults to 2s.
+	PollInterval time.Duration
+	// Heartbeat is how often a running operation persists its progress and checks for cancellation. Defaults to 1s.
+	Heartbeat time.Duration
+	// Lease is how long a running operation may go without a heartbeat before another worker claims it.
+	// Defaults to 30s.
+	Lease time.Duration
+	// Retention is how long finished operations are kept. Defaults to 7 days.
+	Retention time.Duration
+}
+
+// Manager starts operations and runs them on a bounded pool of workers.
+type Manager struct {
+	logger     *slog.Logger
+	operations *store.Collection[state]
+	funcs      map[string]Func
+	running    map[string]context.CancelCauseFunc
+	wake       chan struct{}
+	cfg        Config
+	mu         sync.Mutex
+}
+
+// NewManager returns a Manager storing operations in s. Register the operation types before calling Run.
+func NewManager(s store.Store, cfg Config) *Manager {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 4
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 2 * time.Second
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = time.Second
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = 30 * time.Second
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = 7 * 24 * time.Hour
+	}
+
+	return &Manager{
+		logger:     cfg.Logger.With("component", "operations"),
+		operations: store.NewCollection[state](s, Collection),
+		funcs:      map[string]Func{},
+		running:    map[string]context.CancelCauseFunc{},
+		wake:       make(chan struct{}, 1),
+		cfg:        cfg,
+	}
+}
+
+// Register sets the Func that performs operations of type kind. Every replica sharing a store must register
+// the same types.
+func (m *Manager) Register(kind string, fn Func) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.funcs[kind] = fn
+}
+
+// Start queues an operation of type kind. The input is encoded as JSON and passed to the Func with Task.Decode.
+func (m *Manager) Start(ctx context.Context, kind string, input any) (Operation, error) {
+	m.mu.Lock()
+	_, ok := m.funcs[kind]
+	m.mu.Unlock()
+	if !ok {
+		return Operation{}, fmt.Errorf("%w %q", ErrUnknownType, kind)
+	}
+
+	var data json.RawMessage
+	if input != nil {
+		var err error
+		data, err = json.Marshal(input)
+		if err != nil {
+			return Operation{}, err
+		}
+	}
+
+	doc, err := m.operations.Create(ctx, state{Type: kind, Status: Pending, Input: data})
+	if err != nil {
+		return Operation{}, err
+	}
+	m.notify()
+
+	return toOperation(doc), nil
+}
+
+// Get returns the operation with id or store.ErrNotFound.
+func (m *Manager) Get(ctx context.Context, id string) (Operation, error) {
+	doc, err := m.operations.Get(ctx, id)
+	if err != nil {
+		return Operation{}, err
+	}
+
+	return toOperation(doc), nil
+}
+
+// Result returns a succeeded operation and its JSON result. It returns ErrNotSucceeded with the operation if
+// the operation has not succeeded.
+func (m *Manager) Result(ctx context.Context, id string) (Operation, json.RawMessage, error) {
+	doc, err := m.operations.Get(ctx, id)
+	if err != nil {
+		return Operation{}, nil, err
+	}
+
+	if doc.Value.Status != Succeeded {
+		return toOperation(doc), nil, ErrNotSucceeded
+	}
+
+	return toOperation(doc), doc.Value.Result, nil
+}
+
+// Cancel cancels an operation. A pending operation is cancelled immediately; a running one is cancelled
+// once its Func returns. It returns ErrDone if the operation has already finished.
+func (m *Manager) Cancel(ctx context.Context, id string) (Operation, error) {
+	doc, err := m.update(ctx, id, func(s *state) error {
+		switch {
+		case s.Status.Done():
+			return ErrDone
+		case s.Status == Pending:
+			s.Status = Cancelled
+		default:
+			s.CancelRequested = true
+			s.Message = "cancelling"
+		}
+		return nil
+	})
+	if err != nil {
+		return toOperation(doc), err
+	}
+
+	// Operations running on other replicas notice the request with their next heartbeat
+	m.mu.Lock()
+	cancel, ok := m.running[id]
+	m.mu.Unlock()
+	if ok {
+		cancel(errCancelled)
+	}
+
+	return toOperation(doc), nil
+}
+
+// Run runs queued operations until ctx is done, then waits for the running operations to return.
+// Operations interrupted by ctx are queued again so they run after a restart.
+func (m *Manager) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, m.cfg.Workers)
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+
+	var lastCleanup time.Time
+	for {
+		if free := cap(slots) - len(slots); free > 0 {
+			docs, err := m.claimable(ctx, free)
+			if err != nil && ctx.Err() == nil {
+				m.logger.Error("listing operations", "err", err)
+			}
+
+			for _, doc := range docs {
+				doc, ok := m.claim(ctx, doc)
+				if !ok {
+					continue
+				}
+
+				slots <- struct{}{}
+				wg.Go(func() {
+					defer func() {
+						<-slots
+						m.notify()
+					}()
+					m.execute(ctx, doc)
+				})
+			}
+		}
+
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			m.cleanup(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+// notify wakes Run to look for operations to claim.
+func (m *Manager) notify() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// claimable returns up to limit operations that are pending or whose lease has expired, oldest first.
+func (m *Manager) claimable(ctx context.Context, limit int) ([]store.Document[state], error) {
+	docs, err := m.operations.List(ctx, store.Query{
+		Filters: []store.Filter{{Field: "status", Op: store.OpEq, Value: string(Pending)}},
+		Limit:   limit,
+	})
+	if err != nil || len(docs) == limit {
+		return docs, err
+	}
+
+	abandoned, err := m.operations.List(ctx, store.Query{
+		Filters: []store.Filter{
+			{Field: "status", Op: store.OpEq, Value: string(Running)},
+			{Field: store.FieldUpdatedAt, Op: store.OpLt, Value: time.Now().Add(-m.cfg.Lease)},
+		},
+		Limit: limit - len(docs),
+	})
+
+	return append(docs, abandoned...), err
+}
+
+// claim marks an operation as running by this worker. It returns false if another worker claimed it first.
+func (m *Manager) claim(ctx context.Context, doc store.Document[state]) (store.Document[state], bool) {
+	s := doc.Value
+	if s.Status == Running {
+		m.logger.Warn("resuming abandoned operation", "id", doc.ID, "type", s.Type)
+	}
+	s.Status = Running
+	s.Claim = rand.Text()
+
+	claimed, err := m.operations.Update(ctx, doc.ID, doc.Version, s)
+	if err != nil {
+		if !errors.Is(err, store.ErrConflict) && ctx.Err() == nil {
+			m.logger.Error("claiming operation", "id", doc.ID, "err", err)
+		}
+		return doc, false
+	}
+
+	return claimed, true
+}
+
+// execute runs a claimed operation and stores its outcome.
+func (m *Manager) execute(ctx context.Context, doc store.Document[state]) {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	m.mu.Lock()
+	fn := m.funcs[doc.Value.Type]
+	m.running[doc.ID] = cancel
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.running, doc.ID)
+		m.mu.Unlock()
+	}()
+
+	if doc.Value.CancelRequested {
+		cancel(errCancelled)
+	}
+
+	task := &Task{ID: doc.ID, input: doc.Value.Input, progress: doc.Value.Progress, message: doc.Value.Message}
+	stopped := make(chan struct{})
+	heartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeat)
+		m.heartbeat(runCtx, doc.ID, doc.Value.Claim, task, cancel, stopped)
+	}()
+
+	var (
+		result any
+		err    error
+	)
+	if fn == nil {
+		err = fmt.Errorf("%w %q", ErrUnknownType, doc.Value.Type)
+	} else {
+		result, err = run(runCtx, fn, task)
+	}
+	close(stopped)
+	<-heartbeat
+
+	if errors.Is(context.Cause(runCtx), errLeaseLost) {
+		m.logger.Warn("operation lease expired before it finished, it may have run twice", "id", doc.ID, "type", doc.Value.Type)
+		return
+	}
+
+	// The outcome is stored even if the process is shutting down
+	storeCtx := context.WithoutCancel(ctx)
+	_, updateErr := m.update(storeCtx, doc.ID, func(s *state) error {
+		if s.Claim != doc.Value.Claim {
+			return errLeaseLost
+		}
+		s.Claim = ""
+		s.Progress, s.Message = task.current()
+
+		switch {
+		case errors.Is(context.Cause(runCtx), errCancelled):
+			s.Status = Cancelled
+			s.Message = "cancelled"
+		case ctx.Err() != nil:
+			// Interrupted by a shutdown, run again later
+			s.Status = Pending
+		case err != nil:
+			s.Status = Failed
+			s.Error = err.Error()
+		default:
+			data, marshalErr := json.Marshal(result)
+			if marshalErr != nil {
+				s.Status = Failed
+				s.Error = "encoding result: " + marshalErr.Error()
+				break
+			}
+			s.Status = Succeeded
+			s.Result = data
+			s.Progress = 100
+		}
+		return nil
+	})
+	if errors.Is(updateErr, errLeaseLost) {
+		m.logger.Warn("operation lease expired before it finished, it may have run twice", "id", doc.ID, "type", doc.Value.Type)
+	} else if updateErr != nil {
+		m.logger.Error("storing operation outcome", "id", doc.ID, "err", updateErr)
+	}
+	if err != nil && runCtx.Err() == nil {
+		m.logger.Warn("operation failed", "id", doc.ID, "type", doc.Value.Type, "err", err)
+	}
+}
+
+// run calls fn, turning a panic into an error so it fails the operation instead of the process.
+func run(ctx context.Context, fn Func, task *Task) (result any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return fn(ctx, task)
+}
+
+// heartbeat persists the progress of a running operation until stopped is closed, renewing the lease of claim.
+// It cancels the operation if a client requested cancellation from another replica, or if another worker
+// claimed it after the lease expired.
+func (m *Manager) heartbeat(ctx context.Context, id, claim string, task *Task, cancel context.CancelCauseFunc, stopped <-chan struct{}) {
+	ticker := time.NewTicker(m.cfg.Heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+
+		doc, err := m.update(context.WithoutCancel(ctx), id, func(s *state) error {
+			if s.Claim != claim {
+				return errLeaseLost
+			}
+			s.Progress, s.Message = task.current()
+			return nil
+		})
+		if errors.Is(err, errLeaseLost) {
+			cancel(errLeaseLost)
+			return
+		}
+		if err != nil {
+			m.logger.Error("recording operation heartbeat", "id", id, "err", err)
+			continue
+		}
+		if doc.Value.CancelRequested {
+			cancel(errCancelled)
+		}
+	}
+}
+
+// cleanup deletes operations that finished before the retention period.
+func (m *Manager) cleanup(ctx context.Context) {
+	docs, err := m.operations.List(ctx, store.Query{
+		Filters: []store.Filter{
+			{Field: "status", Op: store.OpNe, Value: string(Pending)},
+			{Field: "status", Op: store.OpNe, Value: string(Running)},
+			{Field: store.FieldUpdatedAt, Op: store.OpLt, Value: time.Now().Add(-m.cfg.Retention)},
+		},
+		Limit: 100,
+	})
+	if err != nil {
+		if ctx.Err() == nil {
+			m.logger.Error("listing expired operations", "err", err)
+		}
+		return
+	}
+
+	for _, doc := range docs {
+		err = m.operations.Delete(ctx, doc.ID, doc.Version)
+		if err != nil && !errors.Is(err, store.ErrConflict) && !errors.Is(err, store.ErrNotFound) {
+			m.logger.Error("deleting expired operation", "id", doc.ID, "err", err)
+		}
+	}
+}
+
+// update applies fn to the stored state of an operation, retrying if the operation changes concurrently.
+// If fn returns an error the operation is not updated and the error is returned with the current document.
+func (m *Manager) update(ctx context.Context, id string, fn func(s *state) error) (store.Document[state], error) {
+	for {
+		doc, err := m.operations.Get(ctx, id)
+		if err != nil {
+			return doc, err
+		}
+
+		err = fn(&doc.Value)
+		if err != nil {
+			return doc, err
+		}
+
+		updated, err := m.operations.Update(ctx, id, doc.Version, doc.Value)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+
+		return updated, err
+	}
+}
+
+func toOperation(doc store.Document[state]) Operation {
+	return Operation{
+		ID:        doc.ID,
+		Type:      doc.Value.Type,
+		Status:    doc.Value.Status,
+		Progress:  doc.Value.Progress,
+		Message:   doc.Value.Message,
+		Error:     doc.Value.Error,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}
+}
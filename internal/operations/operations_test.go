@@ -0,0 +1,327 @@
+package operations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// testConfig makes operations run and heartbeat quickly.
+var testConfig = Config{
+	Logger:       slog.New(slog.DiscardHandler),
+	Workers:      2,
+	PollInterval: 10 * time.Millisecond,
+	Heartbeat:    10 * time.Millisecond,
+}
+
+// startManager runs m until the test ends.
+func startManager(t *testing.T, m *Manager) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// waitFor polls an operation until cond is true for it.
+func waitFor(t *testing.T, m *Manager, id string, cond func(Operation) bool) Operation {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		op, err := m.Get(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cond(op) {
+			return op
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for operation: %+v", op)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func isDone(op Operation) bool {
+	return op.Status.Done()
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(store.NewMemory(), testConfig)
+	m.Register("sum", func(ctx context.Context, task *Task) (any, error) {
+		var input []int
+		err := task.Decode(&input)
+		if err != nil {
+			return nil, err
+		}
+
+		sum := 0
+		for i, n := range input {
+			sum += n
+			task.Progress((i+1)*100/len(input), "adding")
+		}
+		return sum, nil
+	})
+	m.Register("fail", func(ctx context.Context, task *Task) (any, error) {
+		return nil, errors.New("boom")
+	})
+	m.Register("panic", func(ctx context.Context, task *Task) (any, error) {
+		panic("boom")
+	})
+	startManager(t, m)
+
+	_, err := m.Start(ctx, "unknown", nil)
+	if !errors.Is(err, ErrUnknownType) {
+		t.Errorf("unexpected error starting an unknown type: got %v want %v", err, ErrUnknownType)
+	}
+
+	tests := []struct {
+		input        any
+		name         string
+		kind         string
+		expectError  string
+		expectResult string
+		expectStatus Status
+	}{
+		{name: "succeeded", kind: "sum", input: []int{1, 2, 3}, expectStatus: Succeeded, expectResult: "6"},
+		{name: "invalid input", kind: "sum", input: "x", expectStatus: Failed, expectError: "json: cannot unmarshal string into Go value of type []int"},
+		{name: "failed", kind: "fail", expectStatus: Failed, expectError: "boom"},
+		{name: "panicked", kind: "panic", expectStatus: Failed, expectError: "panic: boom"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op, err := m.Start(ctx, test.kind, test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if op.Status != Pending || op.Type != test.kind {
+				t.Errorf("unexpected started operation: %+v", op)
+			}
+
+			op = waitFor(t, m, op.ID, isDone)
+			if op.Status != test.expectStatus || op.Error != test.expectError {
+				t.Errorf("unexpected outcome: got %s %q want %s %q", op.Status, op.Error, test.expectStatus, test.expectError)
+			}
+
+			_, result, err := m.Result(ctx, op.ID)
+			if test.expectStatus != Succeeded {
+				if !errors.Is(err, ErrNotSucceeded) {
+					t.Errorf("unexpected result error: got %v want %v", err, ErrNotSucceeded)
+				}
+				return
+			}
+			if err != nil || string(result) != test.expectResult || op.Progress != 100 {
+				t.Errorf("unexpected result: got %s %d %v want %s 100", result, op.Progress, err, test.expectResult)
+			}
+
+			_, err = m.Cancel(ctx, op.ID)
+			if !errors.Is(err, ErrDone) {
+				t.Errorf("unexpected error cancelling a finished operation: got %v want %v", err, ErrDone)
+			}
+		})
+	}
+
+	_, err = m.Get(ctx, "missing")
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unexpected error getting a missing operation: got %v want %v", err, store.ErrNotFound)
+	}
+}
+
+func TestManagerCancel(t *testing.T) {
+	ctx := context.Background()
+	cfg := testConfig
+	cfg.Workers = 1
+	m := NewManager(store.NewMemory(), cfg)
+	m.Register("wait", func(ctx context.Context, task *Task) (any, error) {
+		task.Progress(50, "waiting")
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	startManager(t, m)
+
+	running, err := m.Start(ctx, "wait", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := waitFor(t, m, running.ID, func(op Operation) bool { return op.Progress == 50 })
+	if op.Status != Running || op.Message != "waiting" {
+		t.Errorf("unexpected progress: %+v", op)
+	}
+
+	// The only worker is busy, so this operation stays pending
+	pending, err := m.Start(ctx, "wait", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op, err = m.Cancel(ctx, pending.ID)
+	if err != nil || op.Status != Cancelled {
+		t.Errorf("unexpected result cancelling a pending operation: got %s, %v want %s", op.Status, err, Cancelled)
+	}
+
+	op, err = m.Cancel(ctx, running.ID)
+	if err != nil || op.Status != Running {
+		t.Errorf("unexpected result cancelling a running operation: got %s, %v want %s", op.Status, err, Running)
+	}
+	op = waitFor(t, m, running.ID, isDone)
+	if op.Status != Cancelled || op.Error != "" {
+		t.Errorf("unexpected outcome of a cancelled operation: %+v", op)
+	}
+}
+
+func TestManagerConcurrency(t *testing.T) {
+	ctx := context.Background()
+	m := NewManager(store.NewMemory(), testConfig)
+
+	var current, peak atomic.Int32
+	m.Register("work", func(ctx context.Context, task *Task) (any, error) {
+		n := current.Add(1)
+		defer current.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil
+	})
+	startManager(t, m)
+
+	var ids []string
+	for range 6 {
+		op, err := m.Start(ctx, "work", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, op.ID)
+	}
+	for _, id := range ids {
+		op := waitFor(t, m, id, isDone)
+		if op.Status != Succeeded {
+			t.Errorf("unexpected outcome: %+v", op)
+		}
+	}
+
+	if peak.Load() != int32(testConfig.Workers) {
+		t.Errorf("unexpected peak concurrency: got %d want %d", peak.Load(), testConfig.Workers)
+	}
+}
+
+func TestManagerRestart(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+
+	// A shutdown interrupts the running operation and queues it again
+	first := NewManager(s, testConfig)
+	started := make(chan struct{})
+	first.Register("resume", func(ctx context.Context, task *Task) (any, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	runCtx, stop := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		first.Run(runCtx)
+	}()
+
+	interrupted, err := first.Start(ctx, "resume", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	stop()
+	<-done
+
+	op, err := first.Get(ctx, interrupted.ID)
+	if err != nil || op.Status != Pending {
+		t.Errorf("unexpected status after shutdown: got %s, %v want %s", op.Status, err, Pending)
+	}
+
+	// An operation left running by a process that died is claimed once its lease expires
+	operations := store.NewCollection[state](s, Collection)
+	abandoned, err := operations.Create(ctx, state{Type: "resume", Status: Running, Input: json.RawMessage(`"abandoned"`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig
+	cfg.Lease = 50 * time.Millisecond
+	second := NewManager(s, cfg)
+	second.Register("resume", func(ctx context.Context, task *Task) (any, error) {
+		var input string
+		err := task.Decode(&input)
+		return input, err
+	})
+	startManager(t, second)
+
+	for id, expect := range map[string]string{interrupted.ID: `""`, abandoned.ID: `"abandoned"`} {
+		op := waitFor(t, second, id, isDone)
+		_, result, err := second.Result(ctx, id)
+		if op.Status != Succeeded || err != nil || string(result) != expect {
+			t.Errorf("unexpected outcome of resumed operation: got %s %s, %v want %s %s", op.Status, result, err, Succeeded, expect)
+		}
+	}
+}
+
+func TestManagerLeaseLost(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemory()
+	m := NewManager(s, testConfig)
+	causes := make(chan error, 1)
+	m.Register("slow", func(ctx context.Context, task *Task) (any, error) {
+		<-ctx.Done()
+		causes <- context.Cause(ctx)
+		return nil, ctx.Err()
+	})
+	startManager(t, m)
+
+	op, err := m.Start(ctx, "slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, m, op.ID, func(op Operation) bool { return op.Status == Running })
+
+	// Another worker claims the operation, as if the lease of this one had expired
+	operations := store.NewCollection[state](s, Collection)
+	_, err = m.update(ctx, op.ID, func(s *state) error {
+		s.Claim = "other"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case cause := <-causes:
+		if !errors.Is(cause, errLeaseLost) {
+			t.Errorf("unexpected cancellation cause: got %v want %v", cause, errLeaseLost)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("operation was not cancelled")
+	}
+
+	// The outcome is left to the worker holding the claim
+	time.Sleep(50 * time.Millisecond)
+	doc, err := operations.Get(ctx, op.ID)
+	if err != nil || doc.Value.Status != Running || doc.Value.Claim != "other" {
+		t.Errorf("unexpected state after the lease was lost: %+v, %v", doc.Value, err)
+	}
+}
@@ -0,0 +1,353 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Operation is a JSON Patch operation. Value is kept as raw JSON so that a null value is preserved.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// DecodeJSONPatch decodes and checks the operations of an RFC 6902 JSON Patch document.
+func DecodeJSONPatch(data []byte) ([]Operation, error) {
+	var ops []Operation
+	err := json.Unmarshal(data, &ops)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON patch: %w", err)
+	}
+
+	for i, op := range ops {
+		err := op.check()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON patch: operation %d: %w", i, err)
+		}
+	}
+
+	return ops, nil
+}
+
+func (op Operation) check() error {
+	_, err := parsePointer(op.Path)
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%s requires a value", op.Op)
+		}
+	case "move", "copy":
+		_, err := parsePointer(op.From)
+		if err != nil {
+			return fmt.Errorf("from: %w", err)
+		}
+	case "remove":
+	default:
+		return fmt.Errorf("unknown op %q", op.Op)
+	}
+
+	return nil
+}
+
+// Apply applies JSON Patch operations to doc in order. The patch is atomic: if any operation fails the error is
+// returned and doc is unchanged. A failed test operation returns ErrTestFailed.
+func Apply(doc []byte, ops []Operation) ([]byte, error) {
+	var target any
+	err := json.Unmarshal(doc, &target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid document: %w", err)
+	}
+
+	for i, op := range ops {
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+func (op Operation) apply(doc any) (any, error) {
+	err := op.check()
+	if err != nil {
+		return nil, err
+	}
+
+	path, _ := parsePointer(op.Path)
+	from, _ := parsePointer(op.From)
+
+	var value any
+	if op.Value != nil {
+		err := json.Unmarshal(op.Value, &value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value: %w", err)
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return add(doc, path, value)
+	case "remove":
+		return remove(doc, path)
+	case "replace":
+		doc, err := remove(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "move":
+		if len(path) > len(from) && slices.Equal(path[:len(from)], from) {
+			return nil, fmt.Errorf("cannot move %q into itself", op.From)
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		doc, err = remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+	case "copy":
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, clone(value))
+	case "test":
+		current, err := get(doc, path)
+		if err != nil || !reflect.DeepEqual(current, value) {
+			return nil, fmt.Errorf("%w: %s", ErrTestFailed, op.Path)
+		}
+		return doc, nil
+	}
+
+	return nil, fmt.Errorf("unknown op %q", op.Op)
+}
+
+// Diff returns the JSON Patch operations that change before into after. Objects are compared member by member,
+// while arrays that differ are replaced as a whole.
+func Diff(before, after any) ([]Operation, error) {
+	b, a, err := decodePair(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	ops := []Operation{}
+	return diff(ops, "", b, a)
+}
+
+func diff(ops []Operation, path string, before, after any) ([]Operation, error) {
+	if reflect.DeepEqual(before, after) {
+		return ops, nil
+	}
+
+	b, bok := before.(map[string]any)
+	a, aok := after.(map[string]any)
+	if !bok || !aok {
+		value, err := json.Marshal(after)
+		return append(ops, Operation{Op: "replace", Path: path, Value: value}), err
+	}
+
+	var err error
+	for _, name := range sortedKeys(b) {
+		if _, ok := a[name]; !ok {
+			ops = append(ops, Operation{Op: "remove", Path: path + "/" + escapeToken(name)})
+		}
+	}
+	for _, name := range sortedKeys(a) {
+		child := path + "/" + escapeToken(name)
+		previous, ok := b[name]
+		if !ok {
+			value, err := json.Marshal(a[name])
+			if err != nil {
+				return nil, err
+			}
+			ops = append(ops, Operation{Op: "add", Path: child, Value: value})
+			continue
+		}
+
+		ops, err = diff(ops, child, previous, a[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ops, nil
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func escapeToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]any:
+			value, ok := node[token]
+			if !ok {
+				return nil, pathError(path)
+			}
+			doc = value
+		case []any:
+			i, err := index(token, len(node)-1)
+			if err != nil {
+				return nil, pathError(path)
+			}
+			doc = node[i]
+		default:
+			return nil, pathError(path)
+		}
+	}
+
+	return doc, nil
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			node[token] = value
+			return node, nil
+		case []any:
+			if token == "-" {
+				return append(node, value), nil
+			}
+			i, err := index(token, len(node))
+			if err != nil {
+				return nil, pathError(path)
+			}
+			return slices.Insert(node, i, value), nil
+		}
+
+		return nil, pathError(path)
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	return update(doc, path, func(parent any, token string) (any, error) {
+		switch node := parent.(type) {
+		case map[string]any:
+			if _, ok := node[token]; !ok {
+				return nil, pathError(path)
+			}
+			delete(node, token)
+			return node, nil
+		case []any:
+			i, err := index(token, len(node)-1)
+			if err != nil {
+				return nil, pathError(path)
+			}
+			return slices.Delete(node, i, i+1), nil
+		}
+
+		return nil, pathError(path)
+	})
+}
+
+// update walks to the parent of the last token of path and replaces it with the result of fn,
+// since adding to or removing from an array returns a new slice.
+func update(doc any, path []string, fn func(parent any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	child, err := get(doc, path[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = update(child, path[1:], fn)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := doc.(type) {
+	case map[string]any:
+		node[path[0]] = child
+	case []any:
+		i, _ := index(path[0], len(node)-1)
+		node[i] = child
+	}
+
+	return doc, nil
+}
+
+// index parses an array index token, which must be between 0 and upper.
+func index(token string, upper int) (int, error) {
+	if token != "0" && strings.HasPrefix(token, "0") {
+		return 0, errors.New("array indexes cannot have leading zeros")
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > upper {
+		return 0, errors.New("array index out of range")
+	}
+
+	return i, nil
+}
+
+func pathError(path []string) error {
+	pointer := ""
+	for _, token := range path {
+		pointer += "/" + escapeToken(token)
+	}
+
+	return fmt.Errorf("path %q does not exist", pointer)
+}
+
+func clone(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(v))
+		for name, child := range v {
+			c[name] = clone(child)
+		}
+		return c
+	case []any:
+		c := make([]any, len(v))
+		for i, child := range v {
+			c[i] = clone(child)
+		}
+		return c
+	}
+
+	return value
+}
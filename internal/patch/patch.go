@@ -0,0 +1,123 @@
+// Package patch implements JSON Merge Patch (RFC 7396) and JSON Patch (RFC 6902) for partial updates,
+// both applying patches to JSON documents and creating patches from the difference between two values.
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+)
+
+// Media types of patch documents.
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrTestFailed is returned by Apply when a test operation does not match the document.
+var ErrTestFailed = errors.New("test operation failed")
+
+// Merge applies an RFC 7396 merge patch to doc. Members of the patch replace those of doc,
+// null members remove them, and a patch that is not an object replaces doc entirely.
+func Merge(doc, patch []byte) ([]byte, error) {
+	var target, p any
+	err := json.Unmarshal(patch, &p)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge patch: %w", err)
+	}
+
+	if len(doc) > 0 {
+		err = json.Unmarshal(doc, &target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid document: %w", err)
+		}
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+			continue
+		}
+		t[name] = merge(t[name], value)
+	}
+
+	return t
+}
+
+// CreateMerge returns a merge patch that changes before into after. Both are encoded as JSON first, so
+// fields omitted from after's encoding are removed by the patch.
+func CreateMerge(before, after any) ([]byte, error) {
+	b, a, err := decodePair(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(diffMerge(b, a))
+}
+
+func diffMerge(before, after any) any {
+	b, bok := before.(map[string]any)
+	a, aok := after.(map[string]any)
+	if !bok || !aok {
+		return after
+	}
+
+	patch := map[string]any{}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			patch[name] = nil
+		}
+	}
+	for name, value := range a {
+		previous, ok := b[name]
+		switch {
+		case !ok:
+			patch[name] = value
+		case !reflect.DeepEqual(previous, value):
+			// A null value in after removes the member, since merge patches cannot set null
+			patch[name] = diffMerge(previous, value)
+		}
+	}
+
+	return patch
+}
+
+// decodePair encodes before and after as JSON and decodes them into generic values to compare.
+func decodePair(before, after any) (any, any, error) {
+	var values [2]any
+	for i, v := range []any{before, after} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = json.Unmarshal(data, &values[i])
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return values[0], values[1], nil
+}
+
+// sortedKeys returns the keys of m in order, so created patches are deterministic.
+func sortedKeys(m map[string]any) []string {
+	return slices.Sorted(maps.Keys(m))
+}
@@ -0,0 +1,188 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	// Examples from RFC 7396 appendix A
+	tests := []struct {
+		doc      string
+		patch    string
+		expected string
+	}{
+		{doc: `{"a":"b"}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"b":"c"}`, expected: `{"a":"b","b":"c"}`},
+		{doc: `{"a":"b"}`, patch: `{"a":null}`, expected: `{}`},
+		{doc: `{"a":"b","b":"c"}`, patch: `{"a":null}`, expected: `{"b":"c"}`},
+		{doc: `{"a":["b"]}`, patch: `{"a":"c"}`, expected: `{"a":"c"}`},
+		{doc: `{"a":"c"}`, patch: `{"a":["b"]}`, expected: `{"a":["b"]}`},
+		{doc: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, expected: `{"a":{"b":"d"}}`},
+		{doc: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, expected: `{"a":[1]}`},
+		{doc: `["a","b"]`, patch: `["c","d"]`, expected: `["c","d"]`},
+		{doc: `{"a":"b"}`, patch: `["c"]`, expected: `["c"]`},
+		{doc: `{"a":"foo"}`, patch: `null`, expected: `null`},
+		{doc: `{"a":"foo"}`, patch: `"bar"`, expected: `"bar"`},
+		{doc: `{"e":null}`, patch: `{"a":1}`, expected: `{"a":1,"e":null}`},
+		{doc: `[1,2]`, patch: `{"a":"b","c":null}`, expected: `{"a":"b"}`},
+		{doc: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, expected: `{"a":{"bb":{}}}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.patch, func(t *testing.T) {
+			got, err := Merge([]byte(test.doc), []byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, test.expected)
+		})
+	}
+
+	_, err := Merge([]byte(`{}`), []byte(`{`))
+	if err == nil {
+		t.Error("expected an error for an invalid patch")
+	}
+}
+
+func TestApply(t *testing.T) {
+	// Examples from RFC 6902 appendix A
+	tests := []struct {
+		err      error
+		name     string
+		doc      string
+		patch    string
+		expected string
+	}{
+		{name: "add member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz","value":"qux"}]`, expected: `{"baz":"qux","foo":"bar"}`},
+		{name: "add array element", doc: `{"foo":["bar","baz"]}`, patch: `[{"op":"add","path":"/foo/1","value":"qux"}]`, expected: `{"foo":["bar","qux","baz"]}`},
+		{name: "remove member", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"remove","path":"/baz"}]`, expected: `{"foo":"bar"}`},
+		{name: "remove array element", doc: `{"foo":["bar","qux","baz"]}`, patch: `[{"op":"remove","path":"/foo/1"}]`, expected: `{"foo":["bar","baz"]}`},
+		{name: "replace", doc: `{"baz":"qux","foo":"bar"}`, patch: `[{"op":"replace","path":"/baz","value":"boo"}]`, expected: `{"baz":"boo","foo":"bar"}`},
+		{name: "move member", doc: `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, patch: `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, expected: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{name: "move array element", doc: `{"foo":["all","grass","cows","eat"]}`, patch: `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, expected: `{"foo":["all","cows","eat","grass"]}`},
+		{name: "test", doc: `{"baz":"qux","foo":["a",2,"c"]}`, patch: `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`, expected: `{"baz":"qux","foo":["a",2,"c"]}`},
+		{name: "test failure", doc: `{"baz":"qux"}`, patch: `[{"op":"test","path":"/baz","value":"bar"}]`, err: ErrTestFailed},
+		{name: "add nested member", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, expected: `{"foo":"bar","child":{"grandchild":{}}}`},
+		{name: "add to nonexistent target", doc: `{"foo":"bar"}`, patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`, err: errAny},
+		{name: "escape ordering", doc: `{"/":9,"~1":10}`, patch: `[{"op":"test","path":"/~01","value":10}]`, expected: `{"/":9,"~1":10}`},
+		{name: "add array value", doc: `{"foo":["bar"]}`, patch: `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, expected: `{"foo":["bar",["abc","def"]]}`},
+		{name: "add null", doc: `{}`, patch: `[{"op":"add","path":"/a","value":null}]`, expected: `{"a":null}`},
+		{name: "copy", doc: `{"a":{"b":1}}`, patch: `[{"op":"copy","from":"/a","path":"/c"},{"op":"replace","path":"/c/b","value":2}]`, expected: `{"a":{"b":1},"c":{"b":2}}`},
+		{name: "replace root", doc: `{"a":1}`, patch: `[{"op":"replace","path":"","value":[1]}]`, expected: `[1]`},
+		{name: "remove missing member", doc: `{}`, patch: `[{"op":"remove","path":"/a"}]`, err: errAny},
+		{name: "index out of range", doc: `{"a":[1]}`, patch: `[{"op":"add","path":"/a/2","value":1}]`, err: errAny},
+		{name: "leading zero index", doc: `{"a":[1,2]}`, patch: `[{"op":"remove","path":"/a/01"}]`, err: errAny},
+		{name: "move into child", doc: `{"a":{"b":{}}}`, patch: `[{"op":"move","from":"/a","path":"/a/b/c"}]`, err: errAny},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops, err := DecodeJSONPatch([]byte(test.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := Apply([]byte(test.doc), ops)
+			switch {
+			case test.err == errAny && err != nil:
+			case test.err != nil && !errors.Is(err, test.err):
+				t.Errorf("unexpected error: got %v want %v", err, test.err)
+			case test.err == nil && err != nil:
+				t.Fatal(err)
+			case test.err == nil:
+				assertJSON(t, got, test.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeJSONPatch(t *testing.T) {
+	for _, patch := range []string{
+		`{"op":"add","path":"/a","value":1}`,
+		`[{"op":"add","path":"/a"}]`,
+		`[{"op":"remove","path":"a"}]`,
+		`[{"op":"delete","path":"/a"}]`,
+	} {
+		_, err := DecodeJSONPatch([]byte(patch))
+		if err == nil {
+			t.Errorf("expected an error decoding %s", patch)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	type widget struct {
+		Description *string  `json:"description,omitempty"`
+		Dimensions  any      `json:"dimensions,omitempty"`
+		Name        string   `json:"name"`
+		Tags        []string `json:"tags,omitempty"`
+	}
+
+	description := "A small widget"
+	tests := []struct {
+		name   string
+		before widget
+		after  widget
+	}{
+		{name: "unchanged", before: widget{Name: "a"}, after: widget{Name: "a"}},
+		{name: "changed", before: widget{Name: "a", Tags: []string{"x"}}, after: widget{Name: "b", Tags: []string{"x", "y"}}},
+		{name: "added", before: widget{Name: "a"}, after: widget{Name: "a", Description: &description}},
+		{name: "removed", before: widget{Name: "a", Description: &description}, after: widget{Name: "a"}},
+		{name: "nested", before: widget{Dimensions: map[string]any{"w": 1, "h": 2}}, after: widget{Dimensions: map[string]any{"w": 3, "d": 4, "a/b~": 5}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before, _ := json.Marshal(test.before)
+			after, _ := json.Marshal(test.after)
+
+			merge, err := CreateMerge(test.before, test.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Merge(before, merge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, string(after))
+
+			ops, err := Diff(test.before, test.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err = Apply(before, ops)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, string(after))
+
+			if test.name == "unchanged" && (string(merge) != "{}" || len(ops) != 0) {
+				t.Errorf("unexpected patches for an unchanged value: %s %v", merge, ops)
+			}
+		})
+	}
+}
+
+// errAny matches any error in test cases.
+var errAny = errors.New("any error")
+
+func assertJSON(t *testing.T, got []byte, expected string) {
+	t.Helper()
+
+	var g, e any
+	err := json.Unmarshal(got, &g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal([]byte(expected), &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(g, e) {
+		t.Errorf("unexpected document: got %s want %s", got, expected)
+	}
+}
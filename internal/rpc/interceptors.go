@@ -0,0 +1,226 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDKey is the metadata key carrying the request ID of a call, in requests and response headers.
+const RequestIDKey = "x-request-id"
+
+// maxRequestIDLength bounds the request IDs accepted from clients, so they cannot flood the logs.
+const maxRequestIDLength = 128
+
+// requestIDContextKey is the context key of the request ID of a call.
+type requestIDContextKey struct{}
+
+// RequestID returns the request ID of the call in ctx, or an empty string outside of a call.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// serverStream is a grpc.ServerStream with the context of its interceptors.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// withRequestID returns ctx with the request ID sent by the client, or a new one, and the ID.
+func withRequestID(ctx context.Context) (context.Context, string) {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RequestIDKey); len(values) > 0 && len(values[0]) <= maxRequestIDLength {
+			id = values[0]
+		}
+	}
+	if id == "" {
+		id = rand.Text()
+	}
+
+	return context.WithValue(ctx, requestIDContextKey{}, id), id
+}
+
+// requestIDUnary sets the request ID of unary calls and returns it in the response headers.
+func requestIDUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, id := withRequestID(ctx)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDKey, id))
+
+	return handler(ctx, req)
+}
+
+// requestIDStream sets the request ID of streams and returns it in the response headers.
+func requestIDStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, id := withRequestID(ss.Context())
+	_ = ss.SetHeader(metadata.Pairs(RequestIDKey, id))
+
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+// metricsUnary measures unary calls.
+func metricsUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observe(info.FullMethod, start, err)
+
+	return resp, err
+}
+
+// metricsStream measures streams.
+func metricsStream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observe(info.FullMethod, start, err)
+
+	return err
+}
+
+// loggingUnary logs unary calls.
+func loggingUnary(l *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		logCall(ctx, l, info.FullMethod, start, err)
+
+		return resp, err
+	}
+}
+
+// loggingStream logs streams once they end.
+func loggingStream(l *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		logCall(ss.Context(), l, info.FullMethod, start, err)
+
+		return err
+	}
+}
+
+// logCall logs a call like the access logs of the HTTP server.
+func logCall(ctx context.Context, l *slog.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+	ip := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		ip = p.Addr.String()
+	}
+
+	fields := []any{
+		"code", code.String(),
+		"method", method,
+		"duration", time.Since(start).String(),
+		"ip", ip,
+		"request_id", RequestID(ctx),
+	}
+
+	switch code {
+	case codes.Internal, codes.Unknown, codes.DataLoss:
+		l.Error("grpc", fields...)
+	case codes.NotFound:
+		l.Warn("grpc", fields...)
+	default:
+		l.Info("grpc", fields...)
+	}
+}
+
+// recoveryUnary turns a panic in a unary handler into an Internal error, so it fails the call instead of
+// the process.
+func recoveryUnary(l *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer recoverCall(ctx, l, info.FullMethod, &err)
+
+		return handler(ctx, req)
+	}
+}
+
+// recoveryStream turns a panic in a stream handler into an Internal error.
+func recoveryStream(l *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer recoverCall(ss.Context(), l, info.FullMethod, &err)
+
+		return handler(srv, ss)
+	}
+}
+
+// recoverCall recovers a panic of a handler and sets err to an Internal error. Deferred calls only.
+func recoverCall(ctx context.Context, l *slog.Logger, method string, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	l.Error("grpc handler panicked", "method", method, "request_id", RequestID(ctx), "panic", fmt.Sprint(p),
+		"stack", string(debug.Stack()))
+	*err = status.Error(codes.Internal, "internal error")
+}
+
+// authUnary rejects unary calls without token as a bearer token with Unauthenticated.
+func authUnary(token string) grpc.UnaryServerInterceptor {
+	want := sha256.Sum256([]byte(token))
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		err := authenticate(ctx, info.FullMethod, want)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// authStream rejects streams without token as a bearer token with Unauthenticated.
+func authStream(token string) grpc.StreamServerInterceptor {
+	want := sha256.Sum256([]byte(token))
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := authenticate(ss.Context(), info.FullMethod, want)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+// authenticate checks the bearer token of a call against the hash of the expected token in constant time.
+// Health checks are not authenticated.
+func authenticate(ctx context.Context, method string, want [sha256.Size]byte) error {
+	if strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return nil
+	}
+
+	var got string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			scheme, token, ok := strings.Cut(values[0], " ")
+			if ok && strings.EqualFold(scheme, "Bearer") {
+				got = token
+			}
+		}
+	}
+
+	gotSum := sha256.Sum256([]byte(got))
+	if got == "" || subtle.ConstantTimeCompare(gotSum[:], want[:]) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid or missing bearer token")
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package rpc
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	handled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Number of gRPC calls completed, by service, method and status code.",
+	}, []string{"service", "method", "code"})
+	handlingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time taken to complete gRPC calls, by service and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "method"})
+)
+
+// RegisterMetrics registers the gRPC metrics with the default Prometheus registry.
+func RegisterMetrics() error {
+	for _, c := range []prometheus.Collector{handled, handlingDuration} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// observe records a call of fullMethod, such as /items.v1.ItemsService/GetItem, that started at start.
+func observe(fullMethod string, start time.Time, err error) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	handled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	handlingDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
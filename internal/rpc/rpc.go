@@ -0,0 +1,148 @@
+/*
+Package rpc serves gRPC services next to the REST API. Modules register their services with a Registry, and
+a Server serves them with gRPC health checking, server reflection and interceptors that mirror the HTTP
+middlewares: request IDs, metrics, logging, recovery and bearer token authentication.
+
+	registry := &rpc.Registry{}
+	itemsv1.RegisterItemsServiceServer(registry, items)
+
+	s := rpc.New(rpc.Config{Logger: logger}, registry)
+	handler := rpc.Multiplex(s, mux)
+
+A Server either shares the listener of the REST API through Multiplex, which routes HTTP/2 requests with a
+gRPC content type to it, or serves a listener of its own with Serve.
+*/
+package rpc
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// Config holds configuration for a Server.
+type Config struct {
+	// Logger logs every call. Defaults to slog.Default.
+	Logger *slog.Logger
+	// Token is the bearer token required in the authorization metadata of calls. Health checks do not need
+	// it, so probes can call them. Calls are not authenticated if empty.
+	Token string
+	// Options are passed to grpc.NewServer, for example grpc.Creds to serve TLS on a listener of its own.
+	Options []grpc.ServerOption
+	// Metrics enables the metrics interceptors. Register the metrics with RegisterMetrics.
+	Metrics bool
+}
+
+// Registry collects the gRPC services of the modules of the server. It implements grpc.ServiceRegistrar, so
+// the generated Register functions accept it, and the same services are served wherever gRPC listens.
+type Registry struct {
+	services []service
+}
+
+// service is a service registered with a Registry.
+type service struct {
+	desc *grpc.ServiceDesc
+	impl any
+}
+
+// RegisterService registers the implementation of a service. See grpc.ServiceRegistrar.
+func (r *Registry) RegisterService(desc *grpc.ServiceDesc, impl any) {
+	r.services = append(r.services, service{desc: desc, impl: impl})
+}
+
+// Server is a gRPC server serving the services of a Registry.
+type Server struct {
+	*grpc.Server
+	health *health.Server
+	logger *slog.Logger
+}
+
+// New returns a Server serving the services of reg, the health service and reflection.
+func New(cfg Config, reg *Registry) *Server {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	logger := cfg.Logger.With("component", "grpc")
+
+	// Interceptors run in order, so request IDs are set before calls are measured and logged, and panics are
+	// recovered before they reach the logs
+	unary := []grpc.UnaryServerInterceptor{requestIDUnary}
+	stream := []grpc.StreamServerInterceptor{requestIDStream}
+	if cfg.Metrics {
+		unary = append(unary, metricsUnary)
+		stream = append(stream, metricsStream)
+	}
+	unary = append(unary, loggingUnary(logger), recoveryUnary(logger))
+	stream = append(stream, loggingStream(logger), recoveryStream(logger))
+	if cfg.Token != "" {
+		unary = append(unary, authUnary(cfg.Token))
+		stream = append(stream, authStream(cfg.Token))
+	}
+
+	opts := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, cfg.Options...)
+
+	s := &Server{Server: grpc.NewServer(opts...), health: health.NewServer(), logger: logger}
+	for _, svc := range reg.services {
+		s.RegisterService(svc.desc, svc.impl)
+		s.health.SetServingStatus(svc.desc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	}
+	healthpb.RegisterHealthServer(s.Server, s.health)
+	reflection.Register(s.Server)
+
+	return s
+}
+
+// Shutdown reports the services as not serving, then stops the server once the calls in progress complete.
+// If ctx is done first, the remaining calls are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	done := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
+	}
+}
+
+// Multiplex returns a handler that serves gRPC requests, which are HTTP/2 requests with a gRPC content type,
+// with s and other requests with next. gRPC requests skip the middlewares of next, and the read and write
+// timeouts of the HTTP server.
+func Multiplex(s *Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			// Streaming calls outlive the timeouts of the server, which would otherwise end them
+			rc := http.NewResponseController(w)
+			err := rc.SetReadDeadline(time.Time{})
+			if err == nil {
+				err = rc.SetWriteDeadline(time.Time{})
+			}
+			if err != nil && !errors.Is(err, http.ErrNotSupported) {
+				s.logger.Warn("clearing stream deadlines", "err", err)
+			}
+
+			s.ServeHTTP(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,174 @@
+package rpc
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	itemsv1 "github.com/circa10a/go-rest-template/api/proto/items/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// items is a test items service that answers GetItem with the request ID of the call, and panics for the
+// item "panic".
+type items struct {
+	itemsv1.UnimplementedItemsServiceServer
+}
+
+func (items) GetItem(ctx context.Context, req *itemsv1.GetItemRequest) (*itemsv1.GetItemResponse, error) {
+	if req.GetId() == "panic" {
+		panic("boom")
+	}
+
+	return &itemsv1.GetItemResponse{Item: &itemsv1.Item{Id: req.GetId(), Name: RequestID(ctx)}}, nil
+}
+
+func newTestServer(t *testing.T, cfg Config) *Server {
+	t.Helper()
+
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	registry := &Registry{}
+	itemsv1.RegisterItemsServiceServer(registry, items{})
+
+	return New(cfg, registry)
+}
+
+func dial(t *testing.T, addr string) *grpc.ClientConn {
+	t.Helper()
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestServer(t *testing.T) {
+	s := newTestServer(t, Config{Token: "secret", Metrics: true})
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(s.Stop)
+
+	conn := dial(t, lis.Addr().String())
+	ctx := t.Context()
+
+	// Health checks do not need the token
+	health, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: itemsv1.ItemsService_ServiceDesc.ServiceName})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if health.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("unexpected health status %s", health.GetStatus())
+	}
+
+	client := itemsv1.NewItemsServiceClient(conn)
+	_, err = client.GetItem(ctx, &itemsv1.GetItemRequest{Id: "1"})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("expected Unauthenticated without a token, got %v", err)
+	}
+
+	authorized := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret", RequestIDKey, "abc")
+	var header metadata.MD
+	resp, err := client.GetItem(authorized, &itemsv1.GetItemRequest{Id: "1"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetItem().GetName() != "abc" || strings.Join(header.Get(RequestIDKey), ",") != "abc" {
+		t.Errorf("expected the request ID of the client, got %q and header %v", resp.GetItem().GetName(), header)
+	}
+
+	// Calls without a request ID get a new one
+	header = nil
+	resp, err = client.GetItem(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret"), &itemsv1.GetItemRequest{Id: "1"}, grpc.Header(&header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := resp.GetItem().GetName(); id == "" || header.Get(RequestIDKey)[0] != id {
+		t.Errorf("expected a generated request ID, got %q and header %v", id, header)
+	}
+
+	_, err = client.GetItem(authorized, &itemsv1.GetItemRequest{Id: "panic"})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal for a panic, got %v", err)
+	}
+
+	_, err = client.ListItems(authorized, &itemsv1.ListItemsRequest{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented, got %v", err)
+	}
+
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiplex(t *testing.T) {
+	s := newTestServer(t, Config{})
+	t.Cleanup(s.Stop)
+
+	rest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("rest"))
+	})
+
+	ts := httptest.NewUnstartedServer(Multiplex(s, rest))
+	ts.Config.ReadTimeout = 100 * time.Millisecond
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	conn := dial(t, strings.TrimPrefix(ts.URL, "http://"))
+	resp, err := itemsv1.NewItemsServiceClient(conn).GetItem(t.Context(), &itemsv1.GetItemRequest{Id: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.GetItem().GetId() != "1" {
+		t.Errorf("unexpected item %v", resp.GetItem())
+	}
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status of a REST request: %d", res.StatusCode)
+	}
+
+	// Streams are not ended by the timeouts of the server
+	watch, err := healthpb.NewHealthClient(conn).Watch(t.Context(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = watch.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	s.health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	update, err := watch.Recv()
+	if err != nil {
+		t.Fatalf("stream ended by the server timeouts: %v", err)
+	}
+	if update.GetStatus() != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("unexpected status: %v", update.GetStatus())
+	}
+}
@@ -0,0 +1,217 @@
+package schedule
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns when a task runs next.
+type Schedule interface {
+	// Next returns the first time after t that the task runs.
+	Next(t time.Time) time.Time
+}
+
+// descriptors are shorthands for common cron expressions.
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a schedule. It accepts standard five field cron expressions of minute, hour, day of month,
+// month and day of week, with lists, ranges, steps and three letter month and day names:
+//
+//	*/15 * * * *        every 15 minutes
+//	0 3 * * mon-fri     at 03:00 on weekdays
+//
+// It also accepts the descriptors @yearly, @monthly, @weekly, @daily and @hourly, and fixed intervals such as
+// @every 90s. As with cron, a task whose day of month and day of week are both restricted runs on days that
+// match either.
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if every, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(every))
+		if err != nil {
+			return nil, fmt.Errorf("invalid interval %q: %w", every, err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("invalid interval %q: must be positive", every)
+		}
+		return Every(d), nil
+	}
+
+	if expr, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expr
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule %q: expected 5 fields, a descriptor or @every", spec)
+	}
+
+	var c cron
+	var err error
+	for i, f := range []struct {
+		bits  *uint64
+		names []string
+		min   int
+		max   int
+	}{
+		{bits: &c.minute, min: 0, max: 59},
+		{bits: &c.hour, min: 0, max: 23},
+		{bits: &c.dom, min: 1, max: 31},
+		{bits: &c.month, min: 1, max: 12, names: monthNames},
+		{bits: &c.dow, min: 0, max: 7, names: dayNames},
+	} {
+		*f.bits, err = parseField(fields[i], f.min, f.max, f.names)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule %q: %w", spec, err)
+		}
+	}
+
+	// 7 is another name for Sunday
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	c.domStar = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	c.dowStar = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+
+	return c, nil
+}
+
+var (
+	monthNames = []string{"", "jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	dayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// parseField returns the set of values matched by a comma separated list of cron ranges as a bit set.
+func parseField(field string, lo, hi int, names []string) (uint64, error) {
+	var set uint64
+	for part := range strings.SplitSeq(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+
+		start, end := lo, hi
+		if rng != "*" {
+			first, last, isRange := strings.Cut(rng, "-")
+
+			var err error
+			start, err = parseValue(first, lo, hi, names)
+			if err != nil {
+				return 0, err
+			}
+
+			end = start
+			switch {
+			case isRange:
+				end, err = parseValue(last, lo, hi, names)
+				if err != nil {
+					return 0, err
+				}
+			case hasStep:
+				// 5/15 means from 5 to the maximum every 15
+				end = hi
+			}
+			if end < start {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			set |= 1 << v
+		}
+	}
+
+	return set, nil
+}
+
+// parseValue parses a number or name within [lo, hi].
+func parseValue(s string, lo, hi int, names []string) (int, error) {
+	for i, name := range names {
+		if name != "" && strings.EqualFold(s, name) {
+			return i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil || v < lo || v > hi {
+		return 0, fmt.Errorf("invalid value %q, expected %d-%d", s, lo, hi)
+	}
+
+	return v, nil
+}
+
+// cron is a parsed cron expression. Each field is a bit set of the values it matches.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// Next returns the first minute after t matching the expression, in the location of t. It returns the zero
+// time if nothing matches within five years, for example on the 31st of February.
+func (c cron) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			// Skip to the next matching minute of the hour, or the next hour
+			next := bits.TrailingZeros64(c.minute >> uint(t.Minute()))
+			if next == 64 || t.Minute()+next > 59 {
+				t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			} else {
+				t = t.Add(time.Duration(next) * time.Minute)
+			}
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches reports whether the day of t matches the day of month and day of week fields.
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
+
+// interval runs a task at a fixed interval.
+type interval time.Duration
+
+// Every returns a schedule running a task every d.
+func Every(d time.Duration) Schedule {
+	return interval(d)
+}
+
+func (i interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
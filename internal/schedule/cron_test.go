@@ -0,0 +1,85 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	// Wednesday
+	start := time.Date(2026, time.January, 7, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec   string
+		expect []time.Time
+	}{
+		{spec: "* * * * *", expect: []time.Time{
+			time.Date(2026, time.January, 7, 10, 31, 0, 0, time.UTC),
+			time.Date(2026, time.January, 7, 10, 32, 0, 0, time.UTC),
+		}},
+		{spec: "*/15 * * * *", expect: []time.Time{
+			time.Date(2026, time.January, 7, 10, 45, 0, 0, time.UTC),
+			time.Date(2026, time.January, 7, 11, 0, 0, 0, time.UTC),
+		}},
+		{spec: "5,50 9-11 * * *", expect: []time.Time{
+			time.Date(2026, time.January, 7, 10, 50, 0, 0, time.UTC),
+			time.Date(2026, time.January, 7, 11, 5, 0, 0, time.UTC),
+			time.Date(2026, time.January, 7, 11, 50, 0, 0, time.UTC),
+			time.Date(2026, time.January, 8, 9, 5, 0, 0, time.UTC),
+		}},
+		{spec: "0 3 * * mon-fri", expect: []time.Time{
+			time.Date(2026, time.January, 8, 3, 0, 0, 0, time.UTC),
+			time.Date(2026, time.January, 9, 3, 0, 0, 0, time.UTC),
+			time.Date(2026, time.January, 12, 3, 0, 0, 0, time.UTC),
+		}},
+		{spec: "0 0 * * 7", expect: []time.Time{
+			time.Date(2026, time.January, 11, 0, 0, 0, 0, time.UTC),
+		}},
+		{spec: "0 0 13 * fri", expect: []time.Time{
+			time.Date(2026, time.January, 9, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, time.January, 13, 0, 0, 0, 0, time.UTC),
+			time.Date(2026, time.January, 16, 0, 0, 0, 0, time.UTC),
+		}},
+		{spec: "30 4 31 jan,feb,mar *", expect: []time.Time{
+			time.Date(2026, time.January, 31, 4, 30, 0, 0, time.UTC),
+			time.Date(2026, time.March, 31, 4, 30, 0, 0, time.UTC),
+		}},
+		{spec: "@monthly", expect: []time.Time{
+			time.Date(2026, time.February, 1, 0, 0, 0, 0, time.UTC),
+		}},
+		{spec: "@hourly", expect: []time.Time{
+			time.Date(2026, time.January, 7, 11, 0, 0, 0, time.UTC),
+		}},
+		{spec: "@every 90s", expect: []time.Time{
+			time.Date(2026, time.January, 7, 10, 31, 45, 0, time.UTC),
+			time.Date(2026, time.January, 7, 10, 33, 15, 0, time.UTC),
+		}},
+		{spec: "0 0 30 feb *", expect: []time.Time{{}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			schedule, err := Parse(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			next := start
+			for _, expect := range test.expect {
+				next = schedule.Next(next)
+				if !next.Equal(expect) {
+					t.Fatalf("unexpected next run: got %v want %v", next, expect)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "* * * * fun", "@every", "@every -1m", "@sometimes"} {
+		_, err := Parse(spec)
+		if err == nil {
+			t.Errorf("expected an error parsing %q", spec)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package schedule
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	taskRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "schedule_runs_total",
+		Help: "Number of scheduled task runs by outcome: succeeded, failed, interrupted or skipped.",
+	}, []string{"task", "outcome"})
+	taskDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "schedule_run_duration_seconds",
+		Help:    "Time taken to run a scheduled task.",
+		Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"task"})
+	taskLastSuccess = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "schedule_last_success_timestamp_seconds",
+		Help: "Unix time of the last successful run of a scheduled task on this replica.",
+	}, []string{"task"})
+)
+
+// RegisterMetrics registers the scheduler metrics with the default Prometheus registry. Runs are counted by
+// the replica that ran them, so sum the metrics across replicas.
+func RegisterMetrics() error {
+	for _, c := range []prometheus.Collector{taskRuns, taskDuration, taskLastSuccess} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
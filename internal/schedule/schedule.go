@@ -0,0 +1,468 @@
+/*
+Package schedule runs periodic tasks, such as cleanups and reports, in the server. Tasks are registered from
+code with a cron expression or an interval:
+
+	err := s.Register("reports.daily", "0 6 * * *", func(ctx context.Context) error {
+		return generateReport(ctx)
+	}, schedule.Options{Jitter: time.Minute})
+
+Every replica runs the scheduler, but each run happens in only one of them. The state of a task, including
+when it runs next and which replica holds its lease, is a document in the schedules collection of the store.
+A replica runs a task by claiming its lease with a version-checked update and renews the lease while the
+task runs, so replicas sharing a database never run the same tick twice. If the replica holding a lease
+dies, another claims the task once the lease expires.
+
+Runs never overlap. A tick that is due while the previous run is still going is skipped and counted in the
+schedule_runs_total metric.
+*/
+package schedule
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// Collection is the store collection holding the state of scheduled tasks.
+const Collection = "schedules"
+
+// errLeaseLost cancels a run whose lease was claimed by another replica.
+var errLeaseLost = errors.New("lease claimed by another replica")
+
+// Func performs a scheduled task. It must return when ctx is cancelled.
+type Func func(ctx context.Context) error
+
+// Options holds the options of a scheduled task.
+type Options struct {
+	// Jitter delays each run by a random duration up to Jitter, spreading out tasks that are due at the same
+	// time across replicas or deployments.
+	Jitter time.Duration
+	// Timeout cancels a run that takes longer. Defaults to no timeout.
+	Timeout time.Duration
+}
+
+// Config holds configuration for a Scheduler.
+type Config struct {
+	// Logger logs task failures. Defaults to slog.Default.
+	Logger *slog.Logger
+	// Location is the time zone of cron expressions. Defaults to UTC.
+	Location *time.Location
+	// Lease is how long a replica holds a task without renewing it. Leases are renewed every third of the
+	// lease while a task runs. Defaults to 1 minute.
+	Lease time.Duration
+	// PollInterval caps how long the scheduler waits before checking the state of a task again, so changes
+	// made by other replicas are noticed. Defaults to 1 minute.
+	PollInterval time.Duration
+}
+
+// Status is the state of a scheduled task.
+type Status struct {
+	// NextRun is when the task is due next, before jitter.
+	NextRun time.Time
+	// LastRun is when the last run started. It is zero if the task has not run.
+	LastRun time.Time
+	Name    string
+	Spec    string
+	// Holder identifies the replica running the task, if it is running.
+	Holder    string
+	LastError string
+	// LastDuration is how long the last run took.
+	LastDuration time.Duration
+	Running      bool
+}
+
+// state is the stored state of a task.
+type state struct {
+	NextRun      time.Time     `json:"next_run"`
+	LastRun      time.Time     `json:"last_run,omitzero"`
+	LeaseUntil   time.Time     `json:"lease_until,omitzero"`
+	Spec         string        `json:"spec"`
+	Holder       string        `json:"holder,omitempty"`
+	LastError    string        `json:"last_error,omitempty"`
+	LastDuration time.Duration `json:"last_duration,omitempty"`
+}
+
+// task is a registered task.
+type task struct {
+	schedule Schedule
+	fn       Func
+	name     string
+	spec     string
+	opts     Options
+}
+
+// Scheduler runs registered tasks on their schedules.
+type Scheduler struct {
+	states *store.Collection[state]
+	logger *slog.Logger
+	tasks  map[string]*task
+	id     string
+	cfg    Config
+	mu     sync.RWMutex
+}
+
+// New returns a Scheduler storing the state of tasks in s. Register tasks before calling Run.
+func New(s store.Store, cfg Config) *Scheduler {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Location == nil {
+		cfg.Location = time.UTC
+	}
+	if cfg.Lease <= 0 {
+		cfg.Lease = time.Minute
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Minute
+	}
+
+	// The holder ID tells replicas, and restarts of the same replica, apart
+	hostname, _ := os.Hostname()
+
+	return &Scheduler{
+		states: store.NewCollection[state](s, Collection),
+		logger: cfg.Logger.With("component", "schedule"),
+		tasks:  map[string]*task{},
+		id:     hostname + "-" + rand.Text()[:8],
+		cfg:    cfg,
+	}
+}
+
+// Register adds a task running fn on the schedule in spec. See Parse for the supported schedules.
+func (s *Scheduler) Register(name, spec string, fn Func, opts Options) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return fmt.Errorf("task %s: %w", name, err)
+	}
+	if schedule.Next(time.Now().In(s.cfg.Location)).IsZero() {
+		return fmt.Errorf("task %s: schedule %q never runs", name, spec)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[name]; ok {
+		return fmt.Errorf("task %s is already registered", name)
+	}
+	s.tasks[name] = &task{name: name, spec: spec, schedule: schedule, fn: fn, opts: opts}
+
+	return nil
+}
+
+// Statuses returns the state of the registered tasks, ordered by name.
+func (s *Scheduler) Statuses(ctx context.Context) ([]Status, error) {
+	now := time.Now()
+	statuses := []Status{}
+
+	for _, t := range s.registered() {
+		status := Status{Name: t.name, Spec: t.spec}
+
+		doc, err := s.states.Get(ctx, t.name)
+		switch {
+		case errors.Is(err, store.ErrNotFound) || (err == nil && doc.Value.Spec != t.spec):
+			status.NextRun = t.schedule.Next(now.In(s.cfg.Location))
+		case err != nil:
+			return nil, err
+		default:
+			status.NextRun = doc.Value.NextRun
+			status.LastRun = doc.Value.LastRun
+			status.LastError = doc.Value.LastError
+			status.LastDuration = doc.Value.LastDuration
+			if doc.Value.Holder != "" && doc.Value.LeaseUntil.After(now) {
+				status.Running = true
+				status.Holder = doc.Value.Holder
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Run runs the registered tasks until ctx is done, then waits for running tasks to return. A run interrupted
+// by ctx is released so another replica runs it again.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, t := range s.registered() {
+		wg.Go(func() { s.loop(ctx, t) })
+	}
+	wg.Wait()
+}
+
+// registered returns the registered tasks ordered by name.
+func (s *Scheduler) registered() []*task {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tasks := make([]*task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	slices.SortFunc(tasks, func(a, b *task) int { return cmp.Compare(a.name, b.name) })
+
+	return tasks
+}
+
+// loop runs t whenever it is due and this replica claims it, until ctx is done.
+func (s *Scheduler) loop(ctx context.Context, t *task) {
+	var (
+		due    time.Time
+		jitter time.Duration
+	)
+
+	for ctx.Err() == nil {
+		wait := s.cfg.PollInterval
+
+		doc, err := s.load(ctx, t)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			s.logger.Error("loading task state", "task", t.name, "err", err)
+		} else {
+			// Draw new jitter for every tick
+			if !doc.Value.NextRun.Equal(due) {
+				due = doc.Value.NextRun
+				jitter = 0
+				if t.opts.Jitter > 0 {
+					jitter = mathrand.N(t.opts.Jitter)
+				}
+			}
+
+			now := time.Now()
+			runAt := due.Add(jitter)
+			held := doc.Value.Holder != "" && doc.Value.LeaseUntil.After(now)
+			if !now.Before(runAt) && !held {
+				claimed, ok := s.claim(ctx, t, doc, now)
+				if ok {
+					s.execute(ctx, t, claimed, due)
+				}
+				// Check the state again right away, whether this replica ran the task or another one did
+				continue
+			}
+			if !held {
+				wait = min(wait, runAt.Sub(now))
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// load returns the state of t, creating it on the first run and resetting it if the schedule changed.
+func (s *Scheduler) load(ctx context.Context, t *task) (store.Document[state], error) {
+	for {
+		doc, err := s.states.Get(ctx, t.name)
+		if errors.Is(err, store.ErrNotFound) {
+			doc, err = s.states.CreateWithID(ctx, t.name, state{
+				Spec:    t.spec,
+				NextRun: t.schedule.Next(time.Now().In(s.cfg.Location)),
+			})
+			if errors.Is(err, store.ErrConflict) {
+				// Another replica created it first
+				continue
+			}
+			return doc, err
+		}
+		if err != nil || doc.Value.Spec == t.spec {
+			return doc, err
+		}
+
+		// Replicas running an older release keep the schedule they know, so a rolling deployment may
+		// switch back and forth until it completes
+		st := doc.Value
+		st.Spec = t.spec
+		st.NextRun = t.schedule.Next(time.Now().In(s.cfg.Location))
+		doc, err = s.states.Update(ctx, t.name, doc.Version, st)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+		return doc, err
+	}
+}
+
+// claim takes the lease of a due task and schedules its next run. It returns false if another replica claimed
+// it first.
+func (s *Scheduler) claim(ctx context.Context, t *task, doc store.Document[state], now time.Time) (store.Document[state], bool) {
+	st := doc.Value
+	st.Holder = s.id
+	st.LeaseUntil = now.Add(s.cfg.Lease)
+
+	// Keep to the schedule unless ticks were missed while no replica was running
+	st.NextRun = t.schedule.Next(st.NextRun.In(s.cfg.Location))
+	if !st.NextRun.After(now) {
+		st.NextRun = t.schedule.Next(now.In(s.cfg.Location))
+	}
+
+	claimed, err := s.states.Update(ctx, t.name, doc.Version, st)
+	if err != nil {
+		if !errors.Is(err, store.ErrConflict) && ctx.Err() == nil {
+			s.logger.Error("claiming task", "task", t.name, "err", err)
+		}
+		return doc, false
+	}
+
+	return claimed, true
+}
+
+// execute runs a claimed task and stores its outcome. due is the tick being run.
+func (s *Scheduler) execute(ctx context.Context, t *task, doc store.Document[state], due time.Time) {
+	runCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	if t.opts.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		runCtx, cancelTimeout = context.WithTimeout(runCtx, t.opts.Timeout)
+		defer cancelTimeout()
+	}
+
+	stopped := make(chan struct{})
+	heartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeat)
+		s.heartbeat(ctx, t, cancel, stopped)
+	}()
+
+	start := time.Now()
+	runErr := run(runCtx, t.fn)
+	duration := time.Since(start)
+	close(stopped)
+	<-heartbeat
+
+	if errors.Is(context.Cause(runCtx), errLeaseLost) {
+		s.logger.Warn("task lease expired before it finished, it may have run twice", "task", t.name)
+		taskRuns.WithLabelValues(t.name, "interrupted").Inc()
+		return
+	}
+
+	outcome := "succeeded"
+	switch {
+	case ctx.Err() != nil:
+		outcome = "interrupted"
+	case runErr != nil:
+		outcome = "failed"
+		s.logger.Error("scheduled task failed", "task", t.name, "duration", duration, "err", runErr)
+	default:
+		taskLastSuccess.WithLabelValues(t.name).Set(float64(time.Now().Unix()))
+	}
+	taskRuns.WithLabelValues(t.name, outcome).Inc()
+	taskDuration.WithLabelValues(t.name).Observe(duration.Seconds())
+
+	// The outcome is stored even if the process is shutting down
+	skipped := 0
+	_, err := s.update(context.WithoutCancel(ctx), t.name, func(st *state) error {
+		if st.Holder != s.id {
+			return errLeaseLost
+		}
+		st.Holder = ""
+		st.LeaseUntil = time.Time{}
+
+		if outcome == "interrupted" {
+			// Run the tick again, on another replica if this one is shutting down
+			st.NextRun = due
+			return nil
+		}
+
+		st.LastRun = start
+		st.LastDuration = duration
+		st.LastError = ""
+		if runErr != nil {
+			st.LastError = runErr.Error()
+		}
+
+		// Ticks that were due while the task ran are skipped rather than run late
+		now := time.Now()
+		skipped = 0
+		for !st.NextRun.After(now) && skipped < 1000 {
+			st.NextRun = t.schedule.Next(st.NextRun.In(s.cfg.Location))
+			skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		s.logger.Error("storing task outcome", "task", t.name, "err", err)
+	}
+	if skipped > 0 {
+		s.logger.Warn("task ran past its next tick, skipping it", "task", t.name, "skipped", skipped, "duration", duration)
+		taskRuns.WithLabelValues(t.name, "skipped").Add(float64(skipped))
+	}
+}
+
+// heartbeat renews the lease of a running task until stopped is closed, cancelling the run if another replica
+// claimed the task.
+func (s *Scheduler) heartbeat(ctx context.Context, t *task, cancel context.CancelCauseFunc, stopped <-chan struct{}) {
+	ticker := time.NewTicker(s.cfg.Lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopped:
+			return
+		case <-ticker.C:
+		}
+
+		_, err := s.update(context.WithoutCancel(ctx), t.name, func(st *state) error {
+			if st.Holder != s.id {
+				return errLeaseLost
+			}
+			st.LeaseUntil = time.Now().Add(s.cfg.Lease)
+			return nil
+		})
+		if errors.Is(err, errLeaseLost) {
+			cancel(errLeaseLost)
+			return
+		}
+		if err != nil {
+			s.logger.Error("renewing task lease", "task", t.name, "err", err)
+		}
+	}
+}
+
+// update applies fn to the stored state of a task, retrying if the state changes concurrently. If fn returns
+// an error the state is not updated and the error is returned.
+func (s *Scheduler) update(ctx context.Context, name string, fn func(st *state) error) (store.Document[state], error) {
+	for {
+		doc, err := s.states.Get(ctx, name)
+		if err != nil {
+			return doc, err
+		}
+
+		err = fn(&doc.Value)
+		if err != nil {
+			return doc, err
+		}
+
+		updated, err := s.states.Update(ctx, name, doc.Version, doc.Value)
+		if errors.Is(err, store.ErrConflict) {
+			continue
+		}
+
+		return updated, err
+	}
+}
+
+// run calls fn, turning a panic into an error so it fails the run instead of the process.
+func run(ctx context.Context, fn Func) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	return fn(ctx)
+}
@@ -0,0 +1,179 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// testConfig makes schedulers notice changes quickly.
+var testConfig = Config{
+	Logger:       slog.New(slog.DiscardHandler),
+	Lease:        300 * time.Millisecond,
+	PollInterval: 5 * time.Millisecond,
+}
+
+// startScheduler runs s until the returned function is called or the test ends.
+func startScheduler(t *testing.T, s *Scheduler) func() {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+
+	return stop
+}
+
+func TestSchedulerReplicas(t *testing.T) {
+	st := store.NewMemory()
+
+	var runs, running, overlaps atomic.Int32
+	fn := func(ctx context.Context) error {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		defer running.Add(-1)
+
+		runs.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	}
+
+	// Replicas sharing a store run each tick once between them
+	var stops []func()
+	for range 3 {
+		s := New(st, testConfig)
+		err := s.Register("replicated", "@every 50ms", fn, Options{Jitter: 5 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		stops = append(stops, startScheduler(t, s))
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	for _, stop := range stops {
+		stop()
+	}
+
+	if n := runs.Load(); n < 5 || n > 11 {
+		t.Errorf("unexpected number of runs in 500ms at 50ms intervals: got %d", n)
+	}
+	if n := overlaps.Load(); n != 0 {
+		t.Errorf("runs overlapped %d times", n)
+	}
+}
+
+func TestSchedulerOverlap(t *testing.T) {
+	st := store.NewMemory()
+	s := New(st, testConfig)
+
+	var runs atomic.Int32
+	err := s.Register("slow", "@every 20ms", func(ctx context.Context) error {
+		runs.Add(1)
+		time.Sleep(70 * time.Millisecond)
+		return errors.New("report failed")
+	}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := startScheduler(t, s)
+	time.Sleep(200 * time.Millisecond)
+	stop()
+
+	if n := runs.Load(); n < 2 || n > 4 {
+		t.Errorf("unexpected number of runs of a task slower than its interval: got %d", n)
+	}
+	if skipped := testutil.ToFloat64(taskRuns.WithLabelValues("slow", "skipped")); skipped < 2 {
+		t.Errorf("expected skipped ticks to be counted: got %v", skipped)
+	}
+
+	statuses, err := s.Statuses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 1 || statuses[0].LastError != "report failed" || statuses[0].LastDuration < 70*time.Millisecond || statuses[0].Running {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+}
+
+func TestSchedulerInterrupted(t *testing.T) {
+	st := store.NewMemory()
+	s := New(st, testConfig)
+
+	started := make(chan struct{})
+	err := s.Register("interrupted", "@every 10ms", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := startScheduler(t, s)
+	<-started
+
+	running, err := s.Statuses(context.Background())
+	if err != nil || !running[0].Running || running[0].Holder != s.id {
+		t.Errorf("unexpected status of a running task: %+v, %v", running, err)
+	}
+	stop()
+
+	// The interrupted tick is released for another replica to run
+	doc, err := s.states.Get(context.Background(), "interrupted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Value.Holder != "" || !doc.Value.NextRun.Before(time.Now()) {
+		t.Errorf("unexpected state of an interrupted task: %+v", doc.Value)
+	}
+}
+
+func TestSchedulerRegister(t *testing.T) {
+	s := New(store.NewMemory(), testConfig)
+	noop := func(ctx context.Context) error { return nil }
+
+	err := s.Register("b", "@daily", noop, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Register("a", "*/5 * * * *", noop, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, spec := range []string{"not a schedule", "0 0 31 feb *"} {
+		err = s.Register("invalid", spec, noop, Options{})
+		if err == nil {
+			t.Errorf("expected an error registering %q", spec)
+		}
+	}
+	err = s.Register("a", "@hourly", noop, Options{})
+	if err == nil {
+		t.Error("expected an error registering a task twice")
+	}
+
+	statuses, err := s.Statuses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || statuses[0].Name != "a" || statuses[1].Name != "b" || statuses[1].NextRun.Hour() != 0 || !statuses[0].LastRun.IsZero() {
+		t.Errorf("unexpected statuses: %+v", statuses)
+	}
+}
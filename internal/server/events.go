@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+
+	"github.com/circa10a/go-rest-template/internal/events"
+	"github.com/circa10a/go-rest-template/internal/server/handlers"
+	"github.com/circa10a/go-rest-template/internal/sse"
+	"github.com/circa10a/go-rest-template/internal/webhooks"
+	"github.com/circa10a/go-rest-template/internal/ws"
+)
+
+// itemEvents are the types of the events published by the items handler.
+var itemEvents = []string{string(handlers.ItemCreated), string(handlers.ItemUpdated), string(handlers.ItemDeleted)}
+
+// streamEvents returns a subscriber that sends events to the clients of an event stream topic.
+func streamEvents(broker *sse.Broker, topic string) events.HandlerFunc {
+	return func(ctx context.Context, event events.Event) error {
+		broker.Publish(topic, sse.Event{Type: event.Type, Data: event.Data})
+		return nil
+	}
+}
+
+// socketEvents returns a subscriber that sends events to the WebSocket clients subscribed to a topic.
+func socketEvents(hub *ws.Hub, topic string) events.HandlerFunc {
+	return func(ctx context.Context, event events.Event) error {
+		return hub.Publish(topic, ws.Message{Type: event.Type, Data: event.Data})
+	}
+}
+
+// webhookEvents returns a subscriber that delivers events to webhook subscriptions, with the ID of the event
+// so receivers recognise events delivered again.
+func webhookEvents(dispatcher *webhooks.Dispatcher) events.HandlerFunc {
+	return func(ctx context.Context, event events.Event) error {
+		return dispatcher.PublishEvent(ctx, webhooks.Event{
+			ID:        event.ID,
+			Type:      event.Type,
+			CreatedAt: event.CreatedAt,
+			Data:      event.Data,
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := New(&Config{Store: store.NewMemory(), LogLevel: "error", Compression: true, ETags: true, SecurityHeaders: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	// Streams must outlive the timeouts of the server through every middleware
+	ts := httptest.NewUnstartedServer(s.mux)
+	ts.Config.ReadTimeout = 100 * time.Millisecond
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	client, err := api.NewClientWithResponses(ts.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid, err := client.StreamEvents(ctx, &api.StreamEventsParams{Topic: []api.StreamEventsParamsTopic{"orders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status for an unknown topic: got %d want %d", invalid.StatusCode, http.StatusBadRequest)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	t.Cleanup(cancel)
+	resp, err := client.StreamEvents(ctx, &api.StreamEventsParams{Topic: []api.StreamEventsParamsTopic{"items"}}, func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("Accept", "text/event-stream")
+		req.Header.Set("Accept-Encoding", "gzip")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	if resp.Header.Get("Content-Type") != "text/event-stream" || resp.Header.Get("Content-Encoding") != "" {
+		t.Fatalf("unexpected stream headers: %v", resp.Header)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	item, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.JSON201 == nil {
+		t.Fatalf("unexpected item: %d %s", item.StatusCode(), item.Body)
+	}
+
+	fields := map[string]string{}
+	lines := bufio.NewScanner(resp.Body)
+	for lines.Scan() && lines.Text() != "" {
+		name, value, _ := strings.Cut(lines.Text(), ": ")
+		fields[name] = value
+	}
+	if fields["event"] != "item.created" || fields["id"] == "" {
+		t.Fatalf("unexpected event: %v, %v", fields, lines.Err())
+	}
+	var data api.Item
+	_ = json.Unmarshal([]byte(fields["data"]), &data)
+	if data.Id != item.JSON201.Id {
+		t.Errorf("unexpected item in the event: %s", fields["data"])
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	itemsv1 "github.com/circa10a/go-rest-template/api/proto/items/v1"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPC(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := New(&Config{Store: store.NewMemory(), LogLevel: "error", GRPC: true, GRPCToken: "secret", Compression: true, ETags: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	// gRPC shares the port of the REST API over HTTP/2 without TLS
+	ts := httptest.NewUnstartedServer(s.mux)
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetHTTP1(true)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	conn, err := grpc.NewClient(strings.TrimPrefix(ts.URL, "http://"), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	client := itemsv1.NewItemsServiceClient(conn)
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret")
+
+	_, err = client.CreateItem(ctx, &itemsv1.CreateItemRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for an item without a name, got %v", err)
+	}
+
+	created, err := client.CreateItem(ctx, &itemsv1.CreateItemRequest{Name: "Widget", Tags: []string{"tools"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Gadget", "Gizmo"} {
+		_, err = client.CreateItem(ctx, &itemsv1.CreateItemRequest{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Items created over gRPC are served by the REST API
+	rest, err := api.NewClientWithResponses(ts.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := rest.GetItemWithResponse(ctx, created.GetItem().GetId())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.JSON200 == nil || item.JSON200.Name != "Widget" || item.JSON200.Tags == nil || (*item.JSON200.Tags)[0] != "tools" {
+		t.Fatalf("unexpected item: %d %s", item.StatusCode(), item.Body)
+	}
+
+	page, err := client.ListItems(ctx, &itemsv1.ListItemsRequest{PageSize: 2, OrderBy: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.GetItems()) != 2 || page.GetItems()[0].GetName() != "Gadget" || page.GetNextPageToken() == "" {
+		t.Fatalf("unexpected first page: %v", page)
+	}
+	page, err = client.ListItems(ctx, &itemsv1.ListItemsRequest{PageSize: 2, PageToken: page.GetNextPageToken()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.GetItems()) != 1 || page.GetItems()[0].GetName() != "Widget" || page.GetNextPageToken() != "" {
+		t.Fatalf("unexpected last page: %v", page)
+	}
+
+	_, err = client.UpdateItem(ctx, &itemsv1.UpdateItemRequest{Id: created.GetItem().GetId(), Version: 5, Name: "Widget"})
+	if status.Code(err) != codes.Aborted {
+		t.Fatalf("expected Aborted for a stale version, got %v", err)
+	}
+	updated, err := client.UpdateItem(ctx, &itemsv1.UpdateItemRequest{Id: created.GetItem().GetId(), Version: 1, Name: "Widget 2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.GetItem().GetVersion() != 2 || updated.GetItem().GetName() != "Widget 2" {
+		t.Errorf("unexpected updated item: %v", updated.GetItem())
+	}
+
+	_, err = client.DeleteItem(ctx, &itemsv1.DeleteItemRequest{Id: created.GetItem().GetId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetItem(ctx, &itemsv1.GetItemRequest{Id: created.GetItem().GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a deleted item, got %v", err)
+	}
+}
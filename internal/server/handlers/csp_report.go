@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// maxCSPReportSize caps violation report bodies since the endpoint is unauthenticated.
+const maxCSPReportSize = 64 << 10
+
+/*
+CSPReportHandleFunc returns the http handler that collects Content-Security-Policy violation reports and logs them.
+Both the report-uri format (application/csp-report) and the Reporting API format (application/reports+json) are accepted.
+Example request:
+
+	{
+		"csp-report": {
+			"document-uri": "https://example.com/docs",
+			"violated-directive": "script-src-elem",
+			"blocked-uri": "https://evil.com/script.js"
+		}
+	}
+*/
+func CSPReportHandleFunc(l *slog.Logger) http.HandlerFunc {
+	log := l.With("component", "csp")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCSPReportSize))
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		var legacy struct {
+			Report map[string]any `json:"csp-report"`
+		}
+		var reports []struct {
+			Body map[string]any `json:"body"`
+			Type string         `json:"type"`
+		}
+
+		switch {
+		case json.Unmarshal(body, &legacy) == nil && legacy.Report != nil:
+			logViolation(log, legacy.Report)
+		case json.Unmarshal(body, &reports) == nil:
+			for _, report := range reports {
+				if report.Type == "csp-violation" {
+					logViolation(log, report.Body)
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func logViolation(l *slog.Logger, report map[string]any) {
+	fields := make([]any, 0, len(report)*2)
+	for k, v := range report {
+		fields = append(fields, k, v)
+	}
+
+	l.Warn("content security policy violation", fields...)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCSPReportHandleFunc(t *testing.T) {
+	tests := []struct {
+		body         string
+		expectLog    string
+		expectStatus int
+	}{
+		{
+			body:         `{"csp-report":{"blocked-uri":"https://evil.com/a.js","violated-directive":"script-src-elem"}}`,
+			expectLog:    "https://evil.com/a.js",
+			expectStatus: http.StatusNoContent,
+		},
+		{
+			body:         `[{"type":"csp-violation","body":{"blockedURL":"https://evil.com/b.js"}}]`,
+			expectLog:    "https://evil.com/b.js",
+			expectStatus: http.StatusNoContent,
+		},
+		{
+			body:         `not json`,
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		var logs bytes.Buffer
+		handler := CSPReportHandleFunc(slog.New(slog.NewTextHandler(&logs, nil)))
+
+		req := httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(test.body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectStatus {
+			t.Errorf("handler returned unexpected status code: got %d want %d", rec.Code, test.expectStatus)
+		}
+
+		if !strings.Contains(logs.String(), test.expectLog) {
+			t.Errorf("expected violation to be logged: got %s want %s", logs.String(), test.expectLog)
+		}
+	}
+}
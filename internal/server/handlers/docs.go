@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/circa10a/go-rest-template/internal/server/middleware"
+)
+
+/*
+DocsHandleFunc returns the http handler that serves the embedded OpenAPI documentation page. The page is
+compressed with every supported encoding once, when the handler is created, and the best variant accepted by
+the client is served. Its inline scripts are allowed by the hashes of middleware.ScriptHashes in the
+Content-Security-Policy, so the page is the same for every request.
+
+The ETag is derived from the embedded page, so browsers can revalidate it with If-None-Match.
+*/
+func DocsHandleFunc(html []byte) (http.HandlerFunc, error) {
+	variants, err := middleware.Precompress(html)
+	if err != nil {
+		return nil, err
+	}
+
+	etag := middleware.StrongETag(html)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		serveEncoded(w, r, html, etag, variants)
+	}, nil
+}
+
+// serveEncoded writes the precompressed variant negotiated from the request, falling back to the raw data.
+// Encoded variants get their own ETag, suffixed with the encoding like the compression middleware does.
+func serveEncoded(w http.ResponseWriter, r *http.Request, data []byte, etag string, variants map[string][]byte) {
+	h := w.Header()
+	h.Add("Vary", "Accept-Encoding")
+
+	encoding := middleware.NegotiateEncoding(r.Header.Get("Accept-Encoding"), middleware.Encodings)
+	if encoded, ok := variants[encoding]; ok && len(encoded) < len(data) {
+		h.Set("Content-Encoding", encoding)
+		etag = strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+		data = encoded
+	}
+
+	h.Set("ETag", etag)
+	if middleware.NotModified(r, etag) {
+		h.Del("Content-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/circa10a/go-rest-template/internal/server/middleware"
+)
+
+func TestDocsHandleFunc(t *testing.T) {
+	html := []byte(`<html><script src="redoc.js"></script><script>init()</script>` + strings.Repeat("<p>docs</p>", 100) + `</html>`)
+
+	docs, err := DocsHandleFunc(html)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		handler        http.Handler
+		acceptEncoding string
+		expected       string
+		expectEncoding string
+	}{
+		{
+			handler:  docs,
+			expected: string(html),
+		},
+		{
+			handler:        docs,
+			acceptEncoding: "gzip",
+			expectEncoding: "gzip",
+		},
+		{
+			// The page does not depend on the nonce of the security headers, so it is still served precompressed
+			handler:        middleware.SecurityHeaders(middleware.DefaultSecurityHeaders())(docs),
+			acceptEncoding: "gzip",
+			expectEncoding: "gzip",
+		},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/docs", nil)
+		req.Header.Set("Accept-Encoding", test.acceptEncoding)
+		rec := httptest.NewRecorder()
+		test.handler.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Errorf("handler returned unexpected status code: got %d want %d", rec.Code, http.StatusOK)
+		}
+
+		if actual := rec.Header().Get("Content-Encoding"); actual != test.expectEncoding {
+			t.Errorf("handler returned unexpected encoding: got %s want %s", actual, test.expectEncoding)
+		}
+
+		actual := rec.Body.String()
+		if !strings.Contains(actual, test.expected) {
+			t.Errorf("handler returned unexpected body: got %s want %s", actual, test.expected)
+		}
+	}
+}
+
+func TestDocsHandleFuncNotModified(t *testing.T) {
+	docs, err := DocsHandleFunc([]byte(`<html><script>init()</script></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := middleware.SecurityHeaders(middleware.DefaultSecurityHeaders())(docs)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	etag := rec.Header().Get("ETag")
+
+	req := httptest.NewRequest(http.MethodGet, "/docs", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("handler returned unexpected status code: got %d want %d", rec.Code, http.StatusNotModified)
+	}
+}
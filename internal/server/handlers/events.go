@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/sse"
+)
+
+/*
+EventsHandleFunc streams the events of the topics in the topic query parameters from b as Server-Sent Events.
+Example response:
+
+	id: lq3x8k2a-1
+	event: item.created
+	data: {"id":"5b7f3c1e-2a4d-4e8f-9c6b-1d2e3f4a5b6c","name":"Widget","version":1}
+
+	: heartbeat
+*/
+func EventsHandleFunc(b *sse.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		topics := r.URL.Query()["topic"]
+		if len(topics) == 0 {
+			render.Error(w, http.StatusBadRequest, "at least one topic is required")
+			return
+		}
+		for _, topic := range topics {
+			if !b.AllowsTopic(topic) {
+				render.Error(w, http.StatusBadRequest, "unknown topic "+topic)
+				return
+			}
+		}
+
+		b.Serve(w, r, topics...)
+	}
+}
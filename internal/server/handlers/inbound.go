@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/inbound"
+	"github.com/circa10a/go-rest-template/internal/server/pagination"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+/*
+InboundEventsHandler serves the admin API for webhooks received from providers, for inspecting them and
+replaying their handlers. Mount it behind authentication.
+Example response:
+
+	{
+		"id": "4c3b2a19-0f8e-4d7c-9b6a-5e4d3c2b1a09",
+		"provider": "github",
+		"external_id": "72d3162e-cc78-11e3-81ab-4c9367dc0958",
+		"type": "push",
+		"status": "failed",
+		"attempts": 10,
+		"error": "connection refused",
+		"body": "{\"ref\":\"refs/heads/main\"}",
+		"created_at": "2026-01-01T00:00:00Z",
+		"updated_at": "2026-01-01T01:00:00Z"
+	}
+*/
+type InboundEventsHandler struct {
+	logger    *slog.Logger
+	events    *store.Collection[inbound.Event]
+	receiver  *inbound.Receiver
+	paginator *pagination.Paginator
+}
+
+// NewInboundEventsHandler returns the admin handler for the events stored in s, which rc replays.
+// cursorSecret signs list cursors.
+func NewInboundEventsHandler(l *slog.Logger, s store.Store, rc *inbound.Receiver, cursorSecret []byte) (*InboundEventsHandler, error) {
+	exact := []store.Operator{store.OpEq, store.OpNe}
+	paginator, err := pagination.New(pagination.Config{
+		Secret: cursorSecret,
+		Fields: []pagination.Field{
+			{Name: "provider", Type: pagination.String, Operators: exact},
+			{Name: "type", Type: pagination.String, Operators: exact},
+			{Name: "external_id", Type: pagination.String, Operators: exact},
+			{Name: "status", Type: pagination.String, Operators: exact},
+			{Name: store.FieldCreatedAt, Type: pagination.Time, Sortable: true},
+			{Name: store.FieldUpdatedAt, Type: pagination.Time, Sortable: true},
+		},
+		DefaultSort: []store.Sort{{Field: store.FieldCreatedAt, Desc: true}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &InboundEventsHandler{
+		logger:    l.With("component", "inbound"),
+		events:    store.NewCollection[inbound.Event](s, inbound.EventsCollection),
+		receiver:  rc,
+		paginator: paginator,
+	}, nil
+}
+
+// Routes registers the event routes on r.
+func (h *InboundEventsHandler) Routes(r chi.Router) {
+	r.Get("/", h.List)
+	r.Get("/{id}", h.Get)
+	r.Post("/{id}/replay", h.Replay)
+}
+
+// List returns a page of events, newest first unless the request sets a sort.
+func (h *InboundEventsHandler) List(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q, err := h.paginator.Parse(values)
+	if err != nil {
+		render.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	docs, err := h.events.List(r.Context(), q)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	docs, next, err := pagination.Page(h.paginator, q, values, docs)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	resp := api.InboundEventList{Events: make([]api.InboundEvent, 0, len(docs)), NextCursor: next}
+	for _, doc := range docs {
+		resp.Events = append(resp.Events, toInboundEvent(doc))
+	}
+
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// Get returns an event.
+func (h *InboundEventsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.events.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, toInboundEvent(doc))
+}
+
+// Replay runs the handler of an event again.
+func (h *InboundEventsHandler) Replay(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.receiver.Replay(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusAccepted, toInboundEvent(doc))
+}
+
+// storeError writes the response for a store error.
+func (h *InboundEventsHandler) storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		render.Error(w, http.StatusNotFound, "event not found")
+	case errors.Is(err, store.ErrConflict):
+		render.Error(w, http.StatusConflict, "the event is pending")
+	default:
+		h.logger.Error("store error", "err", err)
+		render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+func toInboundEvent(doc store.Document[inbound.Event]) api.InboundEvent {
+	event := doc.Value
+	resp := api.InboundEvent{
+		Id:        doc.ID,
+		Provider:  event.Provider,
+		Type:      event.Type,
+		Status:    api.InboundEventStatus(event.Status),
+		Attempts:  event.Attempts,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}
+	if event.ExternalID != "" {
+		resp.ExternalId = &event.ExternalID
+	}
+	if event.Error != "" {
+		resp.Error = &event.Error
+	}
+	if event.ContentType != "" {
+		resp.ContentType = &event.ContentType
+	}
+	if utf8.Valid(event.Body) {
+		body := string(event.Body)
+		resp.Body = &body
+	}
+
+	return resp
+}
@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/events"
+	"github.com/circa10a/go-rest-template/internal/operations"
+	"github.com/circa10a/go-rest-template/internal/server/middleware"
+	"github.com/circa10a/go-rest-template/internal/server/pagination"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi/v5"
+)
+
+/*
+ItemsHandler serves the items resource. It is the reference implementation of a CRUD resource:
+request bodies are validated against the OpenAPI spec by the validation middleware before they reach
+the handler, items are stored in a typed store.Collection, and every response carries an ETag derived
+from the item version so clients can make conditional requests.
+Example response:
+
+	{
+		"id": "5b7f3c1e-2a4d-4e8f-9c6b-1d2e3f4a5b6c",
+		"name": "Widget",
+		"tags": ["tools"],
+		"version": 1,
+		"created_at": "2026-01-01T00:00:00Z",
+		"updated_at": "2026-01-01T00:00:00Z"
+	}
+*/
+type ItemsHandler struct {
+	logger     *slog.Logger
+	items      *store.Collection[api.NewItem]
+	paginator  *pagination.Paginator
+	schema     *openapi3.Schema
+	operations *OperationsHandler
+	events     *events.Bus
+}
+
+// Item events, published in the transaction of every change to an item.
+var (
+	ItemCreated = events.Type[api.Item](api.ItemCreated)
+	ItemUpdated = events.Type[api.Item](api.ItemUpdated)
+	ItemDeleted = events.Type[api.Item](api.ItemDeleted)
+)
+
+// exportOperation is the operation type of item exports.
+const exportOperation = "items.export"
+
+// exportPageSize is the number of items read from the store at a time by an export.
+const exportPageSize = 100
+
+// NewItemsHandler returns the handler for the items stored in s. Patched items are validated against the
+// NewItem schema in spec, and cursorSecret signs list cursors.
+func NewItemsHandler(l *slog.Logger, s store.Store, spec *openapi3.T, cursorSecret []byte) (*ItemsHandler, error) {
+	schema := spec.Components.Schemas["NewItem"]
+	if schema == nil || schema.Value == nil {
+		return nil, errors.New("the OpenAPI spec has no NewItem schema")
+	}
+
+	paginator, err := pagination.New(pagination.Config{
+		Secret: cursorSecret,
+		Fields: []pagination.Field{
+			{Name: "name", Type: pagination.String, Sortable: true},
+			{Name: store.FieldVersion, Type: pagination.Number},
+			{Name: store.FieldCreatedAt, Type: pagination.Time, Sortable: true},
+			{Name: store.FieldUpdatedAt, Type: pagination.Time, Sortable: true},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ItemsHandler{
+		logger:    l.With("component", "items"),
+		items:     store.NewCollection[api.NewItem](s, "items"),
+		paginator: paginator,
+		schema:    schema.Value,
+	}, nil
+}
+
+// RegisterOperations registers the asynchronous item operations with ops and enables the routes that start them.
+// Call it before Routes.
+func (h *ItemsHandler) RegisterOperations(ops *OperationsHandler) {
+	h.operations = ops
+	ops.Register(exportOperation, h.export)
+}
+
+// RegisterEvents publishes the ItemCreated, ItemUpdated and ItemDeleted events of every change with b, in the
+// transaction of the change.
+func (h *ItemsHandler) RegisterEvents(b *events.Bus) {
+	h.events = b
+}
+
+// Routes registers the item routes on r.
+func (h *ItemsHandler) Routes(r chi.Router) {
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	if h.operations != nil {
+		r.Post("/export", h.Export)
+	}
+	r.Get("/{id}", h.Get)
+	r.Put("/{id}", h.Update)
+	r.Patch("/{id}", h.Patch)
+	r.Delete("/{id}", h.Delete)
+}
+
+// List returns a page of items, oldest first unless the request sets a sort.
+func (h *ItemsHandler) List(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q, err := h.paginator.Parse(values)
+	if err != nil {
+		render.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	docs, err := h.items.List(r.Context(), q)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	docs, next, err := pagination.Page(h.paginator, q, values, docs)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	resp := api.ItemList{Items: make([]api.Item, 0, len(docs)), NextCursor: next}
+	for _, doc := range docs {
+		resp.Items = append(resp.Items, toItem(doc))
+	}
+
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// Create stores a new item and responds with 201 and its location.
+func (h *ItemsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var item api.NewItem
+	if !decodeJSON(w, r, &item) {
+		return
+	}
+
+	doc, err := h.create(r.Context(), item)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+doc.ID)
+	w.Header().Set("ETag", itemETag(doc))
+	render.JSON(w, http.StatusCreated, toItem(doc))
+}
+
+// Get returns an item, or 304 if it matches If-None-Match.
+func (h *ItemsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	doc, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Accept-Patch", acceptPatch)
+	render.JSON(w, http.StatusOK, toItem(doc))
+}
+
+// Update replaces an item.
+func (h *ItemsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var item api.NewItem
+	if !decodeJSON(w, r, &item) {
+		return
+	}
+
+	doc, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	h.save(w, r, doc, item)
+}
+
+// Patch applies a JSON Merge Patch or JSON Patch to an item.
+func (h *ItemsHandler) Patch(w http.ResponseWriter, r *http.Request) {
+	doc, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	var item api.NewItem
+	if !patchJSON(w, r, doc.Value, h.schema, &item) {
+		return
+	}
+
+	h.save(w, r, doc, item)
+}
+
+// Delete removes an item.
+func (h *ItemsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	doc, ok := h.load(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.delete(r.Context(), doc)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Export starts an export of every item and responds with 202 and the location of the operation.
+func (h *ItemsHandler) Export(w http.ResponseWriter, r *http.Request) {
+	h.operations.Start(w, r, exportOperation, nil)
+}
+
+// export reads every item a page at a time and returns them as an api.ItemExport.
+func (h *ItemsHandler) export(ctx context.Context, task *operations.Task) (any, error) {
+	resp := api.ItemExport{Items: []api.Item{}}
+	q := store.Query{Limit: exportPageSize}
+	for {
+		docs, err := h.items.List(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, doc := range docs {
+			resp.Items = append(resp.Items, toItem(doc))
+		}
+		task.Progress(0, fmt.Sprintf("exported %d items", len(resp.Items)))
+
+		if len(docs) < exportPageSize {
+			return resp, nil
+		}
+
+		q.After, err = store.SortKey(docs[len(docs)-1].Record(), q)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// load fetches the item in the URL and evaluates the conditional request headers against it.
+// It returns false if a response has already been written.
+func (h *ItemsHandler) load(w http.ResponseWriter, r *http.Request) (store.Document[api.NewItem], bool) {
+	doc, err := h.items.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err)
+		return doc, false
+	}
+
+	return doc, middleware.Preconditions{ETag: itemETag(doc), LastModified: doc.UpdatedAt}.Check(w, r)
+}
+
+// save stores a new value for a loaded item. The version read by load guards against concurrent changes.
+func (h *ItemsHandler) save(w http.ResponseWriter, r *http.Request, doc store.Document[api.NewItem], item api.NewItem) {
+	doc, err := h.update(r.Context(), doc, item)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", itemETag(doc))
+	render.JSON(w, http.StatusOK, toItem(doc))
+}
+
+// create stores a new item and publishes ItemCreated. The REST and gRPC APIs share it.
+func (h *ItemsHandler) create(ctx context.Context, item api.NewItem) (store.Document[api.NewItem], error) {
+	var doc store.Document[api.NewItem]
+	err := h.change(ctx, func(ctx context.Context) error {
+		var err error
+		doc, err = h.items.Create(ctx, item)
+		if err != nil {
+			return err
+		}
+		return h.publish(ctx, ItemCreated, toItem(doc))
+	})
+
+	return doc, err
+}
+
+// update replaces a loaded item and publishes ItemUpdated. The version of doc guards against concurrent changes.
+func (h *ItemsHandler) update(ctx context.Context, doc store.Document[api.NewItem], item api.NewItem) (store.Document[api.NewItem], error) {
+	err := h.change(ctx, func(ctx context.Context) error {
+		var err error
+		doc, err = h.items.Update(ctx, doc.ID, doc.Version, item)
+		if err != nil {
+			return err
+		}
+		return h.publish(ctx, ItemUpdated, toItem(doc))
+	})
+
+	return doc, err
+}
+
+// delete removes a loaded item and publishes ItemDeleted. The version of doc guards against concurrent changes.
+func (h *ItemsHandler) delete(ctx context.Context, doc store.Document[api.NewItem]) error {
+	return h.change(ctx, func(ctx context.Context) error {
+		err := h.items.Delete(ctx, doc.ID, doc.Version)
+		if err != nil {
+			return err
+		}
+		return h.publish(ctx, ItemDeleted, toItem(doc))
+	})
+}
+
+// change runs fn, which stores a change and publishes its event, in a transaction if events are registered.
+func (h *ItemsHandler) change(ctx context.Context, fn func(ctx context.Context) error) error {
+	if h.events == nil {
+		return fn(ctx)
+	}
+
+	return h.events.WithTx(ctx, fn)
+}
+
+// publish adds an event about an item to the outbox in the transaction of ctx, if events are registered.
+func (h *ItemsHandler) publish(ctx context.Context, typ events.Type[api.Item], item api.Item) error {
+	if h.events == nil {
+		return nil
+	}
+
+	return events.Publish(ctx, h.events, typ, item)
+}
+
+// storeError writes the response for a store error.
+func (h *ItemsHandler) storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		render.Error(w, http.StatusNotFound, "item not found")
+	case errors.Is(err, store.ErrConflict):
+		render.Error(w, http.StatusPreconditionFailed, "the resource has been modified")
+	default:
+		h.logger.Error("store error", "err", err)
+		render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+func itemETag(doc store.Document[api.NewItem]) string {
+	return middleware.VersionETag(strconv.FormatInt(doc.Version, 10))
+}
+
+func toItem(doc store.Document[api.NewItem]) api.Item {
+	return api.Item{
+		Id:          doc.ID,
+		Name:        doc.Value.Name,
+		Description: doc.Value.Description,
+		Tags:        doc.Value.Tags,
+		Version:     doc.Version,
+		CreatedAt:   doc.CreatedAt,
+		UpdatedAt:   doc.UpdatedAt,
+	}
+}
+
+// decodeJSON decodes the request body into v, writing an error response and returning false if it cannot.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		render.Error(w, http.StatusRequestEntityTooLarge, err.Error())
+		return false
+	}
+
+	render.Error(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+	return false
+}
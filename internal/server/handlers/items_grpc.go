@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/circa10a/go-rest-template/api"
+	itemsv1 "github.com/circa10a/go-rest-template/api/proto/items/v1"
+	"github.com/circa10a/go-rest-template/internal/server/middleware"
+	"github.com/circa10a/go-rest-template/internal/server/pagination"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/getkin/kin-openapi/openapi3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// itemsService serves the items of an ItemsHandler over gRPC. Requests are validated against the same
+// NewItem schema as the REST API, and changes publish the same events.
+type itemsService struct {
+	itemsv1.UnimplementedItemsServiceServer
+	h *ItemsHandler
+}
+
+// RegisterGRPC registers the gRPC items service with r.
+func (h *ItemsHandler) RegisterGRPC(r grpc.ServiceRegistrar) {
+	itemsv1.RegisterItemsServiceServer(r, &itemsService{h: h})
+}
+
+// ListItems returns a page of items. Its fields map to the query parameters of the REST API, so page tokens
+// are cursors and work with either API.
+func (s *itemsService) ListItems(ctx context.Context, req *itemsv1.ListItemsRequest) (*itemsv1.ListItemsResponse, error) {
+	values := url.Values{"filter": req.GetFilters()}
+	if req.GetPageSize() > 0 {
+		values.Set("limit", strconv.Itoa(int(req.GetPageSize())))
+	}
+	if req.GetPageToken() != "" {
+		values.Set("cursor", req.GetPageToken())
+	}
+	if req.GetOrderBy() != "" {
+		values.Set("sort", req.GetOrderBy())
+	}
+
+	q, err := s.h.paginator.Parse(values)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	docs, err := s.h.items.List(ctx, q)
+	if err != nil {
+		return nil, s.h.grpcError(err)
+	}
+
+	docs, next, err := pagination.Page(s.h.paginator, q, values, docs)
+	if err != nil {
+		return nil, s.h.grpcError(err)
+	}
+
+	resp := &itemsv1.ListItemsResponse{Items: make([]*itemsv1.Item, 0, len(docs))}
+	for _, doc := range docs {
+		resp.Items = append(resp.Items, toProtoItem(doc))
+	}
+	if next != nil {
+		resp.NextPageToken = *next
+	}
+
+	return resp, nil
+}
+
+// GetItem returns an item.
+func (s *itemsService) GetItem(ctx context.Context, req *itemsv1.GetItemRequest) (*itemsv1.GetItemResponse, error) {
+	doc, err := s.h.items.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, s.h.grpcError(err)
+	}
+
+	return &itemsv1.GetItemResponse{Item: toProtoItem(doc)}, nil
+}
+
+// CreateItem stores a new item.
+func (s *itemsService) CreateItem(ctx context.Context, req *itemsv1.CreateItemRequest) (*itemsv1.CreateItemResponse, error) {
+	item, err := s.h.newItem(req.GetName(), req.Description, req.GetTags())
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := s.h.create(ctx, item)
+	if err != nil {
+		return nil, s.h.grpcError(err)
+	}
+
+	return &itemsv1.CreateItemResponse{Item: toProtoItem(doc)}, nil
+}
+
+// UpdateItem replaces an item, if it still has the version of the request when it is set.
+func (s *itemsService) UpdateItem(ctx context.Context, req *itemsv1.UpdateItemRequest) (*itemsv1.UpdateItemResponse, error) {
+	item, err := s.h.newItem(req.GetName(), req.Description, req.GetTags())
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := s.h.items.Get(ctx, req.GetId())
+	if err == nil && req.GetVersion() != 0 && req.GetVersion() != doc.Version {
+		err = store.ErrConflict
+	}
+	if err == nil {
+		doc, err = s.h.update(ctx, doc, item)
+	}
+	if err != nil {
+		return nil, s.h.grpcError(err)
+	}
+
+	return &itemsv1.UpdateItemResponse{Item: toProtoItem(doc)}, nil
+}
+
+// DeleteItem removes an item, if it still has the version of the request when it is set.
+func (s *itemsService) DeleteItem(ctx context.Context, req *itemsv1.DeleteItemRequest) (*itemsv1.DeleteItemResponse, error) {
+	doc, err := s.h.items.Get(ctx, req.GetId())
+	if err == nil && req.GetVersion() != 0 && req.GetVersion() != doc.Version {
+		err = store.ErrConflict
+	}
+	if err == nil {
+		err = s.h.delete(ctx, doc)
+	}
+	if err != nil {
+		return nil, s.h.grpcError(err)
+	}
+
+	return &itemsv1.DeleteItemResponse{}, nil
+}
+
+// newItem builds an item from the fields of a gRPC request and validates it against the NewItem schema, as
+// the validation middleware does for REST requests. It returns an InvalidArgument error if it does not match.
+func (h *ItemsHandler) newItem(name string, description *string, tags []string) (api.NewItem, error) {
+	item := api.NewItem{Name: name, Description: description}
+	if len(tags) > 0 {
+		item.Tags = &tags
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return item, status.Error(codes.Internal, "internal error")
+	}
+
+	var value any
+	err = json.Unmarshal(data, &value)
+	if err == nil {
+		err = h.schema.VisitJSON(value)
+	}
+	if err != nil {
+		message := err.Error()
+		var schemaErr *openapi3.SchemaError
+		if errors.As(err, &schemaErr) {
+			message = middleware.DescribeSchemaError(schemaErr)
+		}
+		return item, status.Error(codes.InvalidArgument, "invalid item: "+message)
+	}
+
+	return item, nil
+}
+
+// grpcError returns the gRPC status of a store error.
+func (h *ItemsHandler) grpcError(err error) error {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		return status.Error(codes.NotFound, "item not found")
+	case errors.Is(err, store.ErrConflict):
+		return status.Error(codes.Aborted, "the resource has been modified")
+	default:
+		h.logger.Error("store error", "err", err)
+		return status.Error(codes.Internal, "internal error")
+	}
+}
+
+func toProtoItem(doc store.Document[api.NewItem]) *itemsv1.Item {
+	item := &itemsv1.Item{
+		Id:          doc.ID,
+		Name:        doc.Value.Name,
+		Description: doc.Value.Description,
+		Version:     doc.Version,
+		CreatedAt:   timestamppb.New(doc.CreatedAt),
+		UpdatedAt:   timestamppb.New(doc.UpdatedAt),
+	}
+	if doc.Value.Tags != nil {
+		item.Tags = *doc.Value.Tags
+	}
+
+	return item
+}
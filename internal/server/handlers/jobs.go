@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// Default and maximum page sizes of the job list, matching the Limit parameter of the spec.
+const (
+	defaultJobsLimit = 20
+	maxJobsLimit     = 100
+)
+
+/*
+JobsHandler serves the admin API for background jobs, for inspecting the queue and recovering
+dead-lettered jobs. Mount it behind authentication.
+Example response:
+
+	{
+		"id": "3d2c1b0a-9f8e-4d7c-8b6a-5f4e3d2c1b0a",
+		"kind": "log",
+		"state": "dead",
+		"args": {"message": "hello"},
+		"attempts": 10,
+		"max_attempts": 10,
+		"last_error": "connection refused",
+		"run_at": "2026-01-01T00:00:00Z",
+		"created_at": "2026-01-01T00:00:00Z",
+		"updated_at": "2026-01-01T01:00:00Z"
+	}
+*/
+type JobsHandler struct {
+	logger *slog.Logger
+	jobs   store.JobStore
+}
+
+// NewJobsHandler returns the admin handler for the jobs stored in s.
+func NewJobsHandler(l *slog.Logger, s store.JobStore) *JobsHandler {
+	return &JobsHandler{
+		logger: l.With("component", "jobs"),
+		jobs:   s,
+	}
+}
+
+// Routes registers the job routes on r.
+func (h *JobsHandler) Routes(r chi.Router) {
+	r.Get("/", h.List)
+	r.Get("/{id}", h.Get)
+	r.Delete("/{id}", h.Discard)
+	r.Post("/{id}/retry", h.Retry)
+}
+
+// List returns a page of jobs, oldest first.
+func (h *JobsHandler) List(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q := store.JobQuery{
+		Kind:  values.Get("kind"),
+		State: store.JobState(values.Get("state")),
+		Limit: defaultJobsLimit,
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxJobsLimit {
+			render.Error(w, http.StatusBadRequest, "limit must be between 1 and 100")
+			return
+		}
+		q.Limit = n
+	}
+
+	if cursor := values.Get("cursor"); cursor != "" {
+		var ok bool
+		q.AfterCreatedAt, q.AfterID, ok = decodeJobCursor(cursor)
+		if !ok {
+			render.Error(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+	}
+
+	// Fetch one extra job to find out whether there is a next page
+	q.Limit++
+	jobs, err := h.jobs.ListJobs(r.Context(), q)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	resp := api.JobList{Jobs: make([]api.Job, 0, len(jobs))}
+	if len(jobs) == q.Limit {
+		jobs = jobs[:len(jobs)-1]
+		next := encodeJobCursor(jobs[len(jobs)-1])
+		resp.NextCursor = &next
+	}
+	for _, job := range jobs {
+		resp.Jobs = append(resp.Jobs, toJob(job))
+	}
+
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// Get returns a job.
+func (h *JobsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.GetJob(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, toJob(job))
+}
+
+// Retry makes a pending or dead job due now with its attempts reset.
+func (h *JobsHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	job, err := h.jobs.RetryJob(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusOK, toJob(job))
+}
+
+// Discard deletes a pending or dead job.
+func (h *JobsHandler) Discard(w http.ResponseWriter, r *http.Request) {
+	err := h.jobs.DiscardJob(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// storeError writes the response for a store error.
+func (h *JobsHandler) storeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		render.Error(w, http.StatusNotFound, "job not found")
+	case errors.Is(err, store.ErrConflict):
+		render.Error(w, http.StatusConflict, "the job is running or another job holds its unique key")
+	default:
+		h.logger.Error("store error", "err", err)
+		render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+// encodeJobCursor returns the cursor of the page after job.
+func encodeJobCursor(job store.Job) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(job.CreatedAt.Format(time.RFC3339Nano) + " " + job.ID))
+}
+
+// decodeJobCursor returns the creation time and ID of the last job of the previous page.
+func decodeJobCursor(cursor string) (time.Time, string, bool) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+
+	createdAt, id, ok := strings.Cut(string(data), " ")
+	if !ok || id == "" {
+		return time.Time{}, "", false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+
+	return t, id, true
+}
+
+func toJob(job store.Job) api.Job {
+	resp := api.Job{
+		Id:          job.ID,
+		Kind:        job.Kind,
+		State:       api.JobState(job.State),
+		Attempts:    job.Attempts,
+		MaxAttempts: job.MaxAttempts,
+		RunAt:       job.RunAt,
+		CreatedAt:   job.CreatedAt,
+		UpdatedAt:   job.UpdatedAt,
+	}
+	if len(job.Args) > 0 {
+		resp.Args = json.RawMessage(job.Args)
+	}
+	if job.UniqueKey != "" {
+		resp.UniqueKey = &job.UniqueKey
+	}
+	if job.LastError != "" {
+		resp.LastError = &job.LastError
+	}
+	if !job.LockedUntil.IsZero() {
+		resp.LockedUntil = &job.LockedUntil
+	}
+
+	return resp
+}
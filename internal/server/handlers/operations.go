@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/operations"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// operationRetryAfter is the number of seconds clients are asked to wait between polls of an unfinished operation.
+const operationRetryAfter = "1"
+
+/*
+OperationsHandler serves asynchronous operations. Handlers for requests that take too long to answer
+within the write timeout start an operation with Start, which responds with 202 Accepted and the location
+of the operation. Clients poll it until it finishes, then fetch its result.
+Example response:
+
+	{
+		"id": "9c1f2e3d-4b5a-4c6d-8e7f-0a1b2c3d4e5f",
+		"type": "items.export",
+		"status": "running",
+		"progress": 40,
+		"message": "exported 400 items",
+		"created_at": "2026-01-01T00:00:00Z",
+		"updated_at": "2026-01-01T00:00:05Z"
+	}
+*/
+type OperationsHandler struct {
+	logger  *slog.Logger
+	manager *operations.Manager
+	path    string
+}
+
+// NewOperationsHandler returns the handler for the operations run by m, which is mounted at path.
+func NewOperationsHandler(l *slog.Logger, m *operations.Manager, path string) *OperationsHandler {
+	return &OperationsHandler{
+		logger:  l.With("component", "operations"),
+		manager: m,
+		path:    strings.TrimSuffix(path, "/"),
+	}
+}
+
+// Routes registers the operation routes on r.
+func (h *OperationsHandler) Routes(r chi.Router) {
+	r.Get("/{id}", h.Get)
+	r.Get("/{id}/result", h.Result)
+	r.Post("/{id}/cancel", h.Cancel)
+}
+
+// Register sets the function that performs operations of type kind.
+func (h *OperationsHandler) Register(kind string, fn operations.Func) {
+	h.manager.Register(kind, fn)
+}
+
+// Start starts an operation of type kind with input and responds with 202 and its location.
+func (h *OperationsHandler) Start(w http.ResponseWriter, r *http.Request, kind string, input any) {
+	op, err := h.manager.Start(r.Context(), kind, input)
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", h.path+"/"+op.ID)
+	w.Header().Set("Retry-After", operationRetryAfter)
+	render.JSON(w, http.StatusAccepted, toAPIOperation(op))
+}
+
+// Get returns the status and progress of an operation.
+func (h *OperationsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	op, err := h.manager.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	if !op.Status.Done() {
+		w.Header().Set("Retry-After", operationRetryAfter)
+	}
+	render.JSON(w, http.StatusOK, toAPIOperation(op))
+}
+
+// Result returns the result of a succeeded operation, or 409 if it has not succeeded.
+func (h *OperationsHandler) Result(w http.ResponseWriter, r *http.Request) {
+	op, result, err := h.manager.Result(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, operations.ErrNotSucceeded) {
+		if !op.Status.Done() {
+			w.Header().Set("Retry-After", operationRetryAfter)
+		}
+		render.Error(w, http.StatusConflict, "operation is "+string(op.Status))
+		return
+	}
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(result)
+}
+
+// Cancel requests cancellation of an operation, or responds with 409 if it has finished.
+func (h *OperationsHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	op, err := h.manager.Cancel(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, operations.ErrDone) {
+		render.Error(w, http.StatusConflict, "operation is "+string(op.Status))
+		return
+	}
+	if err != nil {
+		h.storeError(w, err)
+		return
+	}
+
+	render.JSON(w, http.StatusAccepted, toAPIOperation(op))
+}
+
+// storeError writes the response for a store error.
+func (h *OperationsHandler) storeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, store.ErrNotFound) {
+		render.Error(w, http.StatusNotFound, "operation not found")
+		return
+	}
+
+	h.logger.Error("store error", "err", err)
+	render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+func toAPIOperation(op operations.Operation) api.Operation {
+	resp := api.Operation{
+		Id:        op.ID,
+		Type:      op.Type,
+		Status:    api.OperationStatus(op.Status),
+		Progress:  op.Progress,
+		CreatedAt: op.CreatedAt,
+		UpdatedAt: op.UpdatedAt,
+	}
+	if op.Message != "" {
+		resp.Message = &op.Message
+	}
+	if op.Error != "" {
+		resp.Error = &op.Error
+	}
+
+	return resp
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/circa10a/go-rest-template/internal/patch"
+	"github.com/circa10a/go-rest-template/internal/server/middleware"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// acceptPatch lists the patch formats accepted by patchJSON.
+const acceptPatch = patch.MergePatchType + ", " + patch.JSONPatchType
+
+/*
+patchJSON applies the JSON Merge Patch or JSON Patch in the request body to current, selected by the
+Content-Type of the request. The result is validated against schema before it is decoded into result,
+so a patch cannot produce a resource that a full update would have rejected.
+It writes an error response and returns false if the patch cannot be applied:
+
+  - 400 if the patch document is invalid
+  - 409 if a JSON Patch test operation fails
+  - 415 if the content type is not a patch format
+  - 422 if an operation targets a missing location or the result does not match schema
+*/
+func patchJSON(w http.ResponseWriter, r *http.Request, current any, schema *openapi3.Schema, result any) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			render.Error(w, http.StatusRequestEntityTooLarge, err.Error())
+			return false
+		}
+		render.Error(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return false
+	}
+
+	doc, err := json.Marshal(current)
+	if err != nil {
+		render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return false
+	}
+
+	var patched []byte
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case patch.MergePatchType:
+		patched, err = patch.Merge(doc, body)
+		if err != nil {
+			render.Error(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+	case patch.JSONPatchType:
+		ops, err := patch.DecodeJSONPatch(body)
+		if err != nil {
+			render.Error(w, http.StatusBadRequest, err.Error())
+			return false
+		}
+
+		patched, err = patch.Apply(doc, ops)
+		if errors.Is(err, patch.ErrTestFailed) {
+			render.Error(w, http.StatusConflict, err.Error())
+			return false
+		}
+		if err != nil {
+			render.Error(w, http.StatusUnprocessableEntity, err.Error())
+			return false
+		}
+	default:
+		w.Header().Set("Accept-Patch", acceptPatch)
+		render.Error(w, http.StatusUnsupportedMediaType, "unsupported content type "+r.Header.Get("Content-Type"))
+		return false
+	}
+
+	var value any
+	err = json.Unmarshal(patched, &value)
+	if err == nil {
+		err = schema.VisitJSON(value)
+	}
+	if err != nil {
+		message := err.Error()
+		var schemaErr *openapi3.SchemaError
+		if errors.As(err, &schemaErr) {
+			message = middleware.DescribeSchemaError(schemaErr)
+		}
+		render.Error(w, http.StatusUnprocessableEntity, "invalid patch result: "+message)
+		return false
+	}
+
+	err = json.Unmarshal(patched, result)
+	if err != nil {
+		render.Error(w, http.StatusUnprocessableEntity, "invalid patch result: "+err.Error())
+		return false
+	}
+
+	return true
+}
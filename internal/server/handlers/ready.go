@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+)
+
+// readyTimeout bounds how long a single dependency check may take.
+const readyTimeout = 2 * time.Second
+
+// ReadyCheck reports whether a dependency is available.
+type ReadyCheck func(ctx context.Context) error
+
+/*
+ReadyHandleFunc returns the http handler that indicates the application can serve traffic.
+Every check runs concurrently and the response is 503 if any of them fail. Check errors are
+logged rather than returned since they may contain connection details.
+Example response:
+
+	{
+		"status": "ok",
+		"checks": {
+			"store": "ok"
+		}
+	}
+*/
+func ReadyHandleFunc(l *slog.Logger, checks map[string]ReadyCheck) http.HandlerFunc {
+	log := l.With("component", "ready")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+		defer cancel()
+
+		resp := api.Readiness{Status: "ok", Checks: make(map[string]string, len(checks))}
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for name, check := range checks {
+			wg.Go(func() {
+				err := check(ctx)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err != nil {
+					log.Warn("readiness check failed", "check", name, "err", err)
+					resp.Status = "unavailable"
+					resp.Checks[name] = "unavailable"
+					return
+				}
+				resp.Checks[name] = "ok"
+			})
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		if resp.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+
+		render.JSON(w, status, resp)
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circa10a/go-rest-template/api"
+)
+
+func TestReadyHandleFunc(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	failing := func(context.Context) error { return errors.New("connection refused") }
+
+	tests := []struct {
+		checks         map[string]ReadyCheck
+		expectedChecks map[string]string
+		name           string
+		expectedStatus string
+		expectedCode   int
+	}{
+		{
+			name:           "no checks",
+			checks:         map[string]ReadyCheck{},
+			expectedCode:   http.StatusOK,
+			expectedStatus: "ok",
+			expectedChecks: map[string]string{},
+		},
+		{
+			name:           "all checks pass",
+			checks:         map[string]ReadyCheck{"store": ok, "cache": ok},
+			expectedCode:   http.StatusOK,
+			expectedStatus: "ok",
+			expectedChecks: map[string]string{"store": "ok", "cache": "ok"},
+		},
+		{
+			name:           "a check fails",
+			checks:         map[string]ReadyCheck{"store": failing, "cache": ok},
+			expectedCode:   http.StatusServiceUnavailable,
+			expectedStatus: "unavailable",
+			expectedChecks: map[string]string{"store": "unavailable", "cache": "ok"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := ReadyHandleFunc(slog.New(slog.NewTextHandler(io.Discard, nil)), tt.checks)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+
+			if rec.Code != tt.expectedCode {
+				t.Errorf("unexpected status code: got %d want %d", rec.Code, tt.expectedCode)
+			}
+
+			var resp api.Readiness
+			err := json.NewDecoder(rec.Body).Decode(&resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Status != tt.expectedStatus {
+				t.Errorf("unexpected status: got %s want %s", resp.Status, tt.expectedStatus)
+			}
+
+			if len(resp.Checks) != len(tt.expectedChecks) {
+				t.Errorf("unexpected checks: got %v want %v", resp.Checks, tt.expectedChecks)
+			}
+			for name, expected := range tt.expectedChecks {
+				if resp.Checks[name] != expected {
+					t.Errorf("unexpected result for check %s: got %s want %s", name, resp.Checks[name], expected)
+				}
+			}
+		})
+	}
+}
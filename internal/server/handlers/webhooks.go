@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/server/pagination"
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/circa10a/go-rest-template/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+/*
+WebhooksHandler serves webhook subscriptions and their delivery log. Deliveries are sent by a
+webhooks.Dispatcher. The signing secret of a subscription is only returned when it is created.
+Example response:
+
+	{
+		"id": "7a6b5c4d-3e2f-4a1b-9c8d-7e6f5a4b3c2d",
+		"url": "https://example.com/webhooks",
+		"events": ["item.created", "item.deleted"],
+		"active": true,
+		"created_at": "2026-01-01T00:00:00Z",
+		"updated_at": "2026-01-01T00:00:00Z"
+	}
+*/
+type WebhooksHandler struct {
+	logger        *slog.Logger
+	subscriptions *store.Collection[webhooks.Subscription]
+	deliveries    *store.Collection[webhooks.Delivery]
+	dispatcher    *webhooks.Dispatcher
+	paginator     *pagination.Paginator
+	deliveryPages *pagination.Paginator
+}
+
+// NewWebhooksHandler returns the handler for the webhook subscriptions stored in s, which d delivers to.
+// cursorSecret signs list cursors.
+func NewWebhooksHandler(l *slog.Logger, s store.Store, d *webhooks.Dispatcher, cursorSecret []byte) (*WebhooksHandler, error) {
+	paginator, err := pagination.New(pagination.Config{
+		Secret: cursorSecret,
+		Fields: []pagination.Field{
+			{Name: "url", Type: pagination.String},
+			{Name: "active", Type: pagination.Bool},
+			{Name: store.FieldCreatedAt, Type: pagination.Time, Sortable: true},
+			{Name: store.FieldUpdatedAt, Type: pagination.Time, Sortable: true},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deliveryPages, err := pagination.New(pagination.Config{
+		Secret: cursorSecret,
+		Fields: []pagination.Field{
+			{Name: "status", Type: pagination.String, Operators: []store.Operator{store.OpEq, store.OpNe}},
+			{Name: "event_type", Type: pagination.String, Operators: []store.Operator{store.OpEq, store.OpNe}},
+			{Name: store.FieldCreatedAt, Type: pagination.Time, Sortable: true},
+			{Name: store.FieldUpdatedAt, Type: pagination.Time, Sortable: true},
+		},
+		DefaultSort: []store.Sort{{Field: store.FieldCreatedAt, Desc: true}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebhooksHandler{
+		logger:        l.With("component", "webhooks"),
+		subscriptions: store.NewCollection[webhooks.Subscription](s, webhooks.SubscriptionsCollection),
+		deliveries:    store.NewCollection[webhooks.Delivery](s, webhooks.DeliveriesCollection),
+		dispatcher:    d,
+		paginator:     paginator,
+		deliveryPages: deliveryPages,
+	}, nil
+}
+
+// Routes registers the webhook routes on r.
+func (h *WebhooksHandler) Routes(r chi.Router) {
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	r.Get("/{id}", h.Get)
+	r.Put("/{id}", h.Update)
+	r.Delete("/{id}", h.Delete)
+	r.Get("/{id}/deliveries", h.ListDeliveries)
+	r.Get("/{id}/deliveries/{deliveryId}", h.GetDelivery)
+	r.Post("/{id}/deliveries/{deliveryId}/redeliver", h.Redeliver)
+}
+
+// List returns a page of webhooks, oldest first unless the request sets a sort.
+func (h *WebhooksHandler) List(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	q, err := h.paginator.Parse(values)
+	if err != nil {
+		render.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	docs, err := h.subscriptions.List(r.Context(), q)
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	docs, next, err := pagination.Page(h.paginator, q, values, docs)
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	resp := api.WebhookList{Webhooks: make([]api.Webhook, 0, len(docs)), NextCursor: next}
+	for _, doc := range docs {
+		resp.Webhooks = append(resp.Webhooks, toWebhook(doc))
+	}
+
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// Create stores a new webhook with a new signing secret and responds with 201, its location and the secret.
+func (h *WebhooksHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var webhook api.NewWebhook
+	if !decodeJSON(w, r, &webhook) {
+		return
+	}
+
+	sub := toSubscription(webhook)
+	sub.Secret = webhooks.NewSecret()
+	doc, err := h.subscriptions.Create(r.Context(), sub)
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	created := toWebhook(doc)
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+doc.ID)
+	render.JSON(w, http.StatusCreated, api.WebhookWithSecret{
+		Id:          created.Id,
+		Url:         created.Url,
+		Description: created.Description,
+		Events:      created.Events,
+		Active:      created.Active,
+		Secret:      doc.Value.Secret,
+		CreatedAt:   created.CreatedAt,
+		UpdatedAt:   created.UpdatedAt,
+	})
+}
+
+// Get returns a webhook.
+func (h *WebhooksHandler) Get(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.subscriptions.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	render.JSON(w, http.StatusOK, toWebhook(doc))
+}
+
+// Update replaces a webhook, keeping its signing secret.
+func (h *WebhooksHandler) Update(w http.ResponseWriter, r *http.Request) {
+	var webhook api.NewWebhook
+	if !decodeJSON(w, r, &webhook) {
+		return
+	}
+
+	doc, err := h.subscriptions.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	sub := toSubscription(webhook)
+	sub.Secret = doc.Value.Secret
+	doc, err = h.subscriptions.Update(r.Context(), doc.ID, doc.Version, sub)
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	render.JSON(w, http.StatusOK, toWebhook(doc))
+}
+
+// Delete removes a webhook. Its pending deliveries fail when they are attempted.
+func (h *WebhooksHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	err := h.subscriptions.Delete(r.Context(), chi.URLParam(r, "id"), 0)
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns a page of the delivery log of a webhook, newest first unless the request sets a sort.
+func (h *WebhooksHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	_, err := h.subscriptions.Get(r.Context(), id)
+	if err != nil {
+		h.storeError(w, err, "webhook not found")
+		return
+	}
+
+	values := r.URL.Query()
+	q, err := h.deliveryPages.Parse(values)
+	if err != nil {
+		render.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	q.Filters = append(q.Filters, store.Filter{Field: "subscription_id", Op: store.OpEq, Value: id})
+
+	docs, err := h.deliveries.List(r.Context(), q)
+	if err != nil {
+		h.storeError(w, err, "delivery not found")
+		return
+	}
+
+	docs, next, err := pagination.Page(h.deliveryPages, q, values, docs)
+	if err != nil {
+		h.storeError(w, err, "delivery not found")
+		return
+	}
+
+	resp := api.WebhookDeliveryList{Deliveries: make([]api.WebhookDelivery, 0, len(docs)), NextCursor: next}
+	for _, doc := range docs {
+		resp.Deliveries = append(resp.Deliveries, toWebhookDelivery(doc))
+	}
+
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// GetDelivery returns a delivery of a webhook.
+func (h *WebhooksHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	doc, err := h.deliveries.Get(r.Context(), chi.URLParam(r, "deliveryId"))
+	if err == nil && doc.Value.SubscriptionID != chi.URLParam(r, "id") {
+		err = store.ErrNotFound
+	}
+	if err != nil {
+		h.storeError(w, err, "delivery not found")
+		return
+	}
+
+	render.JSON(w, http.StatusOK, toWebhookDelivery(doc))
+}
+
+// Redeliver sends a delivery again as a new delivery and responds with 202 and its location.
+func (h *WebhooksHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	doc, err := h.dispatcher.Redeliver(r.Context(), id, chi.URLParam(r, "deliveryId"))
+	if err != nil {
+		h.storeError(w, err, "delivery not found")
+		return
+	}
+
+	location := strings.TrimSuffix(r.URL.Path, "/")
+	location = location[:strings.LastIndex(location, "/deliveries/")] + "/deliveries/" + doc.ID
+	w.Header().Set("Location", location)
+	render.JSON(w, http.StatusAccepted, toWebhookDelivery(doc))
+}
+
+// storeError writes the response for a store error, with notFound as the message for missing resources.
+func (h *WebhooksHandler) storeError(w http.ResponseWriter, err error, notFound string) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		render.Error(w, http.StatusNotFound, notFound)
+	case errors.Is(err, store.ErrConflict):
+		render.Error(w, http.StatusConflict, "the webhook has been modified concurrently")
+	default:
+		h.logger.Error("store error", "err", err)
+		render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+func toSubscription(webhook api.NewWebhook) webhooks.Subscription {
+	sub := webhooks.Subscription{URL: webhook.Url, Active: true}
+	if webhook.Description != nil {
+		sub.Description = *webhook.Description
+	}
+	if webhook.Active != nil {
+		sub.Active = *webhook.Active
+	}
+	for _, event := range webhook.Events {
+		sub.Events = append(sub.Events, string(event))
+	}
+
+	return sub
+}
+
+func toWebhook(doc store.Document[webhooks.Subscription]) api.Webhook {
+	resp := api.Webhook{
+		Id:        doc.ID,
+		Url:       doc.Value.URL,
+		Events:    make([]api.WebhookEventType, 0, len(doc.Value.Events)),
+		Active:    doc.Value.Active,
+		CreatedAt: doc.CreatedAt,
+		UpdatedAt: doc.UpdatedAt,
+	}
+	if doc.Value.Description != "" {
+		resp.Description = &doc.Value.Description
+	}
+	for _, event := range doc.Value.Events {
+		resp.Events = append(resp.Events, api.WebhookEventType(event))
+	}
+
+	return resp
+}
+
+func toWebhookDelivery(doc store.Document[webhooks.Delivery]) api.WebhookDelivery {
+	delivery := doc.Value
+	resp := api.WebhookDelivery{
+		Id:        doc.ID,
+		WebhookId: delivery.SubscriptionID,
+		EventId:   delivery.EventID,
+		EventType: delivery.EventType,
+		Status:    api.WebhookDeliveryStatus(delivery.Status),
+		Attempts:  delivery.Attempts,
+		Payload:   json.RawMessage(delivery.Payload),
+		CreatedAt: doc.CreatedAt,
+	}
+	if delivery.ResponseStatus != 0 {
+		resp.ResponseStatus = &delivery.ResponseStatus
+	}
+	if delivery.Error != "" {
+		resp.Error = &delivery.Error
+	}
+	if delivery.Attempts > 0 {
+		duration := delivery.Duration.Milliseconds()
+		resp.DurationMs = &duration
+	}
+	if delivery.RedeliveryOf != "" {
+		resp.RedeliveryOf = &delivery.RedeliveryOf
+	}
+	if !delivery.LastAttemptAt.IsZero() {
+		resp.LastAttemptAt = &delivery.LastAttemptAt
+	}
+
+	return resp
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/inbound"
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// inboundProviders are the providers enabled with --inbound-secret, by name. Add the definitions of other
+// providers here.
+var inboundProviders = map[string]func(secret string) inbound.Provider{
+	"github": inbound.GitHub,
+	"stripe": inbound.Stripe,
+	"partner": func(secret string) inbound.Provider {
+		return inbound.Standard("partner", secret)
+	},
+}
+
+// registerInboundHandlers registers the handlers of received webhooks. The server and the worker command
+// both call it, through registerJobs, so events are processed in whichever process claims them.
+func registerInboundHandlers(rc *inbound.Receiver, logger *slog.Logger) {
+	// Logging every event is a reference handler. Replace it with real work, such as syncing payments.
+	for provider := range inboundProviders {
+		rc.Handle(provider, inbound.AnyEvent, func(ctx context.Context, event inbound.Event) error {
+			logger.Info("received webhook", "component", "inbound", "provider", event.Provider, "type", event.Type, "external_id", event.ExternalID)
+			return nil
+		})
+	}
+}
+
+// registerInboundProviders mounts the endpoints of the providers with a secret in secrets, keyed by name.
+func registerInboundProviders(rc *inbound.Receiver, secrets map[string]string, tolerance time.Duration) error {
+	for name, secret := range secrets {
+		provider, ok := inboundProviders[name]
+		if !ok {
+			supported := strings.Join(slices.Sorted(maps.Keys(inboundProviders)), ", ")
+			return fmt.Errorf("unknown webhook provider %q, supported providers are %s", name, supported)
+		}
+
+		p := provider(secret)
+		p.Tolerance = tolerance
+		err := rc.Register(p)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReplayInboundEvents runs the handlers of stored webhooks again and returns how many were replayed. It
+// replays the events with ids, or every event matching filters if there are none. The events are processed
+// by the job workers of the servers or worker processes sharing the database at databaseURL.
+func ReplayInboundEvents(ctx context.Context, databaseURL string, ids []string, filters []store.Filter) (int, error) {
+	if databaseURL == "" || strings.HasPrefix(databaseURL, "memory:") {
+		return 0, errors.New("a database URL is required, events in the in-memory store are not shared with the server")
+	}
+
+	st, err := store.Open(ctx, databaseURL)
+	if err != nil {
+		return 0, fmt.Errorf("opening store: %w", err)
+	}
+	defer func() { _ = st.Close() }()
+
+	jobStore, ok := st.(store.JobStore)
+	if !ok {
+		return 0, fmt.Errorf("%s does not support jobs", databaseURL)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	rc := inbound.New(st, jobs.New(jobStore, jobs.Config{Logger: logger}), inbound.Config{Logger: logger})
+	if len(ids) == 0 {
+		return rc.ReplayAll(ctx, filters)
+	}
+
+	for i, id := range ids {
+		_, err = rc.Replay(ctx, id)
+		if err != nil {
+			return i, fmt.Errorf("replaying event %s: %w", id, err)
+		}
+	}
+
+	return len(ids), nil
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+func TestInboundWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := New(&Config{Store: store.NewMemory(), LogLevel: "error", InboundSecrets: map[string]string{"gitlab": "secret"}})
+	if err == nil || !strings.Contains(err.Error(), "github") {
+		t.Errorf("unexpected error for an unknown provider: %v", err)
+	}
+
+	s, err := New(&Config{
+		Store:          store.NewMemory(),
+		LogLevel:       "error",
+		AdminToken:     "secret",
+		JobWorkers:     1,
+		InboundSecrets: map[string]string{"github": "secret"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	ts := httptest.NewServer(s.mux)
+	t.Cleanup(ts.Close)
+
+	authorized := api.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer secret")
+		return nil
+	})
+	client, err := api.NewClientWithResponses(ts.URL+"/v1", authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `{"ref":"refs/heads/main"}`
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	// GitHub redelivers with the same delivery ID, so the second request is a replay
+	for i, expect := range []int{http.StatusAccepted, http.StatusOK} {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/inbound/github", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-GitHub-Delivery", "72d3162e-cc78-11e3-81ab-4c9367dc0958")
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("X-Hub-Signature-256", signature)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != expect {
+			t.Errorf("unexpected status of request %d: got %d want %d", i, resp.StatusCode, expect)
+		}
+	}
+
+	unsigned, err := http.Post(ts.URL+"/v1/inbound/github", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unsigned.Body.Close()
+	if unsigned.StatusCode != http.StatusUnauthorized {
+		t.Errorf("unexpected status of an unsigned request: got %d want %d", unsigned.StatusCode, http.StatusUnauthorized)
+	}
+
+	// waitForProcessed polls the events until there is one and it is processed
+	waitForProcessed := func() api.InboundEvent {
+		t.Helper()
+
+		for range 500 {
+			events, err := client.ListInboundEventsWithResponse(ctx, &api.ListInboundEventsParams{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if events.JSON200 != nil && len(events.JSON200.Events) == 1 && events.JSON200.Events[0].Status == api.InboundEventStatusProcessed {
+				return events.JSON200.Events[0]
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		t.Fatal("timed out waiting for the event to be processed")
+		return api.InboundEvent{}
+	}
+
+	event := waitForProcessed()
+	if event.Provider != "github" || event.Type != "push" || event.Body == nil || *event.Body != body {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	got, err := client.GetInboundEventWithResponse(ctx, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.JSON200 == nil || got.JSON200.ExternalId == nil || *got.JSON200.ExternalId != "72d3162e-cc78-11e3-81ab-4c9367dc0958" {
+		t.Errorf("unexpected event: %d %s", got.StatusCode(), got.Body)
+	}
+
+	replayed, err := client.ReplayInboundEventWithResponse(ctx, event.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayed.StatusCode() != http.StatusAccepted {
+		t.Fatalf("unexpected status replaying the event: got %d want %d", replayed.StatusCode(), http.StatusAccepted)
+	}
+	waitForProcessed()
+
+	missing, err := client.ReplayInboundEventWithResponse(ctx, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing.StatusCode() != http.StatusNotFound {
+		t.Errorf("unexpected status replaying a missing event: got %d want %d", missing.StatusCode(), http.StatusNotFound)
+	}
+}
@@ -0,0 +1,467 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// newTestClient starts the server with st behind httptest and returns a client for its API.
+func newTestClient(t *testing.T, st store.Store, opts ...api.ClientOption) *api.ClientWithResponses {
+	t.Helper()
+
+	s, err := New(&Config{Store: st, LogLevel: "error", AutoMigrate: true, ETags: true, SecurityHeaders: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	ts := httptest.NewServer(s.mux)
+	t.Cleanup(ts.Close)
+
+	client, err := api.NewClientWithResponses(ts.URL+"/v1", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func ifMatch(etag string) *string {
+	return &etag
+}
+
+func TestItems(t *testing.T) {
+	sqlite, err := store.OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "items.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]store.Store{
+		"memory": store.NewMemory(),
+		"sqlite": sqlite,
+	}
+
+	for name, st := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			client := newTestClient(t, st)
+
+			description := "A small widget"
+			created, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Widget", Description: &description, Tags: &[]string{"tools"}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.StatusCode() != http.StatusCreated || created.JSON201 == nil {
+				t.Fatalf("unexpected create response: %d %s", created.StatusCode(), created.Body)
+			}
+
+			item := *created.JSON201
+			if item.Id == "" || item.Name != "Widget" || item.Version != 1 {
+				t.Errorf("unexpected created item: %+v", item)
+			}
+			if location := created.HTTPResponse.Header.Get("Location"); location != "/v1/items/"+item.Id {
+				t.Errorf("unexpected location: got %s want %s", location, "/v1/items/"+item.Id)
+			}
+			etag := created.HTTPResponse.Header.Get("ETag")
+			if etag != strconv.Quote("1") {
+				t.Errorf("unexpected etag: got %s want %s", etag, strconv.Quote("1"))
+			}
+
+			got, err := client.GetItemWithResponse(ctx, item.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.StatusCode() != http.StatusOK || got.JSON200 == nil || got.JSON200.Name != "Widget" {
+				t.Fatalf("unexpected get response: %d %s", got.StatusCode(), got.Body)
+			}
+
+			notModified, err := client.GetItemWithResponse(ctx, item.Id, func(ctx context.Context, req *http.Request) error {
+				req.Header.Set("If-None-Match", etag)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notModified.StatusCode() != http.StatusNotModified {
+				t.Errorf("unexpected conditional get status: got %d want %d", notModified.StatusCode(), http.StatusNotModified)
+			}
+
+			_, err = client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Gadget"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			list, err := client.ListItemsWithResponse(ctx, &api.ListItemsParams{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if list.JSON200 == nil || len(list.JSON200.Items) != 2 || list.JSON200.Items[0].Id != item.Id {
+				t.Fatalf("unexpected list response: %d %s", list.StatusCode(), list.Body)
+			}
+
+			limit := 1
+			list, err = client.ListItemsWithResponse(ctx, &api.ListItemsParams{Limit: &limit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if list.JSON200 == nil || len(list.JSON200.Items) != 1 {
+				t.Errorf("unexpected limited list response: %d %s", list.StatusCode(), list.Body)
+			}
+
+			updated, err := client.UpdateItemWithResponse(ctx, item.Id, &api.UpdateItemParams{IfMatch: ifMatch(etag)}, api.NewItem{Name: "Widget v2"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated.JSON200 == nil || updated.JSON200.Name != "Widget v2" || updated.JSON200.Description != nil || updated.JSON200.Version != 2 {
+				t.Fatalf("unexpected update response: %d %s", updated.StatusCode(), updated.Body)
+			}
+
+			// The item changed since etag was read
+			stale, err := client.UpdateItemWithResponse(ctx, item.Id, &api.UpdateItemParams{IfMatch: ifMatch(etag)}, api.NewItem{Name: "Lost update"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stale.StatusCode() != http.StatusPreconditionFailed {
+				t.Errorf("unexpected stale update status: got %d want %d", stale.StatusCode(), http.StatusPreconditionFailed)
+			}
+
+			tags := []string{"tools", "small"}
+			patched, err := client.PatchItemWithApplicationMergePatchPlusJSONBodyWithResponse(ctx, item.Id, &api.PatchItemParams{}, api.ItemPatch{Tags: &tags})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if patched.JSON200 == nil || patched.JSON200.Name != "Widget v2" || patched.JSON200.Tags == nil || len(*patched.JSON200.Tags) != 2 {
+				t.Fatalf("unexpected patch response: %d %s", patched.StatusCode(), patched.Body)
+			}
+
+			deleted, err := client.DeleteItemWithResponse(ctx, item.Id, &api.DeleteItemParams{IfMatch: ifMatch(patched.HTTPResponse.Header.Get("ETag"))})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if deleted.StatusCode() != http.StatusNoContent {
+				t.Errorf("unexpected delete status: got %d want %d", deleted.StatusCode(), http.StatusNoContent)
+			}
+
+			missing, err := client.GetItemWithResponse(ctx, item.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if missing.StatusCode() != http.StatusNotFound || missing.JSON404 == nil {
+				t.Errorf("unexpected status getting deleted item: got %d want %d", missing.StatusCode(), http.StatusNotFound)
+			}
+		})
+	}
+}
+
+func TestItemsValidation(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, store.NewMemory())
+
+	tests := []struct {
+		name         string
+		contentType  string
+		body         string
+		expectStatus int
+	}{
+		{name: "valid", contentType: "application/json", body: `{"name":"Widget"}`, expectStatus: http.StatusCreated},
+		{name: "missing name", contentType: "application/json", body: `{"tags":["tools"]}`, expectStatus: http.StatusBadRequest},
+		{name: "empty name", contentType: "application/json", body: `{"name":""}`, expectStatus: http.StatusBadRequest},
+		{name: "read only field", contentType: "application/json", body: `{"name":"Widget","id":"chosen"}`, expectStatus: http.StatusBadRequest},
+		{name: "wrong type", contentType: "application/json", body: `{"name":"Widget","tags":"tools"}`, expectStatus: http.StatusBadRequest},
+		{name: "malformed", contentType: "application/json", body: `{"name":`, expectStatus: http.StatusBadRequest},
+		{name: "unsupported content type", contentType: "application/xml", body: `<item/>`, expectStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := client.CreateItemWithBodyWithResponse(ctx, &api.CreateItemParams{}, test.contentType, bytes.NewBufferString(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.StatusCode() != test.expectStatus {
+				t.Errorf("unexpected status: got %d want %d (%s)", resp.StatusCode(), test.expectStatus, resp.Body)
+			}
+			if test.expectStatus == http.StatusBadRequest && resp.JSON400 == nil {
+				t.Errorf("expected an error body: %s", resp.Body)
+			}
+		})
+	}
+
+	limit := 1000
+	resp, err := client.ListItemsWithResponse(ctx, &api.ListItemsParams{Limit: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode() != http.StatusBadRequest {
+		t.Errorf("unexpected status for limit above maximum: got %d want %d", resp.StatusCode(), http.StatusBadRequest)
+	}
+}
+
+func TestItemsPagination(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, store.NewMemory())
+
+	for _, name := range []string{"delta", "alpha", "charlie", "bravo", "echo"} {
+		resp, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode() != http.StatusCreated {
+			t.Fatalf("unexpected create response: %d %s", resp.StatusCode(), resp.Body)
+		}
+	}
+
+	limit := 2
+	page, err := client.ListItemsWithResponse(ctx, &api.ListItemsParams{Limit: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.JSON200 == nil || len(page.JSON200.Items) != limit || page.JSON200.NextCursor == nil {
+		t.Fatalf("unexpected first page: %d %s", page.StatusCode(), page.Body)
+	}
+
+	sort := "-name"
+	filter := []string{"name:ne:charlie"}
+	var names []string
+	for item, err := range client.AllItems(ctx, &api.ListItemsParams{Limit: &limit, Sort: &sort, Filter: &filter}) {
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, item.Name)
+	}
+	if expected := []string{"echo", "delta", "bravo", "alpha"}; !slices.Equal(names, expected) {
+		t.Errorf("unexpected items: got %q want %q", names, expected)
+	}
+
+	invalid := "price"
+	for _, err := range client.AllItems(ctx, &api.ListItemsParams{Sort: &invalid}) {
+		var apiErr api.Error
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+			t.Errorf("unexpected error: got %v want a 400 error", err)
+		}
+	}
+
+	// Cursors cannot be reused with a different sort
+	resp, err := client.ListItemsWithResponse(ctx, &api.ListItemsParams{Cursor: page.JSON200.NextCursor, Sort: &sort})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode() != http.StatusBadRequest {
+		t.Errorf("unexpected status for a mismatched cursor: got %d want %d", resp.StatusCode(), http.StatusBadRequest)
+	}
+}
+
+func TestItemsPatch(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, store.NewMemory())
+
+	description := "A small widget"
+	original := api.NewItem{Name: "Widget", Description: &description, Tags: &[]string{"tools"}}
+	created, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, original)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := created.JSON201.Id
+
+	// Merge patches remove fields that are omitted from the changed item
+	changed := api.NewItem{Name: "Gadget", Tags: original.Tags}
+	merged, err := client.MergePatchItemWithResponse(ctx, id, &api.PatchItemParams{}, original, changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.JSON200 == nil || merged.JSON200.Name != "Gadget" || merged.JSON200.Description != nil {
+		t.Fatalf("unexpected merge patch response: %d %s", merged.StatusCode(), merged.Body)
+	}
+
+	ops, err := api.NewJSONPatch(changed, api.NewItem{Name: "Gadget", Tags: &[]string{"tools", "small"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops = append(api.JSONPatch{{Op: "test", Path: "/name", Value: "Gadget"}}, ops...)
+	patched, err := client.PatchItemWithApplicationJSONPatchPlusJSONBodyWithResponse(ctx, id, &api.PatchItemParams{}, ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.JSON200 == nil || patched.JSON200.Tags == nil || !slices.Equal(*patched.JSON200.Tags, []string{"tools", "small"}) {
+		t.Fatalf("unexpected JSON patch response: %d %s", patched.StatusCode(), patched.Body)
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{name: "failed test", contentType: "application/json-patch+json", body: `[{"op":"test","path":"/name","value":"Widget"},{"op":"remove","path":"/tags"}]`, status: http.StatusConflict},
+		{name: "missing path", contentType: "application/json-patch+json", body: `[{"op":"remove","path":"/description"}]`, status: http.StatusUnprocessableEntity},
+		{name: "invalid result", contentType: "application/json-patch+json", body: `[{"op":"remove","path":"/name"}]`, status: http.StatusUnprocessableEntity},
+		{name: "unknown field", contentType: "application/json-patch+json", body: `[{"op":"add","path":"/price","value":1}]`, status: http.StatusUnprocessableEntity},
+		{name: "invalid operation", contentType: "application/json-patch+json", body: `[{"op":"delete","path":"/name"}]`, status: http.StatusBadRequest},
+		{name: "invalid merge patch", contentType: "application/merge-patch+json", body: `{"name":null}`, status: http.StatusBadRequest},
+		{name: "unsupported content type", contentType: "application/json", body: `{"name":"Gizmo"}`, status: http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := client.PatchItemWithBodyWithResponse(ctx, id, &api.PatchItemParams{}, test.contentType, bytes.NewBufferString(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode() != test.status {
+				t.Errorf("unexpected status: got %d want %d: %s", resp.StatusCode(), test.status, resp.Body)
+			}
+			if test.status == http.StatusUnsupportedMediaType && resp.HTTPResponse.Header.Get("Accept-Patch") == "" {
+				t.Error("expected an Accept-Patch header")
+			}
+		})
+	}
+
+	got, err := client.GetItemWithResponse(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.JSON200 == nil || got.JSON200.Version != 3 {
+		t.Errorf("failed patches changed the item: %s", got.Body)
+	}
+}
+
+// lostResponseDoer sends requests but reports the first response as lost, as if the connection dropped.
+type lostResponseDoer struct {
+	sent atomic.Int32
+}
+
+func (d *lostResponseDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if d.sent.Add(1) == 1 && err == nil {
+		_ = resp.Body.Close()
+		return nil, errors.New("connection reset by peer")
+	}
+
+	return resp, err
+}
+
+func TestItemsIdempotency(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	doer := &lostResponseDoer{}
+	client := newTestClient(t, st, api.WithHTTPClient(doer), api.WithRetries(api.RetryConfig{Backoff: time.Millisecond}))
+
+	created, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.StatusCode() != http.StatusCreated || created.HTTPResponse.Header.Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected the retry to replay the created item: got %d %v", created.StatusCode(), created.HTTPResponse.Header)
+	}
+	if doer.sent.Load() != 2 {
+		t.Errorf("unexpected number of attempts: got %d want 2", doer.sent.Load())
+	}
+
+	items, err := client.ListItemsWithResponse(ctx, &api.ListItemsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items.JSON200 == nil || len(items.JSON200.Items) != 1 {
+		t.Errorf("expected a single item to be created: %s", items.Body)
+	}
+
+	// Reusing a key for a different request is rejected
+	key := api.NewIdempotencyKey()
+	params := &api.CreateItemParams{IdempotencyKey: &key}
+	_, err = client.CreateItemWithResponse(ctx, params, api.NewItem{Name: "Gadget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reused, err := client.CreateItemWithResponse(ctx, params, api.NewItem{Name: "Gizmo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reused.StatusCode() != http.StatusUnprocessableEntity {
+		t.Errorf("unexpected status reusing a key: got %d want %d", reused.StatusCode(), http.StatusUnprocessableEntity)
+	}
+}
+
+func TestItemsExport(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, store.NewMemory())
+
+	for _, name := range []string{"Widget", "Gadget", "Gizmo"} {
+		_, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	started, err := client.ExportItemsWithResponse(ctx, &api.ExportItemsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if started.StatusCode() != http.StatusAccepted || started.JSON202 == nil {
+		t.Fatalf("unexpected response starting an export: %d %s", started.StatusCode(), started.Body)
+	}
+	id := started.JSON202.Id
+	if location := started.HTTPResponse.Header.Get("Location"); location != "/v1/operations/"+id {
+		t.Errorf("unexpected Location: got %s want /v1/operations/%s", location, id)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		op, err := client.GetOperationWithResponse(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if op.JSON200 == nil {
+			t.Fatalf("unexpected response polling the export: %d %s", op.StatusCode(), op.Body)
+		}
+		if op.JSON200.Status == api.OperationStatusSucceeded {
+			break
+		}
+		if op.JSON200.Status == api.OperationStatusFailed || time.Now().After(deadline) {
+			t.Fatalf("export did not succeed: %+v", op.JSON200)
+		}
+		if op.HTTPResponse.Header.Get("Retry-After") == "" {
+			t.Errorf("expected Retry-After while the export is %s", op.JSON200.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	result, err := client.GetOperationResultWithResponse(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export api.ItemExport
+	err = json.Unmarshal(result.Body, &export)
+	if err != nil || len(export.Items) != 3 || export.Items[0].Name != "Widget" {
+		t.Errorf("unexpected export result: %d %s", result.StatusCode(), result.Body)
+	}
+
+	cancelled, err := client.CancelOperationWithResponse(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled.StatusCode() != http.StatusConflict {
+		t.Errorf("unexpected status cancelling a finished operation: got %d want %d", cancelled.StatusCode(), http.StatusConflict)
+	}
+
+	missing, err := client.GetOperationWithResponse(ctx, "missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing.StatusCode() != http.StatusNotFound {
+		t.Errorf("unexpected status getting a missing operation: got %d want %d", missing.StatusCode(), http.StatusNotFound)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/circa10a/go-rest-template/internal/inbound"
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/circa10a/go-rest-template/internal/webhooks"
+)
+
+// LogJobArgs are the arguments of the log job.
+type LogJobArgs struct {
+	Message string `json:"message"`
+}
+
+// registerJobs registers the handlers of every job kind and returns the webhook dispatcher and receiver, whose
+// deliveries and events are jobs too. The server and the worker command both call it, so jobs enqueued by the
+// server run in whichever process claims them. allowPrivate lets webhooks deliver to private networks.
+func registerJobs(q *jobs.Queue, st store.Store, logger *slog.Logger, allowPrivate bool) (*webhooks.Dispatcher, *inbound.Receiver) {
+	// log is a reference job. Replace it with real work, such as sending emails.
+	jobs.Handle(q, "log", func(ctx context.Context, job store.Job, args LogJobArgs) error {
+		logger.Info(args.Message, "component", "jobs", "id", job.ID, "attempt", job.Attempts)
+		return nil
+	})
+
+	receiver := inbound.New(st, q, inbound.Config{Logger: logger})
+	registerInboundHandlers(receiver, logger)
+
+	return webhooks.New(st, q, webhooks.Config{Logger: logger, AllowPrivateNetworks: allowPrivate}), receiver
+}
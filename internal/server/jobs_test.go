@@ -0,0 +1,104 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+func TestAdminJobs(t *testing.T) {
+	ctx := context.Background()
+
+	// Without workers, enqueued jobs stay pending for the admin API to inspect
+	s, err := New(&Config{Store: store.NewMemory(), LogLevel: "error", AdminToken: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	ts := httptest.NewServer(s.mux)
+	t.Cleanup(ts.Close)
+
+	authorized := api.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer secret")
+		return nil
+	})
+	client, err := api.NewClientWithResponses(ts.URL+"/v1", authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := api.NewClientWithResponses(ts.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, message := range []string{"first", "second", "third"} {
+		job, err := s.Jobs.Enqueue(ctx, "log", LogJobArgs{Message: message}, jobs.EnqueueOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, job.ID)
+	}
+
+	unauthorized, err := anonymous.ListJobsWithResponse(ctx, &api.ListJobsParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unauthorized.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("unexpected status without a token: got %d want %d", unauthorized.StatusCode(), http.StatusUnauthorized)
+	}
+
+	limit := 2
+	page, err := client.ListJobsWithResponse(ctx, &api.ListJobsParams{Limit: &limit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.JSON200 == nil || len(page.JSON200.Jobs) != 2 || page.JSON200.Jobs[0].Id != ids[0] || page.JSON200.NextCursor == nil {
+		t.Fatalf("unexpected first page: %d %s", page.StatusCode(), page.Body)
+	}
+	page, err = client.ListJobsWithResponse(ctx, &api.ListJobsParams{Limit: &limit, Cursor: page.JSON200.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.JSON200 == nil || len(page.JSON200.Jobs) != 1 || page.JSON200.Jobs[0].Id != ids[2] || page.JSON200.NextCursor != nil {
+		t.Fatalf("unexpected last page: %d %s", page.StatusCode(), page.Body)
+	}
+
+	job, err := client.GetJobWithResponse(ctx, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.JSON200 == nil || job.JSON200.Kind != "log" || job.JSON200.State != api.JobStatePending || job.JSON200.Args.(map[string]any)["message"] != "first" {
+		t.Errorf("unexpected job: %d %s", job.StatusCode(), job.Body)
+	}
+
+	retried, err := client.RetryJobWithResponse(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.StatusCode() != http.StatusOK {
+		t.Errorf("unexpected status retrying a job: got %d want %d", retried.StatusCode(), http.StatusOK)
+	}
+
+	discarded, err := client.DiscardJobWithResponse(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discarded.StatusCode() != http.StatusNoContent {
+		t.Errorf("unexpected status discarding a job: got %d want %d", discarded.StatusCode(), http.StatusNoContent)
+	}
+
+	missing, err := client.GetJobWithResponse(ctx, ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing.StatusCode() != http.StatusNotFound {
+		t.Errorf("unexpected status getting a discarded job: got %d want %d", missing.StatusCode(), http.StatusNotFound)
+	}
+}
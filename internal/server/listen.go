@@ -0,0 +1,286 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/caddyserver/certmagic"
+	"github.com/circa10a/go-rest-template/internal/listeners"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// listener is an open socket of a listener address, with the certificate and key it serves TLS with.
+type listener struct {
+	net.Listener
+	certFile string
+	keyFile  string
+	addr     listeners.Address
+}
+
+// socket is an open socket that can be passed to another process.
+type socket interface {
+	File() (*os.File, error)
+}
+
+// namedSocket is a socket of the server, which an upgrade passes to the new process under key.
+type namedSocket struct {
+	conn socket
+	key  string
+}
+
+// listenAddresses returns the parsed Listeners. Without any, the server listens on Port, or on the sockets
+// passed by systemd socket activation.
+func (s *Server) listenAddresses() ([]listeners.Address, error) {
+	urls := s.Listeners
+	if len(urls) == 0 {
+		urls = []string{fmt.Sprintf("tcp://:%d", s.Port)}
+		if listeners.SystemdActivated() {
+			urls = []string{"systemd://"}
+		}
+	}
+
+	addresses := make([]listeners.Address, 0, len(urls))
+	for _, raw := range urls {
+		addr, err := listeners.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, addr)
+	}
+
+	return addresses, nil
+}
+
+// listen opens the sockets of the listener addresses. Listeners without a certificate of their own serve TLS
+// with TLSCert and TLSKey, unless they disable it.
+func (s *Server) listen() ([]listener, error) {
+	var opened []listener
+	for _, addr := range s.addresses {
+		lns, err := addr.Listen()
+		if err != nil {
+			closeListeners(opened)
+			return nil, err
+		}
+
+		certFile, keyFile := addr.CertFile, addr.KeyFile
+		if certFile == "" && !addr.NoTLS {
+			certFile, keyFile = s.TLSCert, s.TLSKey
+		}
+		for _, ln := range lns {
+			opened = append(opened, listener{Listener: ln, addr: addr, certFile: certFile, keyFile: keyFile})
+			s.addSocket(addr.URL, ln)
+		}
+	}
+
+	return opened, nil
+}
+
+// Start starts the listeners of the server and blocks until one of them stops.
+func (s *Server) Start() error {
+	log := s.logger.With("component", "server")
+
+	var lns []listener
+	if !s.AutoTLS {
+		var err error
+		lns, err = s.listen()
+		if err != nil {
+			return err
+		}
+	}
+	errs := make(chan error, 2+2*len(lns))
+
+	if s.grpc != nil && s.GRPCPort != 0 {
+		lis, err := listeners.Listen(fmt.Sprintf("grpc://:%d", s.GRPCPort), "tcp", fmt.Sprintf(":%d", s.GRPCPort))
+		if err != nil {
+			closeListeners(lns)
+			return err
+		}
+		s.addSocket(fmt.Sprintf("grpc://:%d", s.GRPCPort), lis)
+		log.Info(fmt.Sprintf("Starting gRPC server on :%d", s.GRPCPort))
+		go func() { errs <- s.grpc.Serve(lis) }()
+	}
+
+	// Auto TLS will create listeners on port 80 and 443
+	if s.AutoTLS {
+		handler := s.mux
+		if s.HTTP3 {
+			// The default config shares the certificate cache of certmagic.HTTPS, which manages the certificates
+			h3, err := s.serveHTTP3(log, fmt.Sprintf(":%d", certmagic.HTTPSPort), certmagic.NewDefault().TLSConfig(), errs)
+			if err != nil {
+				return err
+			}
+			handler = altSvc(h3, handler)
+		}
+
+		log.Info("Starting server on :80 and :443")
+		certmagic.DefaultACME.Agreed = true
+		certmagic.DefaultACME.Email = "user@oss.com"
+		go func() { errs <- certmagic.HTTPS(s.Domains, handler) }()
+		close(s.started)
+
+		return <-errs
+	}
+
+	for _, ln := range lns {
+		handler := s.mux
+
+		// HTTP/3 is served on the UDP port of TLS listeners over TCP
+		if s.HTTP3 && ln.certFile != "" && ln.addr.Scheme == "tcp" {
+			cert, err := tls.LoadX509KeyPair(ln.certFile, ln.keyFile)
+			if err != nil {
+				closeListeners(lns)
+				return err
+			}
+			tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS13}
+			h3, err := s.serveHTTP3(log, ln.Addr().String(), tlsConfig, errs)
+			if err != nil {
+				closeListeners(lns)
+				return err
+			}
+			handler = altSvc(h3, handler)
+		}
+
+		// Servers are recorded before Started is closed, so Shutdown stops every one of them
+		httpServer := s.newHTTPServer(ln, handler)
+		s.mu.Lock()
+		s.httpServers = append(s.httpServers, httpServer)
+		s.mu.Unlock()
+
+		log.Info("Starting server on "+ln.addr.URL, "addr", ln.Addr().String(), "tls", ln.certFile != "")
+		go func() {
+			if ln.certFile != "" {
+				errs <- httpServer.ServeTLS(ln, ln.certFile, ln.keyFile)
+				return
+			}
+			errs <- httpServer.Serve(ln)
+		}()
+	}
+
+	// The sockets are open, so connections wait for the servers to accept them
+	close(s.started)
+
+	return <-errs
+}
+
+// newHTTPServer returns the HTTP server of ln, serving handler.
+func (s *Server) newHTTPServer(ln listener, handler http.Handler) *http.Server {
+	httpServer := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       5 * time.Second,
+		WriteTimeout:      5 * time.Second,
+		IdleTimeout:       5 * time.Second,
+	}
+
+	// Without TLS, HTTP/2 needs h2c, which service meshes use between proxies, and gRPC clients use when
+	// gRPC shares the port
+	if ln.certFile == "" && (s.H2C || s.grpc != nil && s.GRPCPort == 0) {
+		httpServer.Protocols = new(http.Protocols)
+		httpServer.Protocols.SetHTTP1(true)
+		httpServer.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	return httpServer
+}
+
+// serveHTTP3 serves HTTP/3 on the UDP socket at addr until it stops, sending the error to errs.
+func (s *Server) serveHTTP3(log *slog.Logger, addr string, tlsConfig *tls.Config, errs chan<- error) (*http3.Server, error) {
+	conn, err := listeners.ListenPacket("udp://"+addr, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.addSocket("udp://"+addr, conn)
+
+	h3 := &http3.Server{
+		Handler:     s.mux,
+		TLSConfig:   http3.ConfigureTLSConfig(tlsConfig),
+		IdleTimeout: 30 * time.Second,
+		Logger:      s.logger.With("component", "http3"),
+	}
+
+	s.mu.Lock()
+	s.http3Servers = append(s.http3Servers, h3)
+	s.mu.Unlock()
+
+	log.Info("Starting HTTP/3 server on " + conn.LocalAddr().String() + "/udp")
+	go func() { errs <- h3.Serve(conn) }()
+
+	return h3, nil
+}
+
+// Started is closed once Start has opened the sockets of the server.
+func (s *Server) Started() <-chan struct{} {
+	return s.started
+}
+
+// ListenerFiles returns duplicates of the open sockets of the server, to pass them to a new process with
+// listeners.Upgrade. Call HandOff once the new process has started. Sockets opened by AutoTLS cannot be passed.
+func (s *Server) ListenerFiles() ([]listeners.File, error) {
+	if s.AutoTLS {
+		return nil, errors.New("the sockets of AutoTLS cannot be passed to another process")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files := make([]listeners.File, 0, len(s.sockets))
+	for _, sock := range s.sockets {
+		f, err := sock.conn.File()
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, listeners.File{File: f, Key: sock.key})
+	}
+
+	return files, nil
+}
+
+// HandOff keeps the unix socket files of the server when it stops, since the process started with its
+// ListenerFiles serves them. Call it once the upgrade succeeds, so a server that fails to upgrade still
+// removes them.
+func (s *Server) HandOff() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sock := range s.sockets {
+		if unix, ok := sock.conn.(*net.UnixListener); ok {
+			unix.SetUnlinkOnClose(false)
+		}
+	}
+}
+
+// addSocket records a socket opened by Start, for ListenerFiles.
+func (s *Server) addSocket(key string, conn any) {
+	sock, ok := conn.(socket)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	s.sockets = append(s.sockets, namedSocket{key: key, conn: sock})
+	s.mu.Unlock()
+}
+
+// altSvc advertises h3 in the Alt-Svc header of the responses of next, which is how clients discover HTTP/3.
+func altSvc(h3 *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = h3.SetQUICHeaders(w.Header())
+		next.ServeHTTP(w, r)
+	})
+}
+
+// closeListeners closes the sockets of lns.
+func closeListeners(lns []listener) {
+	for _, ln := range lns {
+		_ = ln.Close()
+	}
+}
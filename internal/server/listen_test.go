@@ -0,0 +1,358 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// freePort returns a port that is free for both TCP and UDP.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	for range 10 {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := lis.Addr().(*net.TCPAddr).Port
+		_ = lis.Close()
+
+		conn, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err == nil {
+			_ = conn.Close()
+			return port
+		}
+	}
+
+	t.Fatal("no free port")
+	return 0
+}
+
+// writeCertificate writes a self-signed certificate for localhost and its key, and returns their paths.
+func writeCertificate(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	if err == nil {
+		err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+// start starts s and shuts it down at the end of the test.
+func start(t *testing.T, s *Server) {
+	t.Helper()
+
+	errs := make(chan error, 1)
+	go func() { errs <- s.Start() }()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := s.Shutdown(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		_ = s.Close()
+	})
+
+	// Wait for the TCP listener
+	for range 100 {
+		conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", s.Port))
+		if err == nil {
+			_ = conn.Close()
+			return
+		}
+		select {
+		case err := <-errs:
+			t.Fatal(err)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	t.Fatal("server did not start")
+}
+
+func TestH2C(t *testing.T) {
+	s, err := New(&Config{Store: store.NewMemory(), LogLevel: "error", Port: freePort(t), H2C: true, Validation: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, s)
+
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	resp, err := client.Get(fmt.Sprintf("http://127.0.0.1:%d/health", s.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 2 {
+		t.Errorf("unexpected response: %d over %s", resp.StatusCode, resp.Proto)
+	}
+
+	// HTTP/1.1 is still served
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:%d/health", s.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 1 {
+		t.Errorf("unexpected response: %d over %s", resp.StatusCode, resp.Proto)
+	}
+}
+
+func TestHTTP3(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+	s, err := New(&Config{
+		Store:      store.NewMemory(),
+		LogLevel:   "error",
+		Port:       freePort(t),
+		TLSCert:    certFile,
+		TLSKey:     keyFile,
+		HTTP3:      true,
+		Validation: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, s)
+
+	url := fmt.Sprintf("https://localhost:%d/health", s.Port)
+	tlsConfig := &tls.Config{InsecureSkipVerify: true} //nolint:gosec // self-signed test certificate
+
+	// Responses over TCP advertise HTTP/3
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if want := fmt.Sprintf(`h3=":%d"`, s.Port); !strings.HasPrefix(resp.Header.Get("Alt-Svc"), want) {
+		t.Errorf("unexpected Alt-Svc header %q, want %s", resp.Header.Get("Alt-Svc"), want)
+	}
+
+	h3 := &http3.Transport{TLSClientConfig: tlsConfig}
+	t.Cleanup(func() { _ = h3.Close() })
+	resp, err = (&http.Client{Transport: h3}).Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ProtoMajor != 3 {
+		t.Errorf("unexpected response: %d over %s", resp.StatusCode, resp.Proto)
+	}
+}
+
+func TestListeners(t *testing.T) {
+	certFile, keyFile := writeCertificate(t)
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	port, tlsPort := freePort(t), freePort(t)
+	s, err := New(&Config{
+		Store:    store.NewMemory(),
+		LogLevel: "error",
+		// The port the test waits for
+		Port: port,
+		Listeners: []string{
+			fmt.Sprintf("tcp://127.0.0.1:%d", port),
+			"unix://" + socket + "?mode=0600",
+			fmt.Sprintf("tcp://127.0.0.1:%d?cert=%s&key=%s", tlsPort, certFile, keyFile),
+		},
+		Validation: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start(t, s)
+
+	// Plain TCP
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/health", s.Port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code %d over tcp", resp.StatusCode)
+	}
+
+	// TLS with the certificate of the listener
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec // self-signed test certificate
+	}}
+	resp, err = client.Get(fmt.Sprintf("https://127.0.0.1:%d/health", tlsPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("unexpected status code %d over tls", resp.StatusCode)
+	}
+
+	// Unix domain socket with its file mode
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected socket mode %v", info.Mode().Perm())
+	}
+	client = &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	resp, err = client.Get("http://app/health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("unexpected status code %d over unix socket", resp.StatusCode)
+	}
+}
+
+func TestListenerFiles(t *testing.T) {
+	for _, handOff := range []bool{true, false} {
+		t.Run(fmt.Sprintf("handoff=%t", handOff), func(t *testing.T) {
+			socket := filepath.Join(t.TempDir(), "app.sock")
+			port := freePort(t)
+			s, err := New(&Config{
+				Store:      store.NewMemory(),
+				LogLevel:   "error",
+				Port:       port,
+				Listeners:  []string{fmt.Sprintf("tcp://127.0.0.1:%d", port), "unix://" + socket},
+				GRPC:       true,
+				GRPCPort:   freePort(t),
+				Validation: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			start(t, s)
+			<-s.Started()
+
+			files, err := s.ListenerFiles()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, f := range files {
+				keys = append(keys, f.Key)
+				_ = f.Close()
+			}
+			want := []string{fmt.Sprintf("tcp://127.0.0.1:%d", port), "unix://" + socket, fmt.Sprintf("grpc://:%d", s.GRPCPort)}
+			if !slices.Equal(keys, want) {
+				t.Errorf("unexpected sockets %v, want %v", keys, want)
+			}
+			if handOff {
+				s.HandOff()
+			}
+
+			// The new process serves the unix socket after the server stops, and a failed upgrade removes it
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			err = s.Shutdown(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = os.Stat(socket)
+			if handOff && err != nil {
+				t.Error(err)
+			}
+			if !handOff && !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("socket %s was not removed: %v", socket, err)
+			}
+		})
+	}
+}
+
+func TestShutdownAfterStarted(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "app.sock")
+	port := freePort(t)
+	s, err := New(&Config{
+		Store:      store.NewMemory(),
+		LogLevel:   "error",
+		Port:       port,
+		Listeners:  []string{fmt.Sprintf("tcp://127.0.0.1:%d", port), "unix://" + socket},
+		Validation: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	errs := make(chan error, 1)
+	go func() { errs <- s.Start() }()
+	<-s.Started()
+
+	// Shutting down right away stops every server, even those not serving yet
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = s.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	for _, addr := range [][2]string{{"tcp", fmt.Sprintf("127.0.0.1:%d", port)}, {"unix", socket}} {
+		conn, err := net.DialTimeout(addr[0], addr[1], time.Second)
+		if err == nil {
+			_ = conn.Close()
+			t.Errorf("%s listener %s is still open", addr[0], addr[1])
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/circa10a/go-rest-template/internal/events"
+	"github.com/circa10a/go-rest-template/internal/messaging"
+)
+
+// LogMessage is the data of the messages consumed by the log consumer.
+type LogMessage struct {
+	Message string `json:"message"`
+}
+
+// registerConsumers subscribes the consumers of the messages published to the stream by other services.
+// Replicas share the messages of a group, so each message is handled by one of them.
+func registerConsumers(ctx context.Context, b messaging.Broker, stream string, logger *slog.Logger) error {
+	// log is a reference consumer. Replace it with real work, such as importing the items of another service.
+	return b.Subscribe(ctx, messaging.Subscription{Subject: stream + ".log", Group: "server"},
+		func(ctx context.Context, d *messaging.Delivery) error {
+			var msg LogMessage
+			err := json.Unmarshal(d.Data, &msg)
+			if err != nil {
+				// Redelivering cannot fix the message, so it is acknowledged and dropped
+				logger.Error("dropping invalid message", "component", "messaging", "subject", d.Subject, "err", err)
+				return nil
+			}
+
+			logger.Info(msg.Message, "component", "messaging", "subject", d.Subject, "attempt", d.Attempt)
+			return nil
+		})
+}
+
+// subscribeEvents consumes the events of types published to the broker by brokerSink under prefix and passes
+// them to fn. The consumers have no group, so every replica receives every event, for fn to push it to the
+// clients connected to the replica.
+func subscribeEvents(ctx context.Context, b messaging.Broker, prefix string, types []string, fn events.HandlerFunc, logger *slog.Logger) error {
+	for _, typ := range types {
+		err := b.Subscribe(ctx, messaging.Subscription{Subject: prefix + "." + typ},
+			func(ctx context.Context, d *messaging.Delivery) error {
+				var event events.Event
+				err := json.Unmarshal(d.Data, &event)
+				if err != nil {
+					// Redelivering cannot fix the message, so it is acknowledged and dropped
+					logger.Error("dropping invalid event", "component", "messaging", "subject", d.Subject, "err", err)
+					return nil
+				}
+
+				return fn(ctx, event)
+			})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// brokerSink is an events.Sink that publishes events to a message broker, under the subject prefix followed
+// by the event type, such as app.events.item.created. Other services subscribe to the events there.
+type brokerSink struct {
+	broker messaging.Broker
+	prefix string
+}
+
+// Send publishes event with its ID, so a broker that deduplicates messages drops events sent again.
+func (s brokerSink) Send(ctx context.Context, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return s.broker.Publish(ctx, messaging.Message{
+		Subject: fmt.Sprintf("%s.%s", s.prefix, event.Type),
+		ID:      event.ID,
+		Header:  map[string]string{"Content-Type": "application/json"},
+		Data:    data,
+	})
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/events"
+	"github.com/circa10a/go-rest-template/internal/messaging"
+	"github.com/circa10a/go-rest-template/internal/store"
+	natsserver "github.com/nats-io/nats-server/v2/server"
+)
+
+// newNATSServer starts an embedded NATS server with JetStream.
+func newNATSServer(t *testing.T) *natsserver.Server {
+	t.Helper()
+
+	ns, err := natsserver.NewServer(&natsserver.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server not ready")
+	}
+
+	return ns
+}
+
+func TestMessaging(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ns := newNATSServer(t)
+
+	s, err := New(&Config{Store: store.NewMemory(), LogLevel: "error", NATSURL: ns.ClientURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	ts := httptest.NewServer(s.mux)
+	t.Cleanup(ts.Close)
+
+	client, err := api.NewClientWithResponses(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ready, err := client.GetReadyWithResponse(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ready.JSON200 == nil || ready.JSON200.Checks["nats"] != "ok" {
+		t.Fatalf("unexpected readiness: %d %s", ready.StatusCode(), ready.Body)
+	}
+
+	// Another service consumes the events published by the server
+	consumer, err := messaging.NewNATS(ctx, messaging.NATSConfig{Logger: slog.New(slog.DiscardHandler), URL: ns.ClientURL(), Stream: "app"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = consumer.Close(context.Background()) })
+
+	received := make(chan messaging.Message, 10)
+	err = consumer.Subscribe(ctx, messaging.Subscription{Subject: "app.events.>", Group: "test"}, func(ctx context.Context, d *messaging.Delivery) error {
+		received <- d.Message
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err = api.NewClientWithResponses(ts.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.JSON201 == nil {
+		t.Fatalf("unexpected item: %d %s", item.StatusCode(), item.Body)
+	}
+
+	select {
+	case msg := <-received:
+		var event events.Event
+		err = json.Unmarshal(msg.Data, &event)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Subject != "app.events.item.created" || msg.ID != event.ID || event.Type != "item.created" {
+			t.Errorf("unexpected message %s: %s", msg.Subject, msg.Data)
+		}
+	case <-ctx.Done():
+		t.Fatal("no event published")
+	}
+}
+
+func TestMessagingLiveEvents(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	ns := newNATSServer(t)
+
+	// Two replicas share a store, so the outbox relays each event in only one of them
+	st := store.NewMemory()
+	var streams []*bufio.Scanner
+	var clients []*api.ClientWithResponses
+	for range 2 {
+		s, err := New(&Config{Store: st, LogLevel: "error", NATSURL: ns.ClientURL()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = s.Close() })
+
+		ts := httptest.NewServer(s.mux)
+		t.Cleanup(ts.Close)
+
+		client, err := api.NewClientWithResponses(ts.URL + "/v1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.StreamEvents(ctx, &api.StreamEventsParams{Topic: []api.StreamEventsParamsTopic{"items"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = resp.Body.Close() })
+
+		clients = append(clients, client)
+		streams = append(streams, bufio.NewScanner(resp.Body))
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	item, err := clients[0].CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.JSON201 == nil {
+		t.Fatalf("unexpected item: %d %s", item.StatusCode(), item.Body)
+	}
+
+	// The clients of every replica receive the event
+	for i, lines := range streams {
+		fields := map[string]string{}
+		for lines.Scan() && lines.Text() != "" {
+			name, value, _ := strings.Cut(lines.Text(), ": ")
+			fields[name] = value
+		}
+		if fields["event"] != "item.created" || !strings.Contains(fields["data"], item.JSON201.Id) {
+			t.Errorf("unexpected event on replica %d: %v, %v", i, fields, lines.Err())
+		}
+	}
+}
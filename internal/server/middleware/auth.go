@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/circa10a/go-rest-template/internal/server/render"
+)
+
+// AccessTokenParam is the query parameter carrying the bearer token of upgrade requests.
+const AccessTokenParam = "access_token"
+
+// BearerToken returns a route level middleware that rejects requests without an Authorization header
+// carrying token as a bearer token with 401. Browsers cannot set headers on WebSocket connections, so
+// upgrade requests may send the token in the access_token query parameter instead. Tokens are compared in
+// constant time.
+func BearerToken(token string) func(http.Handler) http.Handler {
+	want := sha256.Sum256([]byte(token))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := bearerToken(r)
+			gotSum := sha256.Sum256([]byte(got))
+			if !ok || subtle.ConstantTimeCompare(gotSum[:], want[:]) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer`)
+				render.Error(w, http.StatusUnauthorized, "invalid or missing bearer token")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bearerToken returns the bearer token of r and whether it has one.
+func bearerToken(r *http.Request) (string, bool) {
+	if r.Header.Get("Authorization") == "" && r.Header.Get("Upgrade") != "" {
+		token := r.URL.Query().Get(AccessTokenParam)
+		return token, token != ""
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	return token, ok && strings.EqualFold(scheme, "Bearer")
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBearerToken(t *testing.T) {
+	handler := BearerToken("secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		authorization string
+		target        string
+		upgrade       string
+		expectStatus  int
+	}{
+		{authorization: "Bearer secret", expectStatus: http.StatusNoContent},
+		{authorization: "bearer secret", expectStatus: http.StatusNoContent},
+		{authorization: "Bearer other", expectStatus: http.StatusUnauthorized},
+		{authorization: "Basic secret", expectStatus: http.StatusUnauthorized},
+		{authorization: "secret", expectStatus: http.StatusUnauthorized},
+		{authorization: "", expectStatus: http.StatusUnauthorized},
+		{target: "/?access_token=secret", upgrade: "websocket", expectStatus: http.StatusNoContent},
+		{target: "/?access_token=other", upgrade: "websocket", expectStatus: http.StatusUnauthorized},
+		{target: "/?access_token=secret", expectStatus: http.StatusUnauthorized},
+	}
+
+	for _, test := range tests {
+		target := test.target
+		if target == "" {
+			target = "/"
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if test.authorization != "" {
+			req.Header.Set("Authorization", test.authorization)
+		}
+		if test.upgrade != "" {
+			req.Header.Set("Upgrade", test.upgrade)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectStatus {
+			t.Errorf("unexpected status for %q %s: got %d want %d", test.authorization, target, rec.Code, test.expectStatus)
+		}
+		if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != "Bearer" {
+			t.Errorf("expected a WWW-Authenticate challenge for %q", test.authorization)
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// MaxBodySizeExtension is the OpenAPI operation extension that overrides the default request body size limit.
+const MaxBodySizeExtension = "x-max-body-size"
+
+type bodyLimitKey struct{}
+
+// BodyConfig holds configuration for the request body middleware.
+type BodyConfig struct {
+	// Routes maps "METHOD /path/{param}" patterns to body size limits that override MaxSize.
+	// A {param} matches a single path segment. Use BodyLimitsFromSpec to build them from the OpenAPI spec.
+	Routes map[string]int64
+	// MaxSize is the maximum size in bytes of a request body as sent by the client. Zero disables the limit.
+	MaxSize int64
+	// MaxDecompressedSize is the maximum size in bytes of a compressed request body once decompressed.
+	// It protects against decompression bombs. Zero disables the limit.
+	MaxDecompressedSize int64
+}
+
+// bodyLimit is shared through the request context so route level middleware can adjust it before the body is read.
+type bodyLimit struct {
+	wire     int64
+	expanded int64
+}
+
+type routeBodyLimit struct {
+	method   string
+	segments []string
+	limit    int64
+	params   int
+}
+
+// Body returns a middleware that limits request body sizes and transparently decompresses gzip and zstd
+// encoded request bodies. Bodies declaring a Content-Length over the limit are rejected with 413 before the
+// handler runs. Otherwise reads past the limit fail with an *http.MaxBytesError that handlers should answer with 413.
+func Body(cfg BodyConfig) (func(http.Handler) http.Handler, error) {
+	routes, err := compileBodyRoutes(cfg.Routes)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			limit := &bodyLimit{wire: cfg.MaxSize, expanded: cfg.MaxDecompressedSize}
+			for _, route := range routes {
+				if route.match(r.Method, r.URL.Path) {
+					limit.wire = route.limit
+					break
+				}
+			}
+
+			if limit.wire > 0 && r.ContentLength > limit.wire {
+				render.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", limit.wire))
+				return
+			}
+
+			if r.Body != nil && r.Body != http.NoBody {
+				body, status, err := newLimitedBody(r, limit)
+				if err != nil {
+					if status == http.StatusUnsupportedMediaType {
+						w.Header().Set("Accept-Encoding", "gzip, zstd")
+					}
+					render.Error(w, status, err.Error())
+					return
+				}
+				defer func() { _ = body.Close() }()
+				r.Body = body
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), bodyLimitKey{}, limit)))
+		})
+	}, nil
+}
+
+// MaxBodySize returns a route level middleware that overrides the request body size limit, for example
+// router.With(middleware.MaxBodySize(10 << 20)).Post("/uploads", handler).
+func MaxBodySize(n int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if n > 0 && r.ContentLength > n {
+				render.Error(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", n))
+				return
+			}
+
+			limit, ok := r.Context().Value(bodyLimitKey{}).(*bodyLimit)
+			if ok {
+				limit.wire = n
+			} else if n > 0 {
+				// Body middleware is not installed
+				r.Body = http.MaxBytesReader(w, r.Body, n)
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// BodyLimitsFromSpec returns the body size limits declared with the x-max-body-size extension on OpenAPI operations.
+// Paths are prefixed with the base path of the first server in the spec.
+func BodyLimitsFromSpec(doc *openapi3.T) (map[string]int64, error) {
+	limits := map[string]int64{}
+	if doc.Paths == nil {
+		return limits, nil
+	}
+
+	basePath, err := SpecBasePath(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for path, item := range doc.Paths.Map() {
+		for method, op := range item.Operations() {
+			value, ok := op.Extensions[MaxBodySizeExtension]
+			if !ok {
+				continue
+			}
+
+			var limit int64
+			switch v := value.(type) {
+			case float64:
+				limit = int64(v)
+			case int:
+				limit = int64(v)
+			case int64:
+				limit = v
+			default:
+				return nil, fmt.Errorf("%s %s: %s must be an integer", method, path, MaxBodySizeExtension)
+			}
+
+			limits[method+" "+basePath+path] = limit
+		}
+	}
+
+	return limits, nil
+}
+
+// compileBodyRoutes parses route patterns, ordering them so literal segments win over parameters.
+func compileBodyRoutes(patterns map[string]int64) ([]routeBodyLimit, error) {
+	routes := make([]routeBodyLimit, 0, len(patterns))
+	for pattern, limit := range patterns {
+		method, path, ok := strings.Cut(pattern, " ")
+		if !ok || !strings.HasPrefix(path, "/") {
+			return nil, fmt.Errorf("invalid body limit route %q: expected \"METHOD /path\"", pattern)
+		}
+
+		route := routeBodyLimit{
+			method:   strings.ToUpper(method),
+			segments: strings.Split(strings.Trim(path, "/"), "/"),
+			limit:    limit,
+		}
+		for _, segment := range route.segments {
+			if strings.HasPrefix(segment, "{") {
+				route.params++
+			}
+		}
+		routes = append(routes, route)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].params < routes[j].params
+	})
+
+	return routes, nil
+}
+
+func (route routeBodyLimit) match(method, path string) bool {
+	if route.method != method {
+		return false
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) != len(route.segments) {
+		return false
+	}
+
+	for i, segment := range route.segments {
+		if !strings.HasPrefix(segment, "{") && segment != segments[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// limitedBody enforces the wire and decompressed size limits of a request body.
+type limitedBody struct {
+	io.Reader
+	limit   *bodyLimit
+	closers []io.Closer
+}
+
+// newLimitedBody wraps the request body, returning the status code to respond with when it cannot be decoded.
+func newLimitedBody(r *http.Request, limit *bodyLimit) (*limitedBody, int, error) {
+	body := &limitedBody{limit: limit, closers: []io.Closer{r.Body}}
+	wire := &limitReader{r: r.Body, limit: &limit.wire}
+
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		body.Reader = wire
+		return body, http.StatusOK, nil
+	case EncodingGzip:
+		// Reads the gzip header from the body
+		gz, err := gzip.NewReader(wire)
+		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return nil, http.StatusRequestEntityTooLarge, err
+			}
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid gzip request body: %w", err)
+		}
+		body.closers = append(body.closers, gz)
+		body.Reader = &limitReader{r: gz, limit: &limit.expanded}
+	case EncodingZstd:
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(8 << 20)}
+		if limit.expanded > 0 {
+			opts = append(opts, zstd.WithDecoderMaxMemory(uint64(limit.expanded)))
+		}
+		zs, err := zstd.NewReader(wire, opts...)
+		if err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("invalid zstd request body: %w", err)
+		}
+		body.closers = append(body.closers, zs.IOReadCloser())
+		body.Reader = &limitReader{r: zs, limit: &limit.expanded}
+	default:
+		return nil, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	// Handlers see the decoded body
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+
+	return body, http.StatusOK, nil
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.Reader.Read(p)
+	// The zstd decoder enforces the decompressed limit itself before allocating memory for it
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+		return n, &http.MaxBytesError{Limit: b.limit.expanded}
+	}
+
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if closeErr := b.closers[i].Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	b.closers = nil
+
+	return err
+}
+
+// limitReader fails with *http.MaxBytesError once more than *limit bytes are read. The limit is read on
+// every call so route level middleware can change it before the handler consumes the body.
+type limitReader struct {
+	r     io.Reader
+	limit *int64
+	n     int64
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	limit := *l.limit
+	if limit <= 0 {
+		return l.r.Read(p)
+	}
+
+	if l.n > limit {
+		return 0, &http.MaxBytesError{Limit: limit}
+	}
+
+	// Read one byte past the limit to detect bodies that are too large
+	if remaining := limit - l.n + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > limit {
+		return n - int(l.n-limit), &http.MaxBytesError{Limit: limit}
+	}
+
+	return n, err
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestBody(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	_, _ = gz.Write([]byte(strings.Repeat("a", 1000)))
+	_ = gz.Close()
+
+	zs, _ := zstd.NewWriter(nil)
+	zstdBomb := zs.EncodeAll([]byte(strings.Repeat("a", 100000)), nil)
+	zstdSmall := zs.EncodeAll([]byte("hello"), nil)
+	_ = zs.Close()
+
+	mw, err := Body(BodyConfig{
+		MaxSize:             100,
+		MaxDecompressedSize: 2000,
+		Routes: map[string]int64{
+			"POST /uploads/{id}": 10000,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// echo responds with the number of bytes read or 413 when the body is too large
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+		_, _ = w.Write(b)
+	})
+
+	tests := []struct {
+		handler      http.Handler
+		name         string
+		path         string
+		encoding     string
+		expectBody   string
+		body         []byte
+		expectStatus int
+		chunked      bool
+	}{
+		{name: "within limit", path: "/items", body: []byte("hello"), expectStatus: http.StatusOK, expectBody: "hello"},
+		{name: "content length over limit", path: "/items", body: bytes.Repeat([]byte("a"), 101), expectStatus: http.StatusRequestEntityTooLarge, expectBody: `"code":413`},
+		{name: "chunked over limit", path: "/items", body: bytes.Repeat([]byte("a"), 101), chunked: true, expectStatus: http.StatusRequestEntityTooLarge},
+		{name: "route override", path: "/uploads/1", body: bytes.Repeat([]byte("a"), 101), expectStatus: http.StatusOK},
+		{name: "route level middleware", path: "/items", body: bytes.Repeat([]byte("a"), 101), chunked: true, handler: MaxBodySize(200)(echo), expectStatus: http.StatusOK},
+		{name: "gzip", path: "/uploads/1", encoding: "gzip", body: gzipped.Bytes(), expectStatus: http.StatusOK, expectBody: strings.Repeat("a", 1000)},
+		{name: "zstd", path: "/items", encoding: "zstd", body: zstdSmall, expectStatus: http.StatusOK, expectBody: "hello"},
+		{name: "decompression bomb", path: "/items", encoding: "zstd", body: zstdBomb, expectStatus: http.StatusRequestEntityTooLarge},
+		{name: "invalid gzip", path: "/items", encoding: "gzip", body: []byte("nope"), expectStatus: http.StatusBadRequest},
+		{name: "unsupported encoding", path: "/items", encoding: "compress", body: []byte("x"), expectStatus: http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := test.handler
+			if handler == nil {
+				handler = echo
+			}
+
+			req := httptest.NewRequest(http.MethodPost, test.path, bytes.NewReader(test.body))
+			if test.chunked {
+				req.ContentLength = -1
+			}
+			req.Header.Set("Content-Encoding", test.encoding)
+
+			rec := httptest.NewRecorder()
+			mw(handler).ServeHTTP(rec, req)
+
+			if rec.Code != test.expectStatus {
+				t.Errorf("unexpected status code: got %d want %d", rec.Code, test.expectStatus)
+			}
+
+			if !strings.Contains(rec.Body.String(), test.expectBody) {
+				t.Errorf("unexpected body: got %s want %s", rec.Body.String(), test.expectBody)
+			}
+		})
+	}
+}
+
+func TestBodyLimitsFromSpec(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(`
+openapi: 3.0.0
+info: {title: test, version: 1.0.0}
+servers:
+  - url: https://example.com/v1
+paths:
+  /uploads/{id}:
+    put:
+      x-max-body-size: 5242880
+      responses: {'204': {description: ok}}
+    get:
+      responses: {'200': {description: ok}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limits, err := BodyLimitsFromSpec(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(limits) != 1 || limits["PUT /v1/uploads/{id}"] != 5242880 {
+		t.Errorf("unexpected limits: got %v", limits)
+	}
+}
@@ -0,0 +1,299 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/server/render"
+)
+
+// ETagConfig holds configuration for the ETag middleware.
+type ETagConfig struct {
+	// MaxSize is the largest response in bytes that is buffered to compute an ETag. Defaults to 4MiB.
+	MaxSize int
+	// Weak generates weak ETags, which allow semantically equivalent but not byte identical responses to match.
+	Weak bool
+}
+
+// StrongETag returns a strong ETag computed from the bytes of a representation.
+func StrongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// WeakETag returns a weak ETag for a resource version such as a revision number or updated timestamp.
+func WeakETag(version string) string {
+	return `W/"` + strings.ReplaceAll(version, `"`, "") + `"`
+}
+
+// VersionETag returns a strong ETag for a resource version. Use it when the version changes with every
+// change to the representation, so If-Match preconditions can be evaluated without rendering the resource.
+func VersionETag(version string) string {
+	return `"` + strings.ReplaceAll(version, `"`, "") + `"`
+}
+
+// CacheControl returns a route level middleware that sets the Cache-Control header before the handler runs, so a
+// value set by the handler wins, for example router.With(middleware.CacheControl("public, max-age=300")).Get(...).
+func CacheControl(policy string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", policy)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Preconditions describes the current state of a resource for evaluating conditional request headers.
+type Preconditions struct {
+	LastModified time.Time
+	// ETag is the current entity tag of the resource. Empty means the resource does not exist.
+	ETag string
+	// RequireIfMatch rejects unsafe requests without an If-Match header with 428 Precondition Required.
+	RequireIfMatch bool
+}
+
+/*
+Check evaluates If-Match, If-Unmodified-Since, If-None-Match and If-Modified-Since as described by RFC 9110.
+It sets the ETag and Last-Modified response headers. When a precondition fails it writes 304, 412 or 428 and
+returns false, in which case the handler must not continue.
+
+	if !(middleware.Preconditions{ETag: middleware.VersionETag(item.Version), RequireIfMatch: true}).Check(w, r) {
+		return
+	}
+*/
+func (p Preconditions) Check(w http.ResponseWriter, r *http.Request) bool {
+	h := w.Header()
+	if p.ETag != "" {
+		h.Set("ETag", p.ETag)
+	}
+	if !p.LastModified.IsZero() {
+		h.Set("Last-Modified", p.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	safe := r.Method == http.MethodGet || r.Method == http.MethodHead
+	ifMatch := r.Header.Get("If-Match")
+
+	if !safe && p.RequireIfMatch && ifMatch == "" {
+		render.Error(w, http.StatusPreconditionRequired, "this request requires an If-Match header")
+		return false
+	}
+
+	if ifMatch != "" {
+		if !matchETag(ifMatch, p.ETag, true) {
+			render.Error(w, http.StatusPreconditionFailed, "the resource has been modified")
+			return false
+		}
+	} else if since, err := http.ParseTime(r.Header.Get("If-Unmodified-Since")); err == nil && !p.LastModified.IsZero() {
+		if p.LastModified.Truncate(time.Second).After(since) {
+			render.Error(w, http.StatusPreconditionFailed, "the resource has been modified")
+			return false
+		}
+	}
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" {
+		if matchETag(ifNoneMatch, p.ETag, false) {
+			if safe {
+				writeNotModified(w)
+			} else {
+				render.Error(w, http.StatusPreconditionFailed, "the resource already exists")
+			}
+			return false
+		}
+	} else if safe && !p.LastModified.IsZero() {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err == nil && !p.LastModified.Truncate(time.Second).After(since) {
+			writeNotModified(w)
+			return false
+		}
+	}
+
+	return true
+}
+
+// NotModified reports whether a GET or HEAD request's If-None-Match header matches etag.
+func NotModified(r *http.Request, etag string) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	return matchETag(r.Header.Get("If-None-Match"), etag, false)
+}
+
+// ETag returns a middleware that adds an ETag to successful GET responses and answers
+// If-None-Match and If-Modified-Since with 304 Not Modified. Handlers may set their own ETag or Last-Modified
+// headers, typically from a resource version, and the middleware evaluates the request against those instead.
+// Responses that are flushed or larger than MaxSize are streamed without an ETag.
+func ETag(cfg ETagConfig) func(http.Handler) http.Handler {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 4 << 20
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Upgraded connections are not responses to buffer
+			if r.Method != http.MethodGet || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ew := &etagWriter{ResponseWriter: w, cfg: &cfg, status: http.StatusOK}
+			next.ServeHTTP(ew, r)
+			ew.finish(r)
+		})
+	}
+}
+
+// etagWriter buffers a response so an ETag can be computed before headers are sent.
+type etagWriter struct {
+	http.ResponseWriter
+	cfg         *ETagConfig
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	passthrough bool
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if ew.wroteHeader || ew.passthrough {
+		return
+	}
+
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	ew.status = code
+	ew.wroteHeader = true
+
+	// Only successful responses are cacheable by validator
+	if code != http.StatusOK {
+		ew.startPassthrough()
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	if ew.passthrough {
+		return ew.ResponseWriter.Write(b)
+	}
+
+	if ew.buf.Len()+len(b) > ew.cfg.MaxSize {
+		ew.startPassthrough()
+		return ew.ResponseWriter.Write(b)
+	}
+
+	return ew.buf.Write(b)
+}
+
+// Flush streams the response without an ETag from this point on.
+func (ew *etagWriter) Flush() {
+	if !ew.wroteHeader {
+		ew.WriteHeader(http.StatusOK)
+	}
+	ew.startPassthrough()
+	_ = http.NewResponseController(ew.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// startPassthrough sends the headers and anything buffered so far unmodified.
+func (ew *etagWriter) startPassthrough() {
+	if ew.passthrough {
+		return
+	}
+
+	ew.passthrough = true
+	ew.ResponseWriter.WriteHeader(ew.status)
+	if ew.buf.Len() > 0 {
+		_, _ = ew.ResponseWriter.Write(ew.buf.Bytes())
+		ew.buf.Reset()
+	}
+}
+
+// finish evaluates the conditional headers once the complete response is buffered.
+func (ew *etagWriter) finish(r *http.Request) {
+	if ew.passthrough {
+		return
+	}
+
+	h := ew.Header()
+	etag := h.Get("ETag")
+	if etag == "" {
+		etag = StrongETag(ew.buf.Bytes())
+		if ew.cfg.Weak {
+			etag = "W/" + etag
+		}
+		h.Set("ETag", etag)
+	}
+
+	lastModified, _ := http.ParseTime(h.Get("Last-Modified"))
+	if !(Preconditions{ETag: etag, LastModified: lastModified}).Check(ew.ResponseWriter, r) {
+		return
+	}
+
+	h.Set("Content-Length", strconv.Itoa(ew.buf.Len()))
+	ew.ResponseWriter.WriteHeader(ew.status)
+	_, _ = ew.ResponseWriter.Write(ew.buf.Bytes())
+}
+
+// writeNotModified sends a 304 without the headers that describe a body.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	for _, header := range []string{"Content-Type", "Content-Length", "Content-Encoding", "Transfer-Encoding"} {
+		h.Del(header)
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// matchETag compares an If-Match or If-None-Match header against etag using strong or weak comparison.
+// Suffixes added by the compression middleware are ignored so validators of encoded responses still match.
+func matchETag(header, etag string, strong bool) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	if strong && strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	etag = trimEncodingSuffix(strings.TrimPrefix(etag, "W/"))
+
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if strong && strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if trimEncodingSuffix(strings.TrimPrefix(candidate, "W/")) == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func trimEncodingSuffix(etag string) string {
+	for _, encoding := range Encodings {
+		if trimmed, ok := strings.CutSuffix(etag, "-"+encoding+`"`); ok {
+			return trimmed + `"`
+		}
+	}
+
+	return etag
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	handler := ETag(ETagConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 with an ETag: got %d %q", rec.Code, etag)
+	}
+
+	tests := []struct {
+		ifNoneMatch  string
+		expectStatus int
+	}{
+		{ifNoneMatch: etag, expectStatus: http.StatusNotModified},
+		{ifNoneMatch: "W/" + etag, expectStatus: http.StatusNotModified},
+		{ifNoneMatch: `"other", ` + etag[:len(etag)-1] + `-gzip"`, expectStatus: http.StatusNotModified},
+		{ifNoneMatch: "*", expectStatus: http.StatusNotModified},
+		{ifNoneMatch: `"other"`, expectStatus: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("If-None-Match", test.ifNoneMatch)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != test.expectStatus {
+			t.Errorf("If-None-Match %s: got %d want %d", test.ifNoneMatch, rec.Code, test.expectStatus)
+		}
+
+		if test.expectStatus == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Errorf("expected empty body for 304: got %q", rec.Body.String())
+		}
+	}
+}
+
+func TestPreconditions(t *testing.T) {
+	modified := time.Date(2024, 10, 26, 12, 0, 0, 0, time.UTC)
+	current := VersionETag("2")
+
+	tests := []struct {
+		headers      map[string]string
+		name         string
+		method       string
+		expectStatus int
+		required     bool
+	}{
+		{name: "unconditional write", method: http.MethodPut, expectStatus: http.StatusOK},
+		{name: "missing If-Match", method: http.MethodPut, required: true, expectStatus: http.StatusPreconditionRequired},
+		{name: "matching If-Match", method: http.MethodPut, required: true, headers: map[string]string{"If-Match": current}, expectStatus: http.StatusOK},
+		{name: "stale If-Match", method: http.MethodPatch, headers: map[string]string{"If-Match": VersionETag("1")}, expectStatus: http.StatusPreconditionFailed},
+		{name: "weak If-Match", method: http.MethodPut, headers: map[string]string{"If-Match": "W/" + current}, expectStatus: http.StatusPreconditionFailed},
+		{name: "If-Unmodified-Since", method: http.MethodDelete, headers: map[string]string{"If-Unmodified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, expectStatus: http.StatusPreconditionFailed},
+		{name: "If-None-Match on create", method: http.MethodPut, headers: map[string]string{"If-None-Match": "*"}, expectStatus: http.StatusPreconditionFailed},
+		{name: "If-Modified-Since", method: http.MethodGet, headers: map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, expectStatus: http.StatusNotModified},
+		{name: "modified since", method: http.MethodGet, headers: map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, expectStatus: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/items/1", nil)
+			for k, v := range test.headers {
+				req.Header.Set(k, v)
+			}
+
+			rec := httptest.NewRecorder()
+			if (Preconditions{ETag: current, LastModified: modified, RequireIfMatch: test.required}).Check(rec, req) {
+				rec.WriteHeader(http.StatusOK)
+			}
+
+			if rec.Code != test.expectStatus {
+				t.Errorf("unexpected status code: got %d want %d", rec.Code, test.expectStatus)
+			}
+		})
+	}
+}
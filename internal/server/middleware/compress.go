@@ -0,0 +1,331 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported content encodings in order of server preference.
+const (
+	EncodingZstd   = "zstd"
+	EncodingBrotli = "br"
+	EncodingGzip   = "gzip"
+)
+
+// Encodings lists the supported content encodings in order of server preference.
+var Encodings = []string{EncodingZstd, EncodingBrotli, EncodingGzip}
+
+var defaultCompressibleTypes = []string{
+	"text/",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"application/yaml",
+	"image/svg+xml",
+}
+
+// CompressConfig holds configuration for the compression middleware.
+type CompressConfig struct {
+	// ContentTypes are media type prefixes eligible for compression. Defaults to text and common structured types.
+	ContentTypes []string
+	// MinSize is the response size in bytes below which responses are sent uncompressed. Defaults to 1024.
+	MinSize int
+}
+
+// encoder is implemented by all of the supported compression writers.
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// encoderPools holds reusable encoders per content encoding.
+var encoderPools = map[string]*sync.Pool{
+	EncodingZstd: {New: func() any {
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return enc
+	}},
+	EncodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, 4)
+	}},
+	EncodingGzip: {New: func() any {
+		enc, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return enc
+	}},
+}
+
+// Compress returns a middleware that compresses responses using the best encoding accepted by the client.
+func Compress(cfg CompressConfig) func(http.Handler) http.Handler {
+	if len(cfg.ContentTypes) == 0 {
+		cfg.ContentTypes = defaultCompressibleTypes
+	}
+	if cfg.MinSize <= 0 {
+		cfg.MinSize = 1024
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := NegotiateEncoding(r.Header.Get("Accept-Encoding"), Encodings)
+			if encoding == "" || r.Method == http.MethodHead || r.Header.Get("Upgrade") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: w,
+				cfg:            &cfg,
+				encoding:       encoding,
+				status:         http.StatusOK,
+			}
+			defer cw.close()
+
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+// compressWriter buffers the start of a response until it can decide whether compressing it is worthwhile.
+type compressWriter struct {
+	http.ResponseWriter
+	cfg      *CompressConfig
+	enc      encoder
+	encoding string
+	buf      []byte
+	status   int
+	decided  bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.decided {
+		return
+	}
+
+	// Informational responses are forwarded as is
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	cw.status = code
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) < cw.cfg.MinSize {
+			return len(b), nil
+		}
+
+		err := cw.decide()
+		if err != nil {
+			return 0, err
+		}
+
+		return len(b), nil
+	}
+
+	if cw.enc != nil {
+		return cw.enc.Write(b)
+	}
+
+	return cw.ResponseWriter.Write(b)
+}
+
+// Flush sends buffered data to the client. Flushing before the size threshold is reached sends the response uncompressed,
+// so streamed responses are never held back waiting for more data.
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		_ = cw.decide()
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide writes the headers and buffered data, compressing them when the response is eligible.
+func (cw *compressWriter) decide() error {
+	cw.decided = true
+	h := cw.Header()
+
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 && h.Get("Content-Encoding") == "" {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	compressible := cw.compressible()
+	if compressible {
+		h.Add("Vary", "Accept-Encoding")
+	}
+
+	if compressible && len(cw.buf) >= cw.cfg.MinSize {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		// A strong validator must differ between representations
+		if etag := h.Get("ETag"); strings.HasSuffix(etag, `"`) && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+cw.encoding+`"`)
+		}
+
+		cw.enc = encoderPools[cw.encoding].Get().(encoder)
+		cw.enc.Reset(cw.ResponseWriter)
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	if len(cw.buf) == 0 {
+		return nil
+	}
+
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(cw.buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(cw.buf)
+	}
+	cw.buf = nil
+
+	return err
+}
+
+// compressible reports whether the response status, encoding and content type allow compression.
+func (cw *compressWriter) compressible() bool {
+	if cw.status < http.StatusOK || cw.status == http.StatusNoContent || cw.status == http.StatusNotModified {
+		return false
+	}
+
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	// Event streams are flushed after every event, which leaves little for compression to gain, and some
+	// proxies buffer compressed streams
+	if mediaType == "text/event-stream" {
+		return false
+	}
+
+	for _, contentType := range cw.cfg.ContentTypes {
+		if strings.HasPrefix(mediaType, contentType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// close finishes the response once the handler returns.
+func (cw *compressWriter) close() {
+	// Responses that finished below the size threshold are sent uncompressed with an accurate length
+	if !cw.decided {
+		if len(cw.buf) > 0 {
+			cw.Header().Set("Content-Length", strconv.Itoa(len(cw.buf)))
+		}
+		_ = cw.decide()
+	}
+
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		cw.enc.Reset(nil)
+		encoderPools[cw.encoding].Put(cw.enc)
+		cw.enc = nil
+	}
+}
+
+// NegotiateEncoding returns the supported encoding preferred by an Accept-Encoding header, or an empty string
+// if the response should not be encoded. Ties in quality are broken by the order of supported.
+func NegotiateEncoding(acceptEncoding string, supported []string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	qualities := map[string]float64{}
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+
+		qualities[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range supported {
+		q, ok := qualities[encoding]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+
+	return best
+}
+
+// Precompress encodes data with every supported encoding at the highest compression level.
+// It is intended for embedded assets that are compressed once at startup rather than on every request.
+func Precompress(data []byte) (map[string][]byte, error) {
+	variants := map[string][]byte{}
+
+	var buf bytes.Buffer
+	gz, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	_, err = gz.Write(data)
+	if err == nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	variants[EncodingGzip] = bytes.Clone(buf.Bytes())
+
+	buf.Reset()
+	br := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	_, err = br.Write(data)
+	if err == nil {
+		err = br.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	variants[EncodingBrotli] = bytes.Clone(buf.Bytes())
+
+	zs, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithWindowSize(1<<20))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = zs.Close() }()
+	variants[EncodingZstd] = zs.EncodeAll(data, nil)
+
+	return variants, nil
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "", expected: ""},
+		{input: "gzip", expected: EncodingGzip},
+		{input: "gzip, deflate, br, zstd", expected: EncodingZstd},
+		{input: "gzip;q=1.0, br;q=0.5", expected: EncodingGzip},
+		{input: "br;q=0", expected: ""},
+		{input: "*", expected: EncodingZstd},
+		{input: "*;q=0.1, zstd;q=0", expected: EncodingBrotli},
+		{input: "identity", expected: ""},
+	}
+
+	for _, test := range tests {
+		actual := NegotiateEncoding(test.input, Encodings)
+		if actual != test.expected {
+			t.Errorf("NegotiateEncoding(%q): got %q want %q", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"status":"ok"}`, 200)
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		expectEncoding string
+	}{
+		{name: "gzip", acceptEncoding: "gzip", contentType: "application/json", body: large, expectEncoding: EncodingGzip},
+		{name: "brotli", acceptEncoding: "br", contentType: "application/json", body: large, expectEncoding: EncodingBrotli},
+		{name: "zstd", acceptEncoding: "zstd", contentType: "application/json", body: large, expectEncoding: EncodingZstd},
+		{name: "below threshold", acceptEncoding: "gzip", contentType: "application/json", body: `{"status":"ok"}`},
+		{name: "not allowed type", acceptEncoding: "gzip", contentType: "image/png", body: large},
+		{name: "event stream", acceptEncoding: "gzip", contentType: "text/event-stream", body: large},
+		{name: "not accepted", contentType: "application/json", body: large},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := Compress(CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				// Write in chunks to exercise buffering across the threshold
+				for i := 0; i < len(test.body); i += 100 {
+					_, _ = w.Write([]byte(test.body[i:min(i+100, len(test.body))]))
+				}
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept-Encoding", test.acceptEncoding)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if actual := rec.Header().Get("Content-Encoding"); actual != test.expectEncoding {
+				t.Fatalf("unexpected encoding: got %q want %q", actual, test.expectEncoding)
+			}
+
+			if test.expectEncoding != "" && rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("expected Vary header: got %q", rec.Header().Get("Vary"))
+			}
+
+			actual := decode(t, test.expectEncoding, rec.Body.Bytes())
+			if actual != test.body {
+				t.Errorf("unexpected body: got %d bytes want %d bytes", len(actual), len(test.body))
+			}
+		})
+	}
+
+	t.Run("Flush", func(t *testing.T) {
+		handler := Compress(CompressConfig{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("data: hello\n\n"))
+			w.(http.Flusher).Flush()
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if !rec.Flushed {
+			t.Error("expected flush to reach the underlying writer")
+		}
+
+		if rec.Body.String() != "data: hello\n\n" {
+			t.Errorf("expected small flushed response to be sent uncompressed: got %q", rec.Body.String())
+		}
+	})
+}
+
+func decode(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+
+	var r io.Reader = bytes.NewReader(body)
+	switch encoding {
+	case EncodingGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	case EncodingBrotli:
+		r = brotli.NewReader(r)
+	case EncodingZstd:
+		zs, err := zstd.NewReader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zs.Close()
+		r = zs
+	}
+
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(decoded)
+}
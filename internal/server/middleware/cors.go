@@ -0,0 +1,336 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+var defaultCORSMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+}
+
+var defaultCORSHeaders = []string{
+	"Accept",
+	"Authorization",
+	"Content-Type",
+}
+
+// CORSPolicy describes which cross-origin requests are allowed.
+// Allowed origins may be exact ("https://example.com"), wildcard subdomains
+// ("https://*.example.com"), regular expressions when prefixed with "^", or "*" to allow any origin.
+type CORSPolicy struct {
+	AllowedOrigins   []string `mapstructure:"allowed-origins"`
+	AllowedMethods   []string `mapstructure:"allowed-methods"`
+	AllowedHeaders   []string `mapstructure:"allowed-headers"`
+	ExposedHeaders   []string `mapstructure:"exposed-headers"`
+	MaxAge           int      `mapstructure:"max-age"`
+	AllowCredentials bool     `mapstructure:"allow-credentials"`
+}
+
+// CORSConfig is the default CORS policy along with per-route overrides keyed by path prefix.
+// The longest matching prefix wins.
+type CORSConfig struct {
+	Routes map[string]CORSPolicy
+	CORSPolicy
+}
+
+// CORS is a cross-origin resource sharing middleware whose policies can be swapped at runtime.
+type CORS struct {
+	policies atomic.Pointer[corsPolicies]
+}
+
+type corsPolicies struct {
+	defaultPolicy *corsPolicy
+	routes        []corsRoute
+}
+
+type corsRoute struct {
+	policy *corsPolicy
+	prefix string
+}
+
+// wildcardOrigin matches any subdomain of suffix for the given scheme.
+type wildcardOrigin struct {
+	scheme string
+	suffix string
+}
+
+type corsPolicy struct {
+	exactOrigins     map[string]struct{}
+	allowedMethods   map[string]struct{}
+	allowedHeaders   map[string]struct{}
+	methods          string
+	headers          string
+	exposedHeaders   string
+	maxAge           string
+	wildcardOrigins  []wildcardOrigin
+	regexOrigins     []*regexp.Regexp
+	anyOrigin        bool
+	anyHeader        bool
+	allowCredentials bool
+}
+
+// NewCORS returns a CORS middleware configured from cfg.
+func NewCORS(cfg CORSConfig) (*CORS, error) {
+	c := &CORS{}
+	err := c.Update(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Update atomically replaces the active CORS policies. In-flight requests keep the policy they started with.
+func (c *CORS) Update(cfg CORSConfig) error {
+	defaultPolicy, err := compileCORSPolicy(cfg.CORSPolicy)
+	if err != nil {
+		return err
+	}
+
+	policies := &corsPolicies{defaultPolicy: defaultPolicy}
+	for prefix, p := range cfg.Routes {
+		policy, err := compileCORSPolicy(p)
+		if err != nil {
+			return fmt.Errorf("cors route %s: %w", prefix, err)
+		}
+		policies.routes = append(policies.routes, corsRoute{prefix: prefix, policy: policy})
+	}
+
+	// Longest prefix first so the most specific override wins
+	sort.Slice(policies.routes, func(i, j int) bool {
+		return len(policies.routes[i].prefix) > len(policies.routes[j].prefix)
+	})
+
+	c.policies.Store(policies)
+
+	return nil
+}
+
+// Handler wraps an http.Handler to answer preflight requests and add CORS headers to actual requests.
+func (c *CORS) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		policy := c.policies.Load().match(r.URL.Path)
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if policy == nil || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		h.Add("Vary", "Origin")
+
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+
+			if !policy.allowOrigin(origin) ||
+				!policy.allowMethod(r.Header.Get("Access-Control-Request-Method")) ||
+				!policy.allowHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+
+			policy.setOrigin(h, origin)
+			h.Set("Access-Control-Allow-Methods", policy.methods)
+			if policy.anyHeader {
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+			} else {
+				h.Set("Access-Control-Allow-Headers", policy.headers)
+			}
+			if policy.maxAge != "" {
+				h.Set("Access-Control-Max-Age", policy.maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if policy.allowOrigin(origin) {
+			policy.setOrigin(h, origin)
+			if policy.exposedHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", policy.exposedHeaders)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowOrigin reports whether the policy for path allows requests from origin. Requests that browsers do not
+// check with CORS, such as WebSocket handshakes, use it to apply the same policy.
+func (c *CORS) AllowOrigin(path, origin string) bool {
+	policy := c.policies.Load().match(path)
+	return policy != nil && policy.allowOrigin(origin)
+}
+
+// match returns the policy for path or nil if CORS is disabled for it.
+func (p *corsPolicies) match(path string) *corsPolicy {
+	for _, route := range p.routes {
+		// Prefixes match whole path segments, so /public does not match /publications
+		prefix := strings.TrimSuffix(route.prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return route.policy
+		}
+	}
+
+	return p.defaultPolicy
+}
+
+// compileCORSPolicy precomputes lookups and header values for p. A policy without origins disables CORS.
+func compileCORSPolicy(p CORSPolicy) (*corsPolicy, error) {
+	if len(p.AllowedOrigins) == 0 {
+		return nil, nil
+	}
+
+	if p.MaxAge < 0 {
+		return nil, fmt.Errorf("invalid cors max age %d", p.MaxAge)
+	}
+
+	// Browsers reject credentialed responses allowing any origin, and echoing the origin instead would let any
+	// site make requests with the credentials of users
+	if p.AllowCredentials && slices.Contains(p.AllowedOrigins, "*") {
+		return nil, errors.New("cors origin * cannot be allowed with credentials")
+	}
+
+	policy := &corsPolicy{
+		exactOrigins:     map[string]struct{}{},
+		allowedMethods:   map[string]struct{}{},
+		allowedHeaders:   map[string]struct{}{},
+		allowCredentials: p.AllowCredentials,
+		exposedHeaders:   strings.Join(p.ExposedHeaders, ", "),
+	}
+
+	for _, origin := range p.AllowedOrigins {
+		switch {
+		case origin == "*":
+			policy.anyOrigin = true
+		case strings.HasPrefix(origin, "^"):
+			re, err := regexp.Compile(origin)
+			if err != nil {
+				return nil, fmt.Errorf("invalid cors origin pattern %q: %w", origin, err)
+			}
+			policy.regexOrigins = append(policy.regexOrigins, re)
+		case strings.Contains(origin, "*"):
+			// https://*.example.com matches https://api.example.com
+			scheme, host, ok := strings.Cut(origin, "://*")
+			if !ok || strings.Contains(host, "*") {
+				return nil, fmt.Errorf("invalid cors wildcard origin %q", origin)
+			}
+			policy.wildcardOrigins = append(policy.wildcardOrigins, wildcardOrigin{
+				scheme: strings.ToLower(scheme + "://"),
+				suffix: strings.ToLower(host),
+			})
+		default:
+			policy.exactOrigins[strings.ToLower(origin)] = struct{}{}
+		}
+	}
+
+	methods := p.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	upperMethods := make([]string, 0, len(methods))
+	for _, m := range methods {
+		m = strings.ToUpper(m)
+		upperMethods = append(upperMethods, m)
+		policy.allowedMethods[m] = struct{}{}
+	}
+	policy.methods = strings.Join(upperMethods, ", ")
+
+	headers := p.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	for _, header := range headers {
+		if header == "*" {
+			policy.anyHeader = true
+			continue
+		}
+		policy.allowedHeaders[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	policy.headers = strings.Join(headers, ", ")
+
+	if p.MaxAge > 0 {
+		policy.maxAge = strconv.Itoa(p.MaxAge)
+	}
+
+	return policy, nil
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if _, ok := p.exactOrigins[origin]; ok {
+		return true
+	}
+
+	for _, wildcard := range p.wildcardOrigins {
+		rest, ok := strings.CutPrefix(origin, wildcard.scheme)
+		if ok && len(rest) > len(wildcard.suffix) && strings.HasSuffix(rest, wildcard.suffix) {
+			return true
+		}
+	}
+
+	for _, re := range p.regexOrigins {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *corsPolicy) allowMethod(method string) bool {
+	_, ok := p.allowedMethods[strings.ToUpper(method)]
+	return ok
+}
+
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	if p.anyHeader || requested == "" {
+		return true
+	}
+
+	for header := range strings.SplitSeq(requested, ",") {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+		if header == "" {
+			continue
+		}
+		if _, ok := p.allowedHeaders[header]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setOrigin echoes the request origin unless any origin is allowed.
+func (p *corsPolicy) setOrigin(h http.Header, origin string) {
+	if p.anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+
+	if p.allowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	cfg := CORSConfig{
+		CORSPolicy: CORSPolicy{
+			AllowedOrigins: []string{"https://app.example.com", "https://*.example.org", `^https://pr-[0-9]+\.example\.net$`},
+			ExposedHeaders: []string{"X-Request-Id"},
+			MaxAge:         600,
+		},
+		Routes: map[string]CORSPolicy{
+			"/public": {
+				AllowedOrigins: []string{"*"},
+				AllowedMethods: []string{"get"},
+			},
+		},
+	}
+
+	c, err := NewCORS(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		origin        string
+		requestMethod string
+		expectOrigin  string
+		expectStatus  int
+	}{
+		{name: "exact origin", method: http.MethodGet, path: "/health", origin: "https://app.example.com", expectOrigin: "https://app.example.com", expectStatus: http.StatusOK},
+		{name: "wildcard subdomain", method: http.MethodGet, path: "/health", origin: "https://api.example.org", expectOrigin: "https://api.example.org", expectStatus: http.StatusOK},
+		{name: "wildcard does not match apex", method: http.MethodGet, path: "/health", origin: "https://example.org", expectStatus: http.StatusOK},
+		{name: "regex origin", method: http.MethodGet, path: "/health", origin: "https://pr-42.example.net", expectOrigin: "https://pr-42.example.net", expectStatus: http.StatusOK},
+		{name: "disallowed origin", method: http.MethodGet, path: "/health", origin: "https://evil.com", expectStatus: http.StatusOK},
+		{name: "preflight", method: http.MethodOptions, path: "/health", origin: "https://app.example.com", requestMethod: http.MethodDelete, expectOrigin: "https://app.example.com", expectStatus: http.StatusNoContent},
+		{name: "preflight disallowed origin", method: http.MethodOptions, path: "/health", origin: "https://evil.com", requestMethod: http.MethodGet, expectStatus: http.StatusForbidden},
+		{name: "route override", method: http.MethodGet, path: "/public/thing", origin: "https://evil.com", expectOrigin: "*", expectStatus: http.StatusOK},
+		{name: "route override exact path", method: http.MethodGet, path: "/public", origin: "https://evil.com", expectOrigin: "*", expectStatus: http.StatusOK},
+		{name: "route override whole segments", method: http.MethodGet, path: "/publications", origin: "https://evil.com", expectStatus: http.StatusOK},
+		{name: "route override method", method: http.MethodOptions, path: "/public/thing", origin: "https://evil.com", requestMethod: http.MethodDelete, expectStatus: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, nil)
+			req.Header.Set("Origin", test.origin)
+			if test.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", test.requestMethod)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectStatus {
+				t.Errorf("unexpected status code: got %d want %d", rec.Code, test.expectStatus)
+			}
+
+			actual := rec.Header().Get("Access-Control-Allow-Origin")
+			if actual != test.expectOrigin {
+				t.Errorf("unexpected allowed origin: got %q want %q", actual, test.expectOrigin)
+			}
+		})
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		err := c.Update(CORSConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if actual := rec.Header().Get("Access-Control-Allow-Origin"); actual != "" {
+			t.Errorf("expected cors to be disabled after update: got %q", actual)
+		}
+	})
+
+	t.Run("InvalidPattern", func(t *testing.T) {
+		_, err := NewCORS(CORSConfig{CORSPolicy: CORSPolicy{AllowedOrigins: []string{"^https://("}}})
+		if err == nil {
+			t.Error("expected error for invalid origin pattern")
+		}
+	})
+
+	t.Run("AnyOriginWithCredentials", func(t *testing.T) {
+		_, err := NewCORS(CORSConfig{Routes: map[string]CORSPolicy{
+			"/public": {AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		}})
+		if err == nil {
+			t.Error("expected error for any origin with credentials")
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key accepted.
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyConfig holds configuration for the Idempotency middleware.
+type IdempotencyConfig struct {
+	// Store holds the stored responses.
+	Store store.IdempotencyStore
+	// Logger logs store errors. Defaults to slog.Default.
+	Logger *slog.Logger
+	// Principal identifies the client making a request, so clients cannot replay each other's responses.
+	// Defaults to the Authorization header.
+	Principal func(r *http.Request) string
+	// Methods that accept an Idempotency-Key header. Defaults to POST and PATCH.
+	Methods []string
+	// TTL is how long a response is replayed for. Defaults to 24 hours.
+	TTL time.Duration
+	// MaxSize is the largest response body in bytes that is stored. Requests with larger responses are not
+	// replayed and can be retried. Defaults to 1MiB.
+	MaxSize int
+}
+
+/*
+Idempotency returns a middleware that makes retries of unsafe requests with an Idempotency-Key header safe.
+The first response for a key is stored, and requests repeating the key with an identical method, URL and body
+are answered with it and an Idempotent-Replayed header instead of being handled again.
+A key reused for a different request is rejected with 422, and a retry that arrives while the first request
+is still being handled with 409. Server errors are not stored, so those requests can be retried.
+
+Keys are scoped to the principal making the request and expire after the TTL. Requests without the header are
+handled as usual.
+*/
+func Idempotency(cfg IdempotencyConfig) func(http.Handler) http.Handler {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Principal == nil {
+		cfg.Principal = func(r *http.Request) string { return r.Header.Get("Authorization") }
+	}
+	if len(cfg.Methods) == 0 {
+		cfg.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 1 << 20
+	}
+
+	logger := cfg.Logger.With("component", "idempotency")
+	var lastCleanup atomic.Int64
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || !slices.Contains(cfg.Methods, r.Method) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				render.Error(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					render.Error(w, http.StatusRequestEntityTooLarge, err.Error())
+					return
+				}
+				render.Error(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := context.WithoutCancel(r.Context())
+			storeKey := hashParts(cfg.Principal(r), key)
+			resp, err := cfg.Store.ReserveKey(ctx, storeKey, hashParts(r.Method, r.URL.RequestURI(), string(body)), time.Now().Add(cfg.TTL))
+			switch {
+			case errors.Is(err, store.ErrKeyInFlight):
+				w.Header().Set("Retry-After", "1")
+				render.Error(w, http.StatusConflict, "a request with this Idempotency-Key is in progress")
+				return
+			case errors.Is(err, store.ErrKeyMismatch):
+				render.Error(w, http.StatusUnprocessableEntity, "this Idempotency-Key was used for a different request")
+				return
+			case err != nil:
+				logger.Error("reserving idempotency key", "err", err)
+				render.Error(w, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+				return
+			case resp != nil:
+				replay(w, resp)
+				return
+			}
+
+			// Outer middlewares such as CORS set headers for the current request, which a replay must not repeat
+			iw := &idempotencyWriter{ResponseWriter: w, before: w.Header().Clone(), maxSize: cfg.MaxSize, status: http.StatusOK}
+			defer func() {
+				// Release the key if the handler panics, so the request can be retried
+				if p := recover(); p != nil {
+					_ = cfg.Store.ReleaseKey(ctx, storeKey)
+					panic(p)
+				}
+			}()
+			next.ServeHTTP(iw, r)
+			if !iw.wroteHeader {
+				iw.WriteHeader(http.StatusOK)
+			}
+
+			if iw.status >= http.StatusInternalServerError || iw.overflow {
+				err = cfg.Store.ReleaseKey(ctx, storeKey)
+			} else {
+				err = cfg.Store.CompleteKey(ctx, storeKey, store.IdempotentResponse{Status: iw.status, Header: iw.header, Body: iw.buf.Bytes()})
+			}
+			if err != nil {
+				logger.Error("storing idempotent response", "err", err)
+			}
+
+			// Expired keys are claimed again when reused, so deleting them only reclaims space
+			now := time.Now()
+			last := lastCleanup.Load()
+			if now.Sub(time.Unix(0, last)) > time.Minute && lastCleanup.CompareAndSwap(last, now.UnixNano()) {
+				_, err = cfg.Store.DeleteExpiredKeys(ctx, now)
+				if err != nil {
+					logger.Error("deleting expired idempotency keys", "err", err)
+				}
+			}
+		})
+	}
+}
+
+// replay writes a stored response.
+func replay(w http.ResponseWriter, resp *store.IdempotentResponse) {
+	h := w.Header()
+	for name, values := range resp.Header {
+		h[name] = values
+	}
+	h.Set("Idempotent-Replayed", "true")
+
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(resp.Body)
+}
+
+// hashParts returns a hash of parts that is unambiguous however the parts are split.
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, part := range parts {
+		_, _ = h.Write([]byte(part))
+		_, _ = h.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyWriter records a response while it is written. Only the headers set by the handler are recorded,
+// not those already set by outer middlewares when the handler was called.
+type idempotencyWriter struct {
+	http.ResponseWriter
+	before      http.Header
+	header      http.Header
+	buf         bytes.Buffer
+	maxSize     int
+	status      int
+	wroteHeader bool
+	overflow    bool
+}
+
+func (iw *idempotencyWriter) WriteHeader(code int) {
+	if iw.wroteHeader {
+		return
+	}
+
+	if code >= 100 && code < 200 {
+		iw.ResponseWriter.WriteHeader(code)
+		return
+	}
+
+	iw.status = code
+	iw.wroteHeader = true
+	iw.header = http.Header{}
+	for name, values := range iw.Header() {
+		if !slices.Equal(values, iw.before[name]) {
+			iw.header[name] = slices.Clone(values)
+		}
+	}
+	iw.header.Del("Date")
+	iw.ResponseWriter.WriteHeader(code)
+}
+
+func (iw *idempotencyWriter) Write(b []byte) (int, error) {
+	if !iw.wroteHeader {
+		iw.WriteHeader(http.StatusOK)
+	}
+
+	if iw.buf.Len()+len(b) > iw.maxSize {
+		iw.overflow = true
+		iw.buf.Reset()
+	}
+	if !iw.overflow {
+		iw.buf.Write(b)
+	}
+
+	return iw.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (iw *idempotencyWriter) Unwrap() http.ResponseWriter {
+	return iw.ResponseWriter
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+func TestIdempotency(t *testing.T) {
+	var calls atomic.Int32
+	handler := Idempotency(IdempotencyConfig{Store: store.NewMemory()})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Location", fmt.Sprintf("/items/%d", n))
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprintf(w, `{"id":%d}`, n)
+	}))
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		key            string
+		authorization  string
+		body           string
+		expectBody     string
+		expectStatus   int
+		expectReplayed bool
+	}{
+		{name: "first request", method: http.MethodPost, path: "/items", key: "a", body: `{"name":"x"}`, expectStatus: http.StatusCreated, expectBody: `{"id":1}`},
+		{name: "replay", method: http.MethodPost, path: "/items", key: "a", body: `{"name":"x"}`, expectStatus: http.StatusCreated, expectBody: `{"id":1}`, expectReplayed: true},
+		{name: "different body", method: http.MethodPost, path: "/items", key: "a", body: `{"name":"y"}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "different path", method: http.MethodPost, path: "/other", key: "a", body: `{"name":"x"}`, expectStatus: http.StatusUnprocessableEntity},
+		{name: "other principal", method: http.MethodPost, path: "/items", key: "a", authorization: "Bearer other", body: `{"name":"x"}`, expectStatus: http.StatusCreated, expectBody: `{"id":2}`},
+		{name: "no key", method: http.MethodPost, path: "/items", body: `{"name":"x"}`, expectStatus: http.StatusCreated, expectBody: `{"id":3}`},
+		{name: "idempotent method", method: http.MethodPut, path: "/items", key: "a", body: `{"name":"x"}`, expectStatus: http.StatusCreated, expectBody: `{"id":4}`},
+		{name: "server error", method: http.MethodPost, path: "/fail", key: "b", expectStatus: http.StatusInternalServerError},
+		{name: "server error is not replayed", method: http.MethodPost, path: "/fail", key: "b", expectStatus: http.StatusInternalServerError},
+		{name: "key too long", method: http.MethodPost, path: "/items", key: strings.Repeat("k", 256), expectStatus: http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before := calls.Load()
+
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.key != "" {
+				req.Header.Set("Idempotency-Key", test.key)
+			}
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectStatus {
+				t.Errorf("unexpected status: got %d want %d", rec.Code, test.expectStatus)
+			}
+			if test.expectBody != "" && rec.Body.String() != test.expectBody {
+				t.Errorf("unexpected body: got %s want %s", rec.Body.String(), test.expectBody)
+			}
+
+			replayed := rec.Header().Get("Idempotent-Replayed") == "true"
+			if replayed != test.expectReplayed {
+				t.Errorf("unexpected Idempotent-Replayed: got %t want %t", replayed, test.expectReplayed)
+			}
+			if replayed && (calls.Load() != before || rec.Header().Get("Location") != "/items/1") {
+				t.Errorf("replay called the handler or lost headers: %v", rec.Header())
+			}
+		})
+	}
+}
+
+func TestIdempotencyOuterHeaders(t *testing.T) {
+	idempotent := Idempotency(IdempotencyConfig{Store: store.NewMemory()})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/items/1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	// Like CORS, the outer middleware sets a header that depends on the request
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
+		idempotent.ServeHTTP(w, r)
+	})
+
+	for _, origin := range []string{"https://a.example.com", "https://b.example.com"} {
+		req := httptest.NewRequest(http.MethodPost, "/items", nil)
+		req.Header.Set("Idempotency-Key", "a")
+		req.Header.Set("Origin", origin)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if actual := rec.Header().Get("Access-Control-Allow-Origin"); actual != origin {
+			t.Errorf("unexpected Access-Control-Allow-Origin: got %s want %s", actual, origin)
+		}
+		if rec.Header().Get("Location") != "/items/1" {
+			t.Errorf("expected the handler's headers to be replayed: %v", rec.Header())
+		}
+	}
+}
+
+func TestIdempotencyInFlight(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := Idempotency(IdempotencyConfig{Store: store.NewMemory()})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/items", strings.NewReader("{}"))
+		req.Header.Set("Idempotency-Key", "a")
+		return req
+	}
+
+	first := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		handler.ServeHTTP(first, newRequest())
+		close(done)
+	}()
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest())
+	if rec.Code != http.StatusConflict || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("unexpected response to a duplicate in flight: got %d %v want %d with Retry-After", rec.Code, rec.Header(), http.StatusConflict)
+	}
+
+	close(release)
+	<-done
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest())
+	if rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("unexpected response once the first request completed: got %d %v", rec.Code, rec.Header())
+	}
+}
@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"bufio"
 	"log/slog"
+	"net"
 	"net/http"
 	"time"
 )
@@ -27,6 +29,21 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.wroteHeader = true
 }
 
+// Flush sends buffered data to the client, so streamed responses pass through the logger.
+func (rw *responseWriter) Flush() {
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+// Hijack takes over the connection, so upgrades such as WebSockets pass through the logger.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // Logging wraps an http.Handler for access logging.
 func Logging(l *slog.Logger, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -43,9 +60,10 @@ func Logging(l *slog.Logger, next http.Handler) http.Handler {
 		fields := []any{
 			"status", wrapped.status,
 			"method", r.Method,
+			"proto", r.Proto,
 			"duration", time.Since(startTime).String(),
 			"ip", remoteAddr,
-			"path", r.RequestURI,
+			"path", redactRequestURI(r),
 		}
 
 		switch wrapped.status {
@@ -58,3 +76,17 @@ func Logging(l *slog.Logger, next http.Handler) http.Handler {
 		}
 	})
 }
+
+// redactRequestURI returns the request URI of r without the value of a bearer token in the query.
+func redactRequestURI(r *http.Request) string {
+	query := r.URL.Query()
+	if !query.Has(AccessTokenParam) {
+		return r.RequestURI
+	}
+
+	query.Set(AccessTokenParam, "REDACTED")
+	redacted := *r.URL
+	redacted.RawQuery = query.Encode()
+
+	return redacted.RequestURI()
+}
@@ -1,18 +1,106 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"mime"
 	"net/http"
+	"strings"
+	"time"
 
-	metrics "github.com/slok/go-http-metrics/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/slok/go-http-metrics/metrics"
 	"github.com/slok/go-http-metrics/middleware"
 	stdmiddleware "github.com/slok/go-http-metrics/middleware/std"
 )
 
-// Prometheus wraps an http.Handler to provide prometheus metrics for the route.
+// protoKey is the context key of the protocol of a request, which go-http-metrics does not pass to recorders.
+type protoKey struct{}
+
+// recorder records the request metrics of go-http-metrics, with the same names and buckets as its Prometheus
+// recorder and a proto label for the protocol of the request: HTTP/1.1, HTTP/2.0 or HTTP/3.0.
+type recorder struct {
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	inflight *prometheus.GaugeVec
+}
+
+var requestMetrics = recorder{
+	duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "The latency of the HTTP requests.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"service", "handler", "method", "code", "proto"}),
+	size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_response_size_bytes",
+		Help:    "The size of the HTTP responses.",
+		Buckets: prometheus.ExponentialBuckets(100, 10, 8),
+	}, []string{"service", "handler", "method", "code", "proto"}),
+	inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "http_requests_inflight",
+		Help: "The number of inflight requests being handled at the same time.",
+	}, []string{"service", "handler", "proto"}),
+}
+
+func (r recorder) ObserveHTTPRequestDuration(ctx context.Context, p metrics.HTTPReqProperties, duration time.Duration) {
+	r.duration.WithLabelValues(p.Service, p.ID, p.Method, p.Code, protoOf(ctx)).Observe(duration.Seconds())
+}
+
+func (r recorder) ObserveHTTPResponseSize(ctx context.Context, p metrics.HTTPReqProperties, sizeBytes int64) {
+	r.size.WithLabelValues(p.Service, p.ID, p.Method, p.Code, protoOf(ctx)).Observe(float64(sizeBytes))
+}
+
+func (r recorder) AddInflightRequests(ctx context.Context, p metrics.HTTPProperties, quantity int) {
+	r.inflight.WithLabelValues(p.Service, p.ID, protoOf(ctx)).Add(float64(quantity))
+}
+
+// protoOf returns the protocol of the request of ctx.
+func protoOf(ctx context.Context) string {
+	proto, _ := ctx.Value(protoKey{}).(string)
+	return proto
+}
+
+// RegisterMetrics registers the request metrics of the Prometheus middleware with the default Prometheus
+// registry.
+func RegisterMetrics() error {
+	for _, c := range []prometheus.Collector{requestMetrics.duration, requestMetrics.size, requestMetrics.inflight} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Prometheus wraps an http.Handler to provide prometheus metrics for the route. Event streams and upgraded
+// connections, such as WebSockets, are passed through unmeasured, since they last as long as clients stay
+// connected and would skew request durations.
 func Prometheus(next http.Handler) http.Handler {
 	mw := middleware.New(middleware.Config{
-		Recorder: metrics.NewRecorder(metrics.Config{}),
+		Recorder: requestMetrics,
 	})
+	measured := stdmiddleware.Handler("", mw, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if AcceptsEventStream(r) || r.Header.Get("Upgrade") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		measured.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), protoKey{}, r.Proto)))
+	})
+}
+
+// AcceptsEventStream reports whether r asks for a Server-Sent Events stream, as browsers' EventSource does.
+func AcceptsEventStream(r *http.Request) bool {
+	for accept := range strings.SplitSeq(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "text/event-stream" {
+			return true
+		}
+	}
 
-	return stdmiddleware.Handler("", mw, next)
+	return false
 }
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// requestProtos returns the proto label of the request duration series of path.
+func requestProtos(t *testing.T, path string) []string {
+	t.Helper()
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(requestMetrics.duration)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var protos []string
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			if labels["handler"] == path {
+				protos = append(protos, labels["proto"])
+			}
+		}
+	}
+
+	return protos
+}
+
+func TestPrometheus(t *testing.T) {
+	handler := Prometheus(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		path   string
+		proto  string
+		accept string
+		expect []string
+	}{
+		{path: "/http1", proto: "HTTP/1.1", expect: []string{"HTTP/1.1"}},
+		{path: "/http2", proto: "HTTP/2.0", expect: []string{"HTTP/2.0"}},
+		{path: "/http3", proto: "HTTP/3.0", expect: []string{"HTTP/3.0"}},
+		// Event streams are not measured
+		{path: "/events", proto: "HTTP/1.1", accept: "text/event-stream"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodGet, test.path, nil)
+		req.Proto = test.proto
+		req.Header.Set("Accept", test.accept)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		protos := requestProtos(t, test.path)
+		if !slices.Equal(protos, test.expect) {
+			t.Errorf("%s: got protocols %v want %v", test.path, protos, test.expect)
+		}
+	}
+}
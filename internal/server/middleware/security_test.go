@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCSPBuild(t *testing.T) {
+	csp := NewCSP().
+		Set("default-src", "'self'").
+		Set("script-src", NonceSource).
+		Add("script-src", "'strict-dynamic'").
+		Set("object-src", "'none'").
+		Remove("object-src")
+
+	expected := "default-src 'self'; script-src 'nonce-abc' 'strict-dynamic'"
+	actual := csp.Build("abc")
+	if actual != expected {
+		t.Errorf("unexpected policy: got %q want %q", actual, expected)
+	}
+
+	if !csp.UsesNonce() {
+		t.Error("expected policy to use a nonce")
+	}
+}
+
+func TestScriptHashes(t *testing.T) {
+	html := []byte(`<script src="https://cdn.example.com/app.js"></script><p>docs</p><script>init()</script>`)
+
+	// echo -n 'init()' | openssl dgst -sha256 -binary | base64
+	expected := []string{"'sha256-w4ujnOpjBoH2vcasx+reJRUwYivG8Q3afx/XevGJod8='"}
+	actual := ScriptHashes(html)
+	if !slices.Equal(actual, expected) {
+		t.Errorf("unexpected hashes: got %v want %v", actual, expected)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	var nonces []string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, Nonce(r.Context()))
+	})
+
+	t.Run("Enforce", func(t *testing.T) {
+		handler := SecurityHeaders(DefaultSecurityHeaders())(next)
+
+		for range 2 {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			for _, header := range []string{"X-Content-Type-Options", "Referrer-Policy", "Permissions-Policy", "X-Frame-Options", "Cross-Origin-Opener-Policy", "Cross-Origin-Embedder-Policy"} {
+				if rec.Header().Get(header) == "" {
+					t.Errorf("expected %s header to be set", header)
+				}
+			}
+
+			nonce := nonces[len(nonces)-1]
+			csp := rec.Header().Get("Content-Security-Policy")
+			if nonce == "" || !strings.Contains(csp, "'nonce-"+nonce+"'") {
+				t.Errorf("expected policy to contain request nonce %q: got %q", nonce, csp)
+			}
+		}
+
+		if nonces[0] == nonces[1] {
+			t.Errorf("expected unique nonce per request: got %q twice", nonces[0])
+		}
+	})
+
+	t.Run("ReportOnly", func(t *testing.T) {
+		cfg := DefaultSecurityHeaders()
+		cfg.ReportOnly = true
+		cfg.ReportURI = "/csp-report"
+		handler := SecurityHeaders(cfg)(next)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if rec.Header().Get("Content-Security-Policy") != "" {
+			t.Error("expected enforced policy to be unset in report only mode")
+		}
+
+		csp := rec.Header().Get("Content-Security-Policy-Report-Only")
+		if !strings.HasSuffix(csp, "report-uri /csp-report") {
+			t.Errorf("expected report only policy with report uri: got %q", csp)
+		}
+
+		// The shared default policy must not be modified
+		if strings.Contains(cfg.ContentSecurityPolicy.Build(""), "report-uri") {
+			t.Error("expected report uri to not leak into the configured policy")
+		}
+	})
+}
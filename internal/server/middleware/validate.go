@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/circa10a/go-rest-template/internal/server/render"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder("application/merge-patch+json", openapi3filter.JSONBodyDecoder)
+	openapi3filter.RegisterBodyDecoder("application/json-patch+json", openapi3filter.JSONBodyDecoder)
+}
+
+// Validate returns a middleware that validates requests against the operations in the OpenAPI spec.
+// Parameters and bodies that do not match are rejected with 400, and bodies with a content type
+// the operation does not accept with 415. A 415 for a PATCH lists the accepted patch formats in Accept-Patch.
+// Requests for paths not in the spec are passed through.
+func Validate(doc *openapi3.T) (func(http.Handler) http.Handler, error) {
+	basePath, err := SpecBasePath(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Match requests on any host, since the servers in the spec describe the public deployment
+	spec := *doc
+	spec.Servers = openapi3.Servers{{URL: basePath + "/"}}
+	router, err := legacy.NewRouter(&spec)
+	if err != nil {
+		return nil, fmt.Errorf("building OpenAPI router: %w", err)
+	}
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+		SkipSettingDefaults: true,
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			err = openapi3filter.ValidateRequest(r.Context(), &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options:    options,
+			})
+			if err != nil {
+				status, message := validationError(r, err)
+				if status == http.StatusUnsupportedMediaType && r.Method == http.MethodPatch && route.Operation.RequestBody != nil {
+					w.Header().Set("Accept-Patch", strings.Join(slices.Sorted(maps.Keys(route.Operation.RequestBody.Value.Content)), ", "))
+				}
+				render.Error(w, status, message)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+// SpecBasePath returns the path of the first server in the spec, such as /v1, which prefixes every operation path.
+func SpecBasePath(doc *openapi3.T) (string, error) {
+	if len(doc.Servers) == 0 {
+		return "", nil
+	}
+
+	basePath, err := doc.Servers[0].BasePath()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(basePath, "/"), nil
+}
+
+// validationError maps a validation error to a status code and a message for the client.
+func validationError(r *http.Request, err error) (int, string) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit)
+	}
+
+	var requestErr *openapi3filter.RequestError
+	if !errors.As(err, &requestErr) {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	var schemaErr *openapi3.SchemaError
+	isSchemaErr := errors.As(err, &schemaErr)
+
+	if requestErr.Parameter != nil {
+		reason := requestErr.Err
+		if isSchemaErr {
+			reason = errors.New(schemaErr.Reason)
+		}
+		return http.StatusBadRequest, fmt.Sprintf("invalid %s parameter %s: %s", requestErr.Parameter.In, requestErr.Parameter.Name, reason)
+	}
+
+	var parseErr *openapi3filter.ParseError
+	if errors.As(err, &parseErr) && parseErr.Kind == openapi3filter.KindUnsupportedFormat || strings.Contains(requestErr.Reason, "Content-Type") {
+		return http.StatusUnsupportedMediaType, fmt.Sprintf("unsupported content type %q", r.Header.Get("Content-Type"))
+	}
+
+	if isSchemaErr {
+		return http.StatusBadRequest, "invalid request body: " + DescribeSchemaError(schemaErr)
+	}
+
+	return http.StatusBadRequest, requestErr.Error()
+}
+
+// DescribeSchemaError returns the invalid field and the reason of a schema error. The error message itself
+// includes the offending value and the full schema, which should not be returned to clients.
+func DescribeSchemaError(err *openapi3.SchemaError) string {
+	field := strings.Join(err.JSONPointer(), ".")
+	if field == "" {
+		return err.Reason
+	}
+
+	return field + ": " + err.Reason
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestValidate(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(`
+openapi: 3.0.0
+info: {title: test, version: 1.0.0}
+servers:
+  - url: https://example.com/v1
+paths:
+  /widgets:
+    get:
+      parameters:
+        - {name: limit, in: query, schema: {type: integer, minimum: 1}}
+      responses: {'200': {description: ok}}
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              type: object
+              additionalProperties: false
+              required: [name]
+              properties:
+                name: {type: string, minLength: 1}
+      responses: {'201': {description: created}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate, err := Validate(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		contentType   string
+		body          string
+		expectMessage string
+		expectStatus  int
+	}{
+		{name: "valid query", method: http.MethodGet, path: "/v1/widgets?limit=5", expectStatus: http.StatusOK},
+		{name: "invalid query", method: http.MethodGet, path: "/v1/widgets?limit=0", expectStatus: http.StatusBadRequest, expectMessage: "invalid query parameter limit"},
+		{name: "valid body", method: http.MethodPost, path: "/v1/widgets", contentType: "application/json", body: `{"name":"a"}`, expectStatus: http.StatusOK},
+		{name: "missing property", method: http.MethodPost, path: "/v1/widgets", contentType: "application/json", body: `{}`, expectStatus: http.StatusBadRequest, expectMessage: "name"},
+		{name: "invalid property", method: http.MethodPost, path: "/v1/widgets", contentType: "application/json", body: `{"name":""}`, expectStatus: http.StatusBadRequest, expectMessage: "invalid request body: name"},
+		{name: "unknown property", method: http.MethodPost, path: "/v1/widgets", contentType: "application/json", body: `{"name":"a","extra":true}`, expectStatus: http.StatusBadRequest, expectMessage: "extra"},
+		{name: "malformed json", method: http.MethodPost, path: "/v1/widgets", contentType: "application/json", body: `{`, expectStatus: http.StatusBadRequest},
+		{name: "unsupported content type", method: http.MethodPost, path: "/v1/widgets", contentType: "text/plain", body: `name`, expectStatus: http.StatusUnsupportedMediaType},
+		{name: "path outside spec", method: http.MethodPost, path: "/csp-report", contentType: "text/plain", body: `report`, expectStatus: http.StatusOK},
+		{name: "path without base path", method: http.MethodPost, path: "/widgets", contentType: "text/plain", body: `name`, expectStatus: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != test.expectStatus {
+				t.Errorf("unexpected status: got %d want %d (%s)", rec.Code, test.expectStatus, rec.Body.String())
+			}
+
+			if !strings.Contains(rec.Body.String(), test.expectMessage) {
+				t.Errorf("unexpected message: got %s want it to contain %s", rec.Body.String(), test.expectMessage)
+			}
+		})
+	}
+}
+
+func TestValidateBodyLimit(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData([]byte(`
+openapi: 3.0.0
+info: {title: test, version: 1.0.0}
+paths:
+  /widgets:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema: {type: object}
+      responses: {'201': {description: created}}
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validate, err := Validate(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, err := Body(BodyConfig{MaxSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := body(validate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/widgets", strings.NewReader(`{"name":"`+strings.Repeat("a", 32)+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	// Unknown length, so the limit is enforced while the validator reads the body
+	req.ContentLength = -1
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("unexpected status: got %d want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
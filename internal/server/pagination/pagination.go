@@ -0,0 +1,396 @@
+/*
+Package pagination implements the list conventions shared by every collection endpoint:
+
+	GET /v1/items?limit=20&sort=-created_at,name&filter=name:contains:widget&filter=version:gt:1
+
+limit is the page size, sort is a comma separated list of fields with a leading - for descending order,
+and each filter is field:operator:value. Responses carry an opaque next_cursor. Passing it as the cursor
+parameter returns the following page with the same sort and filters. Cursors are signed, so clients cannot
+forge the position they resume from.
+*/
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// FieldType determines how filter values and cursor positions are parsed.
+type FieldType int
+
+// Supported field types.
+const (
+	String FieldType = iota
+	Number
+	Bool
+	Time
+)
+
+// Field is a field clients may filter or sort by.
+type Field struct {
+	Name string
+	// Operators allowed in filters. Defaults to every operator supported by the type.
+	Operators []store.Operator
+	Type      FieldType
+	// Sortable fields may be used in the sort parameter. Only make fields that every record has sortable.
+	Sortable bool
+}
+
+// Config holds configuration for a Paginator.
+type Config struct {
+	// Secret signs cursors. Replicas must share it for cursors to work across them.
+	Secret []byte
+	Fields []Field
+	// DefaultSort is used when the request has no sort parameter. Defaults to creation time.
+	DefaultSort []store.Sort
+	// DefaultLimit is the page size when the request has no limit parameter. Defaults to 20.
+	DefaultLimit int
+	// MaxLimit is the largest allowed page size. Defaults to 100.
+	MaxLimit int
+}
+
+// Paginator parses list parameters into store queries and creates cursors for the following pages.
+type Paginator struct {
+	fields map[string]Field
+	cfg    Config
+}
+
+// cursor is the signed state of a list that a next_cursor resumes.
+type cursor struct {
+	Sort    string   `json:"s,omitempty"`
+	Filters []string `json:"f,omitempty"`
+	Key     []any    `json:"k"`
+}
+
+// New returns a Paginator for the fields in cfg.
+func New(cfg Config) (*Paginator, error) {
+	if len(cfg.Secret) == 0 {
+		return nil, errors.New("pagination requires a secret to sign cursors")
+	}
+	if cfg.DefaultLimit <= 0 {
+		cfg.DefaultLimit = 20
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 100
+	}
+
+	p := &Paginator{cfg: cfg, fields: map[string]Field{}}
+	for _, f := range cfg.Fields {
+		p.fields[f.Name] = f
+	}
+
+	return p, nil
+}
+
+/*
+Parse builds a store query from the limit, cursor, sort and filter query parameters. It returns an error
+describing the invalid parameter, which should be answered with 400 Bad Request.
+
+The query fetches one record more than the page size so Page can tell whether another page follows.
+*/
+func (p *Paginator) Parse(values url.Values) (store.Query, error) {
+	q := store.Query{Limit: p.cfg.DefaultLimit}
+
+	if value := values.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > p.cfg.MaxLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", p.cfg.MaxLimit)
+		}
+		q.Limit = limit
+	}
+
+	c, err := p.state(values)
+	if err != nil {
+		return q, err
+	}
+
+	q.Sort, err = p.parseSort(c.Sort)
+	if err != nil {
+		return q, err
+	}
+
+	for _, filter := range c.Filters {
+		f, err := p.parseFilter(filter)
+		if err != nil {
+			return q, err
+		}
+		q.Filters = append(q.Filters, f)
+	}
+
+	if c.Key != nil {
+		q.After, err = p.decodeKey(q, c.Key)
+		if err != nil {
+			return q, err
+		}
+	}
+
+	q.Limit++
+	return q, nil
+}
+
+// state returns the sort and filters of a request, taken from its cursor when it has one.
+func (p *Paginator) state(values url.Values) (cursor, error) {
+	c := cursor{Sort: values.Get("sort"), Filters: values["filter"]}
+
+	value := values.Get("cursor")
+	if value == "" {
+		return c, nil
+	}
+
+	resumed, err := p.decodeCursor(value)
+	if err != nil {
+		return c, err
+	}
+
+	// The cursor carries the sort and filters of the first page. Repeating them is allowed, changing them is not.
+	if values.Has("sort") && c.Sort != resumed.Sort || len(c.Filters) > 0 && !slices.Equal(c.Filters, resumed.Filters) {
+		return c, errors.New("cursor does not match the sort and filter parameters")
+	}
+
+	return resumed, nil
+}
+
+// Page trims the extra record fetched by a query from Parse and returns the cursor of the next page,
+// or nil if docs is the last page.
+func Page[T any](p *Paginator, q store.Query, values url.Values, docs []store.Document[T]) ([]store.Document[T], *string, error) {
+	limit := q.Limit - 1
+	if len(docs) <= limit {
+		return docs, nil, nil
+	}
+
+	docs = docs[:limit]
+	key, err := store.SortKey(docs[limit-1].Record(), q)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c, err := p.state(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	c.Key = key
+
+	next, err := p.encodeCursor(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return docs, &next, nil
+}
+
+func (p *Paginator) parseSort(value string) ([]store.Sort, error) {
+	if value == "" {
+		return p.cfg.DefaultSort, nil
+	}
+
+	var sorts []store.Sort
+	for name := range strings.SplitSeq(value, ",") {
+		s := store.Sort{Field: strings.TrimSpace(name)}
+		s.Field, s.Desc = strings.CutPrefix(s.Field, "-")
+
+		f, ok := p.fields[s.Field]
+		if !ok || !f.Sortable {
+			return nil, fmt.Errorf("cannot sort by %q. Sortable fields are %s", s.Field, strings.Join(p.sortable(), ", "))
+		}
+		if slices.ContainsFunc(sorts, func(existing store.Sort) bool { return existing.Field == s.Field }) {
+			return nil, fmt.Errorf("duplicate sort field %q", s.Field)
+		}
+		sorts = append(sorts, s)
+	}
+
+	return sorts, nil
+}
+
+func (p *Paginator) parseFilter(value string) (store.Filter, error) {
+	name, rest, ok := strings.Cut(value, ":")
+	op, raw, ok2 := strings.Cut(rest, ":")
+	if !ok || !ok2 {
+		return store.Filter{}, fmt.Errorf("invalid filter %q. Filters are field:operator:value", value)
+	}
+
+	f, ok := p.fields[name]
+	if !ok {
+		return store.Filter{}, fmt.Errorf("cannot filter by %q", name)
+	}
+
+	filter := store.Filter{Field: name, Op: store.Operator(op)}
+	if !slices.Contains(f.operators(), filter.Op) {
+		return store.Filter{}, fmt.Errorf("unsupported operator %q for %s", op, name)
+	}
+
+	var err error
+	filter.Value, err = f.parse(raw)
+	if err != nil {
+		return store.Filter{}, fmt.Errorf("invalid value for %s: %w", name, err)
+	}
+
+	return filter, nil
+}
+
+func (p *Paginator) sortable() []string {
+	var names []string
+	for _, f := range p.cfg.Fields {
+		if f.Sortable {
+			names = append(names, f.Name)
+		}
+	}
+
+	return names
+}
+
+func (p *Paginator) encodeCursor(c cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(p.sign(encoded)), nil
+}
+
+func (p *Paginator) decodeCursor(value string) (cursor, error) {
+	var c cursor
+	invalid := errors.New("invalid cursor")
+
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return c, invalid
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, p.sign(encoded)) {
+		return c, invalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return c, invalid
+	}
+
+	err = json.Unmarshal(payload, &c)
+	if err != nil {
+		return c, invalid
+	}
+
+	return c, nil
+}
+
+func (p *Paginator) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, p.cfg.Secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)[:16]
+}
+
+// decodeKey restores the types of a sort key that was encoded as JSON.
+func (p *Paginator) decodeKey(q store.Query, key []any) ([]any, error) {
+	sorts := q.Sort
+	if len(sorts) == 0 {
+		sorts = []store.Sort{{Field: store.FieldCreatedAt}}
+	}
+	sorts = append(sorts[:len(sorts):len(sorts)], store.Sort{Field: store.FieldID})
+
+	if len(key) != len(sorts) {
+		return nil, errors.New("invalid cursor")
+	}
+
+	decoded := make([]any, len(key))
+	for i, s := range sorts {
+		f, ok := p.fields[s.Field]
+		if !ok {
+			f = Field{Name: s.Field, Type: recordFieldType(s.Field)}
+		}
+
+		value, err := f.decode(key[i])
+		if err != nil {
+			return nil, errors.New("invalid cursor")
+		}
+		decoded[i] = value
+	}
+
+	return decoded, nil
+}
+
+func recordFieldType(name string) FieldType {
+	switch name {
+	case store.FieldCreatedAt, store.FieldUpdatedAt:
+		return Time
+	case store.FieldVersion:
+		return Number
+	}
+
+	return String
+}
+
+func (f Field) operators() []store.Operator {
+	if len(f.Operators) > 0 {
+		return f.Operators
+	}
+
+	switch f.Type {
+	case String:
+		return store.Operators
+	case Bool:
+		return []store.Operator{store.OpEq, store.OpNe}
+	}
+
+	return []store.Operator{store.OpEq, store.OpNe, store.OpLt, store.OpLte, store.OpGt, store.OpGte}
+}
+
+// parse converts a filter value from the query string.
+func (f Field) parse(raw string) (any, error) {
+	switch f.Type {
+	case Number:
+		return strconv.ParseFloat(raw, 64)
+	case Bool:
+		return strconv.ParseBool(raw)
+	case Time:
+		return time.Parse(time.RFC3339Nano, raw)
+	}
+
+	return raw, nil
+}
+
+// decode converts a sort key value decoded from JSON back to the type the store compares.
+func (f Field) decode(value any) (any, error) {
+	switch f.Type {
+	case Time:
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("expected a time")
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case Number:
+		n, ok := value.(float64)
+		if !ok {
+			return nil, errors.New("expected a number")
+		}
+		if f.Name == store.FieldVersion {
+			return int64(n), nil
+		}
+		return n, nil
+	case Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, errors.New("expected a bool")
+		}
+		return b, nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return nil, errors.New("expected a string")
+	}
+
+	return s, nil
+}
@@ -0,0 +1,238 @@
+package pagination
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+type widget struct {
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+func newTestPaginator(t *testing.T) *Paginator {
+	t.Helper()
+
+	p, err := New(Config{
+		Secret: []byte("secret"),
+		Fields: []Field{
+			{Name: "name", Type: String, Sortable: true},
+			{Name: "price", Type: Number, Sortable: true},
+			{Name: "active", Type: Bool},
+			{Name: store.FieldCreatedAt, Type: Time, Sortable: true},
+		},
+		MaxLimit: 50,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestParse(t *testing.T) {
+	p := newTestPaginator(t)
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    string
+		expected store.Query
+	}{
+		{
+			name:     "defaults",
+			query:    "",
+			expected: store.Query{Limit: 21},
+		},
+		{
+			name:     "limit",
+			query:    "limit=5",
+			expected: store.Query{Limit: 6},
+		},
+		{
+			name:     "sort",
+			query:    "sort=-price,name",
+			expected: store.Query{Sort: []store.Sort{{Field: "price", Desc: true}, {Field: "name"}}, Limit: 21},
+		},
+		{
+			name:  "filters",
+			query: "filter=name:contains:a:b&filter=price:gte:2.5&filter=active:eq:true&filter=created_at:lt:2026-01-02T03:04:05Z",
+			expected: store.Query{
+				Filters: []store.Filter{
+					{Field: "name", Op: store.OpContains, Value: "a:b"},
+					{Field: "price", Op: store.OpGte, Value: 2.5},
+					{Field: "active", Op: store.OpEq, Value: true},
+					{Field: store.FieldCreatedAt, Op: store.OpLt, Value: created},
+				},
+				Limit: 21,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(test.query)
+			q, err := p.Parse(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := fmt.Sprintf("%+v", q), fmt.Sprintf("%+v", test.expected); got != want {
+				t.Errorf("unexpected query: got %s want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	p := newTestPaginator(t)
+	other, err := New(Config{Secret: []byte("other"), Fields: p.cfg.Fields})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged, err := other.encodeCursor(cursor{Key: []any{"2026-01-01T00:00:00Z", "id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid, err := p.encodeCursor(cursor{Sort: "name", Key: []any{"a", "id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := p.encodeCursor(cursor{Key: []any{1, "id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{name: "limit too large", query: "limit=51", expected: "limit must be between 1 and 50"},
+		{name: "limit not a number", query: "limit=ten", expected: "limit must be between 1 and 50"},
+		{name: "unknown sort field", query: "sort=secret", expected: `cannot sort by "secret"`},
+		{name: "unsortable field", query: "sort=active", expected: `cannot sort by "active"`},
+		{name: "duplicate sort field", query: "sort=name,-name", expected: `duplicate sort field "name"`},
+		{name: "malformed filter", query: "filter=name", expected: "invalid filter"},
+		{name: "unknown filter field", query: "filter=secret:eq:x", expected: `cannot filter by "secret"`},
+		{name: "unsupported operator", query: "filter=active:gt:true", expected: `unsupported operator "gt"`},
+		{name: "invalid number", query: "filter=price:lt:cheap", expected: "invalid value for price"},
+		{name: "invalid cursor", query: "cursor=garbage", expected: "invalid cursor"},
+		{name: "forged cursor", query: "cursor=" + forged, expected: "invalid cursor"},
+		{name: "cursor key type", query: "cursor=" + wrongKey, expected: "invalid cursor"},
+		{name: "cursor with different sort", query: "sort=price&cursor=" + valid, expected: "cursor does not match"},
+		{name: "cursor with different filters", query: "filter=name:eq:a&cursor=" + valid, expected: "cursor does not match"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(test.query)
+			_, err := p.Parse(values)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("unexpected error: got %v want %q", err, test.expected)
+			}
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	ctx := context.Background()
+	p := newTestPaginator(t)
+	widgets := store.NewCollection[widget](store.NewMemory(), "widgets")
+
+	for i, price := range []float64{3, 1, 2, 3, 1, 2, 3} {
+		_, err := widgets.Create(ctx, widget{Name: string(rune('a' + i)), Price: price})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, query := range []string{
+		"limit=2",
+		"limit=3&sort=-price,name",
+		"limit=1&sort=price&filter=price:gt:1",
+		"limit=10",
+	} {
+		t.Run(query, func(t *testing.T) {
+			values, _ := url.ParseQuery(query)
+			q, err := p.Parse(values)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			unpaged := q
+			unpaged.Limit = 0
+			all, err := widgets.List(ctx, unpaged)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var names []string
+			for {
+				docs, err := widgets.List(ctx, q)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				page, next, err := Page(p, q, values, docs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page) > q.Limit-1 {
+					t.Fatalf("page too long: got %d want at most %d", len(page), q.Limit-1)
+				}
+				for _, doc := range page {
+					names = append(names, doc.Value.Name)
+				}
+				if next == nil {
+					break
+				}
+
+				// Later pages only need the cursor
+				values = url.Values{"cursor": {*next}, "limit": values["limit"]}
+				q, err = p.Parse(values)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var expected []string
+			for _, doc := range all {
+				expected = append(expected, doc.Value.Name)
+			}
+			if !slices.Equal(names, expected) {
+				t.Errorf("unexpected pages: got %q want %q", names, expected)
+			}
+		})
+	}
+}
+
+func TestCursorOpaque(t *testing.T) {
+	p := newTestPaginator(t)
+
+	value, err := p.encodeCursor(cursor{Key: []any{"a", "id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tampering with the payload invalidates the signature
+	encoded, signature, _ := strings.Cut(value, ".")
+	payload, _ := json.Marshal(cursor{Key: []any{"b", "id"}})
+	_, err = p.decodeCursor(strings.Replace(value, encoded, base64.RawURLEncoding.EncodeToString(payload), 1))
+	if err == nil {
+		t.Error("expected a tampered cursor to be rejected")
+	}
+	if url.QueryEscape(value) != value || signature == "" {
+		t.Errorf("cursor is not URL safe: %s", value)
+	}
+}
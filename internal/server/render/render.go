@@ -0,0 +1,29 @@
+// Package render writes JSON responses in the format described by the OpenAPI spec.
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/circa10a/go-rest-template/api"
+)
+
+// JSON writes v as a JSON response with the given status code.
+func JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+/*
+Error writes the standard error response.
+Example response:
+
+	{
+		"code": 413,
+		"message": "request body too large"
+	}
+*/
+func Error(w http.ResponseWriter, status int, message string) {
+	JSON(w, status, api.Error{Code: status, Message: message})
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/inbound"
+	"github.com/circa10a/go-rest-template/internal/schedule"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/circa10a/go-rest-template/internal/webhooks"
+)
+
+const (
+	// deliveryRetention is how long webhook deliveries are kept in the delivery log.
+	deliveryRetention = 30 * 24 * time.Hour
+	// inboundRetention is how long received webhooks are kept for inspection and replay.
+	inboundRetention = 30 * 24 * time.Hour
+)
+
+// registerSchedules registers the periodic tasks. The schedule list command calls it too, so it must not
+// start any work.
+func registerSchedules(s *schedule.Scheduler, st store.Store, logger *slog.Logger) error {
+	// Expired idempotency keys are claimed again when reused, so deleting them only reclaims space
+	if keys, ok := st.(store.IdempotencyStore); ok {
+		err := s.Register("idempotency-keys.cleanup", "@every 1h", func(ctx context.Context) error {
+			deleted, err := keys.DeleteExpiredKeys(ctx, time.Now())
+			if err == nil && deleted > 0 {
+				logger.Info("deleted expired idempotency keys", "component", "schedule", "count", deleted)
+			}
+			return err
+		}, schedule.Options{Jitter: 5 * time.Minute, Timeout: 10 * time.Minute})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.Register("webhook-deliveries.cleanup", "@daily", func(ctx context.Context) error {
+		deleted, err := webhooks.DeleteDeliveries(ctx, st, time.Now().Add(-deliveryRetention))
+		if err == nil && deleted > 0 {
+			logger.Info("deleted old webhook deliveries", "component", "schedule", "count", deleted)
+		}
+		return err
+	}, schedule.Options{Jitter: 30 * time.Minute, Timeout: 30 * time.Minute})
+	if err != nil {
+		return err
+	}
+
+	// Requests older than the nonce TTL are outside any timestamp tolerance, so their nonces are not needed
+	err = s.Register("inbound-nonces.cleanup", "@every 1h", func(ctx context.Context) error {
+		deleted, err := inbound.DeleteNonces(ctx, st, time.Now().Add(-inbound.DefaultNonceTTL))
+		if err == nil && deleted > 0 {
+			logger.Info("deleted expired webhook nonces", "component", "schedule", "count", deleted)
+		}
+		return err
+	}, schedule.Options{Jitter: 5 * time.Minute, Timeout: 10 * time.Minute})
+	if err != nil {
+		return err
+	}
+
+	err = s.Register("inbound-events.cleanup", "@daily", func(ctx context.Context) error {
+		deleted, err := inbound.DeleteEvents(ctx, st, time.Now().Add(-inboundRetention))
+		if err == nil && deleted > 0 {
+			logger.Info("deleted old received webhooks", "component", "schedule", "count", deleted)
+		}
+		return err
+	}, schedule.Options{Jitter: 30 * time.Minute, Timeout: 30 * time.Minute})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListSchedules returns the status of the periodic tasks, reading their history from the store at databaseURL.
+func ListSchedules(ctx context.Context, databaseURL string) ([]schedule.Status, error) {
+	st, err := store.OpenExisting(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("opening store: %w", err)
+	}
+	defer func() { _ = st.Close() }()
+
+	err = store.CheckMigrated(ctx, st)
+	if err != nil {
+		return nil, fmt.Errorf("%w: run the migrate command, or start the server with --auto-migrate", err)
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	s := schedule.New(st, schedule.Config{Logger: logger})
+	err = registerSchedules(s, st, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Statuses(ctx)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+func TestListSchedules(t *testing.T) {
+	ctx := context.Background()
+	dsn := "sqlite://" + filepath.Join(t.TempDir(), "app.db")
+
+	st, err := store.Open(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = st.(store.Migrator).MigrateUp(ctx, 0)
+	_ = st.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statuses, err := ListSchedules(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"idempotency-keys.cleanup", "inbound-events.cleanup", "inbound-nonces.cleanup", "webhook-deliveries.cleanup"}
+	if len(statuses) != len(names) {
+		t.Fatalf("unexpected schedules: %+v", statuses)
+	}
+	for i, status := range statuses {
+		if status.Name != names[i] || status.NextRun.IsZero() || !status.LastRun.IsZero() {
+			t.Errorf("unexpected schedule: %+v", status)
+		}
+	}
+}
+
+func TestListSchedulesNotMigrated(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "app.db")
+
+	_, err := ListSchedules(ctx, "sqlite://"+path)
+	if err == nil {
+		t.Fatal("expected an error for a missing database")
+	}
+	_, err = os.Stat(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the database not to be created: %v", err)
+	}
+
+	st, err := store.Open(ctx, "sqlite://"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = st.Close()
+
+	_, err = ListSchedules(ctx, "sqlite://"+path)
+	if !errors.Is(err, store.ErrNotMigrated) {
+		t.Fatalf("expected ErrNotMigrated, got %v", err)
+	}
+}
@@ -1,24 +1,44 @@
 package server
 
 import (
+	"context"
+	"crypto/rand"
+	"database/sql"
 	_ "embed"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"os"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/log"
 
 	"github.com/go-chi/chi/v5"
 
-	"github.com/caddyserver/certmagic"
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/events"
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/listeners"
+	"github.com/circa10a/go-rest-template/internal/messaging"
+	"github.com/circa10a/go-rest-template/internal/operations"
+	"github.com/circa10a/go-rest-template/internal/rpc"
+	"github.com/circa10a/go-rest-template/internal/schedule"
 	"github.com/circa10a/go-rest-template/internal/server/handlers"
 	"github.com/circa10a/go-rest-template/internal/server/middleware"
+	"github.com/circa10a/go-rest-template/internal/sse"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/circa10a/go-rest-template/internal/ws"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/quic-go/quic-go/http3"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 //go:embed api.html
@@ -26,31 +46,120 @@ var apiDocs []byte
 
 // Server is our web server that runs the network mirror.
 type Server struct {
-	mux         http.Handler
-	logger      *slog.Logger
-	middlewares []func(http.Handler) http.Handler
+	mux    http.Handler
+	logger *slog.Logger
+	cors   *middleware.CORS
+	// Jobs enqueues background jobs. It is nil if the store does not support jobs.
+	Jobs *jobs.Queue
+	// Events publishes domain events through the outbox of the store and relays them to subscribers.
+	Events *events.Bus
+	// Messaging publishes and consumes messages with the broker at NATSURL. It is nil if NATSURL is empty.
+	Messaging    messaging.Broker
+	broker       *sse.Broker
+	hub          *ws.Hub
+	grpc         *rpc.Server
+	addresses    []listeners.Address
+	httpServers  []*http.Server
+	http3Servers []*http3.Server
+	sockets      []namedSocket
+	started      chan struct{}
+	stop         context.CancelFunc
+	middlewares  []func(http.Handler) http.Handler
 	Config
+	background sync.WaitGroup
+	mu         sync.Mutex
 }
 
 // Config holds configuration for creating a Server.
 type Config struct {
-	TLSCert    string
-	TLSKey     string
-	LogFormat  string
-	LogLevel   string
-	Domains    []string
-	Port       int
-	AutoTLS    bool
-	Metrics    bool
-	Validation bool
+	// Store is the data store used by handlers. If nil, one is opened from DatabaseURL.
+	Store store.Store
+	// DatabaseURL selects the store, for example sqlite:///var/lib/app/app.db. Defaults to an in-memory store.
+	DatabaseURL string
+	// CursorSecret signs pagination cursors. Replicas must share it. If empty, a random secret is generated.
+	CursorSecret string
+	AdminToken   string
+	// WebSocketToken is the bearer token required to connect to /ws. Connections are not authenticated if empty.
+	WebSocketToken string
+	// NATSURL is the address of the NATS servers that messages are published to and consumed from, such as
+	// nats://localhost:4222. Messaging is disabled if empty.
+	NATSURL string
+	// NATSStream is the JetStream stream of the messages, and the prefix of their subjects. Defaults to app.
+	NATSStream string
+	// GRPCToken is the bearer token required by gRPC calls, except health checks. Calls are not
+	// authenticated if empty.
+	GRPCToken string
+	TLSCert   string
+	TLSKey    string
+	LogFormat string
+	LogLevel  string
+	Domains   []string
+	// Listeners are the URLs of the sockets the server listens on, such as tcp://127.0.0.1:8080,
+	// unix:///run/app/app.sock?mode=0660 or fd://3, each with its own TLS settings. See package listeners.
+	// Defaults to Port on every interface, or to the sockets passed by systemd socket activation.
+	Listeners  []string
+	BodyLimits map[string]int64
+	// InboundSecrets enables the endpoints of webhook providers under /inbound, mapping provider names to
+	// the secrets that verify their requests.
+	InboundSecrets          map[string]string
+	CORS                    middleware.CORSConfig
+	MaxBodySize             int64
+	MaxDecompressedBodySize int64
+	IdempotencyTTL          time.Duration
+	InboundTolerance        time.Duration
+	Port                    int
+	// GRPCPort serves gRPC on a port of its own. If 0, gRPC shares Port with the REST API.
+	GRPCPort           int
+	CompressionMinSize int
+	OperationWorkers   int
+	JobWorkers         int
+	AutoTLS            bool
+	Metrics            bool
+	// GRPC serves the gRPC services registered by the modules of the server.
+	GRPC bool
+	// H2C serves HTTP/2 without TLS, next to HTTP/1.1, for clients such as the proxies of a service mesh.
+	H2C bool
+	// HTTP3 serves HTTP/3 over QUIC on the UDP port of the TLS listener, and advertises it with Alt-Svc.
+	// It requires TLS.
+	HTTP3           bool
+	SecurityHeaders bool
+	// AllowPrivateWebhooks allows webhook deliveries to loopback, private and link-local addresses.
+	AllowPrivateWebhooks bool
+	AutoMigrate          bool
+	Scheduler            bool
+	CSPReportOnly        bool
+	Compression          bool
+	ETags                bool
+	Validation           bool
 }
 
 // New returns a new server configured from cfg.
-func New(cfg *Config) (*Server, error) {
+func New(cfg *Config) (_ *Server, err error) {
 	server := &Server{
-		Config: *cfg,
+		Config:  *cfg,
+		started: make(chan struct{}),
 	}
 
+	// A server that fails to start stops the work it started and releases what it opened
+	openedStore := server.Store == nil
+	defer func() {
+		if err == nil {
+			return
+		}
+		if server.stop != nil {
+			server.stop()
+			server.background.Wait()
+		}
+		if server.Messaging != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = server.Messaging.Close(ctx)
+		}
+		if openedStore && server.Store != nil {
+			_ = server.Store.Close()
+		}
+	}()
+
 	if server.LogLevel == "" {
 		server.LogLevel = "info"
 	}
@@ -61,32 +170,162 @@ func New(cfg *Config) (*Server, error) {
 	server.mux = router
 
 	// Ensure configuration options are valid/compatible
-	err := server.validate()
+	err = server.validate()
 	if err != nil {
 		return nil, err
 	}
 
-	logLevel, err := log.ParseLevel(server.LogLevel)
+	server.logger, err = newLogger(server.LogFormat, server.LogLevel)
 	if err != nil {
 		return nil, err
 	}
 
-	logHandler := log.NewWithOptions(os.Stdout, log.Options{
-		ReportCaller:    true,
-		ReportTimestamp: true,
-		TimeFormat:      time.RFC3339,
-		Formatter:       getLogFormatter(server.LogFormat),
-		Level:           logLevel,
-	})
-	server.logger = slog.New(logHandler)
+	server.addresses, err = server.listenAddresses()
+	if err != nil {
+		return nil, err
+	}
+
+	if server.Store == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		server.Store, err = store.Open(ctx, server.DatabaseURL)
+		if err != nil {
+			return nil, fmt.Errorf("opening store: %w", err)
+		}
+	}
+
+	cursorSecret := []byte(server.CursorSecret)
+	if len(cursorSecret) == 0 {
+		cursorSecret = make([]byte, 32)
+		_, _ = rand.Read(cursorSecret)
+		server.logger.Warn("no cursor secret configured, list cursors will not work across restarts or replicas", "component", "pagination")
+	}
+
+	if server.AutoMigrate {
+		err = migrate(server.Store, server.logger)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	// Features
 	if server.Metrics {
 		router.Handle("/metrics", promhttp.Handler())
 		server.middlewares = append(server.middlewares, middleware.Prometheus)
+
+		err = registerStoreMetrics(server.Store)
+		if err != nil {
+			return nil, err
+		}
+
+		err = middleware.RegisterMetrics()
+		if err != nil {
+			return nil, err
+		}
+
+		err = sse.RegisterMetrics()
+		if err != nil {
+			return nil, err
+		}
+
+		err = ws.RegisterMetrics()
+		if err != nil {
+			return nil, err
+		}
+
+		err = messaging.RegisterMetrics()
+		if err != nil {
+			return nil, err
+		}
+
+		err = rpc.RegisterMetrics()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	readyChecks := map[string]handlers.ReadyCheck{
+		"store": server.Store.Ping,
+	}
+	if server.NATSURL != "" {
+		if server.NATSStream == "" {
+			server.NATSStream = "app"
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		server.Messaging, err = messaging.NewNATS(ctx, messaging.NATSConfig{
+			Logger: server.logger,
+			URL:    server.NATSURL,
+			Stream: server.NATSStream,
+		})
+		if err != nil {
+			return nil, err
+		}
+		readyChecks["nats"] = server.Messaging.Ping
+	}
+
+	spec, err := api.GetSwagger()
+	if err != nil {
+		return nil, err
+	}
+
+	// Requests are validated once the body middleware has decompressed and limited them
+	validate, err := middleware.Validate(spec)
+	if err != nil {
+		return nil, err
+	}
+	server.mux = validate(server.mux)
+
+	// Retries are detected once the body middleware has decompressed the request, so encodings do not matter
+	if keys, ok := server.Store.(store.IdempotencyStore); ok {
+		server.mux = middleware.Idempotency(middleware.IdempotencyConfig{
+			Store:  keys,
+			Logger: server.logger,
+			TTL:    server.IdempotencyTTL,
+		})(server.mux)
+	}
+
+	bodyLimits, err := middleware.BodyLimitsFromSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(bodyLimits, server.BodyLimits)
+
+	body, err := middleware.Body(middleware.BodyConfig{
+		Routes:              bodyLimits,
+		MaxSize:             server.MaxBodySize,
+		MaxDecompressedSize: server.MaxDecompressedBodySize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	server.mux = body(server.mux)
+
+	if server.SecurityHeaders {
+		headers := middleware.DefaultSecurityHeaders()
+		headers.ContentSecurityPolicy.Add("script-src", middleware.ScriptHashes(apiDocs)...)
+		headers.ReportOnly = server.CSPReportOnly
+		headers.ReportURI = "/csp-report"
+		server.mux = middleware.SecurityHeaders(headers)(server.mux)
+		router.Post("/csp-report", handlers.CSPReportHandleFunc(server.logger))
 	}
 
 	// Default middlewares
+	// CORS is always installed so policies can be enabled by a reload. Without allowed origins it is a no-op.
+	server.cors, err = middleware.NewCORS(server.CORS)
+	if err != nil {
+		return nil, err
+	}
+	server.mux = server.cors.Handler(server.mux)
+	if server.ETags {
+		server.mux = middleware.ETag(middleware.ETagConfig{})(server.mux)
+	}
+	if server.Compression {
+		server.mux = middleware.Compress(middleware.CompressConfig{MinSize: server.CompressionMinSize})(server.mux)
+	}
 	server.mux = middleware.Logging(server.logger, server.mux)
 
 	// Add middlewares via http.Handler chaining
@@ -95,45 +334,264 @@ func New(cfg *Config) (*Server, error) {
 	}
 
 	// Routes
-	router.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write(apiDocs) })
-	router.Get("/health", handlers.HealthHandleFunc)
+	docsHandler, err := handlers.DocsHandleFunc(apiDocs)
+	if err != nil {
+		return nil, err
+	}
+	router.With(middleware.CacheControl("no-cache")).Get("/docs", docsHandler)
+	router.With(middleware.CacheControl("no-store")).Get("/health", handlers.HealthHandleFunc)
+	router.With(middleware.CacheControl("no-store")).Get("/ready", handlers.ReadyHandleFunc(server.logger, readyChecks))
+
+	basePath, err := middleware.SpecBasePath(spec)
+	if err != nil {
+		return nil, err
+	}
+	manager := operations.NewManager(server.Store, operations.Config{
+		Logger:  server.logger,
+		Workers: server.OperationWorkers,
+	})
+	ops := handlers.NewOperationsHandler(server.logger, manager, basePath+"/operations")
+	router.With(middleware.CacheControl("no-store")).Route(basePath+"/operations", ops.Routes)
+
+	items, err := handlers.NewItemsHandler(server.logger, server.Store, spec, cursorSecret)
+	if err != nil {
+		return nil, err
+	}
+	items.RegisterOperations(ops)
+	router.With(middleware.CacheControl("no-cache")).Route(basePath+"/items", items.Routes)
+
+	// Modules register their gRPC services with the registry, which serves them wherever gRPC listens
+	services := &rpc.Registry{}
+	items.RegisterGRPC(services)
+
+	// Changes publish their events in their own transaction, and the relay fans them out to the subscribers
+	server.Events, err = events.New(server.Store, events.Config{Logger: server.logger})
+	if err != nil {
+		return nil, err
+	}
+	items.RegisterEvents(server.Events)
+
+	server.broker = sse.NewBroker(sse.Config{Logger: server.logger, Topics: []string{"items"}})
+	router.Get(basePath+"/events", handlers.EventsHandleFunc(server.broker))
+
+	// WebSocket handshakes are not checked by browsers with CORS, so the hub applies the CORS policies itself
+	server.hub = ws.NewHub(ws.Config{
+		Logger: server.logger,
+		Topics: []string{"items"},
+		CheckOrigin: func(r *http.Request) bool {
+			return server.cors.AllowOrigin(r.URL.Path, r.Header.Get("Origin"))
+		},
+	})
+	socket := router.With()
+	if server.WebSocketToken != "" {
+		socket = router.With(middleware.BearerToken(server.WebSocketToken))
+	}
+	socket.Get(basePath+"/ws", server.hub.ServeHTTP)
+
+	// Operations and jobs run in the background until Close, independent of any request
+	ctx, cancel := context.WithCancel(context.Background())
+	server.stop = cancel
+	server.background.Go(func() { manager.Run(ctx) })
+
+	if jobStore, ok := server.Store.(store.JobStore); ok {
+		server.Jobs = jobs.New(jobStore, jobs.Config{Logger: server.logger, Workers: server.JobWorkers})
+		dispatcher, receiver := registerJobs(server.Jobs, server.Store, server.logger, server.AllowPrivateWebhooks)
+
+		// Webhook deliveries are jobs, so webhooks need a store that supports them. Subscriptions make the
+		// server send requests, so managing them requires the admin token
+		server.Events.Subscribe("webhooks", itemEvents, webhookEvents(dispatcher))
+		if server.AdminToken != "" {
+			hooks, err := handlers.NewWebhooksHandler(server.logger, server.Store, dispatcher, cursorSecret)
+			if err != nil {
+				return nil, err
+			}
+			router.With(middleware.BearerToken(server.AdminToken), middleware.CacheControl("no-store")).
+				Route(basePath+"/webhooks", hooks.Routes)
+		}
+
+		// Providers authenticate with signatures instead of the API's credentials, and their endpoints are
+		// not part of the spec, so request validation does not apply to them
+		err = registerInboundProviders(receiver, server.InboundSecrets, server.InboundTolerance)
+		if err != nil {
+			return nil, err
+		}
+		router.With(middleware.CacheControl("no-store")).Route(basePath+"/inbound", receiver.Routes)
+
+		if server.Metrics {
+			err = jobs.RegisterMetrics(jobStore)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if server.AdminToken != "" {
+			admin := handlers.NewJobsHandler(server.logger, jobStore)
+			router.With(middleware.BearerToken(server.AdminToken), middleware.CacheControl("no-store")).
+				Route(basePath+"/admin/jobs", admin.Routes)
+
+			events, err := handlers.NewInboundEventsHandler(server.logger, server.Store, receiver, cursorSecret)
+			if err != nil {
+				return nil, err
+			}
+			router.With(middleware.BearerToken(server.AdminToken), middleware.CacheControl("no-store")).
+				Route(basePath+"/admin/inbound/events", events.Routes)
+		}
+
+		// Job workers can run in separate processes instead, see the worker command
+		if server.JobWorkers > 0 {
+			server.background.Go(func() { server.Jobs.Run(ctx) })
+		}
+	}
+
+	// The outbox relays each event in a single replica, but streams and WebSockets are served by the replica
+	// the client is connected to. With a broker every replica consumes every event from it, so all clients
+	// receive them. Without one, clients only receive the events relayed by their replica, so running more
+	// than one replica on a shared database requires a broker
+	liveEvents := []struct {
+		fn   events.HandlerFunc
+		name string
+	}{
+		{name: "sse", fn: streamEvents(server.broker, "items")},
+		{name: "ws", fn: socketEvents(server.hub, "items")},
+	}
+
+	if server.Messaging != nil {
+		// Events are published to the broker for other services, and consumers run until Close drains them
+		server.Events.AddSink("nats", brokerSink{broker: server.Messaging, prefix: server.NATSStream + ".events"})
+
+		subscribeCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		err = registerConsumers(subscribeCtx, server.Messaging, server.NATSStream, server.logger)
+		if err != nil {
+			return nil, err
+		}
+		for _, live := range liveEvents {
+			err = subscribeEvents(subscribeCtx, server.Messaging, server.NATSStream+".events", itemEvents, live.fn, server.logger)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		for _, live := range liveEvents {
+			server.Events.Subscribe(live.name, itemEvents, live.fn)
+		}
+	}
+
+	// Every replica runs a relay, and the outbox lets only one of them relay each event
+	server.background.Go(func() { server.Events.Run(ctx) })
+	if outbox, ok := server.Store.(store.OutboxStore); ok && server.Metrics {
+		err = events.RegisterMetrics(outbox)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Every replica runs the scheduler, and a lease in the store lets only one of them run each task
+	if server.Scheduler {
+		scheduler := schedule.New(server.Store, schedule.Config{Logger: server.logger})
+		err = registerSchedules(scheduler, server.Store, server.logger)
+		if err != nil {
+			return nil, err
+		}
+
+		if server.Metrics {
+			err = schedule.RegisterMetrics()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		server.background.Go(func() { scheduler.Run(ctx) })
+	}
+
+	if server.GRPC {
+		var opts []grpc.ServerOption
+		if server.GRPCPort != 0 && server.TLSCert != "" {
+			creds, err := credentials.NewServerTLSFromFile(server.TLSCert, server.TLSKey)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, grpc.Creds(creds))
+		}
+
+		server.grpc = rpc.New(rpc.Config{
+			Logger:  server.logger,
+			Token:   server.GRPCToken,
+			Metrics: server.Metrics,
+			Options: opts,
+		}, services)
+
+		// gRPC requests on the port of the REST API skip its middlewares, which the interceptors replace
+		if server.GRPCPort == 0 {
+			server.mux = rpc.Multiplex(server.grpc, server.mux)
+		}
+	}
 
 	return server, nil
 }
 
-// Start starts the listener of the server.
-func (s *Server) Start() error {
-	log := s.logger.With("component", "server")
+// Logger returns the logger of the server, configured by LogFormat and LogLevel.
+func (s *Server) Logger() *slog.Logger {
+	return s.logger
+}
+
+// ReloadCORS replaces the active CORS policies without restarting the server.
+func (s *Server) ReloadCORS(cfg middleware.CORSConfig) error {
+	return s.cors.Update(cfg)
+}
 
-	// Auto TLS will create listeners on port 80 and 443
-	if s.AutoTLS {
-		log.Info("Starting server on :80 and :443")
-		certmagic.DefaultACME.Agreed = true
-		certmagic.DefaultACME.Email = "user@oss.com"
-		return certmagic.HTTPS(s.Domains, s.mux)
+// Close disconnects the clients of WebSockets and event streams and stops the operation and job workers,
+// waiting for running work to be interrupted and queued again. It then drains the message consumers, letting
+// them handle the messages they received, and releases the resources held by the server, including its store.
+func (s *Server) Close() error {
+	if s.grpc != nil {
+		s.grpc.Stop()
 	}
 
-	// If no auto TLS, use specified server port
-	// :{port}
-	addr := fmt.Sprintf(":%d", s.Port)
-	httpServer := &http.Server{
-		Addr:              addr,
-		Handler:           s.mux,
-		ReadHeaderTimeout: 5 * time.Second,
-		ReadTimeout:       5 * time.Second,
-		WriteTimeout:      5 * time.Second,
-		IdleTimeout:       5 * time.Second,
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := s.hub.Close(ctx)
+	if err != nil {
+		s.logger.Warn("websocket clients did not disconnect in time", "component", "ws", "err", err)
 	}
+	s.broker.Close()
+	s.stop()
+	s.background.Wait()
+
+	if s.Messaging != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		err = s.Messaging.Close(ctx)
+		if err != nil {
+			s.logger.Warn("message consumers did not drain in time", "component", "messaging", "err", err)
+		}
+	}
+
+	return s.Store.Close()
+}
+
+// Shutdown stops the listeners started by Start and waits until ctx is done for the requests and gRPC calls
+// being served to complete. Event streams are closed so they do not hold it up. Call Close afterwards to stop
+// the rest of the server.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	httpServers, http3Servers := s.httpServers, s.http3Servers
+	s.mu.Unlock()
 
-	log.Info("Starting server on " + addr)
+	s.broker.Close()
 
-	// If custom cert and key provided, listen on specified server port via https
-	if s.TLSCert != "" && s.TLSKey != "" {
-		return httpServer.ListenAndServeTLS(s.TLSCert, s.TLSKey)
+	var errs []error
+	if s.grpc != nil {
+		errs = append(errs, s.grpc.Shutdown(ctx))
+	}
+	for _, h3 := range http3Servers {
+		errs = append(errs, h3.Shutdown(ctx))
+	}
+	for _, httpServer := range httpServers {
+		errs = append(errs, httpServer.Shutdown(ctx))
 	}
 
-	// No TLS requirements specified, listen on specified server port via http
-	return httpServer.ListenAndServe()
+	return errors.Join(errs...)
 }
 
 // validate validates the server configuration and checks for conflicting parameters.
@@ -158,6 +616,34 @@ func (s *Server) validate() error {
 		return errors.New("TLS key is missing TLS certificate")
 	}
 
+	if s.GRPC && s.GRPCPort != 0 && s.GRPCPort == s.Port {
+		return errors.New("gRPC port must differ from the server port, or be 0 to share it")
+	}
+
+	if s.AutoTLS && len(s.Listeners) > 0 {
+		return errors.New("listeners cannot be set along with AutoTLS, which listens on ports 80 and 443")
+	}
+
+	addresses, err := s.listenAddresses()
+	if err != nil {
+		return err
+	}
+
+	// h2c is served by the listeners without TLS, and HTTP/3 by the TCP listeners with TLS
+	hasTLS := s.AutoTLS
+	for _, addr := range addresses {
+		if addr.Scheme == "tcp" && (addr.CertFile != "" || !addr.NoTLS && s.TLSCert != "" && s.TLSKey != "") {
+			hasTLS = true
+		}
+	}
+	if s.HTTP3 && !hasTLS {
+		return errors.New("HTTP/3 requires TLS on a TCP listener, with AutoTLS or a TLS cert and key")
+	}
+
+	if s.GRPC && s.GRPCPort != 0 && s.AutoTLS {
+		return errors.New("a separate gRPC port cannot be used with AutoTLS")
+	}
+
 	validLogFormats := []string{"json", "text", ""}
 	if !slices.Contains(validLogFormats, s.LogFormat) {
 		return fmt.Errorf("invalid log format. Valid log formats are: %v", validLogFormats)
@@ -173,6 +659,62 @@ func (s *Server) validate() error {
 	return nil
 }
 
+// registerStoreMetrics exports the connection pool statistics of SQL stores.
+func registerStoreMetrics(st store.Store) error {
+	pool, ok := st.(interface {
+		DB() *sql.DB
+		Dialect() string
+	})
+	if !ok {
+		return nil
+	}
+
+	err := prometheus.Register(collectors.NewDBStatsCollector(pool.DB(), pool.Dialect()))
+	var alreadyRegistered prometheus.AlreadyRegisteredError
+	if errors.As(err, &alreadyRegistered) {
+		return nil
+	}
+
+	return err
+}
+
+// newLogger returns the logger for a log format and level.
+func newLogger(format, level string) (*slog.Logger, error) {
+	logLevel, err := log.ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	logHandler := log.NewWithOptions(os.Stdout, log.Options{
+		ReportCaller:    true,
+		ReportTimestamp: true,
+		TimeFormat:      time.RFC3339,
+		Formatter:       getLogFormatter(format),
+		Level:           logLevel,
+	})
+
+	return slog.New(logHandler), nil
+}
+
+// migrate applies pending migrations if st has a versioned schema. Replicas starting together wait on the
+// migration lock, so only one of them applies migrations.
+func migrate(st store.Store, logger *slog.Logger) error {
+	migrator, ok := st.(store.Migrator)
+	if !ok {
+		return nil
+	}
+
+	applied, err := migrator.MigrateUp(context.Background(), 0)
+	if err != nil {
+		return fmt.Errorf("migrating store: %w", err)
+	}
+	for _, m := range applied {
+		logger.Info("applied migration", "component", "store", "version", m.Version, "name", m.Name)
+	}
+
+	return nil
+}
+
 // getLogFormatter converts a log format string to usable log formatter
 func getLogFormatter(logformat string) log.Formatter {
 	switch logformat {
@@ -3,10 +3,13 @@ package server
 import (
 	"net/http"
 	"reflect"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/circa10a/go-rest-template/internal/store"
 )
 
 func TestValidate(t *testing.T) {
@@ -18,7 +21,8 @@ func TestValidate(t *testing.T) {
 			// Invalid log format
 			server: &Server{
 				Config: Config{
-					LogFormat: "fake",
+					LogFormat:  "fake",
+					Validation: true,
 				},
 			},
 			expectErr: true,
@@ -27,8 +31,9 @@ func TestValidate(t *testing.T) {
 			// Auto TLS and custom cert set (conflict)
 			server: &Server{
 				Config: Config{
-					AutoTLS: true,
-					TLSCert: "cert",
+					AutoTLS:    true,
+					TLSCert:    "cert",
+					Validation: true,
 				},
 			},
 			expectErr: true,
@@ -37,8 +42,9 @@ func TestValidate(t *testing.T) {
 			// Auto TLS and custom key set (conflict)
 			server: &Server{
 				Config: Config{
-					AutoTLS: true,
-					TLSKey:  "key",
+					AutoTLS:    true,
+					TLSKey:     "key",
+					Validation: true,
 				},
 			},
 			expectErr: true,
@@ -47,7 +53,8 @@ func TestValidate(t *testing.T) {
 			// Auto TLS and no domains
 			server: &Server{
 				Config: Config{
-					AutoTLS: true,
+					AutoTLS:    true,
+					Validation: true,
 				},
 			},
 			expectErr: true,
@@ -56,7 +63,8 @@ func TestValidate(t *testing.T) {
 			// Cert set without key
 			server: &Server{
 				Config: Config{
-					TLSCert: "cert",
+					TLSCert:    "cert",
+					Validation: true,
 				},
 			},
 			expectErr: true,
@@ -65,7 +73,8 @@ func TestValidate(t *testing.T) {
 			// Key set without cert
 			server: &Server{
 				Config: Config{
-					TLSKey: "key",
+					TLSKey:     "key",
+					Validation: true,
 				},
 			},
 			expectErr: true,
@@ -74,8 +83,9 @@ func TestValidate(t *testing.T) {
 			// Valid AutoTLS config
 			server: &Server{
 				Config: Config{
-					AutoTLS: true,
-					Domains: []string{"domain"},
+					AutoTLS:    true,
+					Domains:    []string{"domain"},
+					Validation: true,
 				},
 			},
 		},
@@ -83,17 +93,104 @@ func TestValidate(t *testing.T) {
 			// Valid custom cert/key config
 			server: &Server{
 				Config: Config{
-					TLSCert: "cert",
-					TLSKey:  "key",
+					TLSCert:    "cert",
+					TLSKey:     "key",
+					Validation: true,
+				},
+			},
+		},
+		{
+			// HTTP/3 without TLS
+			server: &Server{
+				Config: Config{
+					HTTP3:      true,
+					Validation: true,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			// HTTP/3 with TLS on a unix socket only
+			server: &Server{
+				Config: Config{
+					HTTP3:      true,
+					Listeners:  []string{"unix:///run/app.sock?cert=cert&key=key"},
+					Validation: true,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			// Listeners with AutoTLS
+			server: &Server{
+				Config: Config{
+					AutoTLS:    true,
+					Domains:    []string{"domain"},
+					Listeners:  []string{"tcp://:8080"},
+					Validation: true,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			// Invalid listener
+			server: &Server{
+				Config: Config{
+					Listeners:  []string{"udp://:8080"},
+					Validation: true,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			// Listener with a cert but no key
+			server: &Server{
+				Config: Config{
+					Listeners:  []string{"tcp://:8443?cert=cert"},
+					Validation: true,
+				},
+			},
+			expectErr: true,
+		},
+		{
+			// Valid HTTP/3 config with TLS set on the listener
+			server: &Server{
+				Config: Config{
+					HTTP3:      true,
+					Listeners:  []string{"unix:///run/app.sock", "tcp://:8443?cert=cert&key=key"},
+					Validation: true,
+				},
+			},
+		},
+		{
+			// Valid h2c config with TLS on another listener
+			server: &Server{
+				Config: Config{
+					H2C:        true,
+					TLSCert:    "cert",
+					TLSKey:     "key",
+					Listeners:  []string{"tcp://:8443", "tcp://127.0.0.1:8080?tls=false"},
+					Validation: true,
+				},
+			},
+		},
+		{
+			// Valid HTTP/3 config
+			server: &Server{
+				Config: Config{
+					HTTP3:      true,
+					TLSCert:    "cert",
+					TLSKey:     "key",
+					Validation: true,
 				},
 			},
 		},
 	}
 
-	for _, test := range tests {
+	for i, test := range tests {
 		err := test.server.validate()
-		if err != nil && !test.expectErr {
-			t.Errorf("unexpected validation result: got error=%v wantErr=%v, err=%v", err != nil, test.expectErr, err)
+		if (err != nil) != test.expectErr {
+			t.Errorf("unexpected validation result of case %d: got error=%v wantErr=%v, err=%v", i, err != nil, test.expectErr, err)
 		}
 	}
 }
@@ -290,3 +387,26 @@ func TestServerConfigOpts(t *testing.T) {
 		}
 	})
 }
+
+func TestNewFailureStopsBackgroundWork(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	// Inbound providers are registered after the background workers start
+	_, err := New(&Config{
+		Store:          store.NewMemory(),
+		LogLevel:       "error",
+		InboundSecrets: map[string]string{"unknown": "secret"},
+		Validation:     true,
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("background work is still running: %d goroutines, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/circa10a/go-rest-template/internal/webhooks"
+)
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+
+	// The receiver listens on loopback, which deliveries are refused by default
+	s, err := New(&Config{Store: store.NewMemory(), LogLevel: "error", JobWorkers: 1, AdminToken: "secret", AllowPrivateWebhooks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	ts := httptest.NewServer(s.mux)
+	t.Cleanup(ts.Close)
+
+	authorized := api.WithRequestEditorFn(func(ctx context.Context, req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer secret")
+		return nil
+	})
+	client, err := api.NewClientWithResponses(ts.URL+"/v1", authorized)
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymous, err := api.NewClientWithResponses(ts.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan webhooks.Event, 1)
+	var secret string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		err := webhooks.Verify(secret, r.Header, body, time.Minute)
+		if err != nil {
+			t.Errorf("invalid delivery: %v", err)
+		}
+
+		var event webhooks.Event
+		_ = json.Unmarshal(body, &event)
+		received <- event
+	}))
+	t.Cleanup(receiver.Close)
+
+	unauthorized, err := anonymous.CreateWebhookWithResponse(ctx, &api.CreateWebhookParams{}, api.NewWebhook{
+		Url:    receiver.URL,
+		Events: []api.WebhookEventType{api.ItemCreated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unauthorized.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("unexpected status without the admin token: got %d want %d", unauthorized.StatusCode(), http.StatusUnauthorized)
+	}
+
+	invalid, err := client.CreateWebhookWithResponse(ctx, &api.CreateWebhookParams{}, api.NewWebhook{
+		Url:    receiver.URL,
+		Events: []api.WebhookEventType{"item.archived"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invalid.StatusCode() != http.StatusBadRequest {
+		t.Errorf("unexpected status for an unknown event: got %d want %d", invalid.StatusCode(), http.StatusBadRequest)
+	}
+
+	created, err := client.CreateWebhookWithResponse(ctx, &api.CreateWebhookParams{}, api.NewWebhook{
+		Url:    receiver.URL,
+		Events: []api.WebhookEventType{api.ItemCreated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.JSON201 == nil || created.JSON201.Secret == "" || !created.JSON201.Active {
+		t.Fatalf("unexpected webhook: %d %s", created.StatusCode(), created.Body)
+	}
+	secret = created.JSON201.Secret
+	id := created.JSON201.Id
+
+	webhook, err := client.GetWebhookWithResponse(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if webhook.JSON200 == nil || webhook.JSON200.Url != receiver.URL {
+		t.Errorf("unexpected webhook: %d %s", webhook.StatusCode(), webhook.Body)
+	}
+	var fields map[string]any
+	_ = json.Unmarshal(webhook.Body, &fields)
+	if _, ok := fields["secret"]; ok {
+		t.Error("the secret of a webhook was returned after it was created")
+	}
+
+	item, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.JSON201 == nil {
+		t.Fatalf("unexpected item: %d %s", item.StatusCode(), item.Body)
+	}
+
+	var event webhooks.Event
+	select {
+	case event = <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the delivery")
+	}
+	var data api.Item
+	_ = json.Unmarshal(event.Data, &data)
+	if event.Type != "item.created" || data.Id != item.JSON201.Id {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	var deliveries *api.ListWebhookDeliveriesResponse
+	for range 100 {
+		deliveries, err = client.ListWebhookDeliveriesWithResponse(ctx, id, &api.ListWebhookDeliveriesParams{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deliveries.JSON200 != nil && len(deliveries.JSON200.Deliveries) == 1 && deliveries.JSON200.Deliveries[0].Status != api.WebhookDeliveryStatusPending {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if deliveries.JSON200 == nil || len(deliveries.JSON200.Deliveries) != 1 || deliveries.JSON200.Deliveries[0].Status != api.WebhookDeliveryStatusSucceeded {
+		t.Fatalf("unexpected deliveries: %d %s", deliveries.StatusCode(), deliveries.Body)
+	}
+	delivery := deliveries.JSON200.Deliveries[0]
+
+	redelivered, err := client.RedeliverWebhookDeliveryWithResponse(ctx, id, delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivered.JSON202 == nil || redelivered.JSON202.RedeliveryOf == nil || *redelivered.JSON202.RedeliveryOf != delivery.Id {
+		t.Fatalf("unexpected redelivery: %d %s", redelivered.StatusCode(), redelivered.Body)
+	}
+	if location := redelivered.HTTPResponse.Header.Get("Location"); location != "/v1/webhooks/"+id+"/deliveries/"+redelivered.JSON202.Id {
+		t.Errorf("unexpected location: %s", location)
+	}
+	select {
+	case event := <-received:
+		if event.ID != delivery.EventId {
+			t.Errorf("unexpected redelivered event: %+v", event)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("timed out waiting for the redelivery")
+	}
+
+	filtered, err := client.ListWebhookDeliveriesWithResponse(ctx, id, &api.ListWebhookDeliveriesParams{Filter: &api.Filter{"status:eq:failed"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filtered.JSON200 == nil || len(filtered.JSON200.Deliveries) != 0 {
+		t.Errorf("unexpected failed deliveries: %d %s", filtered.StatusCode(), filtered.Body)
+	}
+
+	other, err := client.GetWebhookDeliveryWithResponse(ctx, "other", delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.StatusCode() != http.StatusNotFound {
+		t.Errorf("unexpected status for a delivery of another webhook: got %d want %d", other.StatusCode(), http.StatusNotFound)
+	}
+
+	deleted, err := client.DeleteWebhookWithResponse(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted.StatusCode() != http.StatusNoContent {
+		t.Errorf("unexpected status deleting the webhook: got %d want %d", deleted.StatusCode(), http.StatusNoContent)
+	}
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// WorkerConfig holds configuration for RunWorker.
+type WorkerConfig struct {
+	// DatabaseURL selects the store holding the jobs. It must be shared with the server, so the in-memory
+	// store is not supported.
+	DatabaseURL string
+	LogFormat   string
+	LogLevel    string
+	Workers     int
+	MetricsPort int
+	AutoMigrate bool
+	Metrics     bool
+	// AllowPrivateWebhooks allows webhook deliveries to loopback, private and link-local addresses.
+	AllowPrivateWebhooks bool
+}
+
+// RunWorker consumes background jobs from the store until ctx is done, then waits for running jobs to be
+// interrupted and queued again. It serves no API, so workers can be scaled separately from servers.
+func RunWorker(ctx context.Context, cfg WorkerConfig) error {
+	logger, err := newLogger(cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	log := logger.With("component", "worker")
+
+	if cfg.DatabaseURL == "" || strings.HasPrefix(cfg.DatabaseURL, "memory:") {
+		return errors.New("a database URL is required, jobs in the in-memory store are not shared with the server")
+	}
+
+	openCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	st, err := store.Open(openCtx, cfg.DatabaseURL)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("opening store: %w", err)
+	}
+	defer func() { _ = st.Close() }()
+
+	jobStore, ok := st.(store.JobStore)
+	if !ok {
+		return fmt.Errorf("%s does not support jobs", cfg.DatabaseURL)
+	}
+
+	if cfg.AutoMigrate {
+		err = migrate(st, logger)
+		if err != nil {
+			return err
+		}
+	}
+
+	q := jobs.New(jobStore, jobs.Config{Logger: logger, Workers: cfg.Workers})
+	_, _ = registerJobs(q, st, logger, cfg.AllowPrivateWebhooks)
+
+	if cfg.Metrics {
+		err = jobs.RegisterMetrics(jobStore)
+		if err == nil {
+			err = registerStoreMetrics(st)
+		}
+		if err != nil {
+			return err
+		}
+
+		metricsServer := &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.MetricsPort),
+			Handler:           promhttp.Handler(),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			log.Info("Serving metrics on " + metricsServer.Addr)
+			err := metricsServer.ListenAndServe()
+			if !errors.Is(err, http.ErrServerClosed) {
+				log.Error("metrics server failed", "err", err)
+			}
+		}()
+		defer func() { _ = metricsServer.Close() }()
+	}
+
+	log.Info("Starting worker", "kinds", q.Kinds(), "workers", cfg.Workers)
+	q.Run(ctx)
+	log.Info("Worker stopped")
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/api"
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/circa10a/go-rest-template/internal/ws"
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+func TestWebSocket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	s, err := New(&Config{
+		Store:           store.NewMemory(),
+		LogLevel:        "error",
+		WebSocketToken:  "secret",
+		Compression:     true,
+		ETags:           true,
+		SecurityHeaders: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	// Connections must outlive the timeouts of the server through every middleware
+	ts := httptest.NewUnstartedServer(s.mux)
+	ts.Config.ReadTimeout = 100 * time.Millisecond
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	url := strings.Replace(ts.URL, "http", "ws", 1) + "/v1/ws"
+	_, resp, err := websocket.Dial(ctx, url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected response without a token: %v, %v", resp, err)
+	}
+
+	conn, _, err := websocket.Dial(ctx, url+"?access_token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.CloseNow() })
+
+	err = wsjson.Write(ctx, conn, ws.Message{Type: ws.TypeSubscribe, Topic: "items"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply ws.Message
+	err = wsjson.Read(ctx, conn, &reply)
+	if err != nil || reply.Type != ws.TypeSubscribed {
+		t.Fatalf("unexpected reply: %+v, %v", reply, err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	client, err := api.NewClientWithResponses(ts.URL + "/v1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	item, err := client.CreateItemWithResponse(ctx, &api.CreateItemParams{}, api.NewItem{Name: "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.JSON201 == nil {
+		t.Fatalf("unexpected item: %d %s", item.StatusCode(), item.Body)
+	}
+
+	var event ws.Message
+	err = wsjson.Read(ctx, conn, &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data api.Item
+	_ = json.Unmarshal(event.Data, &data)
+	if event.Type != "item.created" || event.Topic != "items" || data.Id != item.JSON201.Id {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
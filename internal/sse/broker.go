@@ -0,0 +1,302 @@
+package sse
+
+import (
+	"cmp"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds configuration for a Broker.
+type Config struct {
+	Logger *slog.Logger
+	// Topics are the topics clients may subscribe to.
+	Topics []string
+	// BufferSize is the number of recent events kept per topic for clients resuming with Last-Event-ID.
+	// Defaults to 256.
+	BufferSize int
+	// ClientBuffer is the number of events queued for a client before it is disconnected as too slow. It
+	// reconnects and resumes from the events kept for its topics. Defaults to 64.
+	ClientBuffer int
+	// Heartbeat is the interval of the comments sent to keep idle connections open. Defaults to 15 seconds.
+	Heartbeat time.Duration
+	// Retry is how long clients wait before reconnecting. Clients choose when it is zero, usually 3 seconds.
+	Retry time.Duration
+}
+
+// Broker fans out events to the clients subscribed to their topic.
+type Broker struct {
+	logger *slog.Logger
+	topics map[string]*topic
+	closed chan struct{}
+	// epoch identifies this broker in event IDs, so IDs sent by a broker that has since restarted are
+	// recognised instead of being compared to a sequence that started over
+	epoch string
+	cfg   Config
+	seq   uint64
+	mu    sync.Mutex
+	once  sync.Once
+}
+
+// topic holds the recent events and the subscribers of a topic.
+type topic struct {
+	subscribers map[*subscriber]struct{}
+	events      []sequenced
+}
+
+// sequenced is a published event with its position in the broker's sequence.
+type sequenced struct {
+	event Event
+	seq   uint64
+}
+
+// subscriber receives the events of one or more topics. Its channel is closed when it falls behind.
+type subscriber struct {
+	events chan Event
+}
+
+// NewBroker returns a broker configured with cfg.
+func NewBroker(cfg Config) *Broker {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 256
+	}
+	if cfg.ClientBuffer <= 0 {
+		cfg.ClientBuffer = 64
+	}
+	if cfg.Heartbeat <= 0 {
+		cfg.Heartbeat = 15 * time.Second
+	}
+
+	return &Broker{
+		logger: cfg.Logger.With("component", "sse"),
+		topics: map[string]*topic{},
+		closed: make(chan struct{}),
+		epoch:  strconv.FormatInt(time.Now().UnixNano(), 36),
+		cfg:    cfg,
+	}
+}
+
+// Publish sends event to the clients subscribed to name and keeps it for clients that resume later. It
+// returns the event with its assigned ID.
+func (b *Broker) Publish(name string, event Event) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.seq++
+	event.ID = b.epoch + "-" + strconv.FormatUint(b.seq, 10)
+
+	t := b.topic(name)
+	if len(t.events) == b.cfg.BufferSize {
+		copy(t.events, t.events[1:])
+		t.events = t.events[:len(t.events)-1]
+	}
+	t.events = append(t.events, sequenced{event: event, seq: b.seq})
+
+	for sub := range t.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			// A slow client would hold up every other client, so it is disconnected and catches up when it
+			// reconnects
+			b.remove(sub)
+			close(sub.events)
+			clientsDropped.Inc()
+		}
+	}
+	eventsPublished.WithLabelValues(name).Inc()
+
+	return event
+}
+
+// AllowsTopic reports whether clients may subscribe to the topic with name.
+func (b *Broker) AllowsTopic(name string) bool {
+	return slices.Contains(b.cfg.Topics, name)
+}
+
+// Serve streams the events of topics to the client of r until it disconnects or the broker is closed. Events
+// published since the Last-Event-ID header, or the last_event_id query parameter for the first connection
+// of clients that cannot set headers, are sent first. Clients subscribing to a topic that is not in
+// Config.Topics get a 400 Bad Request.
+func (b *Broker) Serve(w http.ResponseWriter, r *http.Request, topics ...string) {
+	for _, name := range topics {
+		if !b.AllowsTopic(name) {
+			http.Error(w, "unknown topic "+name, http.StatusBadRequest)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+
+	// Streams outlive the read and write timeouts of the server, which would otherwise end them
+	err := rc.SetReadDeadline(time.Time{})
+	if err == nil {
+		err = rc.SetWriteDeadline(time.Time{})
+	}
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		b.logger.Warn("clearing connection deadlines", "err", err)
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("last_event_id")
+	}
+	sub, replay := b.subscribe(topics, lastEventID)
+	defer b.unsubscribe(sub)
+
+	clients.Inc()
+	defer clients.Dec()
+
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Set("Cache-Control", "no-cache")
+	// Disables response buffering in nginx
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusOK)
+
+	if b.cfg.Retry > 0 {
+		err = writeRetry(w, b.cfg.Retry)
+		if err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		err = event.write(w)
+		if err != nil {
+			return
+		}
+	}
+	err = rc.Flush()
+	if err != nil {
+		b.logger.Error("streaming is not supported by the response writer", "err", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(b.cfg.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-b.closed:
+			return
+		case <-heartbeat.C:
+			err = writeHeartbeat(w)
+		case event, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			err = event.write(w)
+			// Events published together are sent together
+			for err == nil && len(sub.events) > 0 {
+				event, ok = <-sub.events
+				if !ok {
+					break
+				}
+				err = event.write(w)
+			}
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Close disconnects every client. Clients reconnect to another replica, or once the server restarts.
+func (b *Broker) Close() {
+	b.once.Do(func() { close(b.closed) })
+}
+
+// subscribe registers a subscriber to topics and returns it with the events to replay after lastEventID.
+func (b *Broker) subscribe(topics []string, lastEventID string) (*subscriber, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscriber{events: make(chan Event, b.cfg.ClientBuffer)}
+	var replay []sequenced
+	after, resume := b.parseID(lastEventID)
+	for _, name := range topics {
+		t := b.topic(name)
+		t.subscribers[sub] = struct{}{}
+
+		if resume {
+			for _, event := range t.events {
+				if event.seq > after {
+					replay = append(replay, event)
+				}
+			}
+		}
+	}
+
+	// Topics interleave, so their events are replayed in the order they were published
+	slices.SortFunc(replay, func(a, b sequenced) int { return cmp.Compare(a.seq, b.seq) })
+	events := make([]Event, len(replay))
+	for i, event := range replay {
+		events[i] = event.event
+	}
+
+	return sub, events
+}
+
+// unsubscribe removes sub from its topics, unless it was already removed for falling behind.
+func (b *Broker) unsubscribe(sub *subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+// remove removes sub from every topic, and deletes the topics left without subscribers or events to
+// replay. The caller holds mu.
+func (b *Broker) remove(sub *subscriber) {
+	for name, t := range b.topics {
+		delete(t.subscribers, sub)
+		if len(t.subscribers) == 0 && len(t.events) == 0 {
+			delete(b.topics, name)
+		}
+	}
+}
+
+// topic returns the topic with name, creating it. The caller holds mu.
+func (b *Broker) topic(name string) *topic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &topic{subscribers: map[*subscriber]struct{}{}}
+		b.topics[name] = t
+	}
+
+	return t
+}
+
+// parseID returns the sequence number of the event with id and whether the client resumes after it. Clients
+// without an ID start with new events. IDs from before a restart resume from the oldest event kept, since
+// every event kept was published after them.
+func (b *Broker) parseID(id string) (uint64, bool) {
+	if id == "" {
+		return 0, false
+	}
+
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0, true
+	}
+
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, true
+	}
+
+	return n, true
+}
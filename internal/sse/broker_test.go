@@ -0,0 +1,251 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stream is a client reading events from a test server.
+type stream struct {
+	lines  *bufio.Scanner
+	cancel context.CancelFunc
+}
+
+// connect opens a stream of topics, resuming after lastEventID if it is set.
+func connect(t *testing.T, ts *httptest.Server, topics, lastEventID string) *stream {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"?topic="+topics, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	if resp.Header.Get("Content-Type") != ContentType {
+		t.Fatalf("unexpected content type: %s", resp.Header.Get("Content-Type"))
+	}
+
+	return &stream{lines: bufio.NewScanner(resp.Body), cancel: cancel}
+}
+
+// next returns the fields of the next event, skipping comments.
+func (s *stream) next(t *testing.T) map[string]string {
+	t.Helper()
+
+	fields := map[string]string{}
+	for s.lines.Scan() {
+		line := s.lines.Text()
+		if line == "" {
+			if len(fields) > 0 {
+				return fields
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			fields["comment"] = line
+			return fields
+		}
+
+		name, value, _ := strings.Cut(line, ": ")
+		if fields[name] != "" {
+			value = fields[name] + "\n" + value
+		}
+		fields[name] = value
+	}
+
+	t.Fatalf("stream ended: %v", s.lines.Err())
+	return nil
+}
+
+func newTestBroker(t *testing.T, cfg Config) (*Broker, *httptest.Server) {
+	t.Helper()
+
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	cfg.Topics = []string{"items", "orders"}
+	b := NewBroker(cfg)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.Serve(w, r, strings.Split(r.URL.Query().Get("topic"), ",")...)
+	}))
+	t.Cleanup(ts.Close)
+	t.Cleanup(b.Close)
+
+	return b, ts
+}
+
+func TestBroker(t *testing.T) {
+	b, ts := newTestBroker(t, Config{})
+
+	items := connect(t, ts, "items", "")
+	both := connect(t, ts, "items,orders", "")
+
+	// Wait for both clients to subscribe before publishing
+	for !b.subscribed("items", 2) {
+		time.Sleep(time.Millisecond)
+	}
+
+	created := b.Publish("items", Event{Type: "item.created", Data: []byte("{\"name\":\"Widget\"}")})
+	b.Publish("orders", Event{Type: "order.created", Data: []byte("first line\nsecond line")})
+
+	tests := []struct {
+		client *stream
+		name   string
+		expect []map[string]string
+	}{
+		{
+			name:   "one topic",
+			client: items,
+			expect: []map[string]string{{"id": created.ID, "event": "item.created", "data": `{"name":"Widget"}`}},
+		},
+		{
+			name:   "several topics",
+			client: both,
+			expect: []map[string]string{
+				{"id": created.ID, "event": "item.created", "data": `{"name":"Widget"}`},
+				{"id": b.epoch + "-2", "event": "order.created", "data": "first line\nsecond line"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, expect := range test.expect {
+				fields := test.client.next(t)
+				for name, value := range expect {
+					if fields[name] != value {
+						t.Errorf("unexpected %s: got %q want %q", name, fields[name], value)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBrokerResume(t *testing.T) {
+	b, ts := newTestBroker(t, Config{BufferSize: 2})
+
+	var ids []string
+	for _, name := range []string{"one", "two", "three"} {
+		ids = append(ids, b.Publish("items", Event{Data: []byte(name)}).ID)
+	}
+
+	tests := []struct {
+		name        string
+		lastEventID string
+		expect      []string
+	}{
+		{name: "after an event", lastEventID: ids[1], expect: []string{"three"}},
+		{name: "beyond the buffer", lastEventID: ids[0], expect: []string{"two", "three"}},
+		{name: "another broker", lastEventID: "other-10", expect: []string{"two", "three"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := connect(t, ts, "items", test.lastEventID)
+			for _, expect := range test.expect {
+				fields := client.next(t)
+				if fields["data"] != expect {
+					t.Errorf("unexpected event: got %q want %q", fields["data"], expect)
+				}
+			}
+		})
+	}
+
+	// Without an ID only new events are sent
+	client := connect(t, ts, "items", "")
+	for !b.subscribed("items", 1) {
+		time.Sleep(time.Millisecond)
+	}
+	b.Publish("items", Event{Data: []byte("four")})
+	if fields := client.next(t); fields["data"] != "four" {
+		t.Errorf("unexpected event for a new client: got %q want %q", fields["data"], "four")
+	}
+}
+
+func TestBrokerTopics(t *testing.T) {
+	b, ts := newTestBroker(t, Config{})
+
+	resp, err := http.Get(ts.URL + "?topic=items,random")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected status for an unknown topic: got %d want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+
+	// Topics without subscribers or events to replay are deleted when the last client leaves
+	client := connect(t, ts, "orders", "")
+	for !b.subscribed("orders", 1) {
+		time.Sleep(time.Millisecond)
+	}
+	client.cancel()
+	for !b.subscribed("orders", 0) {
+		time.Sleep(time.Millisecond)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.topics) != 0 {
+		t.Errorf("unexpected topics left: %v", b.topics)
+	}
+}
+
+func TestBrokerHeartbeat(t *testing.T) {
+	_, ts := newTestBroker(t, Config{Heartbeat: 10 * time.Millisecond})
+
+	client := connect(t, ts, "items", "")
+	if fields := client.next(t); fields["comment"] != ": heartbeat" {
+		t.Errorf("unexpected heartbeat: %v", fields)
+	}
+}
+
+func TestBrokerSlowClient(t *testing.T) {
+	b := NewBroker(Config{Logger: slog.New(slog.DiscardHandler), ClientBuffer: 2})
+
+	sub, _ := b.subscribe([]string{"items"}, "")
+	for range 3 {
+		b.Publish("items", Event{Data: []byte("event")})
+	}
+
+	// The buffered events are kept and the channel is closed after them
+	received := 0
+	for range sub.events {
+		received++
+	}
+	if received != 2 {
+		t.Errorf("unexpected number of events before the client was dropped: got %d want 2", received)
+	}
+	if b.subscribed("items", 1) {
+		t.Error("the slow client is still subscribed")
+	}
+}
+
+// subscribed reports whether topic has n subscribers.
+func (b *Broker) subscribed(topic string, n int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, ok := b.topics[topic]
+	if !ok {
+		return n == 0
+	}
+
+	return len(t.subscribers) == n
+}
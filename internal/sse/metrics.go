@@ -0,0 +1,36 @@
+package sse
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	clients = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "sse_clients",
+		Help: "Number of clients connected to event streams.",
+	})
+	eventsPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "sse_events_published_total",
+		Help: "Number of events published to event streams by topic.",
+	}, []string{"topic"})
+	clientsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "sse_clients_dropped_total",
+		Help: "Number of clients disconnected for falling behind their event stream.",
+	})
+)
+
+// RegisterMetrics registers the event stream metrics with the default Prometheus registry. Streams are not
+// measured by the HTTP request metrics, since their duration is how long clients stay connected.
+func RegisterMetrics() error {
+	for _, c := range []prometheus.Collector{clients, eventsPublished, clientsDropped} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,62 @@
+// Package sse streams events to clients with Server-Sent Events. A Broker fans out published events to the
+// clients subscribed to their topic, keeps the latest events of every topic so reconnecting clients resume
+// from the Last-Event-ID they send, and sends heartbeats so idle connections are not closed by proxies.
+package sse
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of event streams.
+const ContentType = "text/event-stream"
+
+// Event is a message sent to the clients subscribed to a topic.
+type Event struct {
+	// ID is assigned by the broker when the event is published.
+	ID string
+	// Type is the event name clients listen for. Clients receive events without a type as "message".
+	Type string
+	// Data is the payload, usually JSON. It may span several lines.
+	Data []byte
+}
+
+// newlines replaces the line breaks that would end a field early.
+var newlines = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// write writes e in the event stream format.
+func (e Event) write(w io.Writer) error {
+	var buf bytes.Buffer
+	if e.ID != "" {
+		buf.WriteString("id: " + newlines.Replace(e.ID) + "\n")
+	}
+	if e.Type != "" {
+		buf.WriteString("event: " + newlines.Replace(e.Type) + "\n")
+	}
+
+	data := bytes.ReplaceAll(e.Data, []byte("\r\n"), []byte("\n"))
+	for line := range bytes.SplitSeq(data, []byte("\n")) {
+		buf.WriteString("data: ")
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	buf.WriteByte('\n')
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeRetry tells the client how long to wait before reconnecting.
+func writeRetry(w io.Writer, retry time.Duration) error {
+	_, err := io.WriteString(w, "retry: "+strconv.FormatInt(retry.Milliseconds(), 10)+"\n\n")
+	return err
+}
+
+// writeHeartbeat writes a comment, which clients ignore, to keep the connection active.
+func writeHeartbeat(w io.Writer) error {
+	_, err := io.WriteString(w, ": heartbeat\n\n")
+	return err
+}
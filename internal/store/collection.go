@@ -0,0 +1,138 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Document is a typed record.
+type Document[T any] struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Value     T
+	ID        string
+	data      json.RawMessage
+	Version   int64
+}
+
+// Record returns the stored record the document was decoded from.
+func (d Document[T]) Record() Record {
+	return Record{
+		ID:        d.ID,
+		Data:      d.data,
+		Version:   d.Version,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+}
+
+// Collection is a typed wrapper around a Repository that stores values of T as JSON.
+//
+//	items := store.NewCollection[api.NewItem](s, "items")
+//	doc, err := items.Create(ctx, api.NewItem{Name: "example"})
+type Collection[T any] struct {
+	repo Repository
+}
+
+// NewCollection returns the typed collection called name in s.
+func NewCollection[T any](s Store, name string) *Collection[T] {
+	return &Collection[T]{repo: s.Repository(name)}
+}
+
+// Get returns the document with id or ErrNotFound.
+func (c *Collection[T]) Get(ctx context.Context, id string) (Document[T], error) {
+	record, err := c.repo.Get(ctx, id)
+	if err != nil {
+		return Document[T]{}, err
+	}
+
+	return decodeDocument[T](record)
+}
+
+// List returns documents ordered by creation time.
+func (c *Collection[T]) List(ctx context.Context, q Query) ([]Document[T], error) {
+	records, err := c.repo.List(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]Document[T], 0, len(records))
+	for _, record := range records {
+		doc, err := decodeDocument[T](record)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// Create stores a new document with a generated ID.
+func (c *Collection[T]) Create(ctx context.Context, value T) (Document[T], error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Document[T]{}, err
+	}
+
+	record, err := c.repo.Create(ctx, Record{Data: data})
+	if err != nil {
+		return Document[T]{}, err
+	}
+
+	return decodeDocument[T](record)
+}
+
+// CreateWithID stores a new document with id. It returns ErrConflict if the ID is taken.
+func (c *Collection[T]) CreateWithID(ctx context.Context, id string, value T) (Document[T], error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Document[T]{}, err
+	}
+
+	record, err := c.repo.Create(ctx, Record{ID: id, Data: data})
+	if err != nil {
+		return Document[T]{}, err
+	}
+
+	return decodeDocument[T](record)
+}
+
+// Update replaces the value of a document. If version is non-zero it must match the stored version or ErrConflict is returned.
+func (c *Collection[T]) Update(ctx context.Context, id string, version int64, value T) (Document[T], error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Document[T]{}, err
+	}
+
+	record, err := c.repo.Update(ctx, Record{ID: id, Version: version, Data: data})
+	if err != nil {
+		return Document[T]{}, err
+	}
+
+	return decodeDocument[T](record)
+}
+
+// Delete removes a document. If version is non-zero it must match the stored version or ErrConflict is returned.
+func (c *Collection[T]) Delete(ctx context.Context, id string, version int64) error {
+	return c.repo.Delete(ctx, id, version)
+}
+
+func decodeDocument[T any](record Record) (Document[T], error) {
+	doc := Document[T]{
+		ID:        record.ID,
+		Version:   record.Version,
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+		data:      record.Data,
+	}
+
+	err := json.Unmarshal(record.Data, &doc.Value)
+	if err != nil {
+		return Document[T]{}, fmt.Errorf("decoding record %s: %w", record.ID, err)
+	}
+
+	return doc, nil
+}
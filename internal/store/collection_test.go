@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type widget struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestCollection(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			widgets := NewCollection[widget](s, "widgets")
+
+			created, err := widgets.Create(ctx, widget{Name: "one", Count: 1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.ID == "" || created.Version != 1 {
+				t.Errorf("unexpected created document: %+v", created)
+			}
+
+			got, err := widgets.Get(ctx, created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Value != (widget{Name: "one", Count: 1}) {
+				t.Errorf("unexpected value: got %+v want %+v", got.Value, widget{Name: "one", Count: 1})
+			}
+
+			updated, err := widgets.Update(ctx, created.ID, created.Version, widget{Name: "two", Count: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated.Value.Name != "two" || updated.Version != 2 {
+				t.Errorf("unexpected updated document: %+v", updated)
+			}
+
+			docs, err := widgets.List(ctx, Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(docs) != 1 || docs[0].Value.Count != 2 {
+				t.Errorf("unexpected documents: %+v", docs)
+			}
+
+			err = widgets.Delete(ctx, created.ID, updated.Version)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = widgets.Get(ctx, created.ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unexpected error getting deleted document: got %v want %v", err, ErrNotFound)
+			}
+
+			named, err := widgets.CreateWithID(ctx, "named", widget{Name: "named"})
+			if err != nil || named.ID != "named" {
+				t.Errorf("unexpected document created with an ID: %+v, %v", named, err)
+			}
+			_, err = widgets.CreateWithID(ctx, "named", widget{Name: "duplicate"})
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error creating a duplicate ID: got %v want %v", err, ErrConflict)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrKeyInFlight is returned when a request with the same idempotency key has not completed yet.
+	ErrKeyInFlight = errors.New("idempotency key is in use by a request in flight")
+	// ErrKeyMismatch is returned when an idempotency key is reused for a different request.
+	ErrKeyMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// IdempotentResponse is the stored response of a request made with an idempotency key.
+type IdempotentResponse struct {
+	Header map[string][]string
+	Body   []byte
+	Status int
+}
+
+/*
+IdempotencyStore stores the responses of requests made with an idempotency key so retries can be answered
+without repeating the request. Stores that support it implement the interface:
+
+	if s, ok := server.Store.(store.IdempotencyStore); ok {
+		...
+	}
+*/
+type IdempotencyStore interface {
+	// ReserveKey claims key for the request identified by fingerprint until expiresAt. It returns the stored
+	// response if the request already completed, ErrKeyInFlight if it has not, and ErrKeyMismatch if the key
+	// was used for a request with a different fingerprint. Expired keys are claimed again.
+	ReserveKey(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*IdempotentResponse, error)
+	// CompleteKey stores the response of the request holding key.
+	CompleteKey(ctx context.Context, key string, resp IdempotentResponse) error
+	// ReleaseKey deletes key so the request can be retried, for example after a server error.
+	ReleaseKey(ctx context.Context, key string) error
+	// DeleteExpiredKeys deletes keys that expired before now and returns how many were deleted.
+	DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyKey struct {
+	expiresAt   time.Time
+	resp        *IdempotentResponse
+	fingerprint string
+}
+
+// checkReserved returns the result of reserving a key that is already held.
+func (k idempotencyKey) checkReserved(fingerprint string) (*IdempotentResponse, error) {
+	if k.fingerprint != fingerprint {
+		return nil, ErrKeyMismatch
+	}
+	if k.resp == nil {
+		return nil, ErrKeyInFlight
+	}
+
+	return k.resp, nil
+}
+
+// ReserveKey claims an idempotency key. See IdempotencyStore.
+func (m *Memory) ReserveKey(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*IdempotentResponse, error) {
+	defer m.lock(ctx, true)()
+
+	current, ok := m.idempotencyKeys[key]
+	if ok && current.expiresAt.After(time.Now()) {
+		return current.checkReserved(fingerprint)
+	}
+
+	m.idempotencyKeys[key] = idempotencyKey{fingerprint: fingerprint, expiresAt: expiresAt}
+	return nil, nil
+}
+
+// CompleteKey stores the response for an idempotency key. See IdempotencyStore.
+func (m *Memory) CompleteKey(ctx context.Context, key string, resp IdempotentResponse) error {
+	defer m.lock(ctx, true)()
+
+	current, ok := m.idempotencyKeys[key]
+	if !ok {
+		return ErrNotFound
+	}
+
+	current.resp = &resp
+	m.idempotencyKeys[key] = current
+
+	return nil
+}
+
+// ReleaseKey deletes an idempotency key. See IdempotencyStore.
+func (m *Memory) ReleaseKey(ctx context.Context, key string) error {
+	defer m.lock(ctx, true)()
+
+	delete(m.idempotencyKeys, key)
+	return nil
+}
+
+// DeleteExpiredKeys deletes expired idempotency keys. See IdempotencyStore.
+func (m *Memory) DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error) {
+	defer m.lock(ctx, true)()
+
+	var deleted int64
+	for key, current := range m.idempotencyKeys {
+		if !current.expiresAt.After(now) {
+			delete(m.idempotencyKeys, key)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// ReserveKey claims an idempotency key. See IdempotencyStore.
+func (s *SQL) ReserveKey(ctx context.Context, key, fingerprint string, expiresAt time.Time) (*IdempotentResponse, error) {
+	now := time.Now().UTC()
+
+	// Claim the key if it is new, or take it over if it expired. Both are atomic, so concurrent requests
+	// with the same key cannot both claim it.
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`INSERT INTO idempotency_keys (key, fingerprint, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET fingerprint = excluded.fingerprint, expires_at = excluded.expires_at,
+			status = NULL, header = NULL, body = NULL
+		WHERE idempotency_keys.expires_at <= ?`),
+		key, fingerprint, expiresAt.UTC(), now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = expectAffected(result, ErrConflict)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, ErrConflict) {
+		return nil, err
+	}
+
+	var (
+		current idempotencyKey
+		status  sql.NullInt64
+		header  sql.NullString
+		body    []byte
+	)
+	err = s.Conn(ctx).QueryRowContext(ctx, s.Rebind(
+		`SELECT fingerprint, status, header, body FROM idempotency_keys WHERE key = ?`), key).
+		Scan(&current.fingerprint, &status, &header, &body)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The key was released since the insert, so the request is still in flight from the client's view
+		return nil, ErrKeyInFlight
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if status.Valid {
+		current.resp = &IdempotentResponse{Status: int(status.Int64), Body: body}
+		if header.Valid {
+			err = json.Unmarshal([]byte(header.String), &current.resp.Header)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return current.checkReserved(fingerprint)
+}
+
+// CompleteKey stores the response for an idempotency key. See IdempotencyStore.
+func (s *SQL) CompleteKey(ctx context.Context, key string, resp IdempotentResponse) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+
+	body := resp.Body
+	if body == nil {
+		body = []byte{}
+	}
+
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`UPDATE idempotency_keys SET status = ?, header = ?, body = ? WHERE key = ?`),
+		resp.Status, string(header), body, key)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrNotFound)
+}
+
+// ReleaseKey deletes an idempotency key. See IdempotencyStore.
+func (s *SQL) ReleaseKey(ctx context.Context, key string) error {
+	_, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(`DELETE FROM idempotency_keys WHERE key = ?`), key)
+	return err
+}
+
+// DeleteExpiredKeys deletes expired idempotency keys. See IdempotencyStore.
+func (s *SQL) DeleteExpiredKeys(ctx context.Context, now time.Time) (int64, error) {
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(`DELETE FROM idempotency_keys WHERE expires_at <= ?`), now.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
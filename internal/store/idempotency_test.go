@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			keys, ok := s.(IdempotencyStore)
+			if !ok {
+				t.Fatal("store does not implement IdempotencyStore")
+			}
+			expiresAt := time.Now().Add(time.Hour)
+
+			resp, err := keys.ReserveKey(ctx, "a", "request", expiresAt)
+			if err != nil || resp != nil {
+				t.Fatalf("unexpected result reserving a new key: %v %v", resp, err)
+			}
+
+			_, err = keys.ReserveKey(ctx, "a", "request", expiresAt)
+			if !errors.Is(err, ErrKeyInFlight) {
+				t.Errorf("unexpected error reserving a key in flight: got %v want %v", err, ErrKeyInFlight)
+			}
+
+			stored := IdempotentResponse{Status: 201, Header: map[string][]string{"Location": {"/items/1"}}, Body: []byte(`{"id":"1"}`)}
+			err = keys.CompleteKey(ctx, "a", stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err = keys.ReserveKey(ctx, "a", "request", expiresAt)
+			if err != nil || resp == nil || !reflect.DeepEqual(*resp, stored) {
+				t.Errorf("unexpected replay: got %+v, %v want %+v", resp, err, stored)
+			}
+
+			_, err = keys.ReserveKey(ctx, "a", "other request", expiresAt)
+			if !errors.Is(err, ErrKeyMismatch) {
+				t.Errorf("unexpected error reusing a key: got %v want %v", err, ErrKeyMismatch)
+			}
+
+			err = keys.ReleaseKey(ctx, "a")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err = keys.ReserveKey(ctx, "a", "other request", expiresAt)
+			if err != nil || resp != nil {
+				t.Errorf("unexpected result reserving a released key: %v %v", resp, err)
+			}
+
+			// Expired keys can be claimed again and are deleted
+			_, err = keys.ReserveKey(ctx, "b", "request", time.Now().Add(-time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err = keys.ReserveKey(ctx, "b", "other request", time.Now().Add(-time.Second))
+			if err != nil || resp != nil {
+				t.Errorf("unexpected result reserving an expired key: %v %v", resp, err)
+			}
+
+			deleted, err := keys.DeleteExpiredKeys(ctx, time.Now())
+			if err != nil || deleted != 1 {
+				t.Errorf("unexpected expired keys deleted: got %d, %v want 1", deleted, err)
+			}
+		})
+	}
+}
+
+func TestIdempotencyStoreConcurrent(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			keys := s.(IdempotencyStore)
+
+			var reserved atomic.Int32
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Go(func() {
+					_, err := keys.ReserveKey(context.Background(), "key", "request", time.Now().Add(time.Hour))
+					if err == nil {
+						reserved.Add(1)
+					} else if !errors.Is(err, ErrKeyInFlight) {
+						t.Error(err)
+					}
+				})
+			}
+			wg.Wait()
+
+			if reserved.Load() != 1 {
+				t.Errorf("unexpected number of reservations: got %d want 1", reserved.Load())
+			}
+		})
+	}
+}
@@ -0,0 +1,638 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// JobState is the state of a queued job. Jobs that complete are deleted.
+type JobState string
+
+// Job states.
+const (
+	// JobPending jobs run once RunAt has passed.
+	JobPending JobState = "pending"
+	// JobRunning jobs have been claimed by a worker until LockedUntil.
+	JobRunning JobState = "running"
+	// JobDead jobs failed every attempt, or failed permanently, and are kept until they are retried or discarded.
+	JobDead JobState = "dead"
+)
+
+// Job is a unit of background work.
+type Job struct {
+	RunAt     time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// LockedUntil is when the claim of a running job expires and another worker may claim it.
+	LockedUntil time.Time
+	ID          string
+	Kind        string
+	// UniqueKey, if set, prevents enqueueing another job of the same kind with the key while this one is
+	// pending or running.
+	UniqueKey string
+	LastError string
+	State     JobState
+	Args      []byte
+	// Attempts counts the times the job has been claimed.
+	Attempts    int
+	MaxAttempts int
+}
+
+// JobQuery selects the jobs returned by ListJobs. Jobs are ordered by creation time.
+type JobQuery struct {
+	// AfterCreatedAt and AfterID are the creation time and ID of the last job of the previous page.
+	AfterCreatedAt time.Time
+	AfterID        string
+	Kind           string
+	State          JobState
+	// Limit is the maximum number of jobs to return. Zero means no limit.
+	Limit int
+}
+
+// JobStats summarizes the jobs of one kind in one state.
+type JobStats struct {
+	// OldestRunAt is the earliest RunAt of the jobs.
+	OldestRunAt time.Time
+	Kind        string
+	State       JobState
+	Count       int64
+}
+
+/*
+JobStore persists a queue of background jobs. Stores that support it implement the interface:
+
+	if s, ok := server.Store.(store.JobStore); ok {
+		...
+	}
+*/
+type JobStore interface {
+	// EnqueueJob stores a pending job, generating its ID. It returns ErrConflict if the job has a UniqueKey
+	// that a pending or running job of the same kind holds.
+	EnqueueJob(ctx context.Context, job Job) (Job, error)
+	// ClaimJobs marks up to limit jobs of the given kinds as running until lockedUntil and returns them with
+	// their attempts incremented. Pending jobs due by now and running jobs whose lock expired are claimed,
+	// earliest RunAt first. Concurrent calls never claim the same job.
+	ClaimJobs(ctx context.Context, kinds []string, now, lockedUntil time.Time, limit int) ([]Job, error)
+	// CompleteJob deletes a job that succeeded on the given attempt. It returns ErrConflict if the job has
+	// been claimed again since.
+	CompleteJob(ctx context.Context, id string, attempt int) error
+	// FailJob records the error of a failed attempt and makes the job pending again at retryAt, or dead if
+	// retryAt is zero. It returns ErrConflict if the job has been claimed again since.
+	FailJob(ctx context.Context, id string, attempt int, lastError string, retryAt time.Time) error
+	// GetJob returns the job with id or ErrNotFound.
+	GetJob(ctx context.Context, id string) (Job, error)
+	// ListJobs returns the jobs matching q.
+	ListJobs(ctx context.Context, q JobQuery) ([]Job, error)
+	// RetryJob makes a pending or dead job due now with its attempts reset. It returns ErrConflict if the job
+	// is running or another job holds its UniqueKey.
+	RetryJob(ctx context.Context, id string) (Job, error)
+	// DiscardJob deletes a pending or dead job. It returns ErrConflict if the job is running.
+	DiscardJob(ctx context.Context, id string) error
+	// JobStats returns the number of jobs of each kind in each state.
+	JobStats(ctx context.Context) ([]JobStats, error)
+}
+
+// holdsUniqueKey reports whether job prevents other jobs of its kind with the same unique key.
+func (j Job) holdsUniqueKey() bool {
+	return j.UniqueKey != "" && (j.State == JobPending || j.State == JobRunning)
+}
+
+// claimable reports whether job can be claimed at now.
+func (j Job) claimable(now time.Time) bool {
+	switch j.State {
+	case JobPending:
+		return !j.RunAt.After(now)
+	case JobRunning:
+		return !j.LockedUntil.After(now)
+	}
+
+	return false
+}
+
+// newJob fills in the fields set when a job is enqueued.
+func newJob(job Job) Job {
+	now := time.Now().UTC()
+	job.ID = NewID()
+	job.State = JobPending
+	job.Attempts = 0
+	job.LastError = ""
+	job.LockedUntil = time.Time{}
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if job.RunAt.IsZero() {
+		job.RunAt = now
+	}
+	job.RunAt = job.RunAt.UTC()
+
+	return job
+}
+
+// compareJobs orders jobs by creation time then ID.
+func compareJobs(a, b Job) int {
+	return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+}
+
+// uniqueKeyTaken reports whether a job other than job holds its unique key.
+func (m *Memory) uniqueKeyTaken(job Job) bool {
+	if job.UniqueKey == "" {
+		return false
+	}
+
+	for _, other := range m.jobs {
+		if other.ID != job.ID && other.Kind == job.Kind && other.UniqueKey == job.UniqueKey && other.holdsUniqueKey() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnqueueJob stores a pending job. See JobStore.
+func (m *Memory) EnqueueJob(ctx context.Context, job Job) (Job, error) {
+	defer m.lock(ctx, true)()
+
+	job = newJob(job)
+	if m.uniqueKeyTaken(job) {
+		return Job{}, ErrConflict
+	}
+	m.jobs[job.ID] = job
+
+	return job, nil
+}
+
+// ClaimJobs claims due jobs. See JobStore.
+func (m *Memory) ClaimJobs(ctx context.Context, kinds []string, now, lockedUntil time.Time, limit int) ([]Job, error) {
+	defer m.lock(ctx, true)()
+
+	var due []Job
+	for _, job := range m.jobs {
+		if slices.Contains(kinds, job.Kind) && job.claimable(now) {
+			due = append(due, job)
+		}
+	}
+	slices.SortFunc(due, func(a, b Job) int {
+		return cmp.Or(a.RunAt.Compare(b.RunAt), strings.Compare(a.ID, b.ID))
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i, job := range due {
+		job.State = JobRunning
+		job.Attempts++
+		job.LockedUntil = lockedUntil.UTC()
+		job.UpdatedAt = time.Now().UTC()
+		m.jobs[job.ID] = job
+		due[i] = job
+	}
+
+	return due, nil
+}
+
+// CompleteJob deletes a succeeded job. See JobStore.
+func (m *Memory) CompleteJob(ctx context.Context, id string, attempt int) error {
+	defer m.lock(ctx, true)()
+
+	job, ok := m.jobs[id]
+	if !ok || job.State != JobRunning || job.Attempts != attempt {
+		return ErrConflict
+	}
+	delete(m.jobs, id)
+
+	return nil
+}
+
+// FailJob records a failed attempt. See JobStore.
+func (m *Memory) FailJob(ctx context.Context, id string, attempt int, lastError string, retryAt time.Time) error {
+	defer m.lock(ctx, true)()
+
+	job, ok := m.jobs[id]
+	if !ok || job.State != JobRunning || job.Attempts != attempt {
+		return ErrConflict
+	}
+
+	job.State = JobDead
+	if !retryAt.IsZero() {
+		job.State = JobPending
+		job.RunAt = retryAt.UTC()
+	}
+	job.LastError = lastError
+	job.LockedUntil = time.Time{}
+	job.UpdatedAt = time.Now().UTC()
+	m.jobs[id] = job
+
+	return nil
+}
+
+// GetJob returns a job. See JobStore.
+func (m *Memory) GetJob(ctx context.Context, id string) (Job, error) {
+	defer m.lock(ctx, false)()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+
+	return job, nil
+}
+
+// ListJobs lists jobs. See JobStore.
+func (m *Memory) ListJobs(ctx context.Context, q JobQuery) ([]Job, error) {
+	defer m.lock(ctx, false)()
+
+	after := Job{CreatedAt: q.AfterCreatedAt, ID: q.AfterID}
+	jobs := []Job{}
+	for _, job := range m.jobs {
+		if (q.Kind == "" || job.Kind == q.Kind) && (q.State == "" || job.State == q.State) &&
+			(q.AfterID == "" || compareJobs(job, after) > 0) {
+			jobs = append(jobs, job)
+		}
+	}
+	slices.SortFunc(jobs, compareJobs)
+	if q.Limit > 0 && len(jobs) > q.Limit {
+		jobs = jobs[:q.Limit]
+	}
+
+	return jobs, nil
+}
+
+// RetryJob makes a job due now. See JobStore.
+func (m *Memory) RetryJob(ctx context.Context, id string) (Job, error) {
+	defer m.lock(ctx, true)()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	if job.State == JobRunning {
+		return Job{}, ErrConflict
+	}
+
+	now := time.Now().UTC()
+	job.State = JobPending
+	job.Attempts = 0
+	job.RunAt = now
+	job.UpdatedAt = now
+	if m.uniqueKeyTaken(job) {
+		return Job{}, ErrConflict
+	}
+	m.jobs[id] = job
+
+	return job, nil
+}
+
+// DiscardJob deletes a job. See JobStore.
+func (m *Memory) DiscardJob(ctx context.Context, id string) error {
+	defer m.lock(ctx, true)()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if job.State == JobRunning {
+		return ErrConflict
+	}
+	delete(m.jobs, id)
+
+	return nil
+}
+
+// JobStats counts jobs. See JobStore.
+func (m *Memory) JobStats(ctx context.Context) ([]JobStats, error) {
+	defer m.lock(ctx, false)()
+
+	type group struct {
+		kind  string
+		state JobState
+	}
+	groups := map[group]JobStats{}
+	for _, job := range m.jobs {
+		g := group{kind: job.Kind, state: job.State}
+		stats, ok := groups[g]
+		if !ok || job.RunAt.Before(stats.OldestRunAt) {
+			stats.OldestRunAt = job.RunAt
+		}
+		stats.Kind, stats.State = job.Kind, job.State
+		stats.Count++
+		groups[g] = stats
+	}
+
+	return slices.Collect(maps.Values(groups)), nil
+}
+
+// jobColumns are the columns scanned by scanJob.
+const jobColumns = `id, kind, unique_key, state, args, attempts, max_attempts, last_error, run_at, locked_until, created_at, updated_at`
+
+// EnqueueJob stores a pending job. See JobStore.
+func (s *SQL) EnqueueJob(ctx context.Context, job Job) (Job, error) {
+	job = newJob(job)
+
+	// The unique index on pending and running jobs makes the insert a no-op if the key is taken
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`INSERT INTO jobs (id, kind, unique_key, state, args, attempts, max_attempts, run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 0, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`),
+		job.ID, job.Kind, nullString(job.UniqueKey), job.State, s.jobArgs(job.Args), job.MaxAttempts, job.RunAt,
+		job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return Job{}, err
+	}
+
+	err = expectAffected(result, ErrConflict)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+// ClaimJobs claims due jobs. See JobStore.
+func (s *SQL) ClaimJobs(ctx context.Context, kinds []string, now, lockedUntil time.Time, limit int) ([]Job, error) {
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	now = now.UTC()
+	args := []any{JobRunning, lockedUntil.UTC(), now}
+	for _, kind := range kinds {
+		args = append(args, kind)
+	}
+	args = append(args, JobPending, now, JobRunning, now, limit)
+
+	// Postgres skips rows locked by concurrent claims. SQLite has a single writer, so claims cannot overlap.
+	lock := ""
+	if s.dialect.skipLocked {
+		lock = ` FOR UPDATE SKIP LOCKED`
+	}
+
+	rows, err := s.Conn(ctx).QueryContext(ctx, s.Rebind(
+		`UPDATE jobs SET state = ?, attempts = attempts + 1, locked_until = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE kind IN (?`+strings.Repeat(", ?", len(kinds)-1)+`)
+				AND ((state = ? AND run_at <= ?) OR (state = ? AND locked_until <= ?))
+			ORDER BY run_at, id
+			LIMIT ?`+lock+`
+		)
+		RETURNING `+jobColumns),
+		args...)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not preserve the order of the subquery
+	slices.SortFunc(jobs, func(a, b Job) int {
+		return cmp.Or(a.RunAt.Compare(b.RunAt), strings.Compare(a.ID, b.ID))
+	})
+
+	return jobs, nil
+}
+
+// CompleteJob deletes a succeeded job. See JobStore.
+func (s *SQL) CompleteJob(ctx context.Context, id string, attempt int) error {
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`DELETE FROM jobs WHERE id = ? AND state = ? AND attempts = ?`), id, JobRunning, attempt)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrConflict)
+}
+
+// FailJob records a failed attempt. See JobStore.
+func (s *SQL) FailJob(ctx context.Context, id string, attempt int, lastError string, retryAt time.Time) error {
+	now := time.Now().UTC()
+	state, runAt := JobDead, sql.NullTime{}
+	if !retryAt.IsZero() {
+		state, runAt = JobPending, sql.NullTime{Time: retryAt.UTC(), Valid: true}
+	}
+
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`UPDATE jobs SET state = ?, run_at = COALESCE(?, run_at), last_error = ?, locked_until = NULL, updated_at = ?
+		WHERE id = ? AND state = ? AND attempts = ?`),
+		state, runAt, lastError, now, id, JobRunning, attempt)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrConflict)
+}
+
+// GetJob returns a job. See JobStore.
+func (s *SQL) GetJob(ctx context.Context, id string) (Job, error) {
+	rows, err := s.Conn(ctx).QueryContext(ctx, s.Rebind(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`), id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	jobs, err := scanJobs(rows)
+	if err != nil {
+		return Job{}, err
+	}
+	if len(jobs) == 0 {
+		return Job{}, ErrNotFound
+	}
+
+	return jobs[0], nil
+}
+
+// ListJobs lists jobs. See JobStore.
+func (s *SQL) ListJobs(ctx context.Context, q JobQuery) ([]Job, error) {
+	where := []string{"1 = 1"}
+	var args []any
+	if q.Kind != "" {
+		where = append(where, "kind = ?")
+		args = append(args, q.Kind)
+	}
+	if q.State != "" {
+		where = append(where, "state = ?")
+		args = append(args, q.State)
+	}
+	if q.AfterID != "" {
+		after := q.AfterCreatedAt.UTC()
+		where = append(where, "(created_at > ? OR (created_at = ? AND id > ?))")
+		args = append(args, after, after, q.AfterID)
+	}
+
+	query := `SELECT ` + jobColumns + ` FROM jobs WHERE ` + strings.Join(where, " AND ") + ` ORDER BY created_at, id`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.Conn(ctx).QueryContext(ctx, s.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanJobs(rows)
+}
+
+// RetryJob makes a job due now. See JobStore.
+func (s *SQL) RetryJob(ctx context.Context, id string) (Job, error) {
+	var job Job
+	err := s.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		job, err = s.GetJob(ctx, id)
+		if err != nil {
+			return err
+		}
+		if job.State == JobRunning {
+			return ErrConflict
+		}
+
+		if job.UniqueKey != "" {
+			var taken bool
+			err = s.Conn(ctx).QueryRowContext(ctx, s.Rebind(
+				`SELECT EXISTS (SELECT 1 FROM jobs WHERE kind = ? AND unique_key = ? AND state IN (?, ?) AND id <> ?)`),
+				job.Kind, job.UniqueKey, JobPending, JobRunning, id).Scan(&taken)
+			if err != nil {
+				return err
+			}
+			if taken {
+				return ErrConflict
+			}
+		}
+
+		now := time.Now().UTC()
+		job.State = JobPending
+		job.Attempts = 0
+		job.RunAt = now
+		job.UpdatedAt = now
+
+		result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+			`UPDATE jobs SET state = ?, attempts = 0, run_at = ?, updated_at = ? WHERE id = ? AND state <> ?`),
+			job.State, job.RunAt, job.UpdatedAt, id, JobRunning)
+		if err != nil {
+			return err
+		}
+
+		return expectAffected(result, ErrConflict)
+	})
+	if err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+// DiscardJob deletes a job. See JobStore.
+func (s *SQL) DiscardJob(ctx context.Context, id string) error {
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(`DELETE FROM jobs WHERE id = ? AND state <> ?`), id, JobRunning)
+	if err != nil {
+		return err
+	}
+
+	err = expectAffected(result, ErrNotFound)
+	if errors.Is(err, ErrNotFound) {
+		// Distinguish a missing job from a running one
+		_, getErr := s.GetJob(ctx, id)
+		if getErr == nil {
+			return ErrConflict
+		}
+	}
+
+	return err
+}
+
+// JobStats counts jobs. See JobStore.
+func (s *SQL) JobStats(ctx context.Context) ([]JobStats, error) {
+	rows, err := s.Conn(ctx).QueryContext(ctx,
+		`SELECT kind, state, COUNT(*), MIN(run_at) FROM jobs GROUP BY kind, state`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stats []JobStats
+	for rows.Next() {
+		var st JobStats
+		var oldest any
+		err = rows.Scan(&st.Kind, &st.State, &st.Count, &oldest)
+		if err != nil {
+			return nil, err
+		}
+		st.OldestRunAt, err = aggregateTime(oldest)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, st)
+	}
+
+	return stats, rows.Err()
+}
+
+// aggregateTime converts the result of an aggregate over a timestamp column, which SQLite returns as text.
+func aggregateTime(v any) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case string:
+		t, err := time.Parse("2006-01-02 15:04:05.999999999-07:00", v)
+		return t.UTC(), err
+	case []byte:
+		return aggregateTime(string(v))
+	}
+
+	return time.Time{}, fmt.Errorf("unexpected timestamp %T", v)
+}
+
+// jobArgs returns the value stored in the args column.
+func (s *SQL) jobArgs(args []byte) any {
+	if len(args) == 0 {
+		return nil
+	}
+
+	return string(args)
+}
+
+// scanJobs reads and closes rows of jobColumns.
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer func() { _ = rows.Close() }()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var (
+			job                 Job
+			uniqueKey, lastErr  sql.NullString
+			args                []byte
+			lockedUntil         sql.NullTime
+			runAt, created, upd time.Time
+		)
+		err := rows.Scan(&job.ID, &job.Kind, &uniqueKey, &job.State, &args, &job.Attempts, &job.MaxAttempts, &lastErr,
+			&runAt, &lockedUntil, &created, &upd)
+		if err != nil {
+			return nil, err
+		}
+
+		job.UniqueKey = uniqueKey.String
+		job.LastError = lastErr.String
+		job.Args = args
+		job.RunAt = runAt.UTC()
+		job.CreatedAt = created.UTC()
+		job.UpdatedAt = upd.UTC()
+		if lockedUntil.Valid {
+			job.LockedUntil = lockedUntil.Time.UTC()
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+// nullString stores empty strings as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJobStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			jobs, ok := s.(JobStore)
+			if !ok {
+				t.Fatal("store does not implement JobStore")
+			}
+			now := time.Now()
+
+			first, err := jobs.EnqueueJob(ctx, Job{Kind: "email", Args: []byte(`{"to":"a@example.com"}`), UniqueKey: "a", MaxAttempts: 3})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.ID == "" || first.State != JobPending || first.RunAt.IsZero() {
+				t.Errorf("unexpected enqueued job: %+v", first)
+			}
+
+			_, err = jobs.EnqueueJob(ctx, Job{Kind: "email", UniqueKey: "a"})
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error enqueueing a duplicate unique key: got %v want %v", err, ErrConflict)
+			}
+			_, err = jobs.EnqueueJob(ctx, Job{Kind: "report", UniqueKey: "a"})
+			if err != nil {
+				t.Errorf("unique keys should be scoped to the kind: %v", err)
+			}
+
+			delayed, err := jobs.EnqueueJob(ctx, Job{Kind: "email", RunAt: now.Add(time.Hour)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claimed, err := jobs.ClaimJobs(ctx, []string{"email"}, now.Add(time.Second), now.Add(time.Minute), 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(claimed) != 1 || claimed[0].ID != first.ID || claimed[0].State != JobRunning || claimed[0].Attempts != 1 ||
+				string(claimed[0].Args) != `{"to":"a@example.com"}` {
+				t.Fatalf("unexpected claimed jobs: %+v", claimed)
+			}
+
+			// A claimed job is not claimed again until its lock expires
+			claimed, err = jobs.ClaimJobs(ctx, []string{"email"}, now.Add(time.Second), now.Add(time.Minute), 10)
+			if err != nil || len(claimed) != 0 {
+				t.Errorf("unexpected second claim: %+v, %v", claimed, err)
+			}
+			_, err = jobs.RetryJob(ctx, first.ID)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error retrying a running job: got %v want %v", err, ErrConflict)
+			}
+			err = jobs.DiscardJob(ctx, first.ID)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error discarding a running job: got %v want %v", err, ErrConflict)
+			}
+
+			err = jobs.FailJob(ctx, first.ID, 1, "timeout", now.Add(2*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			job, err := jobs.GetJob(ctx, first.ID)
+			if err != nil || job.State != JobPending || job.LastError != "timeout" || !job.LockedUntil.IsZero() {
+				t.Errorf("unexpected failed job: %+v, %v", job, err)
+			}
+
+			// Expired locks are claimed by another worker, and the first worker can no longer settle the job
+			claimed, err = jobs.ClaimJobs(ctx, []string{"email"}, now.Add(3*time.Second), now.Add(4*time.Second), 10)
+			if err != nil || len(claimed) != 1 || claimed[0].Attempts != 2 {
+				t.Fatalf("unexpected retry claim: %+v, %v", claimed, err)
+			}
+			claimed, err = jobs.ClaimJobs(ctx, []string{"email"}, now.Add(5*time.Second), now.Add(time.Minute), 10)
+			if err != nil || len(claimed) != 1 || claimed[0].Attempts != 3 {
+				t.Fatalf("unexpected claim of an expired lock: %+v, %v", claimed, err)
+			}
+			err = jobs.CompleteJob(ctx, first.ID, 2)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error completing a reclaimed job: got %v want %v", err, ErrConflict)
+			}
+
+			err = jobs.FailJob(ctx, first.ID, 3, "bounced", time.Time{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			dead, err := jobs.ListJobs(ctx, JobQuery{State: JobDead})
+			if err != nil || len(dead) != 1 || dead[0].ID != first.ID || dead[0].LastError != "bounced" {
+				t.Errorf("unexpected dead jobs: %+v, %v", dead, err)
+			}
+
+			// Dead jobs release their unique key
+			duplicate, err := jobs.EnqueueJob(ctx, Job{Kind: "email", UniqueKey: "a"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jobs.RetryJob(ctx, first.ID)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error retrying a job whose unique key is taken: got %v want %v", err, ErrConflict)
+			}
+			err = jobs.DiscardJob(ctx, duplicate.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			retried, err := jobs.RetryJob(ctx, first.ID)
+			if err != nil || retried.State != JobPending || retried.Attempts != 0 {
+				t.Errorf("unexpected retried job: %+v, %v", retried, err)
+			}
+
+			claimed, err = jobs.ClaimJobs(ctx, []string{"email"}, time.Now().Add(time.Second), now.Add(time.Minute), 10)
+			if err != nil || len(claimed) != 1 {
+				t.Fatalf("unexpected claim of a retried job: %+v, %v", claimed, err)
+			}
+			err = jobs.CompleteJob(ctx, first.ID, claimed[0].Attempts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = jobs.GetJob(ctx, first.ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unexpected error getting a completed job: got %v want %v", err, ErrNotFound)
+			}
+
+			stats, err := jobs.JobStats(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counts := map[string]int64{}
+			for _, st := range stats {
+				counts[st.Kind+"/"+string(st.State)] = st.Count
+				if st.Kind == "email" && !st.OldestRunAt.Equal(delayed.RunAt) {
+					t.Errorf("unexpected oldest run at: got %v want %v", st.OldestRunAt, delayed.RunAt)
+				}
+			}
+			if len(counts) != 2 || counts["email/pending"] != 1 || counts["report/pending"] != 1 {
+				t.Errorf("unexpected job stats: %v", counts)
+			}
+
+			err = jobs.DiscardJob(ctx, "missing")
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unexpected error discarding a missing job: got %v want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestJobStoreList(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			jobs := s.(JobStore)
+
+			var ids []string
+			for _, kind := range []string{"a", "b", "a", "a"} {
+				job, err := jobs.EnqueueJob(ctx, Job{Kind: kind})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, job.ID)
+			}
+
+			page, err := jobs.ListJobs(ctx, JobQuery{Kind: "a", Limit: 2})
+			if err != nil || len(page) != 2 || page[0].ID != ids[0] || page[1].ID != ids[2] {
+				t.Fatalf("unexpected first page: %+v, %v", page, err)
+			}
+
+			last := page[1]
+			page, err = jobs.ListJobs(ctx, JobQuery{Kind: "a", Limit: 2, AfterCreatedAt: last.CreatedAt, AfterID: last.ID})
+			if err != nil || len(page) != 1 || page[0].ID != ids[3] {
+				t.Errorf("unexpected second page: %+v, %v", page, err)
+			}
+		})
+	}
+}
+
+func TestJobStoreConcurrentClaims(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			jobs := s.(JobStore)
+
+			for range 20 {
+				_, err := jobs.EnqueueJob(ctx, Job{Kind: "work"})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var (
+				wg      sync.WaitGroup
+				mu      sync.Mutex
+				claimed = map[string]int{}
+			)
+			for range 4 {
+				wg.Go(func() {
+					for {
+						now := time.Now()
+						batch, err := jobs.ClaimJobs(ctx, []string{"work"}, now, now.Add(time.Minute), 3)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if len(batch) == 0 {
+							return
+						}
+
+						mu.Lock()
+						for _, job := range batch {
+							claimed[job.ID]++
+						}
+						mu.Unlock()
+					}
+				})
+			}
+			wg.Wait()
+
+			if len(claimed) != 20 {
+				t.Errorf("unexpected number of claimed jobs: got %d want 20", len(claimed))
+			}
+			for id, n := range claimed {
+				if n != 1 {
+					t.Errorf("job %s was claimed %d times", id, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package store
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory Store intended for tests and local development. Data is lost when the process exits.
+type Memory struct {
+	collections     map[string]map[string]Record
+	idempotencyKeys map[string]idempotencyKey
+	jobs            map[string]Job
+	outbox          map[string]OutboxEvent
+	mu              sync.RWMutex
+}
+
+type memoryTxKey struct{}
+
+type memoryRepository struct {
+	store      *Memory
+	collection string
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{collections: map[string]map[string]Record{}, idempotencyKeys: map[string]idempotencyKey{}, jobs: map[string]Job{},
+		outbox: map[string]OutboxEvent{}}
+}
+
+// Repository returns the repository for a collection.
+func (m *Memory) Repository(collection string) Repository {
+	return &memoryRepository{store: m, collection: collection}
+}
+
+// WithTx runs fn with exclusive access to the store, restoring a snapshot of the collections and the outbox if
+// fn returns an error.
+func (m *Memory) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if m.inTx(ctx) {
+		return fn(ctx)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := make(map[string]map[string]Record, len(m.collections))
+	for name, records := range m.collections {
+		snapshot[name] = maps.Clone(records)
+	}
+	outbox := maps.Clone(m.outbox)
+
+	err := fn(context.WithValue(ctx, memoryTxKey{}, m))
+	if err != nil {
+		m.collections = snapshot
+		m.outbox = outbox
+	}
+
+	return err
+}
+
+// Ping always succeeds.
+func (m *Memory) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+// Close is a no-op.
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) inTx(ctx context.Context) bool {
+	tx, _ := ctx.Value(memoryTxKey{}).(*Memory)
+	return tx == m
+}
+
+// lock acquires the store lock unless ctx belongs to a transaction that already holds it.
+func (m *Memory) lock(ctx context.Context, write bool) func() {
+	if m.inTx(ctx) {
+		return func() {}
+	}
+
+	if write {
+		m.mu.Lock()
+		return m.mu.Unlock
+	}
+
+	m.mu.RLock()
+	return m.mu.RUnlock
+}
+
+func (r *memoryRepository) Get(ctx context.Context, id string) (Record, error) {
+	defer r.store.lock(ctx, false)()
+
+	record, ok := r.store.collections[r.collection][id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+
+	return record, nil
+}
+
+func (r *memoryRepository) List(ctx context.Context, q Query) ([]Record, error) {
+	err := q.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.store.lock(ctx, false)()
+
+	sorts := q.sortFields()
+	type entry struct {
+		key    []any
+		record Record
+	}
+
+	var entries []entry
+	for _, record := range r.store.collections[r.collection] {
+		data, err := decodeData(record)
+		if err != nil {
+			return nil, err
+		}
+
+		matches := true
+		for _, f := range q.Filters {
+			if !f.matches(fieldValue(record, data, f.Field)) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			entries = append(entries, entry{record: record, key: sortKey(record, data, sorts)})
+		}
+	}
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		return compareKeys(sorts, a.key, b.key)
+	})
+
+	records := []Record{}
+	for _, e := range entries {
+		if q.After != nil && compareKeys(sorts, e.key, q.After) <= 0 {
+			continue
+		}
+		if q.Limit > 0 && len(records) == q.Limit {
+			break
+		}
+		records = append(records, e.record)
+	}
+
+	return records, nil
+}
+
+func (r *memoryRepository) Create(ctx context.Context, record Record) (Record, error) {
+	defer r.store.lock(ctx, true)()
+
+	if record.ID == "" {
+		record.ID = NewID()
+	}
+
+	records, ok := r.store.collections[r.collection]
+	if !ok {
+		records = map[string]Record{}
+		r.store.collections[r.collection] = records
+	}
+
+	if _, exists := records[record.ID]; exists {
+		return Record{}, ErrConflict
+	}
+
+	now := time.Now().UTC()
+	record.Version = 1
+	record.CreatedAt = now
+	record.UpdatedAt = now
+	records[record.ID] = record
+
+	return record, nil
+}
+
+func (r *memoryRepository) Update(ctx context.Context, record Record) (Record, error) {
+	defer r.store.lock(ctx, true)()
+
+	current, ok := r.store.collections[r.collection][record.ID]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+
+	if record.Version != 0 && record.Version != current.Version {
+		return Record{}, ErrConflict
+	}
+
+	current.Data = record.Data
+	current.Version++
+	current.UpdatedAt = time.Now().UTC()
+	r.store.collections[r.collection][record.ID] = current
+
+	return current, nil
+}
+
+func (r *memoryRepository) Delete(ctx context.Context, id string, version int64) error {
+	defer r.store.lock(ctx, true)()
+
+	current, ok := r.store.collections[r.collection][id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if version != 0 && version != current.Version {
+		return ErrConflict
+	}
+
+	delete(r.store.collections[r.collection], id)
+
+	return nil
+}
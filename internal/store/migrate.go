@@ -0,0 +1,457 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockID identifies the Postgres advisory lock held while migrating, so only one replica migrates at a time.
+const migrationLockID = 7305648142637391872
+
+// noTransactionDirective at the start of a migration runs it outside of a transaction, which is required
+// by statements such as CREATE INDEX CONCURRENTLY. A failure leaves the database marked dirty.
+const noTransactionDirective = "-- migrate:no-transaction"
+
+// Dialects lists the databases that have migrations, which are stored in a directory of the same name.
+var Dialects = []string{"sqlite", "postgres"}
+
+// ErrDirty is returned when a previous migration failed part way through. Fix the schema by hand,
+// then mark the version that is in effect with ForceVersion.
+var ErrDirty = errors.New("database is dirty")
+
+// ErrNotMigrated is returned by CheckMigrated when migrations are pending.
+var ErrNotMigrated = errors.New("database is not migrated")
+
+//go:embed migrations
+var migrations embed.FS
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a versioned schema change.
+type Migration struct {
+	Name string
+	Up   string
+	Down string
+	// Version orders migrations. Versions are applied in ascending order.
+	Version int64
+}
+
+// MigrationStatus describes whether a migration has been applied.
+type MigrationStatus struct {
+	AppliedAt time.Time
+	Migration
+	Applied bool
+	// Dirty is set when the migration failed part way through.
+	Dirty bool
+}
+
+// Migrator is implemented by stores with a versioned schema.
+type Migrator interface {
+	// MigrateUp applies up to steps pending migrations, or all of them if steps is zero.
+	MigrateUp(ctx context.Context, steps int) ([]Migration, error)
+	// MigrateDown reverts up to steps applied migrations, or all of them if steps is zero.
+	MigrateDown(ctx context.Context, steps int) ([]Migration, error)
+	// MigrationStatus returns every known and applied migration in version order.
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+	// ForceVersion marks the migrations up to and including version as applied and clears the dirty state
+	// without running them. A version of zero marks every migration as pending.
+	ForceVersion(ctx context.Context, version int64) error
+}
+
+// CheckMigrated returns ErrNotMigrated if st has a versioned schema with pending migrations.
+func CheckMigrated(ctx context.Context, st Store) error {
+	migrator, ok := st.(Migrator)
+	if !ok {
+		return nil
+	}
+
+	statuses, err := migrator.MigrationStatus(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		if !status.Applied {
+			return fmt.Errorf("%w, migration %d %s is pending", ErrNotMigrated, status.Version, status.Name)
+		}
+	}
+
+	return nil
+}
+
+// Migrations returns the migrations embedded for the store's dialect.
+func (s *SQL) Migrations() ([]Migration, error) {
+	return loadMigrations(migrations, path.Join("migrations", s.dialect.name))
+}
+
+// MigrateUp applies up to steps pending migrations, or all of them if steps is zero.
+func (s *SQL) MigrateUp(ctx context.Context, steps int) ([]Migration, error) {
+	var applied []Migration
+	err := s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		statuses, err := s.migrationStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Dirty {
+				return fmt.Errorf("%w at version %d", ErrDirty, status.Version)
+			}
+		}
+
+		for _, status := range statuses {
+			if status.Applied {
+				continue
+			}
+			if steps > 0 && len(applied) == steps {
+				break
+			}
+
+			err = s.runMigration(ctx, conn, status.Migration, true)
+			if err != nil {
+				return err
+			}
+			applied = append(applied, status.Migration)
+		}
+
+		return nil
+	})
+
+	return applied, err
+}
+
+// MigrateDown reverts up to steps applied migrations, or all of them if steps is zero.
+func (s *SQL) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		statuses, err := s.migrationStatus(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, status := range statuses {
+			if status.Dirty {
+				return fmt.Errorf("%w at version %d", ErrDirty, status.Version)
+			}
+		}
+
+		for _, status := range slices.Backward(statuses) {
+			if !status.Applied {
+				continue
+			}
+			if steps > 0 && len(reverted) == steps {
+				break
+			}
+			if status.Down == "" {
+				return fmt.Errorf("migration %d_%s has no down migration", status.Version, status.Name)
+			}
+
+			err = s.runMigration(ctx, conn, status.Migration, false)
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, status.Migration)
+		}
+
+		return nil
+	})
+
+	return reverted, err
+}
+
+// MigrationStatus returns every known and applied migration in version order.
+func (s *SQL) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		var err error
+		statuses, err = s.migrationStatus(ctx, conn)
+		return err
+	})
+
+	return statuses, err
+}
+
+// ForceVersion marks the migrations up to and including version as applied and clears the dirty state
+// without running them. A version of zero marks every migration as pending.
+func (s *SQL) ForceVersion(ctx context.Context, version int64) error {
+	all, err := s.Migrations()
+	if err != nil {
+		return err
+	}
+
+	if version != 0 && !slices.ContainsFunc(all, func(m Migration) bool { return m.Version == version }) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return s.withMigrationLock(ctx, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM schema_migrations`)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+		for _, m := range all {
+			if m.Version > version {
+				break
+			}
+			_, err = tx.ExecContext(ctx, s.Rebind(`INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)`),
+				m.Version, m.Name, false, now)
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+}
+
+// withMigrationLock runs fn on a dedicated connection while holding the migration lock.
+// SQLite has a single writer, so only Postgres takes an advisory lock.
+func (s *SQL) withMigrationLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if s.dialect.numbered {
+		_, err = conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, int64(migrationLockID))
+		if err != nil {
+			return fmt.Errorf("acquiring migration lock: %w", err)
+		}
+		// Unlock even if ctx was cancelled, otherwise the lock is held until the connection closes
+		defer func() {
+			_, _ = conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, int64(migrationLockID))
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		dirty BOOLEAN NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations table: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func (s *SQL) migrationStatus(ctx context.Context, conn *sql.Conn) ([]MigrationStatus, error) {
+	all, err := s.Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[int64]MigrationStatus, len(all))
+	for _, m := range all {
+		statuses[m.Version] = MigrationStatus{Migration: m}
+	}
+
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, dirty, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var version int64
+		var name string
+		var dirty bool
+		var appliedAt time.Time
+
+		err = rows.Scan(&version, &name, &dirty, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// Applied migrations that no longer exist are still reported
+		status, ok := statuses[version]
+		if !ok {
+			status.Migration = Migration{Version: version, Name: name}
+		}
+		status.Applied = true
+		status.Dirty = dirty
+		status.AppliedAt = appliedAt.UTC()
+		statuses[version] = status
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]MigrationStatus, 0, len(statuses))
+	for _, status := range statuses {
+		sorted = append(sorted, status)
+	}
+	slices.SortFunc(sorted, func(a, b MigrationStatus) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return sorted, nil
+}
+
+// runMigration applies or reverts a migration and records the result in schema_migrations.
+func (s *SQL) runMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	script, record := m.Down, s.Rebind(`DELETE FROM schema_migrations WHERE version = ?`)
+	args := []any{m.Version}
+	if up {
+		script, record = m.Up, s.Rebind(`INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)`)
+		args = []any{m.Version, m.Name, false, time.Now().UTC()}
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(script), noTransactionDirective) {
+		// Mark the database dirty first so a failure part way through is detected
+		_, err := conn.ExecContext(ctx, s.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+		if err == nil {
+			_, err = conn.ExecContext(ctx, s.Rebind(`INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (?, ?, ?, ?)`),
+				m.Version, m.Name, true, time.Now().UTC())
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.ExecContext(ctx, script)
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+
+		_, err = conn.ExecContext(ctx, s.Rebind(`DELETE FROM schema_migrations WHERE version = ?`), m.Version)
+		if err == nil {
+			_, err = conn.ExecContext(ctx, record, args...)
+		}
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, script)
+	if err != nil {
+		return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadMigrations reads the NNNN_name.up.sql and NNNN_name.down.sql files in dir.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		script, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(script)
+		} else {
+			m.Down = string(script)
+		}
+	}
+
+	all := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up migration", m.Version, m.Name)
+		}
+		all = append(all, *m)
+	}
+	slices.SortFunc(all, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return all, nil
+}
+
+// CreateMigration writes empty up and down migration files for every dialect into dir, numbered
+// after the highest existing version. It returns the paths of the created files.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migration name must contain letters or digits")
+	}
+
+	var version int64
+	for _, dialect := range Dialects {
+		existing, err := loadMigrations(os.DirFS(dir), dialect)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		for _, m := range existing {
+			version = max(version, m.Version)
+		}
+	}
+	version++
+
+	var files []string
+	for _, dialect := range Dialects {
+		err := os.MkdirAll(filepath.Join(dir, dialect), 0o750)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, direction := range []string{"up", "down"} {
+			file := filepath.Join(dir, dialect, fmt.Sprintf("%04d_%s.%s.sql", version, name, direction))
+			err = os.WriteFile(file, []byte("-- "+direction+" migration for "+dialect+"\n"), 0o600)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
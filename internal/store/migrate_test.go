@@ -0,0 +1,229 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// testMigrators returns every SQL store available in the test environment with an empty schema.
+func testMigrators(t *testing.T) map[string]*SQL {
+	t.Helper()
+
+	sqlite, err := OpenSQLite(context.Background(), filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := map[string]*SQL{"sqlite": sqlite}
+	if postgres := testPostgres(t); postgres != nil {
+		stores["postgres"] = postgres
+	}
+
+	for _, s := range stores {
+		t.Cleanup(func() { _ = s.Close() })
+	}
+
+	return stores
+}
+
+func TestMigrate(t *testing.T) {
+	for name, s := range testMigrators(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			all, err := s.Migrations()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) == 0 {
+				t.Fatal("no migrations embedded")
+			}
+
+			applied, err := s.MigrateUp(ctx, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(applied) != len(all) {
+				t.Errorf("unexpected number of applied migrations: got %d want %d", len(applied), len(all))
+			}
+
+			// Migrating again is a no-op
+			applied, err = s.MigrateUp(ctx, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(applied) != 0 {
+				t.Errorf("unexpected number of applied migrations on second run: got %d want %d", len(applied), 0)
+			}
+
+			statuses, err := s.MigrationStatus(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, status := range statuses {
+				if !status.Applied || status.Dirty || status.AppliedAt.IsZero() {
+					t.Errorf("unexpected status for migration %d: %+v", status.Version, status)
+				}
+			}
+
+			_, err = s.Repository("items").Create(ctx, Record{Data: []byte(`{}`)})
+			if err != nil {
+				t.Errorf("unexpected error using migrated schema: %v", err)
+			}
+
+			reverted, err := s.MigrateDown(ctx, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reverted) != len(all) {
+				t.Errorf("unexpected number of reverted migrations: got %d want %d", len(reverted), len(all))
+			}
+
+			_, err = s.Repository("items").List(ctx, Query{})
+			if err == nil {
+				t.Error("records table exists after reverting all migrations")
+			}
+
+			// Forcing a version records it as applied without running it
+			err = s.ForceVersion(ctx, all[0].Version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			statuses, err = s.MigrationStatus(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !statuses[0].Applied {
+				t.Errorf("forced migration %d is not applied", all[0].Version)
+			}
+
+			err = s.ForceVersion(ctx, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = s.ForceVersion(ctx, 99999)
+			if err == nil {
+				t.Error("expected error forcing an unknown version")
+			}
+		})
+	}
+}
+
+func TestMigrateDirty(t *testing.T) {
+	s := testMigrators(t)["sqlite"]
+	ctx := context.Background()
+
+	_, err := s.MigrationStatus(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.DB().Exec(`INSERT INTO schema_migrations (version, name, dirty, applied_at) VALUES (1, 'create_records', true, CURRENT_TIMESTAMP)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.MigrateUp(ctx, 0)
+	if !errors.Is(err, ErrDirty) {
+		t.Errorf("unexpected error migrating a dirty database: got %v want %v", err, ErrDirty)
+	}
+
+	err = s.ForceVersion(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.MigrateUp(ctx, 0)
+	if err != nil {
+		t.Errorf("unexpected error after forcing version: %v", err)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	tests := []struct {
+		files       fstest.MapFS
+		name        string
+		expected    []int64
+		expectError bool
+	}{
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"m/0010_add_index.up.sql":      {Data: []byte("CREATE INDEX")},
+				"m/0002_create_table.up.sql":   {Data: []byte("CREATE TABLE")},
+				"m/0002_create_table.down.sql": {Data: []byte("DROP TABLE")},
+				"m/README.md":                  {Data: []byte("ignored")},
+			},
+			expected: []int64{2, 10},
+		},
+		{
+			name: "missing up migration",
+			files: fstest.MapFS{
+				"m/0001_create_table.down.sql": {Data: []byte("DROP TABLE")},
+			},
+			expectError: true,
+		},
+		{
+			name: "duplicate version",
+			files: fstest.MapFS{
+				"m/0001_create_table.up.sql": {Data: []byte("CREATE TABLE")},
+				"m/0001_create_index.up.sql": {Data: []byte("CREATE INDEX")},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all, err := loadMigrations(tt.files, "m")
+			if (err != nil) != tt.expectError {
+				t.Fatalf("unexpected error: got %v, expectError %t", err, tt.expectError)
+			}
+
+			if len(all) != len(tt.expected) {
+				t.Fatalf("unexpected number of migrations: got %d want %d", len(all), len(tt.expected))
+			}
+			for i, m := range all {
+				if m.Version != tt.expected[i] {
+					t.Errorf("unexpected version at %d: got %d want %d", i, m.Version, tt.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+
+	files, err := CreateMigration(dir, "Add Users Table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2*len(Dialects) {
+		t.Fatalf("unexpected number of files: got %d want %d", len(files), 2*len(Dialects))
+	}
+
+	expected := filepath.Join(dir, "sqlite", "0001_add_users_table.up.sql")
+	if files[0] != expected {
+		t.Errorf("unexpected file: got %s want %s", files[0], expected)
+	}
+
+	files, err = CreateMigration(dir, "second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(filepath.Join(dir, "postgres", "0002_second.down.sql"))
+	if err != nil {
+		t.Errorf("second migration was not numbered after the first: %v", files)
+	}
+
+	_, err = CreateMigration(dir, "!!!")
+	if err == nil {
+		t.Error("expected error for an invalid name")
+	}
+}
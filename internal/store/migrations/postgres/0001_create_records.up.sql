@@ -0,0 +1,11 @@
+CREATE TABLE records (
+	collection TEXT NOT NULL,
+	id TEXT NOT NULL,
+	data JSONB NOT NULL,
+	version BIGINT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (collection, id)
+);
+
+CREATE INDEX records_created_at ON records (collection, created_at, id);
@@ -0,0 +1,18 @@
+CREATE TABLE jobs (
+	id TEXT PRIMARY KEY,
+	kind TEXT NOT NULL,
+	unique_key TEXT,
+	state TEXT NOT NULL,
+	args JSONB,
+	attempts INTEGER NOT NULL,
+	max_attempts INTEGER NOT NULL,
+	last_error TEXT,
+	run_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX jobs_claim ON jobs (state, run_at);
+CREATE INDEX jobs_created_at ON jobs (created_at, id);
+CREATE UNIQUE INDEX jobs_unique_key ON jobs (kind, unique_key) WHERE state IN ('pending', 'running');
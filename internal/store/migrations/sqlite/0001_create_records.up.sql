@@ -0,0 +1,11 @@
+CREATE TABLE records (
+	collection TEXT NOT NULL,
+	id TEXT NOT NULL,
+	data TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	updated_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (collection, id)
+);
+
+CREATE INDEX records_created_at ON records (collection, created_at, id);
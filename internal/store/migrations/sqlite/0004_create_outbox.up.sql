@@ -0,0 +1,14 @@
+CREATE TABLE outbox (
+	id TEXT PRIMARY KEY,
+	type TEXT NOT NULL,
+	data TEXT NOT NULL,
+	handled TEXT,
+	attempts INTEGER NOT NULL,
+	last_error TEXT,
+	available_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX outbox_claim ON outbox (available_at);
+CREATE INDEX outbox_created_at ON outbox (created_at, id);
@@ -0,0 +1,301 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+)
+
+// OutboxEvent is an event kept in the transactional outbox until it has been relayed to its subscribers.
+type OutboxEvent struct {
+	CreatedAt time.Time
+	// AvailableAt is when the event may be claimed. It is pushed back after a failed attempt.
+	AvailableAt time.Time
+	// LockedUntil is when the claim of a relay expires and another relay may claim the event.
+	LockedUntil time.Time
+	ID          string
+	Type        string
+	LastError   string
+	Data        []byte
+	// Handled lists the subscribers that have handled the event, so retries skip them.
+	Handled []string
+	// Attempts counts the times the event has been claimed.
+	Attempts int
+}
+
+// OutboxStats summarizes the events waiting in the outbox.
+type OutboxStats struct {
+	// OldestCreatedAt is the earliest CreatedAt of the events.
+	OldestCreatedAt time.Time
+	Count           int64
+}
+
+/*
+OutboxStore persists a transactional outbox. Events are added in the transaction of the change they describe,
+so they are stored if and only if the change is, and relayed afterwards. Stores that support it implement
+the interface:
+
+	if s, ok := server.Store.(store.OutboxStore); ok {
+		...
+	}
+*/
+type OutboxStore interface {
+	// AddOutboxEvent stores an event, generating its ID. It joins the transaction in ctx, see Store.WithTx.
+	AddOutboxEvent(ctx context.Context, event OutboxEvent) (OutboxEvent, error)
+	// ClaimOutboxEvents locks up to limit events until lockedUntil and returns them with their attempts
+	// incremented. Events available by now whose lock is not held are claimed, oldest first. Concurrent calls
+	// never claim the same event.
+	ClaimOutboxEvents(ctx context.Context, now, lockedUntil time.Time, limit int) ([]OutboxEvent, error)
+	// DeleteOutboxEvent deletes an event relayed on the given attempt. It returns ErrConflict if the event has
+	// been claimed again since.
+	DeleteOutboxEvent(ctx context.Context, id string, attempt int) error
+	// RetryOutboxEvent records the subscribers that have handled an event and the error of the failed attempt,
+	// then releases the event until retryAt. It returns ErrConflict if the event has been claimed again since.
+	RetryOutboxEvent(ctx context.Context, id string, attempt int, handled []string, lastError string, retryAt time.Time) error
+	// OutboxStats returns the number of events in the outbox.
+	OutboxStats(ctx context.Context) (OutboxStats, error)
+}
+
+// claimable reports whether event can be claimed at now.
+func (e OutboxEvent) claimable(now time.Time) bool {
+	return !e.AvailableAt.After(now) && !e.LockedUntil.After(now)
+}
+
+// compareOutboxEvents orders events by creation time then ID.
+func compareOutboxEvents(a, b OutboxEvent) int {
+	return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+}
+
+// AddOutboxEvent stores an event. See OutboxStore.
+func (m *Memory) AddOutboxEvent(ctx context.Context, event OutboxEvent) (OutboxEvent, error) {
+	defer m.lock(ctx, true)()
+
+	event = newOutboxEvent(event)
+	m.outbox[event.ID] = event
+
+	return event, nil
+}
+
+// ClaimOutboxEvents claims available events. See OutboxStore.
+func (m *Memory) ClaimOutboxEvents(ctx context.Context, now, lockedUntil time.Time, limit int) ([]OutboxEvent, error) {
+	defer m.lock(ctx, true)()
+
+	var available []OutboxEvent
+	for _, event := range m.outbox {
+		if event.claimable(now) {
+			available = append(available, event)
+		}
+	}
+	slices.SortFunc(available, compareOutboxEvents)
+	if len(available) > limit {
+		available = available[:limit]
+	}
+
+	for i, event := range available {
+		event.Attempts++
+		event.LockedUntil = lockedUntil.UTC()
+		m.outbox[event.ID] = event
+		available[i] = event
+	}
+
+	return available, nil
+}
+
+// DeleteOutboxEvent deletes a relayed event. See OutboxStore.
+func (m *Memory) DeleteOutboxEvent(ctx context.Context, id string, attempt int) error {
+	defer m.lock(ctx, true)()
+
+	event, ok := m.outbox[id]
+	if !ok || event.Attempts != attempt {
+		return ErrConflict
+	}
+	delete(m.outbox, id)
+
+	return nil
+}
+
+// RetryOutboxEvent releases an event until retryAt. See OutboxStore.
+func (m *Memory) RetryOutboxEvent(ctx context.Context, id string, attempt int, handled []string, lastError string, retryAt time.Time) error {
+	defer m.lock(ctx, true)()
+
+	event, ok := m.outbox[id]
+	if !ok || event.Attempts != attempt {
+		return ErrConflict
+	}
+
+	event.Handled = slices.Clone(handled)
+	event.LastError = lastError
+	event.AvailableAt = retryAt.UTC()
+	event.LockedUntil = time.Time{}
+	m.outbox[id] = event
+
+	return nil
+}
+
+// OutboxStats counts the events in the outbox. See OutboxStore.
+func (m *Memory) OutboxStats(ctx context.Context) (OutboxStats, error) {
+	defer m.lock(ctx, false)()
+
+	var stats OutboxStats
+	for _, event := range m.outbox {
+		if stats.Count == 0 || event.CreatedAt.Before(stats.OldestCreatedAt) {
+			stats.OldestCreatedAt = event.CreatedAt
+		}
+		stats.Count++
+	}
+
+	return stats, nil
+}
+
+// outboxColumns are the columns scanned by scanOutboxEvents.
+const outboxColumns = `id, type, data, handled, attempts, last_error, available_at, locked_until, created_at`
+
+// AddOutboxEvent stores an event. See OutboxStore.
+func (s *SQL) AddOutboxEvent(ctx context.Context, event OutboxEvent) (OutboxEvent, error) {
+	event = newOutboxEvent(event)
+
+	_, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`INSERT INTO outbox (id, type, data, attempts, available_at, created_at) VALUES (?, ?, ?, 0, ?, ?)`),
+		event.ID, event.Type, string(event.Data), event.AvailableAt, event.CreatedAt)
+	if err != nil {
+		return OutboxEvent{}, err
+	}
+
+	return event, nil
+}
+
+// ClaimOutboxEvents claims available events. See OutboxStore.
+func (s *SQL) ClaimOutboxEvents(ctx context.Context, now, lockedUntil time.Time, limit int) ([]OutboxEvent, error) {
+	now = now.UTC()
+
+	// Postgres skips rows locked by concurrent claims. SQLite has a single writer, so claims cannot overlap.
+	lock := ""
+	if s.dialect.skipLocked {
+		lock = ` FOR UPDATE SKIP LOCKED`
+	}
+
+	rows, err := s.Conn(ctx).QueryContext(ctx, s.Rebind(
+		`UPDATE outbox SET attempts = attempts + 1, locked_until = ?
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE available_at <= ? AND (locked_until IS NULL OR locked_until <= ?)
+			ORDER BY created_at, id
+			LIMIT ?`+lock+`
+		)
+		RETURNING `+outboxColumns),
+		lockedUntil.UTC(), now, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := scanOutboxEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING does not preserve the order of the subquery
+	slices.SortFunc(events, compareOutboxEvents)
+
+	return events, nil
+}
+
+// DeleteOutboxEvent deletes a relayed event. See OutboxStore.
+func (s *SQL) DeleteOutboxEvent(ctx context.Context, id string, attempt int) error {
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`DELETE FROM outbox WHERE id = ? AND attempts = ?`), id, attempt)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrConflict)
+}
+
+// RetryOutboxEvent releases an event until retryAt. See OutboxStore.
+func (s *SQL) RetryOutboxEvent(ctx context.Context, id string, attempt int, handled []string, lastError string, retryAt time.Time) error {
+	var handledJSON any
+	if len(handled) > 0 {
+		data, err := json.Marshal(handled)
+		if err != nil {
+			return err
+		}
+		handledJSON = string(data)
+	}
+
+	result, err := s.Conn(ctx).ExecContext(ctx, s.Rebind(
+		`UPDATE outbox SET handled = ?, last_error = ?, available_at = ?, locked_until = NULL
+		WHERE id = ? AND attempts = ?`),
+		handledJSON, lastError, retryAt.UTC(), id, attempt)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result, ErrConflict)
+}
+
+// OutboxStats counts the events in the outbox. See OutboxStore.
+func (s *SQL) OutboxStats(ctx context.Context) (OutboxStats, error) {
+	var stats OutboxStats
+	var oldest any
+	err := s.Conn(ctx).QueryRowContext(ctx, `SELECT COUNT(*), MIN(created_at) FROM outbox`).Scan(&stats.Count, &oldest)
+	if err != nil || stats.Count == 0 {
+		return stats, err
+	}
+
+	stats.OldestCreatedAt, err = aggregateTime(oldest)
+	return stats, err
+}
+
+// newOutboxEvent fills in the fields set when an event is added to the outbox.
+func newOutboxEvent(event OutboxEvent) OutboxEvent {
+	now := time.Now().UTC()
+	event.ID = NewID()
+	event.Handled = nil
+	event.Attempts = 0
+	event.LastError = ""
+	event.LockedUntil = time.Time{}
+	event.CreatedAt = now
+	event.AvailableAt = now
+
+	return event
+}
+
+// scanOutboxEvents reads and closes rows of outboxColumns.
+func scanOutboxEvents(rows *sql.Rows) ([]OutboxEvent, error) {
+	defer func() { _ = rows.Close() }()
+
+	events := []OutboxEvent{}
+	for rows.Next() {
+		var (
+			event              OutboxEvent
+			data, handled      []byte
+			lastErr            sql.NullString
+			lockedUntil        sql.NullTime
+			available, created time.Time
+		)
+		err := rows.Scan(&event.ID, &event.Type, &data, &handled, &event.Attempts, &lastErr, &available, &lockedUntil, &created)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(handled) > 0 {
+			err = json.Unmarshal(handled, &event.Handled)
+			if err != nil {
+				return nil, err
+			}
+		}
+		event.Data = data
+		event.LastError = lastErr.String
+		event.AvailableAt = available.UTC()
+		event.CreatedAt = created.UTC()
+		if lockedUntil.Valid {
+			event.LockedUntil = lockedUntil.Time.UTC()
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
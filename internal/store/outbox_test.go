@@ -0,0 +1,123 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestOutboxStore(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			outbox, ok := s.(OutboxStore)
+			if !ok {
+				t.Fatal("store does not implement OutboxStore")
+			}
+			errRollback := errors.New("rollback")
+
+			// Events are added in the transaction of the change they describe
+			err := s.WithTx(ctx, func(ctx context.Context) error {
+				_, err := s.Repository("items").Create(ctx, Record{ID: "rolled-back", Data: json.RawMessage(`{}`)})
+				if err != nil {
+					return err
+				}
+				_, err = outbox.AddOutboxEvent(ctx, OutboxEvent{Type: "item.created", Data: []byte(`{"id":"rolled-back"}`)})
+				if err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				t.Fatalf("unexpected error: got %v want %v", err, errRollback)
+			}
+			stats, err := outbox.OutboxStats(ctx)
+			if err != nil || stats.Count != 0 {
+				t.Errorf("event added in a rolled back transaction exists: %+v, %v", stats, err)
+			}
+
+			var first OutboxEvent
+			err = s.WithTx(ctx, func(ctx context.Context) error {
+				first, err = outbox.AddOutboxEvent(ctx, OutboxEvent{Type: "item.created", Data: []byte(`{"id":"1"}`)})
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if first.ID == "" || first.CreatedAt.IsZero() || first.AvailableAt.IsZero() {
+				t.Errorf("unexpected added event: %+v", first)
+			}
+			second, err := outbox.AddOutboxEvent(ctx, OutboxEvent{Type: "item.deleted", Data: []byte(`{"id":"1"}`)})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stats, err = outbox.OutboxStats(ctx)
+			if err != nil || stats.Count != 2 || !stats.OldestCreatedAt.Equal(first.CreatedAt) {
+				t.Errorf("unexpected stats: %+v, %v", stats, err)
+			}
+
+			now := time.Now()
+			claimed, err := outbox.ClaimOutboxEvents(ctx, now.Add(time.Second), now.Add(time.Minute), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(claimed) != 1 || claimed[0].ID != first.ID || claimed[0].Attempts != 1 || claimed[0].Type != "item.created" {
+				t.Fatalf("unexpected claimed events: %+v", claimed)
+			}
+			var data map[string]string
+			err = json.Unmarshal(claimed[0].Data, &data)
+			if err != nil || data["id"] != "1" {
+				t.Errorf("unexpected data: %s, %v", claimed[0].Data, err)
+			}
+
+			// A claimed event is not claimed again until its lock expires
+			claimed, err = outbox.ClaimOutboxEvents(ctx, now.Add(time.Second), now.Add(time.Minute), 10)
+			if err != nil || len(claimed) != 1 || claimed[0].ID != second.ID {
+				t.Fatalf("unexpected second claim: %+v, %v", claimed, err)
+			}
+
+			err = outbox.RetryOutboxEvent(ctx, first.ID, 1, []string{"webhooks"}, "connection refused", now.Add(2*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			claimed, err = outbox.ClaimOutboxEvents(ctx, now.Add(time.Second), now.Add(time.Minute), 10)
+			if err != nil || len(claimed) != 0 {
+				t.Errorf("event claimed before its retry is due: %+v, %v", claimed, err)
+			}
+
+			// Expired locks are claimed by another relay, and the first relay can no longer settle the event
+			claimed, err = outbox.ClaimOutboxEvents(ctx, now.Add(3*time.Second), now.Add(4*time.Second), 10)
+			if err != nil || len(claimed) != 1 || claimed[0].ID != first.ID || claimed[0].Attempts != 2 ||
+				claimed[0].LastError != "connection refused" || !slices.Equal(claimed[0].Handled, []string{"webhooks"}) {
+				t.Fatalf("unexpected retry claim: %+v, %v", claimed, err)
+			}
+			claimed, err = outbox.ClaimOutboxEvents(ctx, now.Add(time.Hour), now.Add(2*time.Hour), 10)
+			if err != nil || len(claimed) != 2 {
+				t.Fatalf("unexpected claim of expired locks: %+v, %v", claimed, err)
+			}
+			err = outbox.DeleteOutboxEvent(ctx, first.ID, 2)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error deleting with a stale attempt: got %v want %v", err, ErrConflict)
+			}
+			err = outbox.RetryOutboxEvent(ctx, second.ID, 1, nil, "timeout", now)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error retrying with a stale attempt: got %v want %v", err, ErrConflict)
+			}
+
+			for _, event := range claimed {
+				err = outbox.DeleteOutboxEvent(ctx, event.ID, event.Attempts)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			stats, err = outbox.OutboxStats(ctx)
+			if err != nil || stats.Count != 0 {
+				t.Errorf("unexpected stats after relaying every event: %+v, %v", stats, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	// Registers the pgx database/sql driver
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// OpenPostgres connects to a Postgres database using a postgres:// URL.
+func OpenPostgres(ctx context.Context, dsn string) (*SQL, error) {
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	db.SetMaxOpenConns(25)
+	db.SetMaxIdleConns(25)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	return newSQL(ctx, db, dialect{name: "postgres", numbered: true, jsonb: true, skipLocked: true})
+}
@@ -0,0 +1,260 @@
+package store
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Fields stored on every record. Any other field name refers to a top level property of the record data.
+const (
+	FieldID        = "id"
+	FieldVersion   = "version"
+	FieldCreatedAt = "created_at"
+	FieldUpdatedAt = "updated_at"
+)
+
+// Operator compares a field with the value of a Filter.
+type Operator string
+
+// Supported filter operators.
+const (
+	OpEq  Operator = "eq"
+	OpNe  Operator = "ne"
+	OpLt  Operator = "lt"
+	OpLte Operator = "lte"
+	OpGt  Operator = "gt"
+	OpGte Operator = "gte"
+	// OpContains matches strings containing the value, ignoring case.
+	OpContains Operator = "contains"
+)
+
+// Operators lists the supported filter operators.
+var Operators = []Operator{OpEq, OpNe, OpLt, OpLte, OpGt, OpGte, OpContains}
+
+var fieldName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// Filter restricts a list to records whose field compares to Value with Op.
+// Value must be a string, bool, float64 or int64, or a time.Time for created_at and updated_at.
+type Filter struct {
+	Value any
+	Field string
+	Op    Operator
+}
+
+// Sort orders a list by a field. Records missing a sorted field cannot be paginated reliably,
+// so only sort by fields every record has.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query holds the options for listing records.
+type Query struct {
+	// Filters that every returned record must match.
+	Filters []Filter
+	// Sort orders the records. Ties, and lists without a sort, are ordered by creation time then ID.
+	Sort []Sort
+	// After is the sort key of the last record of the previous page, as returned by SortKey.
+	// Only records ordered after it are returned.
+	After []any
+	// Limit is the maximum number of records to return. Zero means no limit.
+	Limit int
+}
+
+// sortFields returns the complete ordering of q, which always ends with the record ID so it is total.
+func (q Query) sortFields() []Sort {
+	sorts := q.Sort
+	if len(sorts) == 0 {
+		sorts = []Sort{{Field: FieldCreatedAt}}
+	}
+
+	return append(sorts[:len(sorts):len(sorts)], Sort{Field: FieldID})
+}
+
+// validate checks the query before it is translated for a store.
+func (q Query) validate() error {
+	for _, f := range q.Filters {
+		if !fieldName.MatchString(f.Field) {
+			return fmt.Errorf("invalid filter field %q", f.Field)
+		}
+
+		switch v := f.Value.(type) {
+		case string, bool, float64, int64:
+		case time.Time:
+			if !isTimeField(f.Field) {
+				return fmt.Errorf("filter on %s cannot compare a time", f.Field)
+			}
+		default:
+			return fmt.Errorf("unsupported filter value %T for %s", v, f.Field)
+		}
+
+		if f.Op == OpContains {
+			if _, ok := f.Value.(string); !ok {
+				return fmt.Errorf("filter on %s: %s requires a string", f.Field, f.Op)
+			}
+		} else if !slices.Contains(Operators, f.Op) {
+			return fmt.Errorf("unsupported filter operator %q", f.Op)
+		}
+	}
+
+	for _, s := range q.Sort {
+		if !fieldName.MatchString(s.Field) {
+			return fmt.Errorf("invalid sort field %q", s.Field)
+		}
+	}
+
+	if q.After != nil && len(q.After) != len(q.sortFields()) {
+		return fmt.Errorf("sort key has %d values, want %d", len(q.After), len(q.sortFields()))
+	}
+
+	return nil
+}
+
+// SortKey returns the values of the fields r is ordered by in q. Pass the key of the last record of a page as
+// Query.After to list the next page.
+func SortKey(r Record, q Query) ([]any, error) {
+	data, err := decodeData(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortKey(r, data, q.sortFields()), nil
+}
+
+func sortKey(r Record, data map[string]any, sorts []Sort) []any {
+	key := make([]any, 0, len(sorts))
+	for _, s := range sorts {
+		value, _ := fieldValue(r, data, s.Field)
+		key = append(key, value)
+	}
+
+	return key
+}
+
+// compareKeys orders two sort keys.
+func compareKeys(sorts []Sort, a, b []any) int {
+	for i, s := range sorts {
+		c, _ := compareValues(a[i], b[i])
+		if s.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return 0
+}
+
+func isTimeField(field string) bool {
+	return field == FieldCreatedAt || field == FieldUpdatedAt
+}
+
+func isRecordField(field string) bool {
+	return field == FieldID || field == FieldVersion || isTimeField(field)
+}
+
+func decodeData(r Record) (map[string]any, error) {
+	var data map[string]any
+	err := json.Unmarshal(r.Data, &data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding record %s: %w", r.ID, err)
+	}
+
+	return data, nil
+}
+
+// fieldValue returns the value of a record field, or of a top level property of its decoded data.
+func fieldValue(r Record, data map[string]any, field string) (any, bool) {
+	switch field {
+	case FieldID:
+		return r.ID, true
+	case FieldVersion:
+		return r.Version, true
+	case FieldCreatedAt:
+		return r.CreatedAt, true
+	case FieldUpdatedAt:
+		return r.UpdatedAt, true
+	}
+
+	value, ok := data[field]
+	return value, ok && value != nil
+}
+
+// compareValues orders two field values. It reports false if they have different types.
+func compareValues(a, b any) (int, bool) {
+	a, b = normalizeValue(a), normalizeValue(b)
+
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return cmp.Compare(a, b), ok
+	case float64:
+		b, ok := b.(float64)
+		return cmp.Compare(a, b), ok
+	case time.Time:
+		b, ok := b.(time.Time)
+		return a.Compare(b), ok
+	case bool:
+		b, ok := b.(bool)
+		if !ok || a == b {
+			return 0, ok
+		}
+		if a {
+			return 1, true
+		}
+		return -1, true
+	}
+
+	return 0, false
+}
+
+func normalizeValue(v any) any {
+	switch v := v.(type) {
+	case int64:
+		return float64(v)
+	case int:
+		return float64(v)
+	}
+
+	return v
+}
+
+// matches evaluates a filter against a field value.
+func (f Filter) matches(value any, ok bool) bool {
+	if !ok {
+		return f.Op == OpNe
+	}
+
+	if f.Op == OpContains {
+		s, isString := value.(string)
+		return isString && strings.Contains(strings.ToLower(s), strings.ToLower(f.Value.(string)))
+	}
+
+	c, comparable := compareValues(value, f.Value)
+	if !comparable {
+		return f.Op == OpNe
+	}
+
+	switch f.Op {
+	case OpEq:
+		return c == 0
+	case OpNe:
+		return c != 0
+	case OpLt:
+		return c < 0
+	case OpLte:
+		return c <= 0
+	case OpGt:
+		return c > 0
+	case OpGte:
+		return c >= 0
+	}
+
+	return false
+}
@@ -0,0 +1,186 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRepositoryQuery(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := s.Repository("query")
+
+			for _, data := range []string{
+				`{"name":"delta","price":4,"active":true}`,
+				`{"name":"alpha","price":1,"active":false}`,
+				`{"name":"Charlie","price":3,"active":true}`,
+				`{"name":"bravo","price":2,"active":true}`,
+				`{"name":"echo_5%","price":2,"active":false}`,
+				`{"price":9}`,
+			} {
+				_, err := repo.Create(ctx, Record{Data: json.RawMessage(data)})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			tests := []struct {
+				name     string
+				expected []string
+				query    Query
+			}{
+				{
+					name:     "default order is creation time",
+					query:    Query{Filters: []Filter{{Field: "name", Op: OpNe, Value: "echo_5%"}}, Limit: 3},
+					expected: []string{"delta", "alpha", "Charlie"},
+				},
+				{
+					name:     "equal",
+					query:    Query{Filters: []Filter{{Field: "name", Op: OpEq, Value: "bravo"}}},
+					expected: []string{"bravo"},
+				},
+				{
+					name:     "not equal includes missing fields",
+					query:    Query{Filters: []Filter{{Field: "name", Op: OpNe, Value: "bravo"}, {Field: "price", Op: OpGte, Value: 4.0}}},
+					expected: []string{"delta", ""},
+				},
+				{
+					name:     "number range sorted descending",
+					query:    Query{Filters: []Filter{{Field: "price", Op: OpGt, Value: 1.0}, {Field: "price", Op: OpLte, Value: 3.0}}, Sort: []Sort{{Field: "price", Desc: true}, {Field: "name"}}},
+					expected: []string{"Charlie", "bravo", "echo_5%"},
+				},
+				{
+					name:     "bool",
+					query:    Query{Filters: []Filter{{Field: "active", Op: OpEq, Value: false}}, Sort: []Sort{{Field: "name"}}},
+					expected: []string{"alpha", "echo_5%"},
+				},
+				{
+					name:     "contains ignores case",
+					query:    Query{Filters: []Filter{{Field: "name", Op: OpContains, Value: "CHAR"}}},
+					expected: []string{"Charlie"},
+				},
+				{
+					name:     "contains escapes wildcards",
+					query:    Query{Filters: []Filter{{Field: "name", Op: OpContains, Value: "_5%"}}},
+					expected: []string{"echo_5%"},
+				},
+				{
+					name:     "created at",
+					query:    Query{Filters: []Filter{{Field: FieldCreatedAt, Op: OpLt, Value: time.Now().Add(time.Hour)}, {Field: "price", Op: OpLt, Value: 2.0}}},
+					expected: []string{"alpha"},
+				},
+			}
+
+			for _, test := range tests {
+				t.Run(test.name, func(t *testing.T) {
+					records, err := repo.List(ctx, test.query)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					names := recordNames(t, records)
+					if !slices.Equal(names, test.expected) {
+						t.Errorf("unexpected records: got %q want %q", names, test.expected)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestRepositoryPagination(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := s.Repository("pages")
+
+			// Duplicate prices check that ties are broken consistently between pages
+			for i, price := range []int{3, 1, 2, 3, 1, 2, 3} {
+				data, _ := json.Marshal(map[string]any{"name": string(rune('a' + i)), "price": price})
+				_, err := repo.Create(ctx, Record{Data: data})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, sorts := range [][]Sort{
+				nil,
+				{{Field: "price"}},
+				{{Field: "price", Desc: true}, {Field: FieldCreatedAt, Desc: true}},
+				{{Field: "name", Desc: true}},
+			} {
+				all, err := repo.List(ctx, Query{Sort: sorts})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var paged []Record
+				q := Query{Sort: sorts, Limit: 2}
+				for {
+					page, err := repo.List(ctx, q)
+					if err != nil {
+						t.Fatal(err)
+					}
+					paged = append(paged, page...)
+					if len(page) < q.Limit {
+						break
+					}
+
+					q.After, err = SortKey(page[len(page)-1], q)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				if got, want := recordNames(t, paged), recordNames(t, all); !slices.Equal(got, want) {
+					t.Errorf("unexpected pages sorted by %v: got %q want %q", sorts, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+	}{
+		{name: "invalid field", query: Query{Filters: []Filter{{Field: "name') OR 1=1 --", Op: OpEq, Value: "x"}}}},
+		{name: "invalid operator", query: Query{Filters: []Filter{{Field: "name", Op: "like", Value: "x"}}}},
+		{name: "invalid value", query: Query{Filters: []Filter{{Field: "name", Op: OpEq, Value: []string{"x"}}}}},
+		{name: "time on data field", query: Query{Filters: []Filter{{Field: "name", Op: OpEq, Value: time.Now()}}}},
+		{name: "contains number", query: Query{Filters: []Filter{{Field: "price", Op: OpContains, Value: 1.0}}}},
+		{name: "invalid sort", query: Query{Sort: []Sort{{Field: "Name"}}}},
+		{name: "short sort key", query: Query{After: []any{"x"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.query.validate() == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func recordNames(t *testing.T, records []Record) []string {
+	t.Helper()
+
+	names := []string{}
+	for _, record := range records {
+		var data struct {
+			Name string `json:"name"`
+		}
+		err := json.Unmarshal(record.Data, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, data.Name)
+	}
+
+	return names
+}
@@ -0,0 +1,406 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SQL is a Store backed by a database/sql connection pool.
+type SQL struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// dialect holds the differences between the supported SQL databases.
+type dialect struct {
+	name string
+	// numbered placeholders ($1, $2) are used instead of ?
+	numbered bool
+	// jsonb is set when record data is stored as Postgres jsonb rather than JSON text
+	jsonb bool
+	// skipLocked is set when SELECT ... FOR UPDATE SKIP LOCKED is supported
+	skipLocked bool
+}
+
+type sqlTx struct {
+	store *SQL
+	tx    *sql.Tx
+}
+
+type sqlTxKey struct{}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type sqlRepository struct {
+	store      *SQL
+	collection string
+}
+
+// newSQL checks the connection to db. The schema is created by the migrations, see MigrateUp.
+func newSQL(ctx context.Context, db *sql.DB, d dialect) (*SQL, error) {
+	err := db.PingContext(ctx)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("connecting to %s: %w", d.name, err)
+	}
+
+	return &SQL{db: db, dialect: d}, nil
+}
+
+// DB returns the underlying connection pool, for example to export its statistics.
+func (s *SQL) DB() *sql.DB {
+	return s.db
+}
+
+// Dialect returns the name of the database, such as sqlite or postgres.
+func (s *SQL) Dialect() string {
+	return s.dialect.name
+}
+
+// Repository returns the repository for a collection.
+func (s *SQL) Repository(collection string) Repository {
+	return &sqlRepository{store: s, collection: collection}
+}
+
+// WithTx runs fn in a database transaction.
+func (s *SQL) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(sqlTxKey{}).(sqlTx); ok && tx.store == s {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	err = fn(context.WithValue(ctx, sqlTxKey{}, sqlTx{store: s, tx: tx}))
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Ping checks the database connection.
+func (s *SQL) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close closes the connection pool.
+func (s *SQL) Close() error {
+	return s.db.Close()
+}
+
+// Conn returns the transaction in ctx, or the connection pool if there is none.
+func (s *SQL) Conn(ctx context.Context) querier {
+	if tx, ok := ctx.Value(sqlTxKey{}).(sqlTx); ok && tx.store == s {
+		return tx.tx
+	}
+
+	return s.db
+}
+
+// Rebind converts ? placeholders to the dialect's placeholder syntax.
+func (s *SQL) Rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+
+	return b.String()
+}
+
+func (r *sqlRepository) Get(ctx context.Context, id string) (Record, error) {
+	row := r.store.Conn(ctx).QueryRowContext(ctx, r.store.Rebind(
+		`SELECT id, data, version, created_at, updated_at FROM records WHERE collection = ? AND id = ?`),
+		r.collection, id)
+
+	return scanRecord(row)
+}
+
+func (r *sqlRepository) List(ctx context.Context, q Query) ([]Record, error) {
+	err := q.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	where := []string{"collection = ?"}
+	args := []any{r.collection}
+
+	for _, f := range q.Filters {
+		condition, filterArgs := r.store.filterSQL(f)
+		where = append(where, condition)
+		args = append(args, filterArgs...)
+	}
+
+	sorts := q.sortFields()
+	if q.After != nil {
+		condition, afterArgs := r.store.afterSQL(sorts, q.After)
+		where = append(where, condition)
+		args = append(args, afterArgs...)
+	}
+
+	order := make([]string, 0, len(sorts))
+	for _, s := range sorts {
+		direction := "ASC"
+		if s.Desc {
+			direction = "DESC"
+		}
+		order = append(order, r.store.fieldSQL(s.Field)+" "+direction)
+	}
+
+	query := `SELECT id, data, version, created_at, updated_at FROM records WHERE ` + strings.Join(where, " AND ") +
+		` ORDER BY ` + strings.Join(order, ", ")
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+
+	rows, err := r.store.Conn(ctx).QueryContext(ctx, r.store.Rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	records := []Record{}
+	for rows.Next() {
+		record, err := scanRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+func (r *sqlRepository) Create(ctx context.Context, record Record) (Record, error) {
+	if record.ID == "" {
+		record.ID = NewID()
+	}
+
+	now := time.Now().UTC()
+	record.Version = 1
+	record.CreatedAt = now
+	record.UpdatedAt = now
+
+	result, err := r.store.Conn(ctx).ExecContext(ctx, r.store.Rebind(
+		`INSERT INTO records (collection, id, data, version, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING`),
+		r.collection, record.ID, string(record.Data), record.Version, record.CreatedAt, record.UpdatedAt)
+	if err != nil {
+		return Record{}, err
+	}
+
+	err = expectAffected(result, ErrConflict)
+	if err != nil {
+		return Record{}, err
+	}
+
+	return record, nil
+}
+
+func (r *sqlRepository) Update(ctx context.Context, record Record) (Record, error) {
+	var updated Record
+	err := r.store.WithTx(ctx, func(ctx context.Context) error {
+		current, err := r.Get(ctx, record.ID)
+		if err != nil {
+			return err
+		}
+
+		if record.Version != 0 && record.Version != current.Version {
+			return ErrConflict
+		}
+
+		updated = current
+		updated.Data = record.Data
+		updated.Version++
+		updated.UpdatedAt = time.Now().UTC()
+
+		// The version check guards against concurrent updates between the read and the write
+		result, err := r.store.Conn(ctx).ExecContext(ctx, r.store.Rebind(
+			`UPDATE records SET data = ?, version = ?, updated_at = ? WHERE collection = ? AND id = ? AND version = ?`),
+			string(updated.Data), updated.Version, updated.UpdatedAt, r.collection, record.ID, current.Version)
+		if err != nil {
+			return err
+		}
+
+		return expectAffected(result, ErrConflict)
+	})
+
+	return updated, err
+}
+
+func (r *sqlRepository) Delete(ctx context.Context, id string, version int64) error {
+	query := `DELETE FROM records WHERE collection = ? AND id = ?`
+	args := []any{r.collection, id}
+	if version != 0 {
+		query += ` AND version = ?`
+		args = append(args, version)
+	}
+
+	result, err := r.store.Conn(ctx).ExecContext(ctx, r.store.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+
+	err = expectAffected(result, ErrNotFound)
+	if errors.Is(err, ErrNotFound) && version != 0 {
+		// Distinguish a missing record from a stale version
+		_, getErr := r.Get(ctx, id)
+		if getErr == nil {
+			return ErrConflict
+		}
+	}
+
+	return err
+}
+
+// fieldSQL returns the expression for a record column or a top level property of the record data.
+func (s *SQL) fieldSQL(field string) string {
+	switch {
+	case isRecordField(field):
+		return field
+	case s.dialect.jsonb:
+		return "data->'" + field + "'"
+	}
+
+	return "json_extract(data, '$." + field + "')"
+}
+
+// valueSQL returns the placeholder and argument to compare fieldSQL(field) with value.
+func (s *SQL) valueSQL(field string, value any) (string, any) {
+	if isRecordField(field) {
+		if f, ok := value.(float64); ok && field == FieldVersion {
+			value = int64(f)
+		}
+		return "?", value
+	}
+
+	if s.dialect.jsonb {
+		data, _ := json.Marshal(value)
+		return "CAST(? AS jsonb)", string(data)
+	}
+
+	return "?", value
+}
+
+// filterSQL returns the condition and arguments for a filter.
+func (s *SQL) filterSQL(f Filter) (string, []any) {
+	field := s.fieldSQL(f.Field)
+
+	if f.Op == OpContains {
+		if s.dialect.jsonb && !isRecordField(f.Field) {
+			field = "data->>'" + f.Field + "'"
+		}
+		like := "LIKE"
+		if s.dialect.jsonb {
+			like = "ILIKE"
+		}
+		pattern := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Value.(string))
+		return field + " " + like + ` ? ESCAPE '\'`, []any{"%" + pattern + "%"}
+	}
+
+	placeholder, arg := s.valueSQL(f.Field, f.Value)
+	switch f.Op {
+	case OpNe:
+		// Records without the field do not equal any value
+		return "(" + field + " IS NULL OR " + field + " <> " + placeholder + ")", []any{arg}
+	case OpLt:
+		return field + " < " + placeholder, []any{arg}
+	case OpLte:
+		return field + " <= " + placeholder, []any{arg}
+	case OpGt:
+		return field + " > " + placeholder, []any{arg}
+	case OpGte:
+		return field + " >= " + placeholder, []any{arg}
+	}
+
+	return field + " = " + placeholder, []any{arg}
+}
+
+// afterSQL returns the keyset condition selecting the records ordered after key.
+func (s *SQL) afterSQL(sorts []Sort, key []any) (string, []any) {
+	var conditions []string
+	var args []any
+
+	for i, sort := range sorts {
+		var terms []string
+		for j := range i {
+			placeholder, arg := s.valueSQL(sorts[j].Field, key[j])
+			terms = append(terms, s.fieldSQL(sorts[j].Field)+" = "+placeholder)
+			args = append(args, arg)
+		}
+
+		op := " > "
+		if sort.Desc {
+			op = " < "
+		}
+		placeholder, arg := s.valueSQL(sort.Field, key[i])
+		terms = append(terms, s.fieldSQL(sort.Field)+op+placeholder)
+		args = append(args, arg)
+
+		conditions = append(conditions, "("+strings.Join(terms, " AND ")+")")
+	}
+
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRecord(row scanner) (Record, error) {
+	var record Record
+	var data []byte
+
+	err := row.Scan(&record.ID, &data, &record.Version, &record.CreatedAt, &record.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	record.Data = data
+	record.CreatedAt = record.CreatedAt.UTC()
+	record.UpdatedAt = record.UpdatedAt.UTC()
+
+	return record, nil
+}
+
+// expectAffected returns err if the statement did not change any rows.
+func expectAffected(result sql.Result, err error) error {
+	n, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return rowsErr
+	}
+
+	if n == 0 {
+		return err
+	}
+
+	return nil
+}
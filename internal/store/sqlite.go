@@ -0,0 +1,30 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	// Pure Go SQLite driver, so the binary builds with CGO_ENABLED=0
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens a SQLite database file, creating it if needed. Use ":memory:" for a throwaway database.
+func OpenSQLite(ctx context.Context, path string) (*SQL, error) {
+	params := "_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_time_format=sqlite"
+	dsn := "file:" + path + "?" + params
+	if strings.Contains(path, "?") {
+		dsn = "file:" + path + "&" + params
+	}
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer. A single connection avoids SQLITE_BUSY errors and keeps
+	// in-memory databases, which are private to a connection, consistent.
+	db.SetMaxOpenConns(1)
+
+	return newSQL(ctx, db, dialect{name: "sqlite"})
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// testStores returns every store implementation available in the test environment.
+// Postgres is only tested when APP_TEST_POSTGRES_URL is set.
+func testStores(t *testing.T) map[string]Store {
+	t.Helper()
+	ctx := context.Background()
+
+	stores := map[string]Store{"memory": NewMemory()}
+
+	sqlite, err := OpenSQLite(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sqlite.MigrateUp(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores["sqlite"] = sqlite
+
+	if postgres := testPostgres(t); postgres != nil {
+		_, err = postgres.MigrateUp(ctx, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stores["postgres"] = postgres
+	}
+
+	for _, s := range stores {
+		t.Cleanup(func() { _ = s.Close() })
+	}
+
+	return stores
+}
+
+// testPostgres connects to the database in APP_TEST_POSTGRES_URL after dropping all tables, or returns nil if it is not set.
+func testPostgres(t *testing.T) *SQL {
+	t.Helper()
+
+	dsn := os.Getenv("APP_TEST_POSTGRES_URL")
+	if dsn == "" {
+		return nil
+	}
+
+	postgres, err := OpenPostgres(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = postgres.DB().Exec("DROP TABLE IF EXISTS records, idempotency_keys, jobs, outbox, schema_migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return postgres
+}
+
+func TestRepository(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := s.Repository("widgets")
+
+			created, err := repo.Create(ctx, Record{Data: json.RawMessage(`{"name":"one"}`)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if created.ID == "" || created.Version != 1 || created.CreatedAt.IsZero() {
+				t.Errorf("unexpected created record: %+v", created)
+			}
+
+			_, err = repo.Create(ctx, Record{ID: created.ID, Data: json.RawMessage(`{}`)})
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error creating duplicate: got %v want %v", err, ErrConflict)
+			}
+
+			got, err := repo.Get(ctx, created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got.Data, `{"name":"one"}`)
+
+			_, err = repo.Get(ctx, "missing")
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unexpected error getting missing record: got %v want %v", err, ErrNotFound)
+			}
+
+			// Other collections are isolated
+			_, err = s.Repository("gadgets").Get(ctx, created.ID)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unexpected error getting record from another collection: got %v want %v", err, ErrNotFound)
+			}
+
+			updated, err := repo.Update(ctx, Record{ID: created.ID, Version: 1, Data: json.RawMessage(`{"name":"two"}`)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated.Version != 2 || !updated.CreatedAt.Equal(created.CreatedAt) {
+				t.Errorf("unexpected updated record: %+v", updated)
+			}
+			assertJSON(t, updated.Data, `{"name":"two"}`)
+
+			_, err = repo.Update(ctx, Record{ID: created.ID, Version: 1, Data: json.RawMessage(`{}`)})
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error updating stale version: got %v want %v", err, ErrConflict)
+			}
+
+			_, err = repo.Update(ctx, Record{ID: "missing", Data: json.RawMessage(`{}`)})
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unexpected error updating missing record: got %v want %v", err, ErrNotFound)
+			}
+
+			err = repo.Delete(ctx, created.ID, 1)
+			if !errors.Is(err, ErrConflict) {
+				t.Errorf("unexpected error deleting stale version: got %v want %v", err, ErrConflict)
+			}
+
+			err = repo.Delete(ctx, created.ID, 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = repo.Delete(ctx, created.ID, 0)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("unexpected error deleting missing record: got %v want %v", err, ErrNotFound)
+			}
+		})
+	}
+}
+
+func TestRepositoryList(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := s.Repository("list")
+
+			var ids []string
+			for range 3 {
+				record, err := repo.Create(ctx, Record{Data: json.RawMessage(`{}`)})
+				if err != nil {
+					t.Fatal(err)
+				}
+				ids = append(ids, record.ID)
+			}
+
+			records, err := repo.List(ctx, Query{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 3 {
+				t.Fatalf("unexpected number of records: got %d want %d", len(records), 3)
+			}
+			for i, record := range records {
+				if record.ID != ids[i] {
+					t.Errorf("unexpected record at %d: got %s want %s", i, record.ID, ids[i])
+				}
+			}
+
+			records, err = repo.List(ctx, Query{Limit: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(records) != 2 {
+				t.Errorf("unexpected number of limited records: got %d want %d", len(records), 2)
+			}
+		})
+	}
+}
+
+func TestWithTx(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo := s.Repository("tx")
+			errRollback := errors.New("rollback")
+
+			err := s.WithTx(ctx, func(ctx context.Context) error {
+				_, err := repo.Create(ctx, Record{ID: "rolled-back", Data: json.RawMessage(`{}`)})
+				if err != nil {
+					return err
+				}
+				return errRollback
+			})
+			if !errors.Is(err, errRollback) {
+				t.Errorf("unexpected error: got %v want %v", err, errRollback)
+			}
+
+			_, err = repo.Get(ctx, "rolled-back")
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("record created in a rolled back transaction exists: got %v want %v", err, ErrNotFound)
+			}
+
+			err = s.WithTx(ctx, func(ctx context.Context) error {
+				_, err := repo.Create(ctx, Record{ID: "outer", Data: json.RawMessage(`{}`)})
+				if err != nil {
+					return err
+				}
+
+				// Nested transactions join the outer one
+				return s.WithTx(ctx, func(ctx context.Context) error {
+					_, err := repo.Get(ctx, "outer")
+					if err != nil {
+						return err
+					}
+					_, err = repo.Create(ctx, Record{ID: "inner", Data: json.RawMessage(`{}`)})
+					return err
+				})
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, id := range []string{"outer", "inner"} {
+				_, err = repo.Get(ctx, id)
+				if err != nil {
+					t.Errorf("record %s created in a committed transaction: %v", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	for name, s := range testStores(t) {
+		t.Run(name, func(t *testing.T) {
+			err := s.Ping(context.Background())
+			if err != nil {
+				t.Errorf("unexpected ping error: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		dsn         string
+		expectError bool
+	}{
+		{dsn: ""},
+		{dsn: "memory://"},
+		{dsn: "sqlite://" + filepath.Join(t.TempDir(), "open.db")},
+		{dsn: "sqlite://:memory:"},
+		{dsn: "mysql://localhost/db", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			s, err := Open(context.Background(), tt.dsn)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("unexpected error: got %v, expectError %t", err, tt.expectError)
+			}
+			if err == nil {
+				_ = s.Close()
+			}
+		})
+	}
+}
+
+func TestNewID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	id := NewID()
+	if !uuid.MatchString(id) {
+		t.Errorf("unexpected id format: got %s", id)
+	}
+
+	if NewID() == id {
+		t.Error("ids are not unique")
+	}
+}
+
+func TestRebind(t *testing.T) {
+	postgres := &SQL{dialect: dialect{numbered: true}}
+	sqlite := &SQL{}
+
+	query := "SELECT * FROM records WHERE collection = ? AND id = ?"
+
+	if got := postgres.Rebind(query); got != "SELECT * FROM records WHERE collection = $1 AND id = $2" {
+		t.Errorf("unexpected postgres query: got %s", got)
+	}
+	if got := sqlite.Rebind(query); got != query {
+		t.Errorf("unexpected sqlite query: got %s", got)
+	}
+}
+
+func assertJSON(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+
+	var gotValue, wantValue any
+	_ = json.Unmarshal(got, &gotValue)
+	_ = json.Unmarshal([]byte(want), &wantValue)
+
+	gotJSON, _ := json.Marshal(gotValue)
+	wantJSON, _ := json.Marshal(wantValue)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("unexpected data: got %s want %s", got, want)
+	}
+}
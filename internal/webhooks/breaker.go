@@ -0,0 +1,60 @@
+package webhooks
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker is a circuit breaker for an endpoint. After threshold consecutive failures it opens and rejects
+// deliveries until the cooldown has passed, then lets a single delivery through to probe the endpoint. The
+// probe closes the breaker if it succeeds and opens it again, with double the cooldown, if it fails.
+type breaker struct {
+	openUntil time.Time
+	cooldown  time.Duration
+	failures  int
+	probing   bool
+	mu        sync.Mutex
+}
+
+// allow reports whether a delivery may be sent at now, and if not, when the breaker lets the next one through.
+func (b *breaker) allow(now time.Time, threshold int) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < threshold {
+		return true, time.Time{}
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false, b.openUntil
+	}
+
+	b.probing = true
+	return true, time.Time{}
+}
+
+// record records the outcome of a delivery sent at now.
+func (b *breaker) record(now time.Time, ok bool, threshold int, cooldown, maxCooldown time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		b.failures = 0
+		b.probing = false
+		b.cooldown = 0
+		return
+	}
+
+	b.failures++
+	if b.failures < threshold {
+		return
+	}
+
+	switch {
+	case b.cooldown == 0:
+		b.cooldown = cooldown
+	case b.probing:
+		b.cooldown = min(b.cooldown*2, maxCooldown)
+	}
+	b.probing = false
+	b.openUntil = now.Add(b.cooldown)
+}
@@ -0,0 +1,57 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress is returned when a delivery would connect to an address that is not public.
+var errPrivateAddress = errors.New("refusing to deliver to a non-public address")
+
+// sharedAddressSpace is the carrier-grade NAT range, which is not public either.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// newClient returns the default client of a Dispatcher. Unless allowPrivate is set, it refuses to connect to
+// loopback, private and link-local addresses, so subscriptions cannot reach services on the network of the
+// server. The check runs on the address being dialed, after DNS resolution, so it also covers names that
+// resolve, or are rebound, to such addresses.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !allowPrivate {
+		dialer.Control = dialPublic
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// A proxy would be dialed instead of the endpoint, bypassing the check
+	transport.Proxy = nil
+
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		// A redirect is a misconfigured endpoint, and following it would send the payload elsewhere
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialPublic is a net.Dialer Control function that rejects connections to addresses that are not public.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errPrivateAddress, address)
+	}
+
+	addr := addrPort.Addr().Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w: %s", errPrivateAddress, addr)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers set on every delivery.
+const (
+	// HeaderID is the ID of the delivery. Retries of a delivery keep it, redeliveries get a new one.
+	HeaderID = "Webhook-Id"
+	// HeaderEvent is the type of the event, such as item.created.
+	HeaderEvent = "Webhook-Event"
+	// HeaderTimestamp is the Unix time the delivery was sent, in seconds.
+	HeaderTimestamp = "Webhook-Timestamp"
+	// HeaderSignature holds the signatures of the delivery, separated by commas.
+	HeaderSignature = "Webhook-Signature"
+)
+
+var (
+	// ErrInvalidTimestamp is returned by Verify when the timestamp is missing, malformed or outside the tolerance.
+	ErrInvalidTimestamp = errors.New("invalid webhook timestamp")
+	// ErrInvalidSignature is returned by Verify when no signature matches the payload.
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// signaturePrefix versions the signature scheme.
+const signaturePrefix = "v1="
+
+// Sign returns the signature of a payload sent at timestamp: the hex encoded HMAC-SHA256, keyed with secret,
+// of the Unix timestamp in seconds, a period and the body.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	return signaturePrefix + hex.EncodeToString(mac(secret, timestamp.Unix(), body))
+}
+
+// Verify checks the timestamp and signature headers of a delivery received at the current time. Deliveries
+// older or newer than tolerance are rejected so captured requests cannot be replayed later.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if age := time.Since(time.Unix(timestamp, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidTimestamp
+	}
+
+	expected := mac(secret, timestamp, body)
+	for signature := range strings.SplitSeq(header.Get(HeaderSignature), ",") {
+		encoded, ok := strings.CutPrefix(strings.TrimSpace(signature), signaturePrefix)
+		if !ok {
+			continue
+		}
+		decoded, err := hex.DecodeString(encoded)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func mac(secret string, timestamp int64, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	h.Write(body)
+
+	return h.Sum(nil)
+}
@@ -0,0 +1,51 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"item.created"}`)
+	now := time.Now()
+
+	headers := func(timestamp time.Time, signature string) http.Header {
+		h := http.Header{}
+		h.Set(HeaderTimestamp, strconv.FormatInt(timestamp.Unix(), 10))
+		h.Set(HeaderSignature, signature)
+		return h
+	}
+
+	tests := []struct {
+		header http.Header
+		expect error
+		name   string
+		body   string
+	}{
+		{name: "valid", header: headers(now, Sign("secret", now, body))},
+		{name: "rotated secret", header: headers(now, Sign("old", now, body)+","+Sign("secret", now, body))},
+		{name: "wrong secret", header: headers(now, Sign("other", now, body)), expect: ErrInvalidSignature},
+		{name: "modified body", header: headers(now, Sign("secret", now, body)), body: `{"type":"item.deleted"}`, expect: ErrInvalidSignature},
+		{name: "modified timestamp", header: headers(now.Add(time.Second), Sign("secret", now, body)), expect: ErrInvalidSignature},
+		{name: "unknown scheme", header: headers(now, "v0=abc"), expect: ErrInvalidSignature},
+		{name: "replayed", header: headers(now.Add(-10*time.Minute), Sign("secret", now.Add(-10*time.Minute), body)), expect: ErrInvalidTimestamp},
+		{name: "missing timestamp", header: http.Header{HeaderSignature: {Sign("secret", now, body)}}, expect: ErrInvalidTimestamp},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received := body
+			if test.body != "" {
+				received = []byte(test.body)
+			}
+
+			err := Verify("secret", test.header, received, 5*time.Minute)
+			if !errors.Is(err, test.expect) {
+				t.Errorf("unexpected error: got %v want %v", err, test.expect)
+			}
+		})
+	}
+}
@@ -0,0 +1,408 @@
+/*
+Package webhooks notifies subscribers of resource changes. Subscribers register an HTTP endpoint and the
+event types they want, and every published event is POSTed to the matching endpoints as JSON:
+
+	{
+		"id": "0b6f2a1c-...",
+		"type": "item.created",
+		"created_at": "2026-01-01T00:00:00Z",
+		"data": {"id": "5b7f3c1e-...", "name": "Widget", ...}
+	}
+
+Deliveries are signed with the secret of the subscription, see Sign and Verify, and sent by the job queue,
+so failed deliveries are retried with exponential backoff. Endpoints that keep failing trip a circuit breaker
+that pauses their deliveries. Every delivery is recorded in a delivery log that can be inspected and
+redelivered through the API.
+*/
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// Store collections holding subscriptions and the delivery log.
+const (
+	SubscriptionsCollection = "webhook_subscriptions"
+	DeliveriesCollection    = "webhook_deliveries"
+)
+
+// deliverJob is the kind of job that sends a delivery.
+const deliverJob = "webhooks.deliver"
+
+// DeliveryStatus is the state of a delivery.
+type DeliveryStatus string
+
+// Delivery states. Pending deliveries have not been sent yet or are waiting for a retry.
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Subscription is an endpoint subscribed to events.
+type Subscription struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+	// Secret signs the deliveries to the endpoint.
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	Active bool     `json:"active"`
+}
+
+// Event is the payload of a delivery.
+type Event struct {
+	CreatedAt time.Time       `json:"created_at"`
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Delivery is an entry of the delivery log: an event sent, or to be sent, to a subscription.
+type Delivery struct {
+	LastAttemptAt  time.Time      `json:"last_attempt_at,omitzero"`
+	SubscriptionID string         `json:"subscription_id"`
+	EventID        string         `json:"event_id"`
+	EventType      string         `json:"event_type"`
+	Status         DeliveryStatus `json:"status"`
+	Error          string         `json:"error,omitempty"`
+	// RedeliveryOf is the ID of the delivery this one repeats.
+	RedeliveryOf   string          `json:"redelivery_of,omitempty"`
+	Payload        json.RawMessage `json:"payload"`
+	Duration       time.Duration   `json:"duration,omitempty"`
+	Attempts       int             `json:"attempts"`
+	ResponseStatus int             `json:"response_status,omitempty"`
+}
+
+// Config holds configuration for a Dispatcher.
+type Config struct {
+	// Logger logs failed deliveries. Defaults to slog.Default.
+	Logger *slog.Logger
+	// Client sends deliveries. Defaults to a client with a 10 second timeout that does not follow redirects
+	// and refuses to connect to loopback, private and link-local addresses.
+	Client *http.Client
+	// MaxAttempts is the number of times a delivery is attempted before it fails. Defaults to 15, which
+	// retries for about four hours with the default backoff of the job queue.
+	MaxAttempts int
+	// BreakerThreshold is the number of consecutive failures that open the circuit breaker of an endpoint.
+	// Defaults to 5.
+	BreakerThreshold int
+	// BreakerCooldown is how long an open breaker pauses deliveries before probing the endpoint again. It
+	// doubles every time the probe fails, up to an hour. Defaults to 1 minute.
+	BreakerCooldown time.Duration
+	// AllowPrivateNetworks lets the default client deliver to loopback, private and link-local addresses, for
+	// endpoints on the network of the server such as in development.
+	AllowPrivateNetworks bool
+}
+
+// Dispatcher publishes events to subscribers.
+type Dispatcher struct {
+	store         store.Store
+	subscriptions *store.Collection[Subscription]
+	deliveries    *store.Collection[Delivery]
+	queue         *jobs.Queue
+	logger        *slog.Logger
+	client        *http.Client
+	breakers      map[string]*breaker
+	cfg           Config
+	mu            sync.Mutex
+}
+
+// deliverArgs are the arguments of a delivery job.
+type deliverArgs struct {
+	DeliveryID string `json:"delivery_id"`
+}
+
+// New returns a Dispatcher for the subscriptions stored in s and registers its delivery job with q.
+func New(s store.Store, q *jobs.Queue, cfg Config) *Dispatcher {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.Client == nil {
+		cfg.Client = newClient(cfg.AllowPrivateNetworks)
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 15
+	}
+	if cfg.BreakerThreshold <= 0 {
+		cfg.BreakerThreshold = 5
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = time.Minute
+	}
+
+	d := &Dispatcher{
+		store:         s,
+		subscriptions: store.NewCollection[Subscription](s, SubscriptionsCollection),
+		deliveries:    store.NewCollection[Delivery](s, DeliveriesCollection),
+		queue:         q,
+		logger:        cfg.Logger.With("component", "webhooks"),
+		client:        cfg.Client,
+		breakers:      map[string]*breaker{},
+		cfg:           cfg,
+	}
+	jobs.Handle(q, deliverJob, d.deliver)
+
+	return d
+}
+
+// NewSecret returns a random signing secret for a subscription.
+func NewSecret() string {
+	return "whsec_" + rand.Text()
+}
+
+// Publish sends an event with data encoded as JSON to every active subscription to eventType. Deliveries
+// are recorded and enqueued before Publish returns, and sent in the background.
+func (d *Dispatcher) Publish(ctx context.Context, eventType string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return d.PublishEvent(ctx, Event{ID: store.NewID(), Type: eventType, CreatedAt: time.Now().UTC(), Data: encoded})
+}
+
+// PublishEvent sends event to every active subscription to its type, keeping its ID so receivers recognise
+// an event published again after a failure. The deliveries of an event are recorded in a transaction, so
+// either every subscription gets one or none does.
+func (d *Dispatcher) PublishEvent(ctx context.Context, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	return d.store.WithTx(ctx, func(ctx context.Context) error {
+		q := store.Query{Filters: []store.Filter{{Field: "active", Op: store.OpEq, Value: true}}, Limit: 100}
+		for {
+			subs, err := d.subscriptions.List(ctx, q)
+			if err != nil {
+				return err
+			}
+
+			for _, sub := range subs {
+				if !slices.Contains(sub.Value.Events, event.Type) {
+					continue
+				}
+
+				_, err = d.enqueue(ctx, Delivery{
+					SubscriptionID: sub.ID,
+					EventID:        event.ID,
+					EventType:      event.Type,
+					Payload:        payload,
+				})
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(subs) < q.Limit {
+				return nil
+			}
+			q.After, err = store.SortKey(subs[len(subs)-1].Record(), q)
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// Redeliver sends a logged delivery of the subscription with subscriptionID again as a new delivery.
+func (d *Dispatcher) Redeliver(ctx context.Context, subscriptionID, deliveryID string) (store.Document[Delivery], error) {
+	original, err := d.deliveries.Get(ctx, deliveryID)
+	if err != nil {
+		return original, err
+	}
+	if original.Value.SubscriptionID != subscriptionID {
+		return original, store.ErrNotFound
+	}
+
+	_, err = d.subscriptions.Get(ctx, subscriptionID)
+	if err != nil {
+		return original, err
+	}
+
+	return d.enqueue(ctx, Delivery{
+		SubscriptionID: subscriptionID,
+		EventID:        original.Value.EventID,
+		EventType:      original.Value.EventType,
+		Payload:        original.Value.Payload,
+		RedeliveryOf:   original.ID,
+	})
+}
+
+// enqueue records a pending delivery and enqueues the job that sends it.
+func (d *Dispatcher) enqueue(ctx context.Context, delivery Delivery) (store.Document[Delivery], error) {
+	delivery.Status = DeliveryPending
+	doc, err := d.deliveries.Create(ctx, delivery)
+	if err != nil {
+		return doc, err
+	}
+
+	_, err = d.queue.Enqueue(ctx, deliverJob, deliverArgs{DeliveryID: doc.ID}, jobs.EnqueueOptions{MaxAttempts: d.cfg.MaxAttempts})
+	if err != nil {
+		return doc, fmt.Errorf("enqueueing delivery %s: %w", doc.ID, err)
+	}
+
+	return doc, nil
+}
+
+// deliver is the job handler that sends a delivery and records the outcome in the delivery log. It returns
+// an error for the job queue to retry the delivery.
+func (d *Dispatcher) deliver(ctx context.Context, job store.Job, args deliverArgs) error {
+	doc, err := d.deliveries.Get(ctx, args.DeliveryID)
+	if errors.Is(err, store.ErrNotFound) {
+		// The delivery log was cleaned up
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if doc.Value.Status != DeliveryPending {
+		return nil
+	}
+	delivery := doc.Value
+	lastAttempt := job.Attempts >= job.MaxAttempts
+
+	sub, err := d.subscriptions.Get(ctx, delivery.SubscriptionID)
+	if errors.Is(err, store.ErrNotFound) {
+		delivery.Status = DeliveryFailed
+		delivery.Error = "the webhook was deleted"
+		return d.record(ctx, doc.ID, delivery)
+	}
+	if err != nil {
+		return err
+	}
+
+	b := d.breaker(sub.Value.URL)
+	allowed, retryAt := b.allow(time.Now(), d.cfg.BreakerThreshold)
+	if !allowed {
+		err = fmt.Errorf("circuit breaker open for %s until %s", sub.Value.URL, retryAt.Format(time.RFC3339))
+		delivery.Error = err.Error()
+		if lastAttempt {
+			delivery.Status = DeliveryFailed
+		}
+		return errors.Join(err, d.record(ctx, doc.ID, delivery))
+	}
+
+	start := time.Now()
+	status, err := d.send(ctx, sub.Value, doc.ID, delivery)
+	b.record(time.Now(), err == nil, d.cfg.BreakerThreshold, d.cfg.BreakerCooldown, time.Hour)
+
+	delivery.Attempts++
+	delivery.LastAttemptAt = start.UTC()
+	delivery.Duration = time.Since(start)
+	delivery.ResponseStatus = status
+	delivery.Error = ""
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySucceeded
+	case lastAttempt || jobs.IsPermanent(err):
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+		d.logger.Warn("webhook delivery failed, giving up", "id", doc.ID, "url", sub.Value.URL, "attempts", delivery.Attempts, "err", err)
+	default:
+		delivery.Error = err.Error()
+	}
+
+	return errors.Join(err, d.record(ctx, doc.ID, delivery))
+}
+
+// send POSTs a delivery to the endpoint of sub and returns the response status. The response body is not
+// kept, so endpoints cannot be used to read other services through the delivery log.
+func (d *Dispatcher) send(ctx context.Context, sub Subscription, id string, delivery Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, jobs.Permanent(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "go-rest-template-webhooks")
+	req.Header.Set(HeaderID, id)
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	now := time.Now()
+	req.Header.Set(HeaderTimestamp, fmt.Sprint(now.Unix()))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, now, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if errors.Is(err, errPrivateAddress) {
+		return 0, jobs.Permanent(err)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded with %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// record stores the outcome of a delivery attempt, even if the process is shutting down.
+func (d *Dispatcher) record(ctx context.Context, id string, delivery Delivery) error {
+	_, err := d.deliveries.Update(context.WithoutCancel(ctx), id, 0, delivery)
+	if err != nil {
+		return fmt.Errorf("recording delivery %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// breaker returns the circuit breaker of an endpoint.
+func (d *Dispatcher) breaker(url string) *breaker {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	b, ok := d.breakers[url]
+	if !ok {
+		b = &breaker{}
+		d.breakers[url] = b
+	}
+
+	return b
+}
+
+// DeleteDeliveries deletes the delivery log entries of s created before before and returns how many were deleted.
+func DeleteDeliveries(ctx context.Context, s store.Store, before time.Time) (int, error) {
+	deliveries := store.NewCollection[Delivery](s, DeliveriesCollection)
+
+	deleted := 0
+	for {
+		docs, err := deliveries.List(ctx, store.Query{
+			Filters: []store.Filter{{Field: store.FieldCreatedAt, Op: store.OpLt, Value: before}},
+			Limit:   100,
+		})
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, doc := range docs {
+			err = deliveries.Delete(ctx, doc.ID, 0)
+			if err != nil && !errors.Is(err, store.ErrNotFound) {
+				return deleted, err
+			}
+			deleted++
+		}
+
+		if len(docs) < 100 {
+			return deleted, nil
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/jobs"
+	"github.com/circa10a/go-rest-template/internal/store"
+)
+
+// receiver is a local webhook endpoint that records the deliveries it receives.
+type receiver struct {
+	server     *httptest.Server
+	deliveries chan Event
+	// fail is the number of requests to answer with 500 before succeeding, or -1 to always fail.
+	fail     atomic.Int32
+	requests atomic.Int32
+}
+
+// newReceiver starts a receiver verifying signatures with secret.
+func newReceiver(t *testing.T, secret string) *receiver {
+	t.Helper()
+
+	rcv := &receiver{deliveries: make(chan Event, 10)}
+	rcv.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rcv.requests.Add(1)
+
+		body, _ := io.ReadAll(r.Body)
+		err := Verify(secret, r.Header, body, 5*time.Minute)
+		if err != nil {
+			t.Errorf("invalid delivery: %v", err)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if fail := rcv.fail.Load(); fail != 0 {
+			rcv.fail.CompareAndSwap(fail, max(fail-1, -1))
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+
+		var event Event
+		_ = json.Unmarshal(body, &event)
+		rcv.deliveries <- event
+		_, _ = w.Write([]byte("ok"))
+	}))
+	t.Cleanup(rcv.server.Close)
+
+	return rcv
+}
+
+// newTestDispatcher returns a dispatcher with a running queue that retries quickly.
+func newTestDispatcher(t *testing.T, cfg Config) (*Dispatcher, store.Store) {
+	t.Helper()
+
+	s := store.NewMemory()
+	q := jobs.New(s, jobs.Config{
+		Logger:       slog.New(slog.DiscardHandler),
+		PollInterval: 5 * time.Millisecond,
+		Backoff:      5 * time.Millisecond,
+		MaxBackoff:   5 * time.Millisecond,
+	})
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	d := New(s, q, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return d, s
+}
+
+// subscribe stores a subscription of the receiver to events.
+func subscribe(t *testing.T, d *Dispatcher, rcv *receiver, secret string, events ...string) store.Document[Subscription] {
+	t.Helper()
+
+	sub, err := d.subscriptions.Create(context.Background(), Subscription{URL: rcv.server.URL, Secret: secret, Events: events, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sub
+}
+
+// waitForDelivery polls the delivery log until the only delivery of sub is no longer pending.
+func waitForDelivery(t *testing.T, d *Dispatcher, sub store.Document[Subscription]) store.Document[Delivery] {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		docs, err := d.deliveries.List(context.Background(), store.Query{
+			Filters: []store.Filter{{Field: "subscription_id", Op: store.OpEq, Value: sub.ID}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(docs) == 1 && docs[0].Value.Status != DeliveryPending {
+			return docs[0]
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatal("timed out waiting for the delivery")
+	return store.Document[Delivery]{}
+}
+
+func TestPublish(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDispatcher(t, Config{AllowPrivateNetworks: true})
+
+	rcv := newReceiver(t, "secret")
+	sub := subscribe(t, d, rcv, "secret", "item.created")
+	other := newReceiver(t, "other")
+	subscribe(t, d, other, "other", "item.deleted")
+
+	err := d.Publish(ctx, "item.created", map[string]string{"name": "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-rcv.deliveries:
+		if event.Type != "item.created" || string(event.Data) != `{"name":"Widget"}` || event.ID == "" {
+			t.Errorf("unexpected event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the delivery")
+	}
+
+	delivery := waitForDelivery(t, d, sub)
+	if delivery.Value.Status != DeliverySucceeded || delivery.Value.Attempts != 1 || delivery.Value.ResponseStatus != http.StatusOK {
+		t.Errorf("unexpected delivery: %+v", delivery.Value)
+	}
+	if n := other.requests.Load(); n != 0 {
+		t.Errorf("a subscriber to other events received %d deliveries", n)
+	}
+}
+
+func TestPublishRetries(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDispatcher(t, Config{MaxAttempts: 5, AllowPrivateNetworks: true})
+
+	rcv := newReceiver(t, "secret")
+	rcv.fail.Store(2)
+	sub := subscribe(t, d, rcv, "secret", "item.updated")
+
+	err := d.Publish(ctx, "item.updated", map[string]string{"name": "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	delivery := waitForDelivery(t, d, sub)
+	if delivery.Value.Status != DeliverySucceeded || delivery.Value.Attempts != 3 || delivery.Value.Error != "" {
+		t.Errorf("unexpected delivery: %+v", delivery.Value)
+	}
+}
+
+func TestPublishPrivateAddress(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDispatcher(t, Config{MaxAttempts: 5})
+
+	rcv := newReceiver(t, "secret")
+	sub := subscribe(t, d, rcv, "secret", "item.created")
+
+	err := d.Publish(ctx, "item.created", map[string]string{"name": "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deliveries to loopback fail without being retried
+	delivery := waitForDelivery(t, d, sub)
+	if delivery.Value.Status != DeliveryFailed || delivery.Value.Attempts != 1 || !strings.Contains(delivery.Value.Error, errPrivateAddress.Error()) {
+		t.Errorf("unexpected delivery: %+v", delivery.Value)
+	}
+	if n := rcv.requests.Load(); n != 0 {
+		t.Errorf("a loopback endpoint received %d deliveries", n)
+	}
+}
+
+func TestDialPublic(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.215.14:443":           true,
+		"[2606:2800:21f:cb07::1]:443": true,
+		"127.0.0.1:80":                false,
+		"[::1]:80":                    false,
+		"10.1.2.3:80":                 false,
+		"172.16.0.1:80":               false,
+		"192.168.1.1:80":              false,
+		"169.254.169.254:80":          false,
+		"[fe80::1]:80":                false,
+		"[fd00::1]:80":                false,
+		"[::ffff:127.0.0.1]:80":       false,
+		"100.64.0.1:80":               false,
+		"0.0.0.0:80":                  false,
+	}
+	for address, allowed := range tests {
+		err := dialPublic("tcp", address, nil)
+		if (err == nil) != allowed {
+			t.Errorf("unexpected result dialing %s: %v", address, err)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDispatcher(t, Config{MaxAttempts: 6, BreakerThreshold: 2, BreakerCooldown: time.Hour, AllowPrivateNetworks: true})
+
+	rcv := newReceiver(t, "secret")
+	rcv.fail.Store(-1)
+	sub := subscribe(t, d, rcv, "secret", "item.created")
+
+	err := d.Publish(ctx, "item.created", map[string]string{"name": "Widget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The breaker opens after two failures, so the remaining attempts do not reach the endpoint
+	delivery := waitForDelivery(t, d, sub)
+	if delivery.Value.Status != DeliveryFailed || delivery.Value.Attempts != 2 || delivery.Value.ResponseStatus != http.StatusInternalServerError {
+		t.Errorf("unexpected delivery: %+v", delivery.Value)
+	}
+	if n := rcv.requests.Load(); n != 2 {
+		t.Errorf("unexpected number of requests to a failing endpoint: got %d want 2", n)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	ctx := context.Background()
+	d, _ := newTestDispatcher(t, Config{MaxAttempts: 1, AllowPrivateNetworks: true})
+
+	rcv := newReceiver(t, "secret")
+	rcv.fail.Store(1)
+	sub := subscribe(t, d, rcv, "secret", "item.deleted")
+
+	err := d.Publish(ctx, "item.deleted", map[string]string{"id": "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := waitForDelivery(t, d, sub)
+	if failed.Value.Status != DeliveryFailed {
+		t.Fatalf("unexpected delivery: %+v", failed.Value)
+	}
+
+	redelivery, err := d.Redeliver(ctx, sub.ID, failed.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redelivery.Value.RedeliveryOf != failed.ID || redelivery.Value.EventID != failed.Value.EventID {
+		t.Errorf("unexpected redelivery: %+v", redelivery.Value)
+	}
+
+	select {
+	case event := <-rcv.deliveries:
+		if event.ID != failed.Value.EventID {
+			t.Errorf("unexpected redelivered event: %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the redelivery")
+	}
+
+	_, err = d.Redeliver(ctx, "other", failed.ID)
+	if !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("unexpected error redelivering another subscription's delivery: got %v want %v", err, store.ErrNotFound)
+	}
+}
+
+func TestDeleteDeliveries(t *testing.T) {
+	ctx := context.Background()
+	d, s := newTestDispatcher(t, Config{AllowPrivateNetworks: true})
+
+	for range 3 {
+		_, err := d.deliveries.Create(ctx, Delivery{Status: DeliverySucceeded})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	deleted, err := DeleteDeliveries(ctx, s, time.Now().Add(-time.Hour))
+	if err != nil || deleted != 0 {
+		t.Errorf("unexpected deletion of recent deliveries: %d, %v", deleted, err)
+	}
+	deleted, err = DeleteDeliveries(ctx, s, time.Now().Add(time.Second))
+	if err != nil || deleted != 3 {
+		t.Errorf("unexpected deletion of old deliveries: got %d, %v want 3", deleted, err)
+	}
+}
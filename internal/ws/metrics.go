@@ -0,0 +1,40 @@
+package ws
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	connections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ws_connections",
+		Help: "Number of open WebSocket connections.",
+	})
+	messagesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ws_messages_sent_total",
+		Help: "Number of messages sent to WebSocket clients.",
+	})
+	messagesReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ws_messages_received_total",
+		Help: "Number of messages received from WebSocket clients.",
+	})
+	evictions = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "ws_evictions_total",
+		Help: "Number of WebSocket clients disconnected for falling behind their messages.",
+	})
+)
+
+// RegisterMetrics registers the WebSocket metrics with the default Prometheus registry. Connections are not
+// measured by the HTTP request metrics, since their duration is how long clients stay connected.
+func RegisterMetrics() error {
+	for _, c := range []prometheus.Collector{connections, messagesSent, messagesReceived, evictions} {
+		err := prometheus.Register(c)
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if err != nil && !errors.As(err, &alreadyRegistered) {
+			return err
+		}
+	}
+
+	return nil
+}
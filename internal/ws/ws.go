@@ -0,0 +1,388 @@
+// Package ws serves WebSocket connections through a Hub. Clients exchange JSON messages with the server:
+// they subscribe to topics to receive the messages published to them, and send messages of other types to
+// the handlers registered on the hub. Each connection has a bounded send buffer, and a client that falls
+// behind is disconnected instead of holding up the others. Pings detect connections that died silently.
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/circa10a/go-rest-template/internal/store"
+	"github.com/coder/websocket"
+)
+
+// Message types handled by every hub.
+const (
+	TypeSubscribe    = "subscribe"
+	TypeUnsubscribe  = "unsubscribe"
+	TypeSubscribed   = "subscribed"
+	TypeUnsubscribed = "unsubscribed"
+	TypeError        = "error"
+)
+
+// Message is a JSON message exchanged with clients.
+type Message struct {
+	// Type selects the handler of a message from a client, or describes a message from the server.
+	Type string `json:"type"`
+	// Topic is the topic of a subscription or of a published message.
+	Topic string `json:"topic,omitempty"`
+	// ID is set by clients to match replies, which carry the ID of the message they answer.
+	ID    string          `json:"id,omitempty"`
+	Error string          `json:"error,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+}
+
+// HandlerFunc handles a message from the client of c. A returned error is sent to the client as an error
+// message, and the connection stays open.
+type HandlerFunc func(ctx context.Context, c *Conn, msg Message) error
+
+// Config holds configuration for a Hub.
+type Config struct {
+	Logger *slog.Logger
+	// CheckOrigin reports whether a cross-origin connection is allowed. Connections from the origin of the
+	// server are always allowed, and cross-origin connections are rejected when it is nil.
+	CheckOrigin func(r *http.Request) bool
+	// Topics are the topics clients may subscribe to.
+	Topics []string
+	// SendBuffer is the number of messages queued for a client before it is disconnected as too slow.
+	// Defaults to 64.
+	SendBuffer int
+	// ReadLimit is the maximum size in bytes of a message from a client. Defaults to 32 KiB.
+	ReadLimit int64
+	// PingInterval is how often clients are pinged. Defaults to 30 seconds.
+	PingInterval time.Duration
+	// PongTimeout is how long a client has to answer a ping before it is disconnected. Defaults to 10 seconds.
+	PongTimeout time.Duration
+	// WriteTimeout is how long a message may take to send. Defaults to 10 seconds.
+	WriteTimeout time.Duration
+}
+
+// Hub tracks the connections of clients and routes messages between them and the server.
+type Hub struct {
+	logger   *slog.Logger
+	conns    map[*Conn]struct{}
+	handlers map[string]HandlerFunc
+	closed   chan struct{}
+	cfg      Config
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	once     sync.Once
+}
+
+// Conn is the connection of a client.
+type Conn struct {
+	ws      *websocket.Conn
+	hub     *Hub
+	send    chan []byte
+	evicted chan struct{}
+	// topics is guarded by the mutex of the hub
+	topics map[string]struct{}
+	// ID identifies the connection in logs.
+	ID        string
+	evictOnce sync.Once
+}
+
+// NewHub returns a hub configured with cfg.
+func NewHub(cfg Config) *Hub {
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	if cfg.SendBuffer <= 0 {
+		cfg.SendBuffer = 64
+	}
+	if cfg.ReadLimit <= 0 {
+		cfg.ReadLimit = 32 << 10
+	}
+	if cfg.PingInterval <= 0 {
+		cfg.PingInterval = 30 * time.Second
+	}
+	if cfg.PongTimeout <= 0 {
+		cfg.PongTimeout = 10 * time.Second
+	}
+	if cfg.WriteTimeout <= 0 {
+		cfg.WriteTimeout = 10 * time.Second
+	}
+
+	h := &Hub{
+		logger:   cfg.Logger.With("component", "ws"),
+		conns:    map[*Conn]struct{}{},
+		handlers: map[string]HandlerFunc{},
+		closed:   make(chan struct{}),
+		cfg:      cfg,
+	}
+	h.handlers[TypeSubscribe] = h.subscribe
+	h.handlers[TypeUnsubscribe] = h.unsubscribe
+
+	return h
+}
+
+// Handle registers fn for the messages of type typ sent by clients. Register handlers before serving.
+func (h *Hub) Handle(typ string, fn HandlerFunc) {
+	h.handlers[typ] = fn
+}
+
+// Publish sends msg to the clients subscribed to topic.
+func (h *Hub) Publish(topic string, msg Message) error {
+	msg.Topic = topic
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for c := range h.conns {
+		if _, ok := c.topics[topic]; ok {
+			c.enqueue(data)
+		}
+	}
+
+	return nil
+}
+
+// ServeHTTP upgrades the request to a WebSocket connection and serves it until either side closes it.
+func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-h.closed:
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	default:
+	}
+
+	// Hijacked connections keep the deadlines set from the read and write timeouts of the server
+	rc := http.NewResponseController(w)
+	err := rc.SetReadDeadline(time.Time{})
+	if err == nil {
+		err = rc.SetWriteDeadline(time.Time{})
+	}
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		h.logger.Warn("clearing connection deadlines", "err", err)
+	}
+
+	opts := &websocket.AcceptOptions{
+		InsecureSkipVerify: h.cfg.CheckOrigin != nil && r.Header.Get("Origin") != "" && h.cfg.CheckOrigin(r),
+	}
+	ws, err := websocket.Accept(w, r, opts)
+	if err != nil {
+		h.logger.Debug("rejected connection", "err", err)
+		return
+	}
+	ws.SetReadLimit(h.cfg.ReadLimit)
+
+	c := &Conn{
+		ws:      ws,
+		hub:     h,
+		send:    make(chan []byte, h.cfg.SendBuffer),
+		evicted: make(chan struct{}),
+		topics:  map[string]struct{}{},
+		ID:      store.NewID(),
+	}
+	if !h.register(c) {
+		_ = ws.Close(websocket.StatusGoingAway, "server shutting down")
+		return
+	}
+	defer h.unregister(c)
+
+	connections.Inc()
+	defer connections.Dec()
+
+	// Requests are not cancelled when their connection is hijacked, so the connection has its own context
+	ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+	defer cancel()
+
+	var writer sync.WaitGroup
+	writer.Go(func() {
+		defer cancel()
+		c.write(ctx)
+	})
+
+	c.read(ctx)
+	cancel()
+	writer.Wait()
+	_ = ws.CloseNow()
+}
+
+// Close disconnects every client with a going away status, which tells them to reconnect, and waits until
+// their connections are closed or ctx is done.
+func (h *Hub) Close(ctx context.Context) error {
+	h.mu.Lock()
+	h.once.Do(func() { close(h.closed) })
+	h.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		h.mu.Lock()
+		for c := range h.conns {
+			_ = c.ws.CloseNow()
+		}
+		h.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Send queues msg for the client of c. A client whose send buffer is full is disconnected.
+func (c *Conn) Send(msg Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	c.enqueue(data)
+	return nil
+}
+
+// Topics returns the topics c is subscribed to.
+func (c *Conn) Topics() []string {
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+
+	return slices.Sorted(maps.Keys(c.topics))
+}
+
+// register adds c to the hub unless it is closed. The hub waits for registered connections when closing.
+func (h *Hub) register(c *Conn) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	select {
+	case <-h.closed:
+		return false
+	default:
+	}
+
+	h.conns[c] = struct{}{}
+	h.wg.Add(1)
+	return true
+}
+
+// unregister removes c from the hub.
+func (h *Hub) unregister(c *Conn) {
+	h.mu.Lock()
+	delete(h.conns, c)
+	h.mu.Unlock()
+
+	h.wg.Done()
+}
+
+// subscribe subscribes c to the topic of msg.
+func (h *Hub) subscribe(ctx context.Context, c *Conn, msg Message) error {
+	if !slices.Contains(h.cfg.Topics, msg.Topic) {
+		return errors.New("unknown topic " + msg.Topic)
+	}
+
+	h.mu.Lock()
+	c.topics[msg.Topic] = struct{}{}
+	h.mu.Unlock()
+
+	return c.Send(Message{Type: TypeSubscribed, Topic: msg.Topic, ID: msg.ID})
+}
+
+// unsubscribe unsubscribes c from the topic of msg.
+func (h *Hub) unsubscribe(ctx context.Context, c *Conn, msg Message) error {
+	h.mu.Lock()
+	delete(c.topics, msg.Topic)
+	h.mu.Unlock()
+
+	return c.Send(Message{Type: TypeUnsubscribed, Topic: msg.Topic, ID: msg.ID})
+}
+
+// enqueue queues data for sending, or evicts c if its send buffer is full. The caller holds the mutex of the hub.
+func (c *Conn) enqueue(data []byte) {
+	select {
+	case c.send <- data:
+	default:
+		c.evictOnce.Do(func() {
+			close(c.evicted)
+			evictions.Inc()
+		})
+	}
+}
+
+// read dispatches the messages from the client to their handlers until the connection is closed.
+func (c *Conn) read(ctx context.Context) {
+	for {
+		typ, data, err := c.ws.Read(ctx)
+		if err != nil {
+			status := websocket.CloseStatus(err)
+			if status == -1 && ctx.Err() == nil {
+				c.hub.logger.Debug("reading message", "conn", c.ID, "err", err)
+			}
+			return
+		}
+		messagesReceived.Inc()
+
+		var msg Message
+		if typ != websocket.MessageText {
+			err = errors.New("messages must be JSON text")
+		} else {
+			err = json.Unmarshal(data, &msg)
+		}
+		if err == nil {
+			handler, ok := c.hub.handlers[msg.Type]
+			if !ok {
+				err = errors.New("unknown message type " + msg.Type)
+			} else {
+				err = handler(ctx, c, msg)
+			}
+		}
+		if err != nil {
+			_ = c.Send(Message{Type: TypeError, ID: msg.ID, Error: err.Error()})
+		}
+	}
+}
+
+// write sends queued messages and pings to the client until ctx is done, the client is evicted or the hub
+// is closed.
+func (c *Conn) write(ctx context.Context) {
+	ping := time.NewTicker(c.hub.cfg.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.hub.closed:
+			_ = c.ws.Close(websocket.StatusGoingAway, "server shutting down")
+			return
+		case <-c.evicted:
+			_ = c.ws.Close(websocket.StatusPolicyViolation, "too slow to receive messages")
+			return
+		case data := <-c.send:
+			writeCtx, cancel := context.WithTimeout(ctx, c.hub.cfg.WriteTimeout)
+			err := c.ws.Write(writeCtx, websocket.MessageText, data)
+			cancel()
+			if err != nil {
+				return
+			}
+			messagesSent.Inc()
+		case <-ping.C:
+			pingCtx, cancel := context.WithTimeout(ctx, c.hub.cfg.PongTimeout)
+			err := c.ws.Ping(pingCtx)
+			cancel()
+			if err != nil {
+				c.hub.logger.Debug("client did not answer ping", "conn", c.ID, "err", err)
+				return
+			}
+		}
+	}
+}
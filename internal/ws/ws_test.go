@@ -0,0 +1,204 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+)
+
+func newTestHub(t *testing.T, cfg Config) (*Hub, *httptest.Server) {
+	t.Helper()
+
+	cfg.Logger = slog.New(slog.DiscardHandler)
+	cfg.Topics = []string{"items"}
+	h := NewHub(cfg)
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	t.Cleanup(func() { _ = h.Close(context.Background()) })
+
+	return h, ts
+}
+
+// dial connects a client to ts.
+func dial(t *testing.T, ts *httptest.Server) *websocket.Conn {
+	t.Helper()
+
+	conn, _, err := websocket.Dial(context.Background(), strings.Replace(ts.URL, "http", "ws", 1), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.CloseNow() })
+
+	return conn
+}
+
+// exchange sends msg and returns the reply.
+func exchange(t *testing.T, conn *websocket.Conn, msg Message) Message {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := wsjson.Write(ctx, conn, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var reply Message
+	err = wsjson.Read(ctx, conn, &reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return reply
+}
+
+func TestHub(t *testing.T) {
+	h, ts := newTestHub(t, Config{})
+	h.Handle("echo", func(ctx context.Context, c *Conn, msg Message) error {
+		if len(msg.Data) == 0 {
+			return errors.New("nothing to echo")
+		}
+		return c.Send(Message{Type: "echo", ID: msg.ID, Data: msg.Data})
+	})
+
+	conn := dial(t, ts)
+
+	tests := []struct {
+		name   string
+		send   Message
+		expect Message
+	}{
+		{name: "subscribe", send: Message{Type: TypeSubscribe, Topic: "items", ID: "1"}, expect: Message{Type: TypeSubscribed, Topic: "items", ID: "1"}},
+		{name: "unknown topic", send: Message{Type: TypeSubscribe, Topic: "orders", ID: "2"}, expect: Message{Type: TypeError, ID: "2", Error: "unknown topic orders"}},
+		{name: "unknown type", send: Message{Type: "publish", ID: "3"}, expect: Message{Type: TypeError, ID: "3", Error: "unknown message type publish"}},
+		{name: "handler", send: Message{Type: "echo", ID: "4", Data: json.RawMessage(`{"a":1}`)}, expect: Message{Type: "echo", ID: "4", Data: json.RawMessage(`{"a":1}`)}},
+		{name: "handler error", send: Message{Type: "echo", ID: "5"}, expect: Message{Type: TypeError, ID: "5", Error: "nothing to echo"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reply := exchange(t, conn, test.send)
+			if reply.Type != test.expect.Type || reply.Topic != test.expect.Topic || reply.ID != test.expect.ID ||
+				reply.Error != test.expect.Error || string(reply.Data) != string(test.expect.Data) {
+				t.Errorf("unexpected reply: got %+v want %+v", reply, test.expect)
+			}
+		})
+	}
+
+	err := h.Publish("items", Message{Type: "item.created", Data: json.RawMessage(`{"name":"Widget"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var published Message
+	err = wsjson.Read(ctx, conn, &published)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if published.Type != "item.created" || published.Topic != "items" || string(published.Data) != `{"name":"Widget"}` {
+		t.Errorf("unexpected message: %+v", published)
+	}
+
+	reply := exchange(t, conn, Message{Type: TypeUnsubscribe, Topic: "items"})
+	if reply.Type != TypeUnsubscribed {
+		t.Errorf("unexpected reply: %+v", reply)
+	}
+}
+
+func TestHubSlowClient(t *testing.T) {
+	h, ts := newTestHub(t, Config{SendBuffer: 1})
+	conn := dial(t, ts)
+	exchange(t, conn, Message{Type: TypeSubscribe, Topic: "items"})
+
+	// The client does not read, so its send buffer fills and it is disconnected
+	data := json.RawMessage(`"` + strings.Repeat("padding", 1000) + `"`)
+	for range 1000 {
+		err := h.Publish("items", Message{Type: "item.created", Data: data})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for {
+		_, _, err := conn.Read(ctx)
+		if err != nil {
+			if status := websocket.CloseStatus(err); status != websocket.StatusPolicyViolation {
+				t.Errorf("unexpected close status: got %v want %v (%v)", status, websocket.StatusPolicyViolation, err)
+			}
+			break
+		}
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h, ts := newTestHub(t, Config{})
+	conn := dial(t, ts)
+	exchange(t, conn, Message{Type: TypeSubscribe, Topic: "items"})
+
+	closed := make(chan error, 1)
+	go func() {
+		_, _, err := conn.Read(context.Background())
+		closed <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := h.Close(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := websocket.CloseStatus(<-closed); status != websocket.StatusGoingAway {
+		t.Errorf("unexpected close status: got %v want %v", status, websocket.StatusGoingAway)
+	}
+
+	// Connections are refused once the hub is closed
+	_, resp, err := websocket.Dial(ctx, strings.Replace(ts.URL, "http", "ws", 1), nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("unexpected response connecting to a closed hub: %v, %v", resp, err)
+	}
+}
+
+func TestHubOrigin(t *testing.T) {
+	_, ts := newTestHub(t, Config{CheckOrigin: func(r *http.Request) bool {
+		return r.Header.Get("Origin") == "https://app.example.com"
+	}})
+
+	tests := []struct {
+		name   string
+		origin string
+		status int
+	}{
+		{name: "allowed", origin: "https://app.example.com", status: http.StatusSwitchingProtocols},
+		{name: "same origin", origin: ts.URL, status: http.StatusSwitchingProtocols},
+		{name: "rejected", origin: "https://evil.example.com", status: http.StatusForbidden},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, resp, err := websocket.Dial(context.Background(), strings.Replace(ts.URL, "http", "ws", 1), &websocket.DialOptions{
+				HTTPHeader: http.Header{"Origin": {test.origin}},
+			})
+			if err == nil {
+				_ = conn.CloseNow()
+			}
+			if resp == nil || resp.StatusCode != test.status {
+				t.Errorf("unexpected response: %v, %v", resp, err)
+			}
+		})
+	}
+}